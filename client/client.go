@@ -0,0 +1,521 @@
+// Package client is a Go client for the whiteboard WebSocket protocol.
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// handshakeTimeout: max time to receive authenticated, room_joined, and sync
+const handshakeTimeout = 10 * time.Second
+
+// Binary frame support, mirrors the server's subprotocol and frame types
+const (
+	protocolBinary      = "whiteboard.binary"
+	binaryCursor   byte = 0x01
+)
+
+// Close codes after which the client doesn't reconnect
+const (
+	closeSuperseded = 4005 // replaced by another connection of the session
+	closeRoomClosed = 4007 // an operator closed the room
+	closeKicked     = 4008 // a moderator removed the user from the room
+)
+
+// ErrWrongPassword: the room is protected and the password was missing or wrong
+var ErrWrongPassword = errors.New("wrong room password")
+
+// JoinRejectedError: the server refused the join (join_rejected), Reason is
+// room_full, server_full, auth_failed, too_many_rooms, unknown_room,
+// invalid_room_code, room_closed or banned
+type JoinRejectedError struct {
+	Reason string
+}
+
+func (e *JoinRejectedError) Error() string {
+	return "join rejected: " + e.Reason
+}
+
+// Client: connection to a single room, reconnects (reusing its token) until closed
+type Client struct {
+	serverURL string
+	roomCode  string
+	origin    string
+	password  string
+	locale    string
+	filters   map[string]interface{} // authenticate subscriptions
+	resume    bool
+	binary    bool // negotiate binary frames (compact cursors)
+	spectator bool // join view only
+	compress  bool // offer permessage-deflate
+
+	mu       sync.RWMutex
+	conn     *websocket.Conn
+	token    string
+	userID   string
+	color    string
+	initial  Event  // last sync received
+	epoch    string // room instance and latest revision seen, for resuming
+	revision uint64
+	delta    *Event // syncDelta received by the last reconnect, not dispatched yet
+	handlers []func(Event)
+
+	writeMu sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// Option: configures Connect
+type Option func(*Client)
+
+// WithOrigin: Origin header sent on connect (must be in the server's DOMAINS)
+func WithOrigin(origin string) Option {
+	return func(c *Client) {
+		c.origin = origin
+	}
+}
+
+// WithPassword: room password, sets it when creating the room and is required
+// to join a protected one (Connect fails with ErrWrongPassword otherwise)
+func WithPassword(password string) Option {
+	return func(c *Client) {
+		c.password = password
+	}
+}
+
+// WithLocale: locale for system texts (error messages, notices), e.g. "es"
+// Unsupported locales fall back to the room's default, then English
+func WithLocale(locale string) Option {
+	return func(c *Client) {
+		c.locale = locale
+	}
+}
+
+// Subscriptions: broadcasts the client doesn't want (the initial sync is never filtered)
+type Subscriptions struct {
+	NoCursors   bool   // no cursor events
+	ObjectsOnly bool   // only drawing changes
+	PageID      string // only events for this page (and those not tied to a page)
+}
+
+// WithSubscriptions: filters broadcasts server-side, e.g. for read-only dashboards
+func WithSubscriptions(s Subscriptions) Option {
+	return func(c *Client) {
+		c.filters = map[string]interface{}{"cursors": !s.NoCursors, "objectsOnly": s.ObjectsOnly}
+		if s.PageID != "" {
+			c.filters["pageId"] = s.PageID
+		}
+	}
+}
+
+// WithResume: reconnects ask for only what changed since the last revision seen,
+// delivered as a "syncDelta" event (Objects to upsert, Deleted, Pages) right
+// after EventReconnected. The server may still answer with a full sync, in which
+// case InitialState has the new board. Only for clients that keep their own
+// board up to date from events
+func WithResume() Option {
+	return func(c *Client) {
+		c.resume = true
+	}
+}
+
+// WithBinaryCursors: negotiates the binary subprotocol and sends cursor moves as
+// compact 9 byte frames. Servers without it keep the connection on JSON
+func WithBinaryCursors() Option {
+	return func(c *Client) {
+		c.binary = true
+	}
+}
+
+// WithCompression: offers permessage-deflate, servers with compression enabled
+// then send large messages (syncs, long strokes) compressed
+func WithCompression() Option {
+	return func(c *Client) {
+		c.compress = true
+	}
+}
+
+// WithSpectator: joins view only, the client receives the board and every
+// broadcast but the server rejects its edits and cursor moves. Spectators have
+// their own room limit. Editing means connecting again without it
+func WithSpectator() Option {
+	return func(c *Client) {
+		c.spectator = true
+	}
+}
+
+// Connect: dials the server, authenticates (token may be empty), and joins the room
+// serverURL is the WebSocket endpoint, e.g. ws://localhost:8080/ws
+func Connect(ctx context.Context, serverURL string, roomCode string, token string, opts ...Option) (*Client, error) {
+	c := &Client{
+		serverURL: serverURL,
+		roomCode:  roomCode,
+		token:     token,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if err := c.connect(ctx); err != nil {
+		return nil, err
+	}
+
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	go c.readLoop()
+	return c, nil
+}
+
+// connect: dials and performs the authenticate → room_joined → sync handshake
+func (c *Client) connect(ctx context.Context) error {
+	u, err := url.Parse(c.serverURL)
+	if err != nil {
+		return fmt.Errorf("parse server url: %w", err)
+	}
+	query := u.Query()
+	query.Set("room", c.roomCode)
+	if c.password != "" {
+		query.Set("password", c.password)
+	}
+	u.RawQuery = query.Encode()
+
+	header := http.Header{}
+	if c.origin != "" {
+		header.Set("Origin", c.origin)
+	}
+
+	dialer := *websocket.DefaultDialer
+	if c.binary {
+		dialer.Subprotocols = []string{protocolBinary}
+	}
+	dialer.EnableCompression = c.compress
+	conn, _, err := dialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		return fmt.Errorf("dial: %w", err)
+	}
+
+	c.mu.RLock()
+	token, epoch, revision := c.token, c.epoch, c.revision
+	c.mu.RUnlock()
+
+	auth := map[string]interface{}{"type": "authenticate", "token": token}
+	if c.resume && epoch != "" {
+		auth["epoch"] = epoch
+		auth["lastRevision"] = revision
+	}
+	if c.locale != "" {
+		auth["locale"] = c.locale
+	}
+	if c.filters != nil {
+		auth["subscriptions"] = c.filters
+	}
+	if c.spectator {
+		auth["mode"] = "spectator"
+	}
+	if err := conn.WriteJSON(auth); err != nil {
+		conn.Close()
+		return fmt.Errorf("send authenticate: %w", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	var authenticated, joined, synced wireMessage
+	for _, step := range []struct {
+		msg      *wireMessage
+		expected string
+	}{
+		{&authenticated, "authenticated"},
+		{&joined, "room_joined"},
+		{&synced, "sync"},
+	} {
+		if err := conn.ReadJSON(step.msg); err != nil {
+			conn.Close()
+			return fmt.Errorf("waiting for %s: %w", step.expected, err)
+		}
+		// Full room with a join queue: wait (the server times the queue out)
+		for step.msg.Type == "queued" {
+			conn.SetReadDeadline(time.Time{})
+			if err := conn.ReadJSON(step.msg); err != nil {
+				conn.Close()
+				return fmt.Errorf("waiting in join queue: %w", err)
+			}
+			conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+		}
+		if step.msg.Type == "error" && step.msg.Code == "wrong_password" {
+			conn.Close()
+			return ErrWrongPassword
+		}
+		// A full room's error message is followed by join_rejected
+		if step.msg.Type == "error" && step.msg.Code == "room_full" {
+			if err := conn.ReadJSON(step.msg); err != nil {
+				conn.Close()
+				return fmt.Errorf("waiting for %s: %w", step.expected, err)
+			}
+		}
+		if step.msg.Type == "join_rejected" {
+			conn.Close()
+			return &JoinRejectedError{Reason: step.msg.Reason}
+		}
+		if step.msg.Type == "syncDelta" && step.expected == "sync" {
+			continue
+		}
+		if step.msg.Type != step.expected {
+			conn.Close()
+			return fmt.Errorf("expected %s, got %s", step.expected, step.msg.Type)
+		}
+	}
+
+	// Large rooms send their objects in syncChunk messages after an empty sync
+	for i := 0; i < synced.Chunks; i++ {
+		var chunk wireMessage
+		if err := conn.ReadJSON(&chunk); err != nil {
+			conn.Close()
+			return fmt.Errorf("waiting for syncChunk: %w", err)
+		}
+		if chunk.Type != "syncChunk" {
+			conn.Close()
+			return fmt.Errorf("expected syncChunk, got %s", chunk.Type)
+		}
+		synced.Objects = append(synced.Objects, chunk.Objects...)
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	c.mu.Lock()
+	c.conn = conn
+	c.token = authenticated.Token
+	c.userID = authenticated.UserID
+	c.color = joined.Color
+	c.epoch, c.revision = synced.Epoch, synced.Revision
+	if synced.Type == "syncDelta" {
+		delta := synced.toEvent(nil)
+		c.delta = &delta
+	} else {
+		c.initial = synced.toEvent(nil)
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+// readLoop: dispatches incoming messages, reconnecting with backoff on failure
+// (but not after being signed out by another connection of the session, the
+// room being closed, or being kicked)
+func (c *Client) readLoop() {
+	backoff := time.Second
+	for {
+		c.mu.RLock()
+		conn := c.conn
+		c.mu.RUnlock()
+
+		signedOut := false
+		cursors := make(map[string]TrailPoint) // last position per user, for cursor trails
+		for {
+			_, raw, err := conn.ReadMessage()
+			if err != nil {
+				signedOut = signedOut || websocket.IsCloseError(err, closeSuperseded, closeRoomClosed, closeKicked)
+				break
+			}
+			var msg wireMessage
+			if err := json.Unmarshal(raw, &msg); err != nil {
+				continue
+			}
+			// Same token joined this room from elsewhere, reconnecting would sign that one out
+			if msg.Type == "error" && msg.Code == "signed_in_elsewhere" {
+				signedOut = true
+			}
+			if msg.Revision > 0 {
+				c.seenRevision(msg.Revision)
+			}
+			if msg.Type == "cursors" {
+				for _, e := range msg.cursorEvents(raw, c.UserID(), cursors) {
+					c.dispatch(e)
+				}
+				continue
+			}
+			c.dispatch(msg.toEvent(raw))
+		}
+		conn.Close()
+		if signedOut {
+			return
+		}
+
+		// Reconnect until closed, reusing the token so the server resumes the session
+		for {
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+
+			if err := c.connect(c.ctx); err == nil {
+				backoff = time.Second
+				c.dispatch(Event{Type: EventReconnected})
+				if delta := c.takeDelta(); delta != nil {
+					c.dispatch(*delta)
+				}
+				break
+			}
+			if backoff < 30*time.Second {
+				backoff *= 2
+			}
+		}
+	}
+}
+
+// seenRevision: records the latest board revision received
+func (c *Client) seenRevision(revision uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if revision > c.revision {
+		c.revision = revision
+	}
+}
+
+// takeDelta: the syncDelta of the last reconnect, once
+func (c *Client) takeDelta() *Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delta := c.delta
+	c.delta = nil
+	return delta
+}
+
+// OnBroadcast: registers a callback for every event received after joining
+// Callbacks run on the read goroutine and should not block
+func (c *Client) OnBroadcast(handler func(Event)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.handlers = append(c.handlers, handler)
+}
+
+func (c *Client) dispatch(e Event) {
+	c.mu.RLock()
+	handlers := c.handlers
+	c.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(e)
+	}
+}
+
+// UserID: ID assigned by the server
+func (c *Client) UserID() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.userID
+}
+
+// Token: session token, pass to Connect to resume the session later
+func (c *Client) Token() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.token
+}
+
+// Color: the user's color in this room
+func (c *Client) Color() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.color
+}
+
+// InitialState: room state (objects, pages) from the most recent join
+func (c *Client) InitialState() Event {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.initial
+}
+
+// AddObject: adds an object (leave ZIndex nil to have the server assign one)
+func (c *Client) AddObject(obj Object) error {
+	return c.send(map[string]interface{}{"type": "objectAdded", "object": obj})
+}
+
+// UpdateObject: replaces an object's data
+func (c *Client) UpdateObject(id string, data map[string]interface{}) error {
+	return c.send(map[string]interface{}{
+		"type":   "objectUpdated",
+		"object": map[string]interface{}{"id": id, "data": data},
+	})
+}
+
+// PatchObject: sets only the given top-level fields of an object's data, the
+// rest is kept (and patches of other fields by others aren't overwritten)
+func (c *Client) PatchObject(id string, fields map[string]interface{}) error {
+	return c.send(map[string]interface{}{
+		"type":   "objectUpdated",
+		"object": map[string]interface{}{"id": id, "data": fields, "partial": true},
+	})
+}
+
+// ReorderObject: moves an object in the stacking order, command is "front",
+// "back", "forward" or "backward". The resolved zIndex comes back as objectReordered
+func (c *Client) ReorderObject(id string, command string) error {
+	return c.send(map[string]interface{}{"type": "objectReordered", "objectId": id, "command": command})
+}
+
+// SetZIndex: moves an object to zIndex in the stacking order
+func (c *Client) SetZIndex(id string, zIndex int) error {
+	return c.send(map[string]interface{}{"type": "objectReordered", "objectId": id, "zIndex": zIndex})
+}
+
+// DeleteObject: deletes an object
+func (c *Client) DeleteObject(id string) error {
+	return c.send(map[string]interface{}{"type": "objectDeleted", "objectId": id})
+}
+
+// SendCursor: moves this user's cursor
+func (c *Client) SendCursor(x, y float64) error {
+	c.mu.RLock()
+	conn := c.conn
+	c.mu.RUnlock()
+
+	if conn.Subprotocol() != protocolBinary {
+		return c.send(map[string]interface{}{"type": "cursor", "x": x, "y": y})
+	}
+
+	// type byte, then float32 x and y (little endian)
+	frame := make([]byte, 9)
+	frame[0] = binaryCursor
+	binary.LittleEndian.PutUint32(frame[1:5], math.Float32bits(float32(x)))
+	binary.LittleEndian.PutUint32(frame[5:9], math.Float32bits(float32(y)))
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return conn.WriteMessage(websocket.BinaryMessage, frame)
+}
+
+// send: writes a JSON message (gorilla/websocket does not allow concurrent writes)
+func (c *Client) send(payload map[string]interface{}) error {
+	c.mu.RLock()
+	conn := c.conn
+	c.mu.RUnlock()
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return conn.WriteJSON(payload)
+}
+
+// Close: closes the connection and stops reconnecting
+func (c *Client) Close() error {
+	c.cancel()
+
+	c.mu.RLock()
+	conn := c.conn
+	c.mu.RUnlock()
+
+	c.writeMu.Lock()
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	c.writeMu.Unlock()
+	return conn.Close()
+}
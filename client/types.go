@@ -0,0 +1,141 @@
+package client
+
+import "encoding/json"
+
+// Object: drawing object as sent over the wire
+type Object struct {
+	ID     string                 `json:"id"`
+	Type   string                 `json:"type"`
+	Data   map[string]interface{} `json:"data"`
+	UserID string                 `json:"userId,omitempty"`
+	ZIndex *int                   `json:"zIndex,omitempty"` // nil lets the server assign one
+	PageID string                 `json:"pageId,omitempty"`
+}
+
+// Page: board tab within a room
+type Page struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Cursor: another user's cursor position
+type Cursor struct {
+	UserID string       `json:"userId"`
+	X      float64      `json:"x"`
+	Y      float64      `json:"y"`
+	Color  string       `json:"color"`
+	PageID string       `json:"pageId"`
+	Trail  []TrailPoint `json:"-"` // positions passed since the previous cursor event, oldest first
+}
+
+// TrailPoint: a position in a cursor trail
+type TrailPoint struct {
+	X, Y float64
+}
+
+// Event: message received from the server after joining
+// Type is the wire message type, only the fields relevant to it are set
+type Event struct {
+	Type     string
+	UserID   string         // user who caused the event
+	Object   *Object        // objectAdded, objectUpdated
+	ObjectID string         // objectDeleted, objectAck, error
+	ZIndex   int            // objectAck, objectReordered
+	ZIndexes map[string]int // objectReordered: every object that moved (objectId → zIndex)
+	Objects  []Object       // sync, syncDelta (changed objects)
+	Deleted  []string       // syncDelta: IDs of objects deleted meanwhile
+	Pages    []Page         // sync, syncDelta
+	Cursor   *Cursor        // cursor (one per entry of a cursors message)
+	Code     string         // error
+	Message  string         // error: text in the client's locale
+	Raw      json.RawMessage
+}
+
+// Event types emitted by the client itself (not on the wire)
+const (
+	EventReconnected = "reconnected"
+)
+
+// wireMessage: union of the fields of incoming messages
+type wireMessage struct {
+	Type     string         `json:"type"`
+	UserID   string         `json:"userId"`
+	Token    string         `json:"token"`
+	Color    string         `json:"color"`
+	Object   *Object        `json:"object"`
+	ObjectID string         `json:"objectId"`
+	ZIndex   int            `json:"zIndex"`
+	ZIndexes map[string]int `json:"zIndexes"` // objectReordered
+	Objects  []Object       `json:"objects"`
+	Pages    []Page         `json:"pages"`
+	Code     string         `json:"code"`
+	Message  string         `json:"message"`
+	Chunks   int            `json:"chunks"`   // sync: number of syncChunk messages that follow
+	Reason   string         `json:"reason"`   // join_rejected
+	PageID   string         `json:"pageId"`   // cursors
+	Epoch    string         `json:"epoch"`    // sync, syncDelta
+	Revision uint64         `json:"revision"` // sync, syncDelta and board changes
+	Deleted  []string       `json:"deleted"`  // syncDelta
+	Cursors  []wireCursor   `json:"cursors"`  // cursors: batched positions of one page
+}
+
+// wireCursor: an entry of a cursors message
+type wireCursor struct {
+	UserID string   `json:"userId"`
+	X      float64  `json:"x"`
+	Y      float64  `json:"y"`
+	Color  string   `json:"color"`
+	Trail  [][2]int `json:"trail"` // deltas, see cursorTrail
+}
+
+// toEvent: converts a decoded wire message to an Event
+func (m *wireMessage) toEvent(raw []byte) Event {
+	e := Event{
+		Type:     m.Type,
+		UserID:   m.UserID,
+		Object:   m.Object,
+		ObjectID: m.ObjectID,
+		ZIndex:   m.ZIndex,
+		ZIndexes: m.ZIndexes,
+		Objects:  m.Objects,
+		Pages:    m.Pages,
+		Deleted:  m.Deleted,
+		Code:     m.Code,
+		Message:  m.Message,
+		Raw:      raw,
+	}
+	return e
+}
+
+// cursorEvents: a cursors message as one cursor event per entry, leaving out
+// self's own cursor. Trails are resolved against (and recorded in) last
+func (m *wireMessage) cursorEvents(raw []byte, self string, last map[string]TrailPoint) []Event {
+	events := make([]Event, 0, len(m.Cursors))
+	for _, entry := range m.Cursors {
+		if entry.UserID == self {
+			continue
+		}
+		cursor := &Cursor{UserID: entry.UserID, X: entry.X, Y: entry.Y, Color: entry.Color, PageID: m.PageID}
+		cursor.Trail = cursorTrail(last, cursor, entry.Trail)
+		events = append(events, Event{Type: "cursor", UserID: entry.UserID, Cursor: cursor, Raw: raw})
+	}
+	return events
+}
+
+// cursorTrail: the absolute positions of a cursor entry's trail, each delta is
+// from the point before it, the first from the user's previous cursor position
+// (none known yet: no trail). Records the event's position in last
+func cursorTrail(last map[string]TrailPoint, cursor *Cursor, trail [][2]int) []TrailPoint {
+	prev, known := last[cursor.UserID]
+	last[cursor.UserID] = TrailPoint{X: cursor.X, Y: cursor.Y}
+	if !known || len(trail) == 0 {
+		return nil
+	}
+
+	points := make([]TrailPoint, 0, len(trail))
+	for _, delta := range trail {
+		prev = TrailPoint{X: prev.X + float64(delta[0]), Y: prev.Y + float64(delta[1])}
+		points = append(points, prev)
+	}
+	return points
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCursorEventsDecodeTrails(t *testing.T) {
+	last := make(map[string]TrailPoint)
+	decode := func(raw string) []Event {
+		t.Helper()
+		var msg wireMessage
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg.cursorEvents([]byte(raw), "me", last)
+	}
+
+	// no previous position yet: the trail can't be placed
+	first := decode(`{"type":"cursors","pageId":"p1","cursors":[
+		{"userId":"bob","x":10,"y":10,"trail":[[1,1]]},
+		{"userId":"me","x":0,"y":0}]}`)
+	if len(first) != 1 || first[0].Cursor.Trail != nil || first[0].Cursor.PageID != "p1" {
+		t.Fatalf("first events = %+v, want bob's cursor without a trail", first)
+	}
+
+	second := decode(`{"type":"cursors","pageId":"p1","cursors":[
+		{"userId":"bob","x":40,"y":20,"trail":[[10,0],[10,6]]}]}`)
+	want := []TrailPoint{{X: 20, Y: 10}, {X: 30, Y: 16}}
+	if got := second[0].Cursor.Trail; !reflect.DeepEqual(got, want) {
+		t.Errorf("trail = %v, want %v", got, want)
+	}
+
+	// v1 style entry, position only
+	third := decode(`{"type":"cursors","cursors":[{"userId":"bob","x":41,"y":20}]}`)
+	if c := third[0].Cursor; c.X != 41 || c.Trail != nil {
+		t.Errorf("cursor = %+v, want the position without a trail", c)
+	}
+}
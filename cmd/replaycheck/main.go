@@ -0,0 +1,311 @@
+// replaycheck replays recorded sessions through the real router, handlers and
+// room code and checks the board state after every operation, catching changes
+// in how operations are applied.
+//
+//	go run ./cmd/replaycheck cmd/replaycheck/testdata/*.ndjson
+//	go run ./cmd/replaycheck -update cmd/replaycheck/testdata/new.ndjson
+//
+// A recording is NDJSON, one operation per line:
+//
+//	{"at": 120, "user": "alice", "message": {"type": "objectAdded", ...}, "state": "<sha256>"}
+//
+// at is milliseconds since the start (only used with -speed), users join the
+// room on their first operation (the first one is host), and state is the
+// board hash expected after the operation ("" skips the check). "$page:N" in a
+// message is replaced by the ID of the room's Nth page (0-based), since page
+// IDs are random. -update rewrites the recording with the hashes it produced.
+//
+// Rooms here use the real clock (see room.Manager.SetClock), so timer ticks
+// and provisional expiry run on wall time and recordings shouldn't depend on
+// them. Rate limits are lifted.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"main/internal/handlers"
+	"main/internal/middleware"
+	"main/internal/object"
+	"main/internal/room"
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+)
+
+const roomCode = "replay"
+
+// operation: one line of a recording
+type operation struct {
+	At      int64           `json:"at"`
+	User    string          `json:"user"`
+	Message json.RawMessage `json:"message"`
+	State   string          `json:"state"`
+}
+
+var pageRef = regexp.MustCompile(`"\$page:(\d+)"`)
+
+func main() {
+	update := flag.Bool("update", false, "rewrite recordings with the state hashes produced")
+	speed := flag.Float64("speed", 0, "replay speed relative to the recording (0 = no waiting)")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		log.Fatal("usage: replaycheck [-update] [-speed N] recording.ndjson...")
+	}
+
+	failed := false
+	for _, path := range flag.Args() {
+		if err := check(path, *update, *speed); err != nil {
+			fmt.Printf("FAIL %s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("ok   %s\n", path)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// check: replays one recording, returns the first divergence
+func check(path string, update bool, speed float64) error {
+	ops, err := load(path)
+	if err != nil {
+		return err
+	}
+
+	srv := newServer()
+	defer srv.close()
+
+	var elapsed int64
+	for i, op := range ops {
+		if speed > 0 && op.At > elapsed {
+			time.Sleep(time.Duration(float64(op.At-elapsed)/speed) * time.Millisecond)
+			elapsed = op.At
+		}
+
+		u, err := srv.user(op.User)
+		if err != nil {
+			return fmt.Errorf("line %d: join %s: %w", i+1, op.User, err)
+		}
+		msg := srv.resolvePages(op.Message)
+		if err := srv.router.Route(context.Background(), srv.room, u, msg); err != nil {
+			// Rejections are part of the recorded behaviour, the hash covers their effect
+			log.Printf("line %d: %s: %v", i+1, op.User, err)
+		}
+
+		state, err := stateHash(srv.room)
+		if err != nil {
+			return err
+		}
+		if update {
+			ops[i].State = state
+			continue
+		}
+		if op.State != "" && op.State != state {
+			return fmt.Errorf("line %d (%s: %s) diverged: expected state %s, got %s", i+1, op.User, messageType(op.Message), op.State[:12], state[:12])
+		}
+	}
+
+	if update {
+		return save(path, ops)
+	}
+	return nil
+}
+
+func load(path string) ([]operation, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var ops []operation
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var op operation
+		if err := json.Unmarshal(scanner.Bytes(), &op); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if op.User == "" || len(op.Message) == 0 {
+			return nil, fmt.Errorf("line %d: user and message are required", line)
+		}
+		ops = append(ops, op)
+	}
+	return ops, scanner.Err()
+}
+
+func save(path string, ops []operation) error {
+	var buf bytes.Buffer
+	for _, op := range ops {
+		line, err := json.Marshal(op)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+func messageType(msg json.RawMessage) string {
+	var base struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(msg, &base)
+	return base.Type
+}
+
+// stateHash: hash of the board as clients see it, without timestamps or page
+// IDs (pages are referred to by position)
+func stateHash(rm *room.Room) (string, error) {
+	board := rm.Export()
+
+	pages := make([]string, len(board.Pages))
+	position := make(map[string]int, len(board.Pages))
+	for i, page := range board.Pages {
+		pages[i] = page.Name
+		position[page.ID] = i
+	}
+
+	type objectState struct {
+		ID     string                 `json:"id"`
+		Type   string                 `json:"type"`
+		Data   map[string]interface{} `json:"data"`
+		UserID string                 `json:"userId"`
+		ZIndex int                    `json:"zIndex"`
+		Page   int                    `json:"page"`
+	}
+	objects := make([]objectState, len(board.Objects))
+	for i, obj := range board.Objects {
+		objects[i] = objectState{obj.ID, obj.Type, obj.Data, obj.UserID, obj.ZIndex, position[obj.PageID]}
+	}
+
+	encoded, err := json.Marshal(map[string]interface{}{"pages": pages, "objects": objects})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// server: the real message path with loopback connections per user
+type server struct {
+	http     *httptest.Server
+	conns    chan *websocket.Conn
+	sessions *user.SessionManager
+	rooms    *room.Manager
+	config   *middleware.RateLimit
+	router   *handlers.MessageRouter
+	room     *room.Room
+	users    map[string]*user.User
+	clients  []*websocket.Conn
+}
+
+func newServer() *server {
+	// Same limits as main.go, except rates (replay runs faster than people type)
+	config := middleware.NewRateLimit(10, 1000, 250000, 100, 5, 1000, 1e6, 1e6)
+	config.CursorPerSecond, config.CursorBurstSize = 1e6, 1e6
+	config.HostActionInterval, config.HostActionBurst = time.Nanosecond, 1e6
+
+	sessions := user.NewSessionManager(config)
+	broadcaster := room.NewBroadcaster()
+	s := &server{
+		conns:    make(chan *websocket.Conn),
+		sessions: sessions,
+		rooms:    room.NewManager(nil),
+		config:   config,
+		router:   handlers.NewMessageRouter(object.NewValidator(), config, broadcaster, room.NewSynchronizer(config.MaxSyncSize), sessions),
+		users:    make(map[string]*user.User),
+	}
+
+	upgrader := websocket.Upgrader{}
+	s.http = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		s.conns <- conn
+	}))
+	return s
+}
+
+// user: the connected user for a recorded name, joining them on first use
+func (s *server) user(name string) (*user.User, error) {
+	if u, exists := s.users[name]; exists {
+		return u, nil
+	}
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.http.URL, "http"), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.clients = append(s.clients, client)
+	go func() {
+		// Replies and broadcasts aren't checked, only the resulting state
+		for {
+			if _, _, err := client.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	session := s.sessions.GetOrCreate(name, "")
+	u := user.NewUser(<-s.conns, user.ConnectionInfo{})
+	if _, err := s.sessions.Attach(session.SessionToken, u); err != nil {
+		return nil, err
+	}
+	rm, err := s.rooms.JoinRoom(roomCode, "", u, s.config)
+	if err != nil {
+		return nil, err
+	}
+	rm.ConfirmJoin(name)
+
+	s.room = rm
+	s.users[name] = u
+	return u, nil
+}
+
+// resolvePages: replaces "$page:N" with the Nth page's current ID
+func (s *server) resolvePages(msg json.RawMessage) []byte {
+	pages := s.room.GetPages()
+	return pageRef.ReplaceAllFunc(msg, func(match []byte) []byte {
+		n, _ := strconv.Atoi(string(pageRef.FindSubmatch(match)[1]))
+		if n >= len(pages) {
+			return match
+		}
+		return []byte(strconv.Quote(pages[n].ID))
+	})
+}
+
+func (s *server) close() {
+	for _, u := range s.users {
+		u.StopWriter()
+	}
+	for _, client := range s.clients {
+		client.Close()
+	}
+	s.http.Close()
+	if s.room != nil {
+		s.room.Close() // stops room workers (e.g. provisional expiry)
+	}
+}
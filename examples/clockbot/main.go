@@ -0,0 +1,92 @@
+// clockbot draws an analog clock in a room and moves its hands every second.
+//
+//	go run ./examples/clockbot -url ws://localhost:8080/ws -room lobby -origin http://localhost
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"math"
+	"time"
+
+	"main/client"
+)
+
+const (
+	centerX = 300.0
+	centerY = 300.0
+	radius  = 200.0
+)
+
+func main() {
+	serverURL := flag.String("url", "ws://localhost:8080/ws", "WebSocket endpoint")
+	room := flag.String("room", "clockbot", "room code")
+	origin := flag.String("origin", "http://localhost", "Origin header (must be in server DOMAINS)")
+	flag.Parse()
+
+	c, err := client.Connect(context.Background(), *serverURL, *room, "", client.WithOrigin(*origin))
+	if err != nil {
+		log.Fatalf("connect: %v", err)
+	}
+	defer c.Close()
+	log.Printf("Joined %s as %s", *room, c.UserID())
+
+	c.OnBroadcast(func(e client.Event) {
+		if e.Type == "error" {
+			log.Printf("Server error: %s (%s)", e.Code, e.ObjectID)
+		}
+	})
+
+	// Face: circle bounded by its enclosing square
+	face := client.Object{
+		ID:   "clockbot-face",
+		Type: "circle",
+		Data: map[string]interface{}{
+			"x1": centerX - radius, "y1": centerY - radius,
+			"x2": centerX + radius, "y2": centerY + radius,
+			"color": "#333333", "width": 4,
+		},
+	}
+	if err := c.AddObject(face); err != nil {
+		log.Fatalf("add face: %v", err)
+	}
+
+	hands := []struct {
+		id     string
+		length float64
+		width  float64
+		angle  func(time.Time) float64 // fraction of a full turn
+	}{
+		{"clockbot-hour", radius * 0.5, 8, func(t time.Time) float64 { return float64(t.Hour()%12)/12 + float64(t.Minute())/720 }},
+		{"clockbot-minute", radius * 0.75, 5, func(t time.Time) float64 { return float64(t.Minute())/60 + float64(t.Second())/3600 }},
+		{"clockbot-second", radius * 0.9, 2, func(t time.Time) float64 { return float64(t.Second()) / 60 }},
+	}
+
+	handData := func(length, width, turn float64) map[string]interface{} {
+		angle := turn*2*math.Pi - math.Pi/2
+		return map[string]interface{}{
+			"x1": centerX, "y1": centerY,
+			"x2": centerX + length*math.Cos(angle), "y2": centerY + length*math.Sin(angle),
+			"color": "#d62828", "width": width,
+		}
+	}
+
+	now := time.Now()
+	for _, h := range hands {
+		hand := client.Object{ID: h.id, Type: "line", Data: handData(h.length, h.width, h.angle(now))}
+		if err := c.AddObject(hand); err != nil {
+			log.Fatalf("add hand: %v", err)
+		}
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		for _, h := range hands {
+			if err := c.UpdateObject(h.id, handData(h.length, h.width, h.angle(now))); err != nil {
+				log.Printf("update %s: %v", h.id, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"main/internal/room"
+)
+
+// RoomGetter: looks up a live room by code
+type RoomGetter interface {
+	GetRoom(roomCode string) (*room.Room, bool)
+}
+
+// AuditHandler: GET /rooms/{code}/audit returns the room's object events (who
+// added, updated or deleted which drawing), oldest first. ?since= and ?until=
+// (RFC 3339) bound the time range
+func AuditHandler(rooms RoomGetter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var bounds [2]time.Time
+		for i, param := range []string{"since", "until"} {
+			raw := r.URL.Query().Get(param)
+			if raw == "" {
+				continue
+			}
+			parsed, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				http.Error(w, "Invalid "+param, http.StatusBadRequest)
+				return
+			}
+			bounds[i] = parsed
+		}
+
+		code := r.PathValue("code")
+		rm, exists := rooms.GetRoom(code)
+		if !exists {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"room":   code,
+			"events": rm.AuditLog(bounds[0], bounds[1]),
+		})
+	})
+}
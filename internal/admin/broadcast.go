@@ -0,0 +1,107 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"main/internal/object"
+	"main/internal/room"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	maxNoticeLength = 500      // characters, after sanitizing
+	maxNoticeBody   = 4 * 1024 // bytes of request body
+)
+
+var noticeSeverities = map[string]bool{"info": true, "warning": true, "critical": true}
+
+// RoomSource: rooms a notice can be delivered to
+type RoomSource interface {
+	Rooms() []*room.Room
+	GetRoom(roomCode string) (*room.Room, bool)
+}
+
+type broadcastRequest struct {
+	Message  string `json:"message"`
+	Severity string `json:"severity"`
+	RoomCode string `json:"roomCode"`
+}
+
+// BroadcastHandler: POST /admin/broadcast sends a systemNotice to every connected
+// user (or one room with roomCode), at most a few notices per minute
+func BroadcastHandler(rooms RoomSource, broadcaster *room.Broadcaster, validator *object.Validator) http.Handler {
+	limiter := rate.NewLimiter(rate.Every(20*time.Second), 3)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req broadcastRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxNoticeBody)).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		message := strings.TrimSpace(validator.SanitizeString(req.Message))
+		if message == "" {
+			http.Error(w, "Missing message", http.StatusBadRequest)
+			return
+		}
+		if utf8.RuneCountInString(message) > maxNoticeLength {
+			http.Error(w, "Message too long", http.StatusBadRequest)
+			return
+		}
+		if req.Severity == "" {
+			req.Severity = "info"
+		}
+		if !noticeSeverities[req.Severity] {
+			http.Error(w, "Invalid severity", http.StatusBadRequest)
+			return
+		}
+
+		targets := rooms.Rooms()
+		if req.RoomCode != "" {
+			rm, exists := rooms.GetRoom(req.RoomCode)
+			if !exists {
+				http.Error(w, "Room not found", http.StatusNotFound)
+				return
+			}
+			targets = []*room.Room{rm}
+		}
+
+		if !limiter.Allow() {
+			http.Error(w, "Too many notices, try again later", http.StatusTooManyRequests)
+			return
+		}
+
+		notice := room.Notice{Message: message, Severity: req.Severity, SentAt: time.Now()}
+		msg, err := notice.MarshalMessage()
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		delivered := 0
+		for _, rm := range targets {
+			rm.AddNotice(notice)
+			delivered += rm.ConnectionCount()
+			broadcaster.Broadcast(context.Background(), rm, msg, nil, room.TagRoom)
+		}
+		slog.Info("System notice sent", "severity", notice.Severity, "rooms", len(targets), "users", delivered)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"rooms": len(targets),
+			"users": delivered,
+		})
+	})
+}
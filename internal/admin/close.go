@@ -0,0 +1,41 @@
+package admin
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"main/internal/logging"
+	"main/internal/room"
+)
+
+// RoomCloser: removes a room for good (see room.Manager.CloseRoom)
+type RoomCloser interface {
+	CloseRoom(roomCode string) (*room.Room, error)
+}
+
+// CloseRoomHandler: DELETE /admin/rooms/{code} closes a room. Everyone in it
+// gets room_closed, then their connections are closed with
+// room.CloseRoomClosed. The room and its saved board are removed
+func CloseRoomHandler(rooms RoomCloser, broadcaster *room.Broadcaster) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		closed, err := rooms.CloseRoom(r.PathValue("code"))
+		if errors.Is(err, room.ErrUnknownRoom) || errors.Is(err, room.ErrInvalidRoomCode) {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.Error("Close room failed", logging.KeyRoom, r.PathValue("code"), "err", err)
+			http.Error(w, "Room could not be closed", http.StatusInternalServerError)
+			return
+		}
+
+		// The room refuses joins and messages already, so nobody arrives or
+		// draws in between. Broadcasts still in flight fail against stopped writers
+		broadcaster.BroadcastSystem(r.Context(), closed, map[string]interface{}{"type": room.CodeRoomClosed}, room.CodeRoomClosed, nil)
+		disconnected := closed.Disconnect(room.CloseRoomClosed, "room closed")
+		slog.Info("Admin closed room", logging.KeyRoom, closed.Code, "connections", disconnected)
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,56 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"main/internal/room"
+)
+
+// maxExtendBody: bytes of an extend request body
+const maxExtendBody = 1024
+
+// RoomExtender: pins a room past its expiry (see room.Manager.ExtendRoom)
+type RoomExtender interface {
+	ExtendRoom(roomCode string, d time.Duration) (time.Time, error)
+}
+
+// ExtendHandler: POST /rooms/{code}/extend with {"seconds": n} keeps the room
+// for at least n more seconds, e.g. a workshop running over several days.
+// Replies with {"room","expiresAt"}
+func ExtendHandler(rooms RoomExtender) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Seconds int64 `json:"seconds"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxExtendBody)).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		// Checked in seconds first, a huge value would overflow the Duration
+		if req.Seconds <= 0 || req.Seconds > int64(room.MaxRoomTTL/time.Second) {
+			http.Error(w, room.ErrInvalidExtension.Error(), http.StatusBadRequest)
+			return
+		}
+
+		code := r.PathValue("code")
+		expiresAt, err := rooms.ExtendRoom(code, time.Duration(req.Seconds)*time.Second)
+		switch {
+		case errors.Is(err, room.ErrInvalidExtension):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"room":      code,
+			"expiresAt": expiresAt,
+		})
+	})
+}
@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"main/internal/room"
+)
+
+// extend: POST /rooms/{code}/extend with body, through a mux like main's
+func extend(rooms RoomExtender, code string, body string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.Handle("POST /rooms/{code}/extend", ExtendHandler(rooms))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/rooms/"+code+"/extend", strings.NewReader(body)))
+	return w
+}
+
+func TestExtendHandler(t *testing.T) {
+	rm := room.NewManager(nil)
+	r, err := rm.CreateRoom(0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := r.ExpiresAt()
+
+	w := extend(rm, r.Code, `{"seconds": 86400}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var reply struct {
+		Room      string    `json:"room"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Room != r.Code || !reply.ExpiresAt.Equal(before.Add(24*time.Hour)) || !r.ExpiresAt().Equal(reply.ExpiresAt) {
+		t.Errorf("reply %+v, want %s expiring a day after %v", reply, r.Code, before)
+	}
+
+	for _, tc := range []struct {
+		name, code, body string
+		status           int
+	}{
+		{"bad body", r.Code, `{"seconds": "soon"}`, http.StatusBadRequest},
+		{"no seconds", r.Code, `{}`, http.StatusBadRequest},
+		{"under a minute", r.Code, `{"seconds": 30}`, http.StatusBadRequest},
+		{"over the maximum", r.Code, `{"seconds": 999999999999}`, http.StatusBadRequest},
+		{"unknown room", "NOROOM", `{"seconds": 3600}`, http.StatusNotFound},
+	} {
+		if w := extend(rm, tc.code, tc.body); w.Code != tc.status {
+			t.Errorf("%s: status %d, want %d", tc.name, w.Code, tc.status)
+		}
+	}
+	if !r.ExpiresAt().Equal(reply.ExpiresAt) {
+		t.Error("rejected requests changed the expiry")
+	}
+}
@@ -0,0 +1,95 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"main/internal/room"
+)
+
+const maxRoomListing = 1000 // rooms per listing response
+
+// RoomLister: room summaries for the listing (see room.Manager.Summaries)
+type RoomLister interface {
+	Summaries() []room.RoomSummary
+}
+
+// roomOrders: ?sort= values, each descending (busiest / newest first)
+var roomOrders = map[string]func(a, b room.RoomSummary) bool{
+	"connections": func(a, b room.RoomSummary) bool { return a.Connections > b.Connections },
+	"objects":     func(a, b room.RoomSummary) bool { return a.Objects > b.Objects },
+	"lastActive":  func(a, b room.RoomSummary) bool { return a.LastActive.After(b.LastActive) },
+	"created":     func(a, b room.RoomSummary) bool { return a.CreatedAt.After(b.CreatedAt) },
+}
+
+// RoomsHandler: GET /admin/rooms lists rooms, ?sort=connections|objects|lastActive|created
+// (default connections) and ?limit=N (top N rooms, at most maxRoomListing)
+// total is the number of rooms before the limit
+func RoomsHandler(rooms RoomLister) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order := r.URL.Query().Get("sort")
+		if order == "" {
+			order = "connections"
+		}
+		before, ok := roomOrders[order]
+		if !ok {
+			http.Error(w, "Invalid sort", http.StatusBadRequest)
+			return
+		}
+
+		limit := maxRoomListing
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, maxRoomListing)
+		}
+
+		summaries := rooms.Summaries()
+		sort.Slice(summaries, func(i, j int) bool {
+			if before(summaries[i], summaries[j]) != before(summaries[j], summaries[i]) {
+				return before(summaries[i], summaries[j])
+			}
+			return summaries[i].Code < summaries[j].Code // stable across requests
+		})
+		total := len(summaries)
+		if len(summaries) > limit {
+			summaries = summaries[:limit]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"rooms": summaries,
+			"total": total,
+		})
+	})
+}
+
+// RoomHandler: GET /admin/rooms/{code} returns the room's summary and everyone
+// connected to it (user ID, name, color, client IP, when they connected)
+func RoomHandler(rooms RoomGetter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rm, exists := rooms.GetRoom(r.PathValue("code"))
+		if !exists {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		summary, live := rm.Summary()
+		if !live {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"room":  summary,
+			"users": rm.ConnectionDetails(),
+		})
+	})
+}
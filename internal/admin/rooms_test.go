@@ -0,0 +1,109 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"main/internal/object"
+	"main/internal/room"
+)
+
+// listing: the rooms RoomsHandler lists for query, and its total
+func listing(t *testing.T, rooms RoomLister, query string) ([]room.RoomSummary, int) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	RoomsHandler(rooms).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/rooms"+query, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d", query, w.Code)
+	}
+	var body struct {
+		Rooms []room.RoomSummary `json:"rooms"`
+		Total int                `json:"total"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return body.Rooms, body.Total
+}
+
+// roomWithObjects: a new room in rm holding n drawings
+func roomWithObjects(t *testing.T, rm *room.Manager, n int) *room.Room {
+	t.Helper()
+	r, err := rm.CreateRoom(0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		err := r.AddObject(&object.Drawing{ID: string(rune('a' + i)), Type: "stroke", Data: map[string]interface{}{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r
+}
+
+func TestRoomsHandlerSortAndLimit(t *testing.T) {
+	rm := room.NewManager(nil)
+	small, big, medium := roomWithObjects(t, rm, 1), roomWithObjects(t, rm, 3), roomWithObjects(t, rm, 2)
+
+	rooms, total := listing(t, rm, "?sort=objects&limit=2")
+	if total != 3 || len(rooms) != 2 {
+		t.Fatalf("%d rooms of %d, want 2 of 3", len(rooms), total)
+	}
+	if rooms[0].Code != big.Code || rooms[1].Code != medium.Code {
+		t.Errorf("order = %s, %s, want %s, %s", rooms[0].Code, rooms[1].Code, big.Code, medium.Code)
+	}
+
+	if _, err := rm.CloseRoom(small.Code); err != nil {
+		t.Fatal(err)
+	}
+	if _, total := listing(t, rm, ""); total != 2 {
+		t.Errorf("total after a close = %d, want 2", total)
+	}
+}
+
+func TestRoomsHandlerRejectsBadQueries(t *testing.T) {
+	for _, query := range []string{"?sort=name", "?limit=0", "?limit=many"} {
+		w := httptest.NewRecorder()
+		RoomsHandler(room.NewManager(nil)).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/rooms"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+// TestRoomsHandlerDuringChurn: run with -race, the listing while rooms are
+// created, drawn into and closed
+func TestRoomsHandlerDuringChurn(t *testing.T) {
+	rm := room.NewManager(nil)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			r, err := rm.CreateRoom(0, 50)
+			if err != nil {
+				continue
+			}
+			r.AddObject(&object.Drawing{ID: "s1", Type: "stroke", Data: map[string]interface{}{}})
+			rm.CloseRoom(r.Code)
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		rooms, total := listing(t, rm, "?sort=lastActive")
+		if len(rooms) != total {
+			t.Fatalf("%d rooms listed, total %d", len(rooms), total)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,105 @@
+package analytics
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+)
+
+// EventType: session lifecycle stage
+type EventType string
+
+const (
+	SessionCreated EventType = "session_created"
+	SessionResumed EventType = "session_resumed"
+	RoomJoined     EventType = "room_joined"
+	RoomLeft       EventType = "room_left"
+	SessionExpired EventType = "session_expired"
+)
+
+// Event: single lifecycle event (user IDs and room codes are anonymized before
+// emitting, a room code is enough to join the room)
+type Event struct {
+	Type     EventType
+	UserHash string
+	RoomHash string
+	Duration time.Duration // time in room (left) or session lifetime (expired)
+	Time     time.Time
+}
+
+// Sink: consumer of lifecycle events
+type Sink interface {
+	Handle(e Event)
+}
+
+// Bus: buffered event bus, emitting never blocks the caller
+type Bus struct {
+	events  chan Event
+	sinks   []Sink
+	dropped atomic.Uint64
+}
+
+// NewBus: creates bus with no sinks (events are discarded until one is added)
+func NewBus(bufferSize int) *Bus {
+	return &Bus{
+		events: make(chan Event, bufferSize),
+	}
+}
+
+// AddSink: registers a sink, must be called before Run
+func (b *Bus) AddSink(sink Sink) {
+	b.sinks = append(b.sinks, sink)
+}
+
+// Emit: queues event, dropping it when the buffer is full
+func (b *Bus) Emit(e Event) {
+	if b == nil || len(b.sinks) == 0 {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	select {
+	case b.events <- e:
+	default:
+		b.dropped.Add(1)
+	}
+}
+
+// Dropped: number of events dropped because the buffer was full
+func (b *Bus) Dropped() uint64 {
+	return b.dropped.Load()
+}
+
+// Run: delivers events to sinks until ctx is cancelled
+func (b *Bus) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-b.events:
+			for _, sink := range b.sinks {
+				sink.Handle(e)
+			}
+		}
+	}
+}
+
+// salt: per-process salt so anonymized IDs can't be matched to raw user IDs
+var salt = func() []byte {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return bytes
+}()
+
+// AnonymizeID: stable (per process) hash of a user ID or room code
+func AnonymizeID(userID string) string {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(userID))
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
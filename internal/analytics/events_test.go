@@ -0,0 +1,135 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type countingSink struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (s *countingSink) Handle(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+}
+
+func (s *countingSink) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.events)
+}
+
+func TestEmitDropsWhenBufferFull(t *testing.T) {
+	bus := NewBus(2)
+	sink := &countingSink{}
+	bus.AddSink(sink)
+
+	// Nothing is consuming yet, emitting must still return at once
+	for i := 0; i < 5; i++ {
+		bus.Emit(Event{Type: RoomJoined})
+	}
+	if bus.Dropped() != 3 {
+		t.Errorf("dropped = %d, want 3", bus.Dropped())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go bus.Run(ctx)
+	for deadline := time.Now().Add(time.Second); sink.count() < 2; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("sink got %d events, want the 2 buffered", sink.count())
+		}
+	}
+}
+
+func TestEmitWithoutSinks(t *testing.T) {
+	bus := NewBus(1)
+	bus.Emit(Event{Type: RoomJoined})
+	bus.Emit(Event{Type: RoomJoined})
+	if bus.Dropped() != 0 {
+		t.Errorf("dropped = %d, events without sinks are discarded, not dropped", bus.Dropped())
+	}
+
+	var nilBus *Bus
+	nilBus.Emit(Event{Type: RoomJoined}) // must not panic
+}
+
+func TestAnonymizeID(t *testing.T) {
+	hash := AnonymizeID("ROOM-CODE")
+	if hash != AnonymizeID("ROOM-CODE") {
+		t.Error("hash not stable within the process")
+	}
+	if hash == AnonymizeID("OTHER-CODE") {
+		t.Error("different IDs hash the same")
+	}
+	if strings.Contains(hash, "ROOM") || len(hash) != 16 {
+		t.Errorf("hash = %q, want 16 hex characters", hash)
+	}
+}
+
+func TestLogSinkOmitsRawIDs(t *testing.T) {
+	var out bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&out, nil)))
+	defer slog.SetDefault(previous)
+
+	LogSink{}.Handle(Event{Type: RoomLeft, UserHash: AnonymizeID("alice"), RoomHash: AnonymizeID("SECRET-ROOM"), Duration: time.Minute})
+
+	line := out.String()
+	if strings.Contains(line, "SECRET-ROOM") || strings.Contains(line, "alice") {
+		t.Errorf("log line has a raw ID: %s", line)
+	}
+	if !strings.Contains(line, AnonymizeID("SECRET-ROOM")) {
+		t.Errorf("log line has no room hash: %s", line)
+	}
+}
+
+func TestPrometheusSink(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	bus := NewBus(1)
+	sink := NewPrometheusSink(reg, bus)
+
+	sink.Handle(Event{Type: RoomJoined})
+	sink.Handle(Event{Type: RoomLeft, Duration: 90 * time.Second})
+	sink.Handle(Event{Type: RoomJoined})
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]float64)
+	var observed uint64
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			switch family.GetName() {
+			case "whiteboard_session_events_total":
+				counts[metric.GetLabel()[0].GetValue()] = metric.GetCounter().GetValue()
+			case "whiteboard_session_duration_seconds":
+				observed += metric.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	if counts[string(RoomJoined)] != 2 || counts[string(RoomLeft)] != 1 {
+		t.Errorf("event counts = %v, want 2 joined and 1 left", counts)
+	}
+	if observed != 1 {
+		t.Errorf("durations observed = %d, want 1 (only events with a duration)", observed)
+	}
+}
+
+func TestParseSinks(t *testing.T) {
+	sinks := ParseSinks(" Log, prometheus ,,")
+	if len(sinks) != 2 || !sinks["log"] || !sinks["prometheus"] {
+		t.Errorf("ParseSinks = %v", sinks)
+	}
+}
@@ -0,0 +1,63 @@
+package analytics
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// LogSink: writes events as structured log lines
+type LogSink struct{}
+
+func (LogSink) Handle(e Event) {
+	slog.Info("Analytics event", "event", e.Type, "user_hash", e.UserHash, "room_hash", e.RoomHash, "duration", e.Duration)
+}
+
+// PrometheusSink: counts events and records session/room durations
+type PrometheusSink struct {
+	events    *prometheus.CounterVec
+	durations *prometheus.HistogramVec
+}
+
+// NewPrometheusSink: creates sink and registers its collectors (plus bus drop counter)
+func NewPrometheusSink(reg prometheus.Registerer, bus *Bus) *PrometheusSink {
+	sink := &PrometheusSink{
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "whiteboard_session_events_total",
+			Help: "Session lifecycle events by type.",
+		}, []string{"type"}),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "whiteboard_session_duration_seconds",
+			Help:    "Time spent in a room (room_left) or session lifetime (session_expired).",
+			Buckets: []float64{10, 60, 300, 900, 1800, 3600, 7200, 14400},
+		}, []string{"type"}),
+	}
+
+	reg.MustRegister(sink.events, sink.durations)
+	reg.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name: "whiteboard_session_events_dropped_total",
+		Help: "Session events dropped because the event buffer was full.",
+	}, func() float64 {
+		return float64(bus.Dropped())
+	}))
+	return sink
+}
+
+func (s *PrometheusSink) Handle(e Event) {
+	s.events.WithLabelValues(string(e.Type)).Inc()
+	if e.Duration > 0 {
+		s.durations.WithLabelValues(string(e.Type)).Observe(e.Duration.Seconds())
+	}
+}
+
+// ParseSinks: parses comma separated sink names (e.g. "log,prometheus")
+func ParseSinks(value string) map[string]bool {
+	names := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(strings.ToLower(name)); name != "" {
+			names[name] = true
+		}
+	}
+	return names
+}
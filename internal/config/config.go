@@ -0,0 +1,169 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Config: server limits and listen port, each overridable by a WB_* environment
+// variable (or the unprefixed name settings had before this package)
+type Config struct {
+	MaxRoomSize       int     // WB_MAX_ROOM_SIZE: connections per room
+	MaxSpectators     int     // WB_MAX_SPECTATORS: view-only connections per room
+	MaxObjects        int     // WB_MAX_OBJECTS: drawings per room
+	MaxMessageSize    int     // WB_MAX_MESSAGE_SIZE: bytes per websocket message
+	MaxRooms          int     // WB_MAX_ROOMS: rooms per server
+	MaxObjectDepth    int     // WB_MAX_OBJECT_DEPTH: nesting of object data
+	MaxObjectElements int     // WB_MAX_OBJECT_ELEMENTS: unique keys in object data
+	MessagesPerSecond float64 // WB_MESSAGES_PER_SECOND: object messages per user
+	BurstSize         int     // WB_BURST_SIZE
+	IPRate            float64 // WB_IP_RATE: new connections per minute per IP
+	IPBurst           int     // WB_IP_BURST
+	IPMaxConnections  int     // WB_IP_MAX_CONNECTIONS: open websockets per IP
+	Port              int     // WB_PORT
+	Compression       bool    // WB_COMPRESSION: offer permessage-deflate
+	CompressionLevel  int     // WB_COMPRESSION_LEVEL: 1 (fastest) to 9
+	RequireZIndex     bool    // WB_REQUIRE_ZINDEX: reject objects without zIndex instead of stacking them on top
+
+	StrictRooms     bool          // STRICT_ROOMS: only room codes issued by POST /rooms can be joined
+	SessionTokenTTL time.Duration // SESSION_TOKEN_TTL (e.g. "12h"): a session token expires this long after it was issued
+	RoomIdleTTL     time.Duration // ROOM_IDLE_TTL: empty rooms expire this long after the last join or edit
+	RoomMaxAge      time.Duration // ROOM_MAX_AGE: empty rooms expire this long after they were created (no cap if unset)
+}
+
+// Default: limits used for variables that aren't set
+func Default() Config {
+	return Config{
+		MaxRoomSize:       10,
+		MaxSpectators:     50,
+		MaxObjects:        1000,
+		MaxMessageSize:    250000,
+		MaxRooms:          100,
+		MaxObjectDepth:    5,
+		MaxObjectElements: 1000,
+		MessagesPerSecond: 30,
+		BurstSize:         10,
+		IPRate:            10,
+		IPBurst:           5,
+		IPMaxConnections:  20,
+		Port:              8080,
+		CompressionLevel:  1,
+		SessionTokenTTL:   24 * time.Hour,
+		RoomIdleTTL:       24 * time.Hour,
+	}
+}
+
+// Load: Default with the variables lookup finds (e.g. os.LookupEnv) applied
+// Every number and duration must be positive and every flag true or false, the
+// error lists all invalid ones
+func Load(lookup func(name string) (string, bool)) (Config, error) {
+	cfg := Default()
+	var errs []error
+
+	ints := []struct {
+		name  string
+		field *int
+	}{
+		{"WB_MAX_ROOM_SIZE", &cfg.MaxRoomSize},
+		{"WB_MAX_SPECTATORS", &cfg.MaxSpectators},
+		{"WB_MAX_OBJECTS", &cfg.MaxObjects},
+		{"WB_MAX_MESSAGE_SIZE", &cfg.MaxMessageSize},
+		{"WB_MAX_ROOMS", &cfg.MaxRooms},
+		{"WB_MAX_OBJECT_DEPTH", &cfg.MaxObjectDepth},
+		{"WB_MAX_OBJECT_ELEMENTS", &cfg.MaxObjectElements},
+		{"WB_BURST_SIZE", &cfg.BurstSize},
+		{"WB_IP_BURST", &cfg.IPBurst},
+		{"WB_IP_MAX_CONNECTIONS", &cfg.IPMaxConnections},
+		{"WB_PORT", &cfg.Port},
+		{"WB_COMPRESSION_LEVEL", &cfg.CompressionLevel},
+	}
+	for _, setting := range ints {
+		value, set := lookup(setting.name)
+		if !set {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			errs = append(errs, fmt.Errorf("invalid %s %q: must be a positive integer", setting.name, value))
+			continue
+		}
+		*setting.field = parsed
+	}
+
+	floats := []struct {
+		name  string
+		field *float64
+	}{
+		{"WB_MESSAGES_PER_SECOND", &cfg.MessagesPerSecond},
+		{"WB_IP_RATE", &cfg.IPRate},
+	}
+	for _, setting := range floats {
+		value, set := lookup(setting.name)
+		if !set {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || !(parsed > 0) {
+			errs = append(errs, fmt.Errorf("invalid %s %q: must be a positive number", setting.name, value))
+			continue
+		}
+		*setting.field = parsed
+	}
+
+	bools := []struct {
+		name  string
+		field *bool
+	}{
+		{"WB_COMPRESSION", &cfg.Compression},
+		{"WB_REQUIRE_ZINDEX", &cfg.RequireZIndex},
+		{"STRICT_ROOMS", &cfg.StrictRooms},
+	}
+	for _, setting := range bools {
+		value, set := lookup(setting.name)
+		if !set {
+			continue
+		}
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %q: must be true or false", setting.name, value))
+			continue
+		}
+		*setting.field = enabled
+	}
+
+	durations := []struct {
+		name  string
+		field *time.Duration
+	}{
+		{"SESSION_TOKEN_TTL", &cfg.SessionTokenTTL},
+		{"ROOM_IDLE_TTL", &cfg.RoomIdleTTL},
+		{"ROOM_MAX_AGE", &cfg.RoomMaxAge},
+	}
+	for _, setting := range durations {
+		value, set := lookup(setting.name)
+		if !set {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			errs = append(errs, fmt.Errorf("invalid %s %q: must be a positive duration (e.g. \"12h\")", setting.name, value))
+			continue
+		}
+		*setting.field = parsed
+	}
+
+	if cfg.Port > 65535 {
+		errs = append(errs, fmt.Errorf("invalid WB_PORT %d: must be at most 65535", cfg.Port))
+	}
+	if cfg.CompressionLevel > 9 {
+		errs = append(errs, fmt.Errorf("invalid WB_COMPRESSION_LEVEL %d: must be at most 9", cfg.CompressionLevel))
+	}
+	return cfg, errors.Join(errs...)
+}
+
+// Addr: listen address for the port
+func (c Config) Addr() string {
+	return ":" + strconv.Itoa(c.Port)
+}
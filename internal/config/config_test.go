@@ -0,0 +1,106 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// env: a lookup over vars, like os.LookupEnv
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, set := vars[name]
+		return value, set
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg != Default() {
+		t.Errorf("config = %+v, want the defaults", cfg)
+	}
+	if cfg.Addr() != ":8080" {
+		t.Errorf("addr = %s, want :8080", cfg.Addr())
+	}
+}
+
+func TestLoadParsesVariables(t *testing.T) {
+	cfg, err := Load(env(map[string]string{
+		"WB_MAX_ROOM_SIZE":       "25",
+		"WB_MAX_OBJECTS":         "5000",
+		"WB_MAX_MESSAGE_SIZE":    "100000",
+		"WB_MAX_ROOMS":           "7",
+		"WB_IP_RATE":             "2.5",
+		"WB_IP_BURST":            "3",
+		"WB_MESSAGES_PER_SECOND": "60",
+		"WB_PORT":                "9000",
+		"WB_COMPRESSION":         "true",
+		"WB_COMPRESSION_LEVEL":   "6",
+		"WB_REQUIRE_ZINDEX":      "1",
+		"SESSION_TOKEN_TTL":      "12h",
+		"STRICT_ROOMS":           "true",
+		"ROOM_IDLE_TTL":          "48h",
+		"ROOM_MAX_AGE":           "168h",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Default()
+	want.MaxRoomSize, want.MaxObjects, want.MaxMessageSize, want.MaxRooms = 25, 5000, 100000, 7
+	want.IPRate, want.IPBurst, want.MessagesPerSecond = 2.5, 3, 60
+	want.Port, want.Compression, want.CompressionLevel, want.RequireZIndex = 9000, true, 6, true
+	want.SessionTokenTTL, want.StrictRooms = 12*time.Hour, true
+	want.RoomIdleTTL, want.RoomMaxAge = 48*time.Hour, 7*24*time.Hour
+	if cfg != want {
+		t.Errorf("config = %+v\nwant %+v", cfg, want)
+	}
+	if cfg.Addr() != ":9000" {
+		t.Errorf("addr = %s, want :9000", cfg.Addr())
+	}
+}
+
+func TestLoadRejectsMalformedValues(t *testing.T) {
+	for name, value := range map[string]string{
+		"WB_MAX_ROOM_SIZE":     "0",
+		"WB_MAX_OBJECTS":       "-5",
+		"WB_MAX_MESSAGE_SIZE":  "250kb",
+		"WB_IP_RATE":           "NaN",
+		"WB_IP_BURST":          "",
+		"WB_PORT":              "70000",
+		"WB_COMPRESSION_LEVEL": "10",
+		"WB_COMPRESSION":       "sometimes",
+		"WB_REQUIRE_ZINDEX":    "yes",
+		"SESSION_TOKEN_TTL":    "forever",
+		"STRICT_ROOMS":         "on",
+		"ROOM_IDLE_TTL":        "0s",
+		"ROOM_MAX_AGE":         "a week",
+	} {
+		_, err := Load(env(map[string]string{name: value}))
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("%s=%q: err = %v, want one naming the variable", name, value, err)
+		}
+	}
+}
+
+func TestLoadReportsEveryInvalidVariable(t *testing.T) {
+	_, err := Load(env(map[string]string{
+		"WB_MAX_ROOMS": "zero",
+		"WB_IP_RATE":   "-1",
+		"WB_PORT":      "8081",
+	}))
+	if err == nil {
+		t.Fatal("invalid variables accepted")
+	}
+	for _, name := range []string{"WB_MAX_ROOMS", "WB_IP_RATE"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error %q doesn't mention %s", err, name)
+		}
+	}
+	if strings.Contains(err.Error(), "WB_PORT") {
+		t.Errorf("error %q mentions the valid WB_PORT", err)
+	}
+}
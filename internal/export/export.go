@@ -0,0 +1,129 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"main/internal/logging"
+	"main/internal/object"
+	"main/internal/room"
+)
+
+// RoomSource: rooms that can be exported
+type RoomSource interface {
+	GetRoom(roomCode string) (*room.Room, bool)
+}
+
+// TokenValidator: resolves a session token to its userID
+type TokenValidator interface {
+	ValidateToken(token string) (string, bool)
+}
+
+// Exporter: serves room downloads and previews, every format goes through the
+// same request (auth, ?scrub= filters) and board pipeline
+type Exporter struct {
+	rooms      RoomSource
+	sessions   TokenValidator
+	scrubber   *Scrubber
+	thumbnails *thumbnailCache
+	fonts      object.FontPolicy
+}
+
+func NewExporter(rooms RoomSource, sessions TokenValidator, scrubber *Scrubber) *Exporter {
+	return &Exporter{
+		rooms:      rooms,
+		sessions:   sessions,
+		scrubber:   scrubber,
+		thumbnails: newThumbnailCache(maxCachedThumbnails, maxCachedBytes),
+		fonts:      object.DefaultFontPolicy(),
+	}
+}
+
+// SetFontPolicy: font families SVG exports render text with (the validator's policy)
+func (e *Exporter) SetFontPolicy(policy object.FontPolicy) {
+	e.fonts = policy
+}
+
+// document: exported board, the Board format plus room metadata
+type document struct {
+	Room       string    `json:"room"`
+	ExportedAt time.Time `json:"exportedAt"`
+	*room.Board
+}
+
+// JSONHandler: GET /rooms/{code}/export downloads the room as a board JSON file
+// (the format importObjects accepts)
+func (e *Exporter) JSONHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rm, opts, ok := e.prepare(w, r)
+		if !ok {
+			return
+		}
+
+		doc := document{
+			Room:       rm.Code,
+			ExportedAt: time.Now().UTC(),
+			Board:      e.board(rm, opts),
+		}
+		encoded, err := json.Marshal(doc)
+		if err != nil {
+			slog.Error("Export failed", logging.KeyRoom, rm.Code, "err", err)
+			http.Error(w, "Export failed", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", attachment(rm.Code, "json"))
+		w.Write(encoded)
+	})
+}
+
+// prepare: authorizes the request and parses its export filters
+func (e *Exporter) prepare(w http.ResponseWriter, r *http.Request) (*room.Room, ScrubOptions, bool) {
+	rm, ok := e.authorize(w, r)
+	if !ok {
+		return nil, ScrubOptions{}, false
+	}
+	opts, err := ParseScrubOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, ScrubOptions{}, false
+	}
+	return rm, opts, true
+}
+
+// board: the room's board with the export filters applied
+func (e *Exporter) board(rm *room.Room, opts ScrubOptions) *room.Board {
+	return e.scrubber.Apply(rm.Export(), opts)
+}
+
+// authorize: resolves {code} to a room the requester has joined
+// The session token comes from "Authorization: Bearer <token>" or ?token=
+func (e *Exporter) authorize(w http.ResponseWriter, r *http.Request) (*room.Room, bool) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		token = r.URL.Query().Get("token")
+	}
+	userID, valid := e.sessions.ValidateToken(token)
+	if token == "" || !valid {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	// Unknown rooms and rooms the user never joined look the same
+	rm, exists := e.rooms.GetRoom(r.PathValue("code"))
+	if !exists || rm.GetUserColor(userID) == "" {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return nil, false
+	}
+	return rm, true
+}
+
+// attachment: Content-Disposition for a download named after the room and date
+func attachment(roomCode string, ext string) string {
+	return fmt.Sprintf(`attachment; filename="board-%s-%s.%s"`, roomCode, time.Now().UTC().Format("2006-01-02"), ext)
+}
@@ -0,0 +1,276 @@
+package export
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+
+	"main/internal/object"
+	"main/internal/room"
+)
+
+const maxPreviewPoints = 64 // strokes are decimated to about this many points
+
+var (
+	previewBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	placeholderBorder = color.RGBA{0xdd, 0xdd, 0xdd, 0xff}
+)
+
+// shape: drawing reduced to what a low detail preview draws
+type shape struct {
+	kind   string // "rect", "ellipse", "polyline", "box"
+	points []object.Point
+	stroke color.RGBA
+	fill   color.RGBA // zero alpha = no fill
+	width  float64
+	bounds object.Bounds
+}
+
+// RenderPreview: low detail size×size PNG of a page, strokes are decimated and
+// text is drawn as boxes. Empty pages render as a placeholder
+func RenderPreview(board *room.Board, pageID string, size int) ([]byte, error) {
+	var shapes []shape
+	bounds := object.Bounds{MinX: math.Inf(1), MinY: math.Inf(1), MaxX: math.Inf(-1), MaxY: math.Inf(-1)}
+	for _, obj := range board.Objects {
+		if obj.PageID != pageID {
+			continue
+		}
+		s, err := previewShape(obj)
+		if err != nil {
+			slog.Warn("Preview: skipping object", "object_type", obj.Type, "object_id", obj.ID, "err", err)
+			continue
+		}
+		shapes = append(shapes, s)
+		bounds.MinX, bounds.MaxX = math.Min(bounds.MinX, s.bounds.MinX), math.Max(bounds.MaxX, s.bounds.MaxX)
+		bounds.MinY, bounds.MaxY = math.Min(bounds.MinY, s.bounds.MinY), math.Max(bounds.MaxY, s.bounds.MaxY)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(previewBackground), image.Point{}, draw.Src)
+
+	if len(shapes) == 0 {
+		drawPlaceholder(img)
+	} else {
+		// Fit the drawings (plus a margin) into the image, keeping aspect ratio
+		bounds = pad(bounds, svgPadding)
+		scale := float64(size) / math.Max(bounds.MaxX-bounds.MinX, bounds.MaxY-bounds.MinY)
+		offsetX := (float64(size) - (bounds.MaxX-bounds.MinX)*scale) / 2
+		offsetY := (float64(size) - (bounds.MaxY-bounds.MinY)*scale) / 2
+		project := func(p object.Point) object.Point {
+			return object.Point{X: (p.X-bounds.MinX)*scale + offsetX, Y: (p.Y-bounds.MinY)*scale + offsetY}
+		}
+		for _, s := range shapes {
+			drawShape(img, s, project, scale)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// previewShape: simplified shape for a drawing, same fields the SVG export uses
+func previewShape(obj *object.Drawing) (shape, error) {
+	switch obj.Type {
+	case "rectangle", "circle":
+		var d object.RectangleData // circle has the same fields
+		if err := decode(obj.Data, &d); err != nil {
+			return shape{}, err
+		}
+		kind := "rect"
+		if obj.Type == "circle" {
+			kind = "ellipse"
+		}
+		return shape{
+			kind:   kind,
+			points: []object.Point{{X: math.Min(d.X1, d.X2), Y: math.Min(d.Y1, d.Y2)}, {X: math.Max(d.X1, d.X2), Y: math.Max(d.Y1, d.Y2)}},
+			stroke: parseColor(d.Color, defaultColor),
+			fill:   parseColor(d.Fill, ""),
+			width:  strokeWidth(d.Width),
+			bounds: boxBounds(d.LineCoordinates, d.Width),
+		}, nil
+
+	case "line":
+		var d object.LineData
+		if err := decode(obj.Data, &d); err != nil {
+			return shape{}, err
+		}
+		return shape{
+			kind:   "polyline",
+			points: []object.Point{{X: d.X1, Y: d.Y1}, {X: d.X2, Y: d.Y2}},
+			stroke: parseColor(d.Color, defaultColor),
+			width:  strokeWidth(d.Width),
+			bounds: boxBounds(d.LineCoordinates, d.Width),
+		}, nil
+
+	case "stroke":
+		var d object.StrokeData
+		if err := decode(obj.Data, &d); err != nil {
+			return shape{}, err
+		}
+		if len(d.Points) < 2 {
+			return shape{}, errTooFewPoints
+		}
+		b, _ := object.BoundingBox(obj.Data)
+		return shape{
+			kind:   "polyline",
+			points: decimate(d.Points, maxPreviewPoints),
+			stroke: parseColor(d.Color, defaultColor),
+			width:  strokeWidth(d.Width),
+			bounds: pad(b, strokeWidth(d.Width)/2),
+		}, nil
+
+	case "text":
+		var d object.TextData
+		if err := decode(obj.Data, &d); err != nil {
+			return shape{}, err
+		}
+		size := d.FontSize
+		if size == 0 {
+			size = defaultFontSize
+		}
+		b := textBounds(d, size)
+		fill := parseColor(d.Color, defaultColor)
+		fill.A = 0x60 // faint, it stands in for the text
+		return shape{
+			kind:   "box",
+			points: []object.Point{{X: b.MinX, Y: b.MinY + size*0.2}, {X: b.MaxX, Y: b.MaxY - size*0.2}},
+			fill:   fill,
+			bounds: b,
+		}, nil
+
+	default:
+		return shape{}, errUnsupportedType
+	}
+}
+
+// decimate: keeps about max points, always the first and last
+func decimate(points []object.Point, max int) []object.Point {
+	if len(points) <= max {
+		return points
+	}
+	step := float64(len(points)-1) / float64(max-1)
+	kept := make([]object.Point, 0, max)
+	for i := 0; i < max-1; i++ {
+		kept = append(kept, points[int(float64(i)*step)])
+	}
+	return append(kept, points[len(points)-1])
+}
+
+// drawShape: rasterizes a shape in image coordinates
+func drawShape(img *image.RGBA, s shape, project func(object.Point) object.Point, scale float64) {
+	width := math.Max(1, s.width*scale)
+	switch s.kind {
+	case "rect", "box":
+		min, max := project(s.points[0]), project(s.points[1])
+		if s.fill.A > 0 {
+			fillRect(img, min, max, s.fill)
+		}
+		if s.kind == "rect" {
+			corners := []object.Point{min, {X: max.X, Y: min.Y}, max, {X: min.X, Y: max.Y}, min}
+			drawPolyline(img, corners, width, s.stroke)
+		}
+
+	case "ellipse":
+		min, max := project(s.points[0]), project(s.points[1])
+		cx, cy := (min.X+max.X)/2, (min.Y+max.Y)/2
+		rx, ry := (max.X-min.X)/2, (max.Y-min.Y)/2
+		if s.fill.A > 0 {
+			for y := int(min.Y); y <= int(max.Y); y++ {
+				dy := (float64(y) + 0.5 - cy) / math.Max(ry, 0.5)
+				if dy*dy > 1 {
+					continue
+				}
+				dx := rx * math.Sqrt(1-dy*dy)
+				fillRect(img, object.Point{X: cx - dx, Y: float64(y)}, object.Point{X: cx + dx, Y: float64(y + 1)}, s.fill)
+			}
+		}
+		segments := 32
+		outline := make([]object.Point, segments+1)
+		for i := range outline {
+			angle := 2 * math.Pi * float64(i) / float64(segments)
+			outline[i] = object.Point{X: cx + rx*math.Cos(angle), Y: cy + ry*math.Sin(angle)}
+		}
+		drawPolyline(img, outline, width, s.stroke)
+
+	case "polyline":
+		projected := make([]object.Point, len(s.points))
+		for i, p := range s.points {
+			projected[i] = project(p)
+		}
+		drawPolyline(img, projected, width, s.stroke)
+	}
+}
+
+// drawPolyline: stamps a square brush along each segment
+func drawPolyline(img *image.RGBA, points []object.Point, width float64, c color.RGBA) {
+	half := width / 2
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		steps := int(math.Max(math.Abs(b.X-a.X), math.Abs(b.Y-a.Y))) + 1
+		for step := 0; step <= steps; step++ {
+			t := float64(step) / float64(steps)
+			x, y := a.X+(b.X-a.X)*t, a.Y+(b.Y-a.Y)*t
+			fillRect(img, object.Point{X: x - half, Y: y - half}, object.Point{X: x + half, Y: y + half}, c)
+		}
+	}
+}
+
+// fillRect: blends c over the pixels between min and max
+func fillRect(img *image.RGBA, min, max object.Point, c color.RGBA) {
+	rect := image.Rect(int(math.Floor(min.X)), int(math.Floor(min.Y)), int(math.Ceil(max.X)), int(math.Ceil(max.Y)))
+	op := draw.Over
+	if c.A == 0xff {
+		op = draw.Src
+	}
+	draw.Draw(img, rect.Intersect(img.Bounds()), image.NewUniform(premultiply(c)), image.Point{}, op)
+}
+
+// drawPlaceholder: frame shown for boards with nothing to preview
+func drawPlaceholder(img *image.RGBA) {
+	size := float64(img.Bounds().Dx())
+	inset := size / 8
+	corners := []object.Point{{X: inset, Y: inset}, {X: size - inset, Y: inset}, {X: size - inset, Y: size - inset}, {X: inset, Y: size - inset}, {X: inset, Y: inset}}
+	drawPolyline(img, corners, math.Max(1, size/64), placeholderBorder)
+}
+
+// parseColor: "#rgb" or "#rrggbb", fallback for anything else ("" = no color)
+func parseColor(value string, fallback string) color.RGBA {
+	if c, ok := hexColor(value); ok {
+		return c
+	}
+	c, _ := hexColor(fallback)
+	return c
+}
+
+func hexColor(value string) (color.RGBA, bool) {
+	hex, found := strings.CutPrefix(value, "#")
+	if !found {
+		return color.RGBA{}, false
+	}
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return color.RGBA{}, false
+	}
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, false
+	}
+	return color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 0xff}, true
+}
+
+// premultiply: color.RGBA is alpha-premultiplied, parsed colors aren't
+func premultiply(c color.RGBA) color.RGBA {
+	a := uint16(c.A)
+	return color.RGBA{R: uint8(uint16(c.R) * a / 0xff), G: uint8(uint16(c.G) * a / 0xff), B: uint8(uint16(c.B) * a / 0xff), A: c.A}
+}
@@ -0,0 +1,143 @@
+package export
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"main/internal/object"
+	"main/internal/room"
+)
+
+// Built-in PII patterns, redacted as "[name]"
+var defaultPIIPatterns = map[string]string{
+	"email": `[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`,
+	"phone": `\+?\d[\d\s().\-]{7,}\d`,
+}
+
+// ScrubOptions: export filters chosen per request with ?scrub=words,pii,text
+type ScrubOptions struct {
+	Words    bool // mask blocked words
+	PII      bool // redact PII patterns
+	DropText bool // leave out text objects entirely
+}
+
+// Key: stable string for caching exports rendered with these options
+func (o ScrubOptions) Key() string {
+	return fmt.Sprintf("w%t.p%t.t%t", o.Words, o.PII, o.DropText)
+}
+
+// ParseScrubOptions: reads ?scrub= (comma separated), unknown filters are an error
+func ParseScrubOptions(r *http.Request) (ScrubOptions, error) {
+	var opts ScrubOptions
+	for _, filter := range strings.Split(r.URL.Query().Get("scrub"), ",") {
+		switch strings.TrimSpace(filter) {
+		case "":
+		case "words":
+			opts.Words = true
+		case "pii":
+			opts.PII = true
+		case "text":
+			opts.DropText = true
+		default:
+			return opts, fmt.Errorf("unknown scrub filter %q (allowed: words, pii, text)", filter)
+		}
+	}
+	return opts, nil
+}
+
+// Scrubber: rewrites exported boards, the live room is never touched
+type Scrubber struct {
+	words *regexp.Regexp // nil when no words are configured
+	pii   []piiPattern
+}
+
+type piiPattern struct {
+	placeholder string
+	re          *regexp.Regexp
+}
+
+// NewScrubber: words are matched whole and case-insensitively, extra PII
+// patterns are redacted as "[redacted]" alongside the built-in email and phone
+func NewScrubber(words []string, extraPII []string) (*Scrubber, error) {
+	s := &Scrubber{}
+
+	if len(words) > 0 {
+		quoted := make([]string, len(words))
+		for i, word := range words {
+			quoted[i] = regexp.QuoteMeta(word)
+		}
+		s.words = regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`)
+	}
+
+	names := make([]string, 0, len(defaultPIIPatterns))
+	for name := range defaultPIIPatterns {
+		names = append(names, name)
+	}
+	sort.Strings(names) // email before phone, so addresses with digits stay one match
+	for _, name := range names {
+		s.pii = append(s.pii, piiPattern{placeholder: "[" + name + "]", re: regexp.MustCompile(defaultPIIPatterns[name])})
+	}
+	for _, pattern := range extraPII {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PII pattern %q: %w", pattern, err)
+		}
+		s.pii = append(s.pii, piiPattern{placeholder: "[redacted]", re: re})
+	}
+	return s, nil
+}
+
+// Apply: scrubbed copy of board, board itself is left as is
+// (its drawings share Data maps with the live room)
+func (s *Scrubber) Apply(board *room.Board, opts ScrubOptions) *room.Board {
+	if opts == (ScrubOptions{}) {
+		return board
+	}
+
+	scrubbed := *board
+	scrubbed.Pages = make([]room.Page, len(board.Pages))
+	for i, page := range board.Pages {
+		page.Name = s.text(page.Name, opts)
+		scrubbed.Pages[i] = page
+	}
+
+	scrubbed.Objects = make([]*object.Drawing, 0, len(board.Objects))
+	for _, obj := range board.Objects {
+		if opts.DropText && obj.Type == "text" {
+			continue
+		}
+
+		copied := *obj
+		copied.Data = make(map[string]interface{}, len(obj.Data))
+		for k, v := range obj.Data {
+			copied.Data[k] = v
+		}
+		if text, ok := copied.Data["text"].(string); ok {
+			copied.Data["text"] = s.text(text, opts)
+		}
+		// A link can't be partially redacted and still work
+		if link, ok := copied.Data["link"].(string); ok && s.text(link, opts) != link {
+			delete(copied.Data, "link")
+		}
+		scrubbed.Objects = append(scrubbed.Objects, &copied)
+	}
+	return &scrubbed
+}
+
+// text: applies the enabled string filters
+func (s *Scrubber) text(value string, opts ScrubOptions) string {
+	if opts.PII {
+		for _, p := range s.pii {
+			value = p.re.ReplaceAllString(value, p.placeholder)
+		}
+	}
+	if opts.Words && s.words != nil {
+		value = s.words.ReplaceAllStringFunc(value, func(word string) string {
+			return strings.Repeat("*", len([]rune(word)))
+		})
+	}
+	return value
+}
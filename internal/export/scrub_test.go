@@ -0,0 +1,194 @@
+package export
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"main/internal/middleware"
+	"main/internal/object"
+	"main/internal/room"
+	"main/internal/user"
+)
+
+const fixtureText = "Mail bob@example.com or call +1 (555) 123-4567, darn it"
+
+// tokens: a TokenValidator for fixed tokens
+type tokens map[string]string
+
+func (t tokens) ValidateToken(token string) (string, bool) {
+	userID, ok := t[token]
+	return userID, ok
+}
+
+// fixtureRoom: a room alice has joined, with a stroke and a text drawing
+// carrying an email, a phone number, a blocked word and a mailto link
+func fixtureRoom(t *testing.T) (*room.Manager, *room.Room) {
+	t.Helper()
+	rooms := room.NewManager(nil)
+	rm, err := rooms.CreateRoom(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(rm.Close)
+
+	sessions := user.NewSessionManager(middleware.NewRateLimit(10, 1000, 250000, 100, 5, 1000, 30, 60))
+	if err := rm.Join(&user.User{ID: "alice", Session: sessions.GetOrCreate("alice", "")}, 10, 10); err != nil {
+		t.Fatal(err)
+	}
+	rm.ConfirmJoin("alice")
+
+	for _, obj := range []*object.Drawing{
+		{ID: "s1", Type: "stroke", UserID: "alice", Data: map[string]interface{}{
+			"points": []interface{}{map[string]interface{}{"x": 0.0, "y": 0.0}, map[string]interface{}{"x": 50.0, "y": 50.0}},
+		}},
+		{ID: "t1", Type: "text", UserID: "alice", Data: map[string]interface{}{
+			"x": 10.0, "y": 20.0, "text": fixtureText, "link": "mailto:bob@example.com",
+		}},
+	} {
+		if err := rm.AddObject(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rooms, rm
+}
+
+func testScrubber(t *testing.T) *Scrubber {
+	t.Helper()
+	s, err := NewScrubber([]string{"darn"}, []string{`ACME-\d+`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// textOf: the text of drawing id on board, "" if it's not there
+func textOf(board *room.Board, id string) (string, *object.Drawing) {
+	for _, obj := range board.Objects {
+		if obj.ID == id {
+			text, _ := obj.Data["text"].(string)
+			return text, obj
+		}
+	}
+	return "", nil
+}
+
+func TestScrubFilters(t *testing.T) {
+	_, rm := fixtureRoom(t)
+	s := testScrubber(t)
+
+	for _, tc := range []struct {
+		opts ScrubOptions
+		want string
+	}{
+		{ScrubOptions{}, fixtureText},
+		{ScrubOptions{Words: true}, "Mail bob@example.com or call +1 (555) 123-4567, **** it"},
+		{ScrubOptions{PII: true}, "Mail [email] or call [phone], darn it"},
+		{ScrubOptions{Words: true, PII: true}, "Mail [email] or call [phone], **** it"},
+	} {
+		board := s.Apply(rm.Export(), tc.opts)
+		text, obj := textOf(board, "t1")
+		if text != tc.want {
+			t.Errorf("%+v: text = %q, want %q", tc.opts, text, tc.want)
+		}
+		if _, kept := obj.Data["link"]; kept == tc.opts.PII {
+			t.Errorf("%+v: link kept = %v", tc.opts, kept)
+		}
+	}
+
+	board := s.Apply(rm.Export(), ScrubOptions{DropText: true})
+	if _, obj := textOf(board, "t1"); obj != nil {
+		t.Error("text drawing kept with DropText")
+	}
+	if _, obj := textOf(board, "s1"); obj == nil {
+		t.Error("stroke dropped with DropText")
+	}
+}
+
+func TestScrubExtraPIIPatterns(t *testing.T) {
+	s := testScrubber(t)
+	if got := s.text("ticket ACME-1234 is open", ScrubOptions{PII: true}); got != "ticket [redacted] is open" {
+		t.Errorf("extra pattern: %q", got)
+	}
+	if _, err := NewScrubber(nil, []string{"("}); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+}
+
+func TestScrubLeavesRoomAlone(t *testing.T) {
+	_, rm := fixtureRoom(t)
+	s := testScrubber(t)
+
+	s.Apply(rm.Export(), ScrubOptions{Words: true, PII: true, DropText: true})
+	obj := rm.GetObject("t1")
+	if obj == nil || obj.Data["text"] != fixtureText || obj.Data["link"] != "mailto:bob@example.com" {
+		t.Errorf("live drawing changed: %+v", obj)
+	}
+}
+
+func TestParseScrubOptions(t *testing.T) {
+	for query, want := range map[string]ScrubOptions{
+		"":                      {},
+		"scrub=words":           {Words: true},
+		"scrub=pii,text":        {PII: true, DropText: true},
+		"scrub=words,%20pii%20": {Words: true, PII: true},
+	} {
+		got, err := ParseScrubOptions(httptest.NewRequest("GET", "/?"+query, nil))
+		if err != nil || got != want {
+			t.Errorf("%q = %+v, %v, want %+v", query, got, err, want)
+		}
+	}
+	if _, err := ParseScrubOptions(httptest.NewRequest("GET", "/?scrub=pii,faces", nil)); err == nil {
+		t.Error("unknown filter accepted")
+	}
+}
+
+func TestExportsApplyScrub(t *testing.T) {
+	rooms, rm := fixtureRoom(t)
+	e := NewExporter(rooms, tokens{"alice-token": "alice"}, testScrubber(t))
+	mux := http.NewServeMux()
+	mux.Handle("GET /rooms/{code}/export", e.JSONHandler())
+	mux.Handle("GET /rooms/{code}/export.svg", e.SVGHandler())
+	mux.Handle("GET /api/rooms/{code}/thumbnail.png", e.ThumbnailHandler())
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer alice-token")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/rooms/" + rm.Code + "/export?scrub=pii,words")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("JSON export: %d %s", rec.Code, rec.Body)
+	}
+	var doc struct {
+		room.Board
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := textOf(&doc.Board, "t1"); text != "Mail [email] or call [phone], **** it" {
+		t.Errorf("JSON export text = %q", text)
+	}
+
+	rec = get("/rooms/" + rm.Code + "/export.svg?scrub=pii")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("SVG export: %d %s", rec.Code, rec.Body)
+	}
+	if svg := rec.Body.String(); strings.Contains(svg, "bob@example.com") || !strings.Contains(svg, "[email]") {
+		t.Errorf("SVG export not scrubbed: %s", svg)
+	}
+
+	for _, path := range []string{"/export", "/export.svg"} {
+		if rec := get("/rooms/" + rm.Code + path + "?scrub=faces"); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s with an unknown filter: %d, want 400", path, rec.Code)
+		}
+	}
+	if rec := get("/api/rooms/" + rm.Code + "/thumbnail.png?scrub=faces"); rec.Code != http.StatusBadRequest {
+		t.Errorf("thumbnail with an unknown filter: %d, want 400", rec.Code)
+	}
+}
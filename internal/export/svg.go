@@ -0,0 +1,231 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"main/internal/logging"
+	"main/internal/object"
+	"main/internal/room"
+)
+
+const (
+	svgPadding      = 20 // around the drawings' bounding box
+	defaultColor    = "#000000"
+	defaultWidth    = 2
+	defaultFontSize = 16
+)
+
+var (
+	errUnsupportedType = errors.New("unsupported type")
+	errTooFewPoints    = errors.New("stroke needs at least 2 points")
+)
+
+// SVGHandler: GET /rooms/{code}/export.svg downloads a page of the room as a
+// static SVG (first page unless ?page=<pageId>)
+func (e *Exporter) SVGHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rm, opts, ok := e.prepare(w, r)
+		if !ok {
+			return
+		}
+
+		board := e.board(rm, opts)
+		pageID := r.URL.Query().Get("page")
+		if pageID == "" {
+			pageID = board.Pages[0].ID
+		}
+
+		var buf bytes.Buffer
+		if err := WriteSVG(&buf, board, pageID, e.fonts); err != nil {
+			slog.Error("SVG export failed", logging.KeyRoom, rm.Code, "err", err)
+			http.Error(w, "Export failed", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Header().Set("Content-Disposition", attachment(rm.Code, "svg"))
+		w.Write(buf.Bytes())
+	})
+}
+
+// WriteSVG: renders the page's drawings (in board order, i.e. by zIndex) as an
+// SVG document sized to their bounding box
+// Unknown or malformed drawings are skipped and logged, text fonts outside the
+// font policy (stored before it changed) are rendered with its default family
+func WriteSVG(w io.Writer, board *room.Board, pageID string, fonts object.FontPolicy) error {
+	var elements []string
+	bounds := object.Bounds{MinX: math.Inf(1), MinY: math.Inf(1), MaxX: math.Inf(-1), MaxY: math.Inf(-1)}
+
+	for _, obj := range board.Objects {
+		if obj.PageID != pageID {
+			continue
+		}
+		element, b, err := renderSVG(obj, fonts)
+		if err != nil {
+			slog.Warn("SVG export: skipping object", "object_type", obj.Type, "object_id", obj.ID, "err", err)
+			continue
+		}
+		elements = append(elements, element)
+		bounds.MinX, bounds.MaxX = math.Min(bounds.MinX, b.MinX), math.Max(bounds.MaxX, b.MaxX)
+		bounds.MinY, bounds.MaxY = math.Min(bounds.MinY, b.MinY), math.Max(bounds.MaxY, b.MaxY)
+	}
+
+	// Empty page still produces a valid (blank) document
+	if len(elements) == 0 {
+		bounds = object.Bounds{}
+	}
+	x, y := bounds.MinX-svgPadding, bounds.MinY-svgPadding
+	width, height := bounds.MaxX-bounds.MinX+2*svgPadding, bounds.MaxY-bounds.MinY+2*svgPadding
+
+	if _, err := fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="%s %s %s %s">`+"\n",
+		num(width), num(height), num(x), num(y), num(width), num(height)); err != nil {
+		return err
+	}
+	for _, element := range elements {
+		if _, err := io.WriteString(w, element+"\n"); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "</svg>\n")
+	return err
+}
+
+// renderSVG: SVG element for a drawing and the area it covers
+func renderSVG(obj *object.Drawing, fonts object.FontPolicy) (string, object.Bounds, error) {
+	switch obj.Type {
+	case "rectangle":
+		var d object.RectangleData
+		if err := decode(obj.Data, &d); err != nil {
+			return "", object.Bounds{}, err
+		}
+		b := boxBounds(d.LineCoordinates, d.Width)
+		return fmt.Sprintf(`<rect x="%s" y="%s" width="%s" height="%s" fill="%s" stroke="%s" stroke-width="%s"/>`,
+			num(math.Min(d.X1, d.X2)), num(math.Min(d.Y1, d.Y2)), num(math.Abs(d.X2-d.X1)), num(math.Abs(d.Y2-d.Y1)),
+			attr(d.Fill, "none"), attr(d.Color, defaultColor), num(strokeWidth(d.Width))), b, nil
+
+	case "circle":
+		// Ellipse inscribed in the x1/y1-x2/y2 box
+		var d object.CircleData
+		if err := decode(obj.Data, &d); err != nil {
+			return "", object.Bounds{}, err
+		}
+		b := boxBounds(d.LineCoordinates, d.Width)
+		return fmt.Sprintf(`<ellipse cx="%s" cy="%s" rx="%s" ry="%s" fill="%s" stroke="%s" stroke-width="%s"/>`,
+			num((d.X1+d.X2)/2), num((d.Y1+d.Y2)/2), num(math.Abs(d.X2-d.X1)/2), num(math.Abs(d.Y2-d.Y1)/2),
+			attr(d.Fill, "none"), attr(d.Color, defaultColor), num(strokeWidth(d.Width))), b, nil
+
+	case "line":
+		var d object.LineData
+		if err := decode(obj.Data, &d); err != nil {
+			return "", object.Bounds{}, err
+		}
+		b := boxBounds(d.LineCoordinates, d.Width)
+		return fmt.Sprintf(`<line x1="%s" y1="%s" x2="%s" y2="%s" stroke="%s" stroke-width="%s" stroke-linecap="round"/>`,
+			num(d.X1), num(d.Y1), num(d.X2), num(d.Y2), attr(d.Color, defaultColor), num(strokeWidth(d.Width))), b, nil
+
+	case "stroke":
+		var d object.StrokeData
+		if err := decode(obj.Data, &d); err != nil {
+			return "", object.Bounds{}, err
+		}
+		if len(d.Points) < 2 {
+			return "", object.Bounds{}, errTooFewPoints
+		}
+		points := make([]string, len(d.Points))
+		for i, p := range d.Points {
+			points[i] = num(p.X) + "," + num(p.Y)
+		}
+		b, _ := object.BoundingBox(obj.Data)
+		return fmt.Sprintf(`<polyline points="%s" fill="none" stroke="%s" stroke-width="%s" stroke-linecap="round" stroke-linejoin="round"/>`,
+			strings.Join(points, " "), attr(d.Color, defaultColor), num(strokeWidth(d.Width))), pad(b, strokeWidth(d.Width)/2), nil
+
+	case "text":
+		var d object.TextData
+		if err := decode(obj.Data, &d); err != nil {
+			return "", object.Bounds{}, err
+		}
+		size := d.FontSize
+		if size == 0 {
+			size = defaultFontSize
+		}
+		style := ""
+		if d.Bold {
+			style += ` font-weight="bold"`
+		}
+		if d.Italic {
+			style += ` font-style="italic"`
+		}
+		if family := fonts.Resolve(d.FontFamily); d.FontFamily != "" && family != "" {
+			style += fmt.Sprintf(` font-family="%s"`, attr(family, ""))
+		}
+		return fmt.Sprintf(`<text x="%s" y="%s" font-size="%s" fill="%s"%s>%s</text>`,
+			num(d.X), num(d.Y), num(size), attr(d.Color, defaultColor), style, escape(d.Text)), textBounds(d, size), nil
+
+	default:
+		return "", object.Bounds{}, errUnsupportedType
+	}
+}
+
+// decode: converts stored object data into its schema struct
+func decode(data map[string]interface{}, schema interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, schema)
+}
+
+// boxBounds: bounds of an x1/y1-x2/y2 shape including half its stroke
+func boxBounds(c object.LineCoordinates, width float64) object.Bounds {
+	b := object.Bounds{
+		MinX: math.Min(c.X1, c.X2), MinY: math.Min(c.Y1, c.Y2),
+		MaxX: math.Max(c.X1, c.X2), MaxY: math.Max(c.Y1, c.Y2),
+	}
+	return pad(b, strokeWidth(width)/2)
+}
+
+// textBounds: estimated, the server doesn't know the font metrics
+func textBounds(d object.TextData, size float64) object.Bounds {
+	return object.Bounds{MinX: d.X, MinY: d.Y - size, MaxX: d.X + float64(len([]rune(d.Text)))*size*0.6, MaxY: d.Y + size*0.25}
+}
+
+func pad(b object.Bounds, by float64) object.Bounds {
+	return object.Bounds{MinX: b.MinX - by, MinY: b.MinY - by, MaxX: b.MaxX + by, MaxY: b.MaxY + by}
+}
+
+func strokeWidth(width float64) float64 {
+	if width == 0 {
+		return defaultWidth
+	}
+	return width
+}
+
+// attr: XML-escaped attribute value, fallback when empty
+func attr(value string, fallback string) string {
+	if value == "" {
+		value = fallback
+	}
+	return escape(value)
+}
+
+func escape(value string) string {
+	var buf strings.Builder
+	xml.EscapeText(&buf, []byte(value))
+	return buf.String()
+}
+
+// num: coordinate rounded to 2 decimals (plenty for screen units)
+func num(f float64) string {
+	return strconv.FormatFloat(math.Round(f*100)/100, 'f', -1, 64)
+}
@@ -0,0 +1,140 @@
+package export
+
+import (
+	"container/list"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"main/internal/logging"
+)
+
+// Thumbnail limits
+const (
+	defaultThumbnailSize = 256
+	minThumbnailSize     = 16
+	maxThumbnailSize     = 512
+	maxCachedThumbnails  = 256
+	maxCachedBytes       = 16 * 1024 * 1024
+)
+
+// ThumbnailHandler: GET /api/rooms/{code}/thumbnail.png?size=256 serves a low
+// detail preview of the room's first page, cached until the board changes
+func (e *Exporter) ThumbnailHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rm, opts, ok := e.prepare(w, r)
+		if !ok {
+			return
+		}
+
+		size := defaultThumbnailSize
+		if value := r.URL.Query().Get("size"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < minThumbnailSize || parsed > maxThumbnailSize {
+				http.Error(w, fmt.Sprintf("size must be %d-%d", minThumbnailSize, maxThumbnailSize), http.StatusBadRequest)
+				return
+			}
+			size = parsed
+		}
+
+		// Revision is read before exporting, so a cached image is never older
+		// than the revision it's stored under
+		key := rm.Code + "/" + strconv.Itoa(size) + "/" + opts.Key()
+		revision := rm.Revision()
+		etag := fmt.Sprintf(`"%s-%d"`, key, revision)
+
+		image, cached := e.thumbnails.get(key, revision)
+		if !cached {
+			board := e.board(rm, opts)
+			rendered, err := RenderPreview(board, board.Pages[0].ID, size)
+			if err != nil {
+				slog.Error("Thumbnail failed", logging.KeyRoom, rm.Code, "err", err)
+				http.Error(w, "Thumbnail failed", http.StatusInternalServerError)
+				return
+			}
+			image = rendered
+			e.thumbnails.put(key, revision, image)
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "private, no-cache")
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write(image)
+	})
+}
+
+// thumbnailCache: LRU of rendered previews bounded by count and bytes
+// An entry is valid only for the room revision it was rendered at
+type thumbnailCache struct {
+	entries    map[string]*list.Element
+	order      *list.List // front = most recently used
+	bytes      int
+	maxEntries int
+	maxBytes   int
+	mu         sync.Mutex
+}
+
+type thumbnailEntry struct {
+	key      string
+	revision uint64
+	image    []byte
+}
+
+func newThumbnailCache(maxEntries int, maxBytes int) *thumbnailCache {
+	return &thumbnailCache{
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+	}
+}
+
+// get: cached image for key, a stale revision is dropped
+func (c *thumbnailCache) get(key string, revision uint64) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, exists := c.entries[key]
+	if !exists {
+		return nil, false
+	}
+	entry := element.Value.(*thumbnailEntry)
+	if entry.revision != revision {
+		c.remove(element)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry.image, true
+}
+
+// put: stores an image, evicting least recently used entries over the limits
+func (c *thumbnailCache) put(key string, revision uint64, image []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, exists := c.entries[key]; exists {
+		c.remove(element)
+	}
+	if len(image) > c.maxBytes {
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&thumbnailEntry{key: key, revision: revision, image: image})
+	c.bytes += len(image)
+	for len(c.entries) > c.maxEntries || c.bytes > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+}
+
+// remove: caller must hold lock
+func (c *thumbnailCache) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*thumbnailEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= len(entry.image)
+}
@@ -0,0 +1,115 @@
+package frontend
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Mode: how the backend serves the frontend at "/"
+type Mode string
+
+const (
+	ModeOff      Mode = "off"      // API only, "/" returns a JSON service descriptor
+	ModeDir      Mode = "dir"      // serve static files with SPA fallback to index.html
+	ModeRedirect Mode = "redirect" // redirect to an externally hosted frontend (CDN)
+)
+
+// Valid: one of the modes above
+func (m Mode) Valid() bool {
+	switch m {
+	case ModeOff, ModeDir, ModeRedirect:
+		return true
+	}
+	return false
+}
+
+// Config: frontend serving configuration
+type Config struct {
+	BasePath    string // prefix the service is mounted under (already stripped from requests)
+	Mode        Mode
+	Dir         string // ModeDir: directory to serve
+	RedirectURL string // ModeRedirect: frontend base URL
+}
+
+// Handler: returns the handler to mount at "/"
+// Paths under /api/ never fall through to the frontend (404 instead)
+func Handler(cfg Config) http.Handler {
+	var h http.Handler
+	switch cfg.Mode {
+	case ModeOff:
+		h = descriptorHandler(cfg.BasePath)
+	case ModeRedirect:
+		h = redirectHandler(cfg.RedirectURL)
+	default: // ModeDir, an unknown mode is refused at startup (see Valid)
+		h = dirHandler(cfg.Dir)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			http.NotFound(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// descriptorHandler: small JSON description of the service at "/"
+func descriptorHandler(basePath string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"service":   "whiteboard-backend",
+			"websocket": basePath + "/ws",
+		})
+	})
+}
+
+// redirectHandler: sends every path to the same path on the frontend URL
+func redirectHandler(baseURL string) http.Handler {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := baseURL + r.URL.Path
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusFound)
+	})
+}
+
+// dirHandler: static files with cache headers, unknown routes fall back to index.html
+func dirHandler(dir string) http.Handler {
+	fileServer := http.FileServer(http.Dir(dir))
+	index := filepath.Join(dir, "index.html")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clean := path.Clean("/" + r.URL.Path)
+		fullPath := filepath.Join(dir, filepath.FromSlash(clean))
+
+		if _, err := os.Stat(fullPath); err != nil {
+			// Missing asset files are real 404s, extensionless paths are SPA routes
+			if path.Ext(clean) != "" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Cache-Control", "no-cache")
+			http.ServeFile(w, r, index)
+			return
+		}
+
+		if clean == "/" || strings.HasSuffix(clean, ".html") {
+			w.Header().Set("Cache-Control", "no-cache")
+		} else {
+			w.Header().Set("Cache-Control", "public, max-age=3600")
+		}
+		fileServer.ServeHTTP(w, r)
+	})
+}
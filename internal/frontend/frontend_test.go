@@ -0,0 +1,106 @@
+package frontend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testMux: the frontend at "/" next to the routes main registers beside it
+func testMux(cfg Config) *http.ServeMux {
+	ok := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Route", name)
+		})
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", Handler(cfg))
+	mux.Handle("/ws", ok("ws"))
+	mux.Handle("/api/stats", ok("stats"))
+	mux.Handle("GET /api/protocol", ok("protocol"))
+	mux.Handle("/metrics", ok("metrics"))
+	return mux
+}
+
+func testConfigs(t *testing.T) []Config {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html></html>"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return []Config{
+		{Mode: ModeOff, BasePath: "/wb"},
+		{Mode: ModeDir, Dir: dir},
+		{Mode: ModeRedirect, RedirectURL: "https://cdn.example.com/"},
+	}
+}
+
+func TestServerRoutesReachableInEveryMode(t *testing.T) {
+	routes := map[string]string{
+		"/ws":           "ws",
+		"/api/stats":    "stats",
+		"/api/protocol": "protocol",
+		"/metrics":      "metrics",
+	}
+	for _, cfg := range testConfigs(t) {
+		mux := testMux(cfg)
+		for path, want := range routes {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			if got := rec.Header().Get("X-Route"); got != want {
+				t.Errorf("%s: GET %s served by %q (status %d), want %q", cfg.Mode, path, got, rec.Code, want)
+			}
+		}
+	}
+}
+
+func TestUnknownAPIPathsNeverReachFrontend(t *testing.T) {
+	for _, cfg := range testConfigs(t) {
+		rec := httptest.NewRecorder()
+		testMux(cfg).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/missing", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: GET /api/missing = %d, want 404", cfg.Mode, rec.Code)
+		}
+	}
+}
+
+func TestHandlerModes(t *testing.T) {
+	configs := testConfigs(t)
+
+	rec := httptest.NewRecorder()
+	Handler(configs[0]).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if ct := rec.Header().Get("Content-Type"); rec.Code != http.StatusOK || ct != "application/json" {
+		t.Errorf("off: GET / = %d %q, want 200 JSON descriptor", rec.Code, ct)
+	}
+
+	rec = httptest.NewRecorder()
+	Handler(configs[1]).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/boards/abc", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("dir: SPA route = %d %q, want index.html without caching", rec.Code, rec.Header().Get("Cache-Control"))
+	}
+	rec = httptest.NewRecorder()
+	Handler(configs[1]).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing.js", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("dir: missing asset = %d, want 404", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	Handler(configs[2]).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/boards/abc?x=1", nil))
+	if loc := rec.Header().Get("Location"); rec.Code != http.StatusFound || loc != "https://cdn.example.com/boards/abc?x=1" {
+		t.Errorf("redirect: = %d %q", rec.Code, loc)
+	}
+}
+
+func TestModeValid(t *testing.T) {
+	for _, m := range []Mode{ModeOff, ModeDir, ModeRedirect} {
+		if !m.Valid() {
+			t.Errorf("%q not valid", m)
+		}
+	}
+	for _, m := range []Mode{"", "static", "DIR"} {
+		if m.Valid() {
+			t.Errorf("%q valid, want refused at startup", m)
+		}
+	}
+}
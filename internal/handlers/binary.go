@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Binary frames start with a type byte, the rest is the type's fixed layout
+// (little endian). Only connections that negotiated the binary subprotocol
+// may send them, everything else stays JSON
+const (
+	// BinaryCursor: compact cursor, float32 x then float32 y
+	BinaryCursor byte = 0x01
+
+	compactCursorSize = 1 + 4 + 4
+)
+
+// decodeBinary: the JSON message equivalent to a binary frame
+func decodeBinary(frame []byte) (map[string]interface{}, error) {
+	if len(frame) == 0 {
+		return nil, NewError(CodeInvalidMessage, "empty binary frame")
+	}
+
+	switch frame[0] {
+	case BinaryCursor:
+		if len(frame) != compactCursorSize {
+			return nil, NewError(CodeInvalidMessage, "compact cursor must be %d bytes, got %d", compactCursorSize, len(frame))
+		}
+		x := math.Float32frombits(binary.LittleEndian.Uint32(frame[1:5]))
+		y := math.Float32frombits(binary.LittleEndian.Uint32(frame[5:9]))
+		if !isFinite(x) || !isFinite(y) {
+			return nil, NewError(CodeInvalidMessage, "compact cursor position must be finite")
+		}
+		return map[string]interface{}{"type": "cursor", "x": float64(x), "y": float64(y)}, nil
+	default:
+		return nil, NewError(CodeUnknownType, "unknown binary frame type: 0x%02x", frame[0])
+	}
+}
+
+func isFinite(f float32) bool {
+	return !math.IsNaN(float64(f)) && !math.IsInf(float64(f), 0)
+}
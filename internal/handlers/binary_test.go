@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// compactCursor: a BinaryCursor frame for x, y
+func compactCursor(x, y float32) []byte {
+	frame := make([]byte, compactCursorSize)
+	frame[0] = BinaryCursor
+	binary.LittleEndian.PutUint32(frame[1:5], math.Float32bits(x))
+	binary.LittleEndian.PutUint32(frame[5:9], math.Float32bits(y))
+	return frame
+}
+
+func TestDecodeBinary(t *testing.T) {
+	data, err := decodeBinary(compactCursor(12.5, -3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["type"] != "cursor" || data["x"] != 12.5 || data["y"] != -3.0 {
+		t.Errorf("decoded %v, want a cursor at 12.5, -3", data)
+	}
+
+	for name, tc := range map[string]struct {
+		frame []byte
+		code  string
+	}{
+		"empty":        {nil, CodeInvalidMessage},
+		"unknown type": {[]byte{0x7f, 1, 2}, CodeUnknownType},
+		"short cursor": {compactCursor(1, 1)[:5], CodeInvalidMessage},
+		"long cursor":  {append(compactCursor(1, 1), 0), CodeInvalidMessage},
+		"nan":          {compactCursor(float32(math.NaN()), 1), CodeInvalidMessage},
+		"inf":          {compactCursor(1, float32(math.Inf(1))), CodeInvalidMessage},
+	} {
+		_, err := decodeBinary(tc.frame)
+		var msgErr *MessageError
+		if !errors.As(err, &msgErr) || msgErr.Code != tc.code {
+			t.Errorf("%s: err = %v, want code %s", name, err, tc.code)
+		}
+	}
+}
+
+func TestRouteBinaryCursorLikeJSON(t *testing.T) {
+	s := newTestServer(t)
+	alice, bob := s.join("alice"), s.join("bob")
+	s.router.Joined(s.room, alice.user)
+
+	if err := s.router.RouteBinary(t.Context(), s.room, alice.user, compactCursor(4, 8)); err != nil {
+		t.Fatal(err)
+	}
+	cursors := bob.next("cursors")["cursors"].([]interface{})
+	cursor := cursors[0].(map[string]interface{})
+	if cursor["userId"] != alice.user.ID || cursor["x"] != 4.0 || cursor["y"] != 8.0 {
+		t.Errorf("cursor = %v, want alice's at 4, 8", cursor)
+	}
+
+	// it draws from the cursor budget, like a JSON cursor
+	alice.user.CursorRateLimiter = rate.NewLimiter(0.01, 5)
+	if err := s.router.RouteBinary(t.Context(), s.room, alice.user, compactCursor(5, 8)); err != nil {
+		t.Fatal(err)
+	}
+	if tokens := alice.user.RateStatus()["cursor"].Tokens; tokens != 4 {
+		t.Errorf("cursor budget = %v, want 4", tokens)
+	}
+}
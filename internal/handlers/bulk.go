@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"main/internal/object"
+	"main/internal/room"
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxAddBatch: max objects per objectsAdded message
+const maxAddBatch = 500
+
+// HandleBulkAdded: objectsAdded messages, adds a batch atomically with one broadcast
+// Any invalid object rejects the whole batch (error reply carries its index)
+func (h *ObjectHandler) HandleBulkAdded(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	if rm.IsFrozen() {
+		return sendError(u, CodeBoardFrozen, nil)
+	}
+
+	items, ok := data["objects"].([]interface{})
+	if !ok || len(items) == 0 {
+		return fmt.Errorf("missing objects array")
+	}
+	if len(items) > maxAddBatch {
+		return sendError(u, CodeBatchTooLarge, map[string]interface{}{"max": maxAddBatch})
+	}
+	if rm.ObjectCount()+len(items) > h.config.MaxObjects {
+		return sendError(u, CodeObjectLimit, map[string]interface{}{"reason": "room at maximum object capacity"})
+	}
+
+	objs := make([]*object.Drawing, 0, len(items))
+	onTop := make([]bool, 0, len(items))
+	seen := make(map[string]bool, len(items))
+	for i, item := range items {
+		objectMsg, ok := item.(map[string]interface{})
+		if !ok {
+			return rejectBatch(u, i, fmt.Errorf("missing object data"))
+		}
+
+		obj, hasZIndex, err := h.parseObject(ctx, objectMsg)
+		if err != nil {
+			return rejectBatch(u, i, err)
+		}
+		if seen[obj.ID] {
+			return rejectBatch(u, i, fmt.Errorf("duplicate object id: %s", obj.ID))
+		}
+		seen[obj.ID] = true
+		if revive, _ := objectMsg["revive"].(bool); !revive && rm.IsDeleted(obj.ID) {
+			return rejectBatch(u, i, fmt.Errorf("object was deleted: %s", obj.ID))
+		}
+
+		obj.UserID = u.ID
+		objs = append(objs, obj)
+		onTop = append(onTop, !hasZIndex)
+	}
+
+	err := rm.AddObjects(objs, onTop)
+	if errors.Is(err, room.ErrObjectExists) {
+		return sendError(u, CodeObjectExists, map[string]interface{}{"reason": err.Error()})
+	}
+	if err != nil {
+		return sendError(u, CodeInvalidBatch, map[string]interface{}{"reason": err.Error()})
+	}
+
+	added := make([]map[string]interface{}, 0, len(objs))
+	assigned := make([]map[string]interface{}, 0)
+	for i, obj := range objs {
+		entry := map[string]interface{}{
+			"id":     obj.ID,
+			"type":   obj.Type,
+			"data":   obj.Data,
+			"zIndex": obj.ZIndex,
+			"pageId": obj.PageID,
+		}
+		if obj.Provisional {
+			entry["provisional"] = true
+		}
+		added = append(added, entry)
+		if onTop[i] {
+			assigned = append(assigned, map[string]interface{}{"objectId": obj.ID, "zIndex": obj.ZIndex})
+		}
+	}
+
+	msg, err := json.Marshal(map[string]interface{}{
+		"type":     "objectsAdded",
+		"objects":  added,
+		"userId":   u.ID,
+		"revision": rm.Revision(),
+	})
+	if err != nil {
+		return fmt.Errorf("marshal broadcast message: %w", err)
+	}
+	h.broadcaster.Broadcast(ctx, rm, msg, u.Connection, room.TagObject)
+
+	// Sender doesn't receive the broadcast, ack so it learns assigned zIndexes
+	ack, err := json.Marshal(map[string]interface{}{
+		"type":    "objectsAck",
+		"count":   len(objs),
+		"objects": assigned,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal objects ack: %w", err)
+	}
+	return u.WriteMessage(websocket.TextMessage, ack)
+}
+
+// rejectBatch: reports the first invalid object of a batch to the sender
+func rejectBatch(u *user.User, index int, err error) error {
+	return sendError(u, CodeInvalidBatch, map[string]interface{}{
+		"index":  index,
+		"reason": err.Error(),
+	})
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"main/internal/object"
+	"main/internal/room"
+	"main/internal/user"
+)
+
+// maxChatLength: characters in a chat message (before sanitizing)
+const maxChatLength = 500
+
+// ChatHandler: room chat, kept next to the board
+type ChatHandler struct {
+	validator   *object.Validator
+	broadcaster *room.Broadcaster
+}
+
+func NewChatHandler(validator *object.Validator, broadcaster *room.Broadcaster) *ChatHandler {
+	return &ChatHandler{
+		validator:   validator,
+		broadcaster: broadcaster,
+	}
+}
+
+// Handle: chat messages, {text}. Broadcast to everyone including the sender,
+// who gets the server's timestamp that way
+func (h *ChatHandler) Handle(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	text, ok := data["text"].(string)
+	if !ok {
+		return fmt.Errorf("missing chat text")
+	}
+	if utf8.RuneCountInString(text) > maxChatLength {
+		return NewError(CodeInvalidMessage, "chat message longer than %d characters", maxChatLength)
+	}
+
+	text = strings.TrimSpace(h.validator.SanitizeString(text))
+	if text == "" {
+		return NewError(CodeInvalidMessage, "empty chat message")
+	}
+
+	chat := rm.AddChat(room.ChatMessage{
+		UserID:     u.ID,
+		Text:       text,
+		ServerTime: time.Now().UnixMilli(),
+	})
+
+	msg, err := json.Marshal(struct {
+		Type string `json:"type"`
+		room.ChatMessage
+	}{Type: "chat", ChatMessage: chat})
+	if err != nil {
+		return fmt.Errorf("marshal chat message: %w", err)
+	}
+	h.broadcaster.Broadcast(ctx, rm, msg, nil, room.TagRoom)
+	return nil
+}
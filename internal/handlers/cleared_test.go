@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// skip: moves the clock by d, for code that reads it without waiting on it
+func (c *fakeClock) skip(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// drawStrokes: c adds n strokes, waiting for each ack
+func drawStrokes(t *testing.T, s *testServer, c *testClient, prefix string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := s.send(c, stroke(fmt.Sprintf("%s%d", prefix, i), nil)); err != nil {
+			t.Fatal(err)
+		}
+		c.next("objectAck")
+	}
+}
+
+func TestRestoreLastClearResyncsEveryone(t *testing.T) {
+	s, _ := timedServer(t)
+	alice, bob := s.join("alice"), s.join("bob")
+	drawStrokes(t, s, alice, "s", 3)
+
+	if err := s.send(alice, map[string]interface{}{"type": "clearBoard"}); err != nil {
+		t.Fatal(err)
+	}
+	bob.next("boardCleared")
+
+	// bob neither cleared nor hosts
+	reply := s.reject(bob, map[string]interface{}{"type": "restoreLastClear"}, CodeForbidden)
+	if reply["messageType"] != "restoreLastClear" {
+		t.Errorf("forbidden reply = %v", reply)
+	}
+
+	if err := s.send(alice, map[string]interface{}{"type": "restoreLastClear"}); err != nil {
+		t.Fatal(err)
+	}
+	restored := bob.next("clearRestored")
+	if restored["action"] != "clearBoard" || restored["restored"] != 3.0 || restored["userId"] != alice.user.ID {
+		t.Errorf("clearRestored = %v", restored)
+	}
+	if objects := bob.next("sync")["objects"]; len(objects.([]interface{})) != 3 {
+		t.Errorf("resync has %d objects, want 3", len(objects.([]interface{})))
+	}
+
+	s.reject(alice, map[string]interface{}{"type": "restoreLastClear"}, CodeNothingToUndo)
+}
+
+func TestRestorePurgeByItsAuthor(t *testing.T) {
+	s, _ := timedServer(t)
+	s.join("alice")
+	bob := s.join("bob")
+	drawStrokes(t, s, bob, "b", 2)
+
+	if err := s.send(bob, map[string]interface{}{"type": "deleteMyObjects", "objectIds": []string{"b0", "b1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if s.room.ObjectCount() != 0 {
+		t.Fatal("purge left drawings")
+	}
+	if err := s.send(bob, map[string]interface{}{"type": "restoreLastClear"}); err != nil {
+		t.Fatal(err)
+	}
+	if restored := bob.next("clearRestored"); restored["action"] != "deleteMyObjects" {
+		t.Errorf("clearRestored = %v", restored)
+	}
+	if s.room.ObjectCount() != 2 {
+		t.Errorf("%d drawings after restore, want 2", s.room.ObjectCount())
+	}
+}
+
+func TestRestoreWindowExpires(t *testing.T) {
+	s, clock := timedServer(t)
+	alice := s.join("alice")
+	drawStrokes(t, s, alice, "s", 2)
+	if err := s.send(alice, map[string]interface{}{"type": "clearBoard"}); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.skip(s.config.ClearRestoreWindow + time.Second)
+	s.reject(alice, map[string]interface{}{"type": "restoreLastClear"}, CodeNothingToUndo)
+	if s.room.ObjectCount() != 0 {
+		t.Error("clear restored after its window")
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxClockSkew: corrected client timestamps further than this from server time are distrusted
+const maxClockSkew = 30 * time.Second
+
+// ClockHandler: estimates client clock offsets and corrects client timestamps
+// Offsets are per connection, each device has its own clock
+type ClockHandler struct {
+	now func() time.Time // server clock, replaced in tests
+}
+
+func NewClockHandler() *ClockHandler {
+	return &ClockHandler{now: time.Now}
+}
+
+// HandleTimeSync: timeSync messages, records an offset sample and echoes server time
+// Client sends {clientTime} in ms since epoch. The message took about half the
+// connection's ping round trip to arrive, so the client's clock read clientTime
+// at now - RTT/2 (just now until the first pong measures it)
+func (h *ClockHandler) HandleTimeSync(u *user.User, data map[string]interface{}) error {
+	clientTime, ok := data["clientTime"].(float64)
+	if !ok {
+		return fmt.Errorf("missing or invalid clientTime")
+	}
+
+	now := h.now()
+	sent := now.Add(-u.RTT() / 2)
+	u.AddClockSample(sent.Sub(time.UnixMilli(int64(clientTime))))
+
+	response := map[string]interface{}{
+		"type":       "timeSync",
+		"clientTime": clientTime,
+		"serverTime": now.UnixMilli(),
+	}
+
+	msg, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("marshal time sync response: %w", err)
+	}
+	return u.WriteMessage(websocket.TextMessage, msg)
+}
+
+// StampTime: corrects a client "timestamp" (ms) using the connection's offset and adds "serverTime"
+// Timestamps still too far from server time after correction are replaced and flagged
+func (h *ClockHandler) StampTime(u *user.User, data map[string]interface{}) {
+	clientTimestamp, ok := data["timestamp"].(float64)
+	if !ok {
+		return
+	}
+
+	now := h.now().UnixMilli()
+	offset, _ := u.ClockOffset()
+	corrected := int64(clientTimestamp) + offset.Milliseconds()
+
+	skewed := math.Abs(float64(corrected-now)) > float64(maxClockSkew.Milliseconds())
+	if skewed {
+		corrected = now
+	}
+
+	data["clockSkewed"] = skewed // overwrites whatever the client claimed
+	data["timestamp"] = corrected
+	data["serverTime"] = now
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock: a server clock that only moves when told to, also a room.Clock
+// for timers
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// advance: moves the clock by d in steps of step, after each one waiting for
+// a timer to be waiting again, so every tick in between fires
+func (c *fakeClock) advance(t *testing.T, d time.Duration, step time.Duration) {
+	t.Helper()
+	for moved := time.Duration(0); moved < d; moved += step {
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			c.mu.Lock()
+			n := len(c.waiters)
+			c.mu.Unlock()
+			if n > 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("nothing waiting on the clock")
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		c.mu.Lock()
+		c.now = c.now.Add(step)
+		var pending []fakeWaiter
+		for _, w := range c.waiters {
+			if w.at.After(c.now) {
+				pending = append(pending, w)
+			} else {
+				w.ch <- c.now
+			}
+		}
+		c.waiters = pending
+		c.mu.Unlock()
+	}
+}
+
+func TestTimeSyncAccountsForRoundTrip(t *testing.T) {
+	s := newTestServer(t)
+	clock := &fakeClock{now: time.UnixMilli(1_700_000_000_000)}
+	s.router.clockHandler.now = clock.Now
+
+	alice := s.join("alice")
+	alice.user.RecordRTT(400 * time.Millisecond)
+
+	// Alice's clock is 10 minutes behind, her timeSync left 200ms (half the
+	// round trip) before the server read it
+	skew := -10 * time.Minute
+	sent := clock.now.Add(-200 * time.Millisecond).Add(skew)
+	if err := s.send(alice, map[string]interface{}{"type": "timeSync", "clientTime": sent.UnixMilli()}); err != nil {
+		t.Fatal(err)
+	}
+
+	offset, ok := alice.user.ClockOffset()
+	if !ok {
+		t.Fatal("no clock sample recorded")
+	}
+	if offset != -skew {
+		t.Errorf("offset = %v, want %v", offset, -skew)
+	}
+	reply := alice.next("timeSync")
+	if reply["serverTime"] != float64(clock.now.UnixMilli()) {
+		t.Errorf("serverTime = %v, want %d", reply["serverTime"], clock.now.UnixMilli())
+	}
+}
+
+func TestTimeSyncWithoutRoundTripYet(t *testing.T) {
+	s := newTestServer(t)
+	clock := &fakeClock{now: time.UnixMilli(1_700_000_000_000)}
+	s.router.clockHandler.now = clock.Now
+
+	alice := s.join("alice")
+	sent := clock.now.Add(-3 * time.Second)
+	if err := s.send(alice, map[string]interface{}{"type": "timeSync", "clientTime": sent.UnixMilli()}); err != nil {
+		t.Fatal(err)
+	}
+	if offset, _ := alice.user.ClockOffset(); offset != 3*time.Second {
+		t.Errorf("offset = %v, want 3s", offset)
+	}
+}
+
+func TestBroadcastsCarryCorrectedTimes(t *testing.T) {
+	s := newTestServer(t)
+	clock := &fakeClock{now: time.UnixMilli(1_700_000_000_000)}
+	s.router.clockHandler.now = clock.Now
+
+	alice := s.join("alice")
+	bob := s.join("bob")
+	alice.user.RecordRTT(100 * time.Millisecond)
+
+	skew := 10 * time.Minute // alice's clock runs ahead
+	sync := clock.now.Add(-50 * time.Millisecond).Add(skew)
+	if err := s.send(alice, map[string]interface{}{"type": "timeSync", "clientTime": sync.UnixMilli()}); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.now = clock.now.Add(time.Second)
+	drawn := clock.now.Add(-20 * time.Millisecond)
+	msg := map[string]interface{}{
+		"type":      "objectAdded",
+		"timestamp": drawn.Add(skew).UnixMilli(),
+		"object": map[string]interface{}{
+			"id":   "s1",
+			"type": "stroke",
+			"data": map[string]interface{}{
+				"points": []map[string]int{{"x": 1, "y": 1}, {"x": 5, "y": 5}},
+				"color":  "#000000",
+				"width":  2,
+			},
+		},
+	}
+	if err := s.send(alice, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	added := bob.next("objectAdded")
+	if added["timestamp"] != float64(drawn.UnixMilli()) {
+		t.Errorf("timestamp = %v, want %d (corrected)", added["timestamp"], drawn.UnixMilli())
+	}
+	if added["serverTime"] != float64(clock.now.UnixMilli()) {
+		t.Errorf("serverTime = %v, want %d", added["serverTime"], clock.now.UnixMilli())
+	}
+	if added["clockSkewed"] != nil {
+		t.Errorf("clockSkewed = %v, want unset after correction", added["clockSkewed"])
+	}
+}
+
+func TestUncorrectedSkewIsFlagged(t *testing.T) {
+	s := newTestServer(t)
+	clock := &fakeClock{now: time.UnixMilli(1_700_000_000_000)}
+	s.router.clockHandler.now = clock.Now
+
+	alice := s.join("alice")
+	data := map[string]interface{}{"timestamp": float64(clock.now.Add(-10 * time.Minute).UnixMilli())}
+	s.router.clockHandler.StampTime(alice.user, data)
+
+	if data["clockSkewed"] != true {
+		t.Error("10 minute skew without a timeSync not flagged")
+	}
+	if data["timestamp"] != clock.now.UnixMilli() {
+		t.Errorf("timestamp = %v, want server time %d", data["timestamp"], clock.now.UnixMilli())
+	}
+}
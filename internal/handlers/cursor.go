@@ -1,60 +1,77 @@
-package handlers 
+package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"time"
+	"log/slog"
 
+	"main/internal/logging"
 	"main/internal/room"
 	"main/internal/user"
 )
 
-
-// User session cursor functions
-type SessionProvider interface {
-	LastCursor(userID string) (time.Time, bool)
-	UpdateLastCursor(userID string, t time.Time)
-}
-
-
 // CursorHandler handles cursor position update messages
 type CursorHandler struct {
-	sessionMgr  SessionProvider
 	broadcaster *room.Broadcaster
 }
 
 // NewCursorHandler creates a new cursor handler with dependencies
-func NewCursorHandler(sessionMgr SessionProvider, broadcaster *room.Broadcaster) *CursorHandler {
+func NewCursorHandler(broadcaster *room.Broadcaster) *CursorHandler {
 	return &CursorHandler{
-		sessionMgr:  sessionMgr,
 		broadcaster: broadcaster,
 	}
 }
 
-// Handle processes cursor messages with server-side throttling
-func (h *CursorHandler) Handle(rm *room.Room, u *user.User, data map[string]interface{}) error {
-	now := time.Now()
-	lastCursorTime, exists := h.sessionMgr.LastCursor(u.ID)
-	if !exists {
-		return fmt.Errorf("session not found")
-	}
-
-	// Throttle cursor updates (~30fps)
-	if !lastCursorTime.IsZero() && now.Sub(lastCursorTime) < 33*time.Millisecond {
-		return nil // Ignore to throttle
+// Handle processes cursor messages, the position goes out with the room's next
+// cursor flush (positions in between become its trail)
+func (h *CursorHandler) Handle(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	x, okX := data["x"].(float64)
+	y, okY := data["y"].(float64)
+	if !okX || !okY {
+		return fmt.Errorf("missing or invalid cursor position")
 	}
 
-	h.sessionMgr.UpdateLastCursor(u.ID, now)
+	rm.MoveCursor(u.ID, x, y, stampedTime(data))
+	return nil
+}
 
-	// Get user's color from the room (room-specific color)
-	data["color"] = rm.GetUserColor(u.ID)
-	data["userId"] = u.ID
+// Start: starts the room's cursor flusher (no-op if it's running)
+func (h *CursorHandler) Start(rm *room.Room) {
+	rm.StartCursors(room.CursorInterval, func(ctx context.Context, moves []room.CursorMove) {
+		h.flush(ctx, rm, moves)
+	})
+}
 
-	msg, err := json.Marshal(data)
-	if err != nil {
-		return fmt.Errorf("marshal cursor message: %w", err)
+// flush: broadcasts moved cursors as one cursors message per page
+func (h *CursorHandler) flush(ctx context.Context, rm *room.Room, moves []room.CursorMove) {
+	pages := make(map[string]*CursorsEvent)
+	var order []string
+	for _, move := range moves {
+		event := pages[move.PageID]
+		if event == nil {
+			event = &CursorsEvent{Type: "cursors", PageID: move.PageID}
+			pages[move.PageID] = event
+			order = append(order, move.PageID)
+		}
+		stamp, _ := move.Meta.(eventTime)
+		event.Cursors = append(event.Cursors, CursorEntry{
+			UserID:    move.UserID,
+			X:         move.X,
+			Y:         move.Y,
+			Color:     move.Color,
+			Name:      move.Name,
+			Trail:     move.Trail,
+			eventTime: stamp,
+		})
 	}
 
-	h.broadcaster.Broadcast(rm, msg, u.Connection)
-	return nil
+	for _, pageID := range order {
+		msg, err := json.Marshal(pages[pageID])
+		if err != nil {
+			slog.Error("Marshal cursors failed", logging.KeyRoom, rm.Code, "err", err)
+			continue
+		}
+		h.broadcaster.Broadcast(ctx, rm, msg, nil, room.Tag{Category: room.CategoryCursor, PageID: pageID})
+	}
 }
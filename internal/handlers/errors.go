@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"main/internal/room"
+	"main/internal/user"
+)
+
+// Error codes clients can branch on ({"type":"error","code":...})
+const (
+	CodeRoomFull           = "room_full"                // no connection slot left in the room
+	CodeWrongPassword      = "wrong_password"           // room is protected, password missing or wrong
+	CodeObjectLimit        = "object_limit"             // room at maximum object capacity
+	CodePermissionDenied   = "permission_denied"        // drawing belongs to someone else
+	CodeForbidden          = "forbidden"                // the sender's role lacks the capability
+	CodeRateLimited        = "rate_limited"             // message dropped by a rate limiter
+	CodeValidationFailed   = "validation_failed"        // object data rejected by the schema
+	CodeUnknownType        = "unknown_type"             // message type the server doesn't handle
+	CodeInvalidMessage     = "invalid_message"          // anything else wrong with a message
+	CodeSignedInElsewhere  = room.CodeSignedInElsewhere // same session joined the room from another connection
+	CodeBoardFrozen        = "board_frozen"             // timer expired, the board is read-only
+	CodeObjectDeleted      = "object_deleted"           // update for a drawing deleted meanwhile
+	CodeObjectLocked       = "object_locked"            // drawing locked by another user (lockObject)
+	CodeTransformSkipped   = "transform_skipped"        // objectsTransformed left some drawings out
+	CodeSessionRevoked     = "session_revoked"          // session token revoked by another connection (revokeSession)
+	CodeTermsRequired      = "terms_required"           // the deployment's terms must be accepted first (acceptTerms)
+	CodeUnsafeLink         = "unsafe_link"              // link with a disallowed scheme
+	CodeLinkNotAllowed     = "link_not_allowed"         // link host denied by the link policy
+	CodeUnsafeImage        = "unsafe_image"             // image url not https, internal, or a data: URI not allowed
+	CodeBatchTooLarge      = "batch_too_large"          // objectsAdded over the batch limit
+	CodeInvalidBatch       = "invalid_batch"            // objectsAdded with an invalid drawing (none added)
+	CodeImportRejected     = "import_rejected"          // importObjects payload not accepted
+	CodeNothingToUndo      = "nothing_to_undo"          // undo / undoHostAction / restoreLastClear with nothing to restore
+	CodeNothingToRedo      = "nothing_to_redo"          // redo with nothing undone
+	CodeTimerActive        = "timer_active"             // startTimer while one is running
+	CodeNoTimer            = "no_timer"                 // cancelTimer without a timer
+	CodeInvalidPermissions = "invalid_permissions"      // setPermissions change not accepted
+	CodeInvalidLocale      = "invalid_locale"           // setRoomLocale with an unsupported locale
+	CodeMergeRejected      = "merge_rejected"           // mergeFrom not possible (unknown source, limits)
+	CodeKickRejected       = "kick_rejected"            // kickUser of yourself, the host, or someone not in the room
+	CodeObjectExists       = "object_exists"            // objectAdded/objectsAdded with the ID of a drawing already in the room
+)
+
+// ErrorCodes: every code above, for the protocol manifest
+var ErrorCodes = []string{
+	CodeRoomFull, CodeWrongPassword, CodeObjectLimit, CodePermissionDenied, CodeForbidden,
+	CodeRateLimited, CodeValidationFailed, CodeUnknownType, CodeInvalidMessage, CodeSignedInElsewhere,
+	CodeBoardFrozen, CodeObjectDeleted, CodeUnsafeLink, CodeLinkNotAllowed, CodeBatchTooLarge,
+	CodeInvalidBatch, CodeImportRejected, CodeNothingToUndo, CodeNothingToRedo, CodeTimerActive,
+	CodeNoTimer, CodeInvalidPermissions, CodeInvalidLocale, CodeMergeRejected, CodeObjectLocked,
+	CodeTransformSkipped, CodeSessionRevoked, CodeTermsRequired, CodeUnsafeImage, CodeKickRejected,
+	CodeObjectExists,
+}
+
+// MessageError: a rejected message, reported to its sender by ReplyError
+type MessageError struct {
+	Code    string
+	Message string
+	Ref     string // objectId the message referred to, if any
+	Err     error  // underlying error, if any
+}
+
+func (e *MessageError) Error() string {
+	if e.Err != nil {
+		return e.Code + ": " + e.Err.Error()
+	}
+	return e.Code + ": " + e.Message
+}
+
+func (e *MessageError) Unwrap() error {
+	return e.Err
+}
+
+// NewError: MessageError with a formatted message
+func NewError(code string, format string, args ...interface{}) *MessageError {
+	return &MessageError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// ReplyError: sends err to u as {"type":"error","code","message","detail","ref"}
+// Errors that aren't a MessageError are reported as invalid_message. message is
+// the localized text for the code, detail the (English) specifics for debugging
+func ReplyError(u *user.User, err error) error {
+	var msgErr *MessageError
+	if !errors.As(err, &msgErr) {
+		msgErr = &MessageError{Code: CodeInvalidMessage, Message: err.Error()}
+	}
+
+	details := map[string]interface{}{"detail": msgErr.Message}
+	if msgErr.Ref != "" {
+		details["ref"] = msgErr.Ref
+	}
+	return sendError(u, msgErr.Code, details)
+}
+
+// withRef: err as a MessageError referring to the message's object (if any)
+func withRef(err error, data map[string]interface{}) error {
+	var msgErr *MessageError
+	if !errors.As(err, &msgErr) {
+		msgErr = &MessageError{Code: CodeInvalidMessage, Message: err.Error(), Err: err}
+	}
+	if msgErr.Ref != "" {
+		return msgErr
+	}
+
+	ref, _ := data["objectId"].(string)
+	if objectMsg, ok := data["object"].(map[string]interface{}); ok && ref == "" {
+		ref, _ = objectMsg["id"].(string)
+	}
+	withRef := *msgErr
+	withRef.Ref = ref
+	return &withRef
+}
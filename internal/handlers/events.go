@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"main/internal/object"
+)
+
+// Outbound events for the hot paths, built from validated fields only so nothing
+// else a client put in its message is echoed to the room, and marshaled once.
+// Revision is the room's content version after the change (see room.ResumePoint)
+
+// ObjectAddedEvent: objectAdded broadcast
+type ObjectAddedEvent struct {
+	Type     string      `json:"type"`
+	Object   addedObject `json:"object"`
+	UserID   string      `json:"userId"`
+	Revision uint64      `json:"revision"`
+	eventTime
+}
+
+type addedObject struct {
+	ID          string                 `json:"id"`
+	Type        string                 `json:"type"`
+	Data        map[string]interface{} `json:"data"`
+	ZIndex      int                    `json:"zIndex"`
+	PageID      string                 `json:"pageId"`
+	Provisional bool                   `json:"provisional,omitempty"`
+}
+
+func newObjectAddedEvent(obj *object.Drawing, revision uint64, data map[string]interface{}) ObjectAddedEvent {
+	return ObjectAddedEvent{
+		Type: "objectAdded",
+		Object: addedObject{
+			ID:          obj.ID,
+			Type:        obj.Type,
+			Data:        obj.Data,
+			ZIndex:      obj.ZIndex,
+			PageID:      obj.PageID,
+			Provisional: obj.Provisional,
+		},
+		UserID:    obj.UserID,
+		Revision:  revision,
+		eventTime: stampedTime(data),
+	}
+}
+
+// ObjectUpdatedEvent: objectUpdated broadcast
+type ObjectUpdatedEvent struct {
+	Type     string        `json:"type"`
+	Object   updatedObject `json:"object"`
+	UserID   string        `json:"userId"`
+	Revision uint64        `json:"revision"`
+	eventTime
+}
+
+type updatedObject struct {
+	ID          string                 `json:"id"`
+	Type        string                 `json:"type"`
+	Data        map[string]interface{} `json:"data"`
+	Provisional *bool                  `json:"provisional,omitempty"` // only when the update changed it
+}
+
+// ObjectDeletedEvent: objectDeleted broadcast
+type ObjectDeletedEvent struct {
+	Type     string `json:"type"`
+	ObjectID string `json:"objectId"`
+	UserID   string `json:"userId"`
+	Revision uint64 `json:"revision"`
+	eventTime
+}
+
+// CursorsEvent: cursors broadcast, the cursors on one page that moved since
+// the room's previous flush (see room.StartCursors). May include the
+// recipient's own cursor
+type CursorsEvent struct {
+	Type    string        `json:"type"`
+	PageID  string        `json:"pageId"` // lets clients hide cursors on other pages
+	Cursors []CursorEntry `json:"cursors"`
+}
+
+// CursorEntry: a user's latest cursor position in a cursors broadcast
+type CursorEntry struct {
+	UserID string  `json:"userId"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Color  string  `json:"color"`
+	Name   string  `json:"name,omitempty"` // display name, for cursor labels
+	// Trail: positions since this user's previous cursor entry, oldest first, as
+	// rounded deltas: the first from the previous entry's x/y, each next one from
+	// the point before it. Omitted if the cursor barely moved
+	Trail [][2]int `json:"trail,omitempty"`
+	eventTime
+}
+
+// eventTime: client timestamp as corrected by ClockHandler.StampTime, if one was sent
+type eventTime struct {
+	Timestamp   int64 `json:"timestamp,omitempty"`
+	ServerTime  int64 `json:"serverTime,omitempty"`
+	ClockSkewed bool  `json:"clockSkewed,omitempty"`
+}
+
+// stampedTime: the fields StampTime set on a message (none if it had no timestamp)
+func stampedTime(data map[string]interface{}) eventTime {
+	timestamp, ok := data["timestamp"].(int64)
+	if !ok {
+		return eventTime{}
+	}
+	serverTime, _ := data["serverTime"].(int64)
+	skewed, _ := data["clockSkewed"].(bool)
+	return eventTime{Timestamp: timestamp, ServerTime: serverTime, ClockSkewed: skewed}
+}
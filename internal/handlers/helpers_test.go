@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"main/internal/middleware"
+	"main/internal/msgpack"
+	"main/internal/object"
+	"main/internal/room"
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+)
+
+// testServer: a router and one room, with users connected over real
+// websockets (the writer needs a connection), like cmd/replaycheck
+type testServer struct {
+	t        *testing.T
+	http     *httptest.Server
+	conns    chan *websocket.Conn
+	sessions *user.SessionManager
+	rooms    *room.Manager
+	config   *middleware.RateLimit
+	router   *MessageRouter
+	room     *room.Room
+}
+
+// testClient: the client end of a connected user, messages it receives are
+// decoded in the background
+type testClient struct {
+	t        *testing.T
+	user     *user.User
+	conn     *websocket.Conn
+	messages chan map[string]interface{}
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	config := middleware.NewRateLimit(10, 1000, 250000, 100, 5, 1000, 1e6, 1e6)
+	config.CursorPerSecond, config.CursorBurstSize = 1e6, 1e6
+	config.HostActionInterval, config.HostActionBurst = time.Nanosecond, 1e6
+
+	sessions := user.NewSessionManager(config)
+	broadcaster := room.NewBroadcaster()
+	s := &testServer{
+		t:        t,
+		conns:    make(chan *websocket.Conn),
+		sessions: sessions,
+		rooms:    room.NewManager(nil),
+		config:   config,
+		router:   NewMessageRouter(object.NewValidator(), config, broadcaster, room.NewSynchronizer(config.MaxSyncSize), sessions),
+	}
+
+	upgrader := websocket.Upgrader{}
+	s.http = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		s.conns <- conn
+	}))
+	t.Cleanup(s.close)
+
+	rm, err := s.rooms.CreateRoom(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.room = rm
+	return s
+}
+
+// join: connects a user named name to the room
+func (s *testServer) join(name string) *testClient {
+	s.t.Helper()
+	return s.joinWith(name, "")
+}
+
+// joinPacked: join for a connection that negotiated MessagePack, it only
+// understands binary MessagePack frames (others never reach next)
+func (s *testServer) joinPacked(name string) *testClient {
+	s.t.Helper()
+	return s.joinWith(name, user.EncodingMsgpack)
+}
+
+func (s *testServer) joinWith(name, encoding string) *testClient {
+	s.t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.http.URL, "http"), nil)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	u := user.NewUser(<-s.conns, user.ConnectionInfo{})
+	u.Encoding = encoding
+	session := s.sessions.GetOrCreate(name, "")
+	if _, err := s.sessions.Attach(session.SessionToken, u); err != nil {
+		s.t.Fatal(err)
+	}
+	if _, err := s.rooms.JoinRoom(s.room.Code, "", u, s.config); err != nil {
+		s.t.Fatal(err)
+	}
+	s.room.ConfirmJoin(u.ID)
+
+	c := &testClient{t: s.t, user: u, conn: conn, messages: make(chan map[string]interface{}, 256)}
+	s.t.Cleanup(func() {
+		u.StopWriter()
+		conn.Close()
+	})
+	go func() {
+		defer close(c.messages)
+		for {
+			messageType, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if u.Msgpack() {
+				if messageType != websocket.BinaryMessage {
+					continue
+				}
+				if data, err := msgpack.Unmarshal(msg, 64, 1e6); err == nil {
+					if data, ok := data.(map[string]interface{}); ok {
+						c.messages <- data
+					}
+				}
+				continue
+			}
+			var data map[string]interface{}
+			if json.Unmarshal(msg, &data) == nil {
+				c.messages <- data
+			}
+		}
+	}()
+	return c
+}
+
+// send: routes msg as if c's user had sent it
+func (s *testServer) send(c *testClient, msg interface{}) error {
+	s.t.Helper()
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return s.router.Route(context.Background(), s.room, c.user, raw)
+}
+
+func (s *testServer) close() {
+	s.http.Close()
+	s.room.Close()
+}
+
+// next: the next message of type msgType c receives, skipping others
+func (c *testClient) next(msgType string) map[string]interface{} {
+	c.t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case msg, ok := <-c.messages:
+			if !ok {
+				c.t.Fatalf("connection closed waiting for %s", msgType)
+			}
+			if msg["type"] == msgType {
+				return msg
+			}
+		case <-timeout:
+			c.t.Fatalf("no %s message received", msgType)
+		}
+	}
+}
+
+// reject: sends msg as c and checks it's refused with code, whether the handler
+// replied itself or returned the error for the pipeline to send (ReplyError)
+func (s *testServer) reject(c *testClient, msg interface{}, code string) map[string]interface{} {
+	s.t.Helper()
+	if err := s.send(c, msg); err != nil {
+		if err := ReplyError(c.user, err); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+	reply := c.next("error")
+	if reply["code"] != code {
+		s.t.Fatalf("error code = %v (%v), want %s", reply["code"], reply["detail"], code)
+	}
+	return reply
+}
+
+// until: every message c receives up to and including the next of type msgType
+func (c *testClient) until(msgType string) []map[string]interface{} {
+	c.t.Helper()
+	var received []map[string]interface{}
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case msg, ok := <-c.messages:
+			if !ok {
+				c.t.Fatalf("connection closed waiting for %s", msgType)
+			}
+			received = append(received, msg)
+			if msg["type"] == msgType {
+				return received
+			}
+		case <-timeout:
+			c.t.Fatalf("no %s message received", msgType)
+		}
+	}
+}
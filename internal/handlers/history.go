@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"main/internal/middleware"
+	"main/internal/room"
+	"main/internal/user"
+)
+
+// HistoryHandler: per-user undo/redo of added drawings
+type HistoryHandler struct {
+	config      *middleware.RateLimit
+	broadcaster *room.Broadcaster
+}
+
+func NewHistoryHandler(config *middleware.RateLimit, broadcaster *room.Broadcaster) *HistoryHandler {
+	return &HistoryHandler{
+		config:      config,
+		broadcaster: broadcaster,
+	}
+}
+
+// HandleUndo: undo messages, removes the sender's most recent drawing
+func (h *HistoryHandler) HandleUndo(ctx context.Context, rm *room.Room, u *user.User) error {
+	if rm.IsFrozen() {
+		return sendError(u, CodeBoardFrozen, nil)
+	}
+
+	obj, err := rm.Undo(u.ID)
+	if errors.Is(err, room.ErrNothingToUndo) {
+		return sendError(u, CodeNothingToUndo, map[string]interface{}{"reason": err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+
+	// Everyone, sender included (the client doesn't know which drawing was undone)
+	return h.broadcastAll(ctx, rm, obj.PageID, map[string]interface{}{
+		"type":     "objectDeleted",
+		"objectId": obj.ID,
+		"userId":   u.ID,
+		"undo":     true,
+	})
+}
+
+// HandleRedo: redo messages, restores the sender's most recently undone drawing
+func (h *HistoryHandler) HandleRedo(ctx context.Context, rm *room.Room, u *user.User) error {
+	if rm.IsFrozen() {
+		return sendError(u, CodeBoardFrozen, nil)
+	}
+	if !h.config.CanAddObject(rm) {
+		return NewError(CodeObjectLimit, "room at maximum object capacity")
+	}
+
+	obj, err := rm.Redo(u.ID)
+	if errors.Is(err, room.ErrNothingToRedo) {
+		return sendError(u, CodeNothingToRedo, map[string]interface{}{"reason": err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+
+	return h.broadcastAll(ctx, rm, obj.PageID, map[string]interface{}{
+		"type": "objectAdded",
+		"object": map[string]interface{}{
+			"id":     obj.ID,
+			"type":   obj.Type,
+			"data":   obj.Data,
+			"zIndex": obj.ZIndex,
+			"pageId": obj.PageID,
+		},
+		"userId": u.ID,
+		"redo":   true,
+	})
+}
+
+// broadcastAll: sends to everyone in the room, sender included (a change to a drawing on pageID)
+func (h *HistoryHandler) broadcastAll(ctx context.Context, rm *room.Room, pageID string, message map[string]interface{}) error {
+	message["revision"] = rm.Revision()
+	msg, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("marshal broadcast message: %w", err)
+	}
+	h.broadcaster.Broadcast(ctx, rm, msg, nil, room.ObjectTag(pageID))
+	return nil
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"main/internal/middleware"
+	"main/internal/room"
+	"main/internal/user"
+)
+
+// hostUndoWindow: how long after a destructive action undoHostAction can revert it
+const hostUndoWindow = 2 * time.Minute
+
+// HostHandler: safety rails for destructive host actions
+type HostHandler struct {
+	config       *middleware.RateLimit
+	broadcaster  *room.Broadcaster
+	synchronizer *room.Synchronizer
+}
+
+func NewHostHandler(config *middleware.RateLimit, broadcaster *room.Broadcaster, synchronizer *room.Synchronizer) *HostHandler {
+	return &HostHandler{
+		config:       config,
+		broadcaster:  broadcaster,
+		synchronizer: synchronizer,
+	}
+}
+
+// beginDestructive: rate limits a destructive action and checkpoints the board
+// before it runs. Returns false (after replying) if the sender is over the limit
+func beginDestructive(rm *room.Room, u *user.User, action string) (bool, error) {
+	if allowed, err := allowHostAction(rm, u, action); !allowed {
+		return false, err
+	}
+
+	rm.Checkpoint(action, u.ID)
+	auditHostAction(rm, u, action, "checkpointed")
+	return true, nil
+}
+
+// allowHostAction: consumes the sender's host action budget, replying if it's spent
+func allowHostAction(rm *room.Room, u *user.User, action string) (bool, error) {
+	if u.Session.HostRateLimiter.Allow() {
+		return true, nil
+	}
+	auditHostAction(rm, u, action, "rate limited")
+	return false, sendError(u, CodeRateLimited, map[string]interface{}{
+		"messageType": action,
+		"rateStatus":  u.RateStatus(),
+	})
+}
+
+// auditHostAction: audit log line with the acting connection's metadata
+func auditHostAction(rm *room.Room, u *user.User, action string, outcome string) {
+	u.Logger().Info("Audit", "action", action, "role", rm.Role(u.ID), "outcome", outcome,
+		"agent", u.Info.UserAgent, "connected_at", u.Info.ConnectedAt.Format(time.RFC3339))
+}
+
+// HandleClearBoard: clearBoard messages (clear), deletes every drawing and
+// broadcasts boardCleared. Checkpointed, so undoHostAction can bring it back
+func (h *HostHandler) HandleClearBoard(ctx context.Context, rm *room.Room, u *user.User) error {
+	if rm.IsFrozen() {
+		return sendError(u, CodeBoardFrozen, nil)
+	}
+	if allowed, err := beginDestructive(rm, u, "clearBoard"); !allowed {
+		return err
+	}
+
+	cleared := rm.ClearBoard("clearBoard", u.ID)
+	auditHostAction(rm, u, "clearBoard", fmt.Sprintf("%d drawings deleted", cleared))
+
+	msg, err := json.Marshal(map[string]interface{}{
+		"type":     "boardCleared",
+		"userId":   u.ID,
+		"revision": rm.Revision(),
+	})
+	if err != nil {
+		return fmt.Errorf("marshal broadcast message: %w", err)
+	}
+	h.broadcaster.Broadcast(ctx, rm, msg, nil, room.TagObject)
+	return nil
+}
+
+// HandleUndo: undoHostAction messages (clear), restores the board from before
+// the last destructive action and resyncs everyone
+func (h *HostHandler) HandleUndo(ctx context.Context, rm *room.Room, u *user.User) error {
+	if allowed, err := allowHostAction(rm, u, "undoHostAction"); !allowed {
+		return err
+	}
+
+	action, err := rm.RestoreCheckpoint(hostUndoWindow)
+	if errors.Is(err, room.ErrNoCheckpoint) {
+		return sendError(u, CodeNothingToUndo, map[string]interface{}{"reason": err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+	auditHostAction(rm, u, "undoHostAction", "restored board from before "+action)
+
+	msg, err := json.Marshal(map[string]interface{}{
+		"type":   "hostActionUndone",
+		"action": action,
+		"userId": u.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal broadcast message: %w", err)
+	}
+	h.broadcaster.Broadcast(ctx, rm, msg, nil, room.TagRoom)
+
+	// Clients replace their board with the restored one
+	h.resync(rm, "host undo")
+	return nil
+}
+
+// HandleRestoreLastClear: restoreLastClear messages, brings back the drawings of
+// the latest clearBoard or deleteMyObjects purge. Open to whoever did it and the
+// host, for config.ClearRestoreWindow, once. Drawings added since are kept
+func (h *HostHandler) HandleRestoreLastClear(ctx context.Context, rm *room.Room, u *user.User) error {
+	if rm.IsFrozen() {
+		return sendError(u, CodeBoardFrozen, nil)
+	}
+	if allowed, err := allowHostAction(rm, u, "restoreLastClear"); !allowed {
+		return err
+	}
+
+	action, restored, err := rm.RestoreLastClear(u.ID, rm.IsHost(u.ID), room.RestoreLimits{
+		Window:     h.config.ClearRestoreWindow,
+		MaxObjects: h.config.MaxObjects,
+		MaxBytes:   h.config.MaxBoardBytes,
+	})
+	switch {
+	case errors.Is(err, room.ErrNoClear):
+		return sendError(u, CodeNothingToUndo, map[string]interface{}{"reason": err.Error()})
+	case errors.Is(err, room.ErrClearNotYours):
+		return sendError(u, CodeForbidden, map[string]interface{}{"messageType": "restoreLastClear", "reason": err.Error()})
+	case errors.Is(err, room.ErrRestoreLimit):
+		return sendError(u, CodeObjectLimit, map[string]interface{}{"reason": err.Error()})
+	case err != nil:
+		return err
+	}
+	auditHostAction(rm, u, "restoreLastClear", fmt.Sprintf("%d drawings restored from %s", restored, action))
+
+	msg, err := json.Marshal(map[string]interface{}{
+		"type":     "clearRestored",
+		"action":   action,
+		"restored": restored,
+		"userId":   u.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal broadcast message: %w", err)
+	}
+	h.broadcaster.Broadcast(ctx, rm, msg, nil, room.TagRoom)
+
+	h.resync(rm, "clear restore")
+	return nil
+}
+
+// resync: sends every connection the full board (after it was replaced)
+func (h *HostHandler) resync(rm *room.Room, reason string) {
+	for _, conn := range rm.GetConnections() {
+		if err := h.synchronizer.SyncNewUser(rm, conn); err != nil {
+			conn.Logger().Error("Resync failed", "reason", reason, "err", err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"main/internal/object"
+	"main/internal/room"
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxImportFailures: failures listed in a rejected import report
+const maxImportFailures = 50
+
+// HandleImport: importObjects messages (manage-settings), {board: {version, objects}}
+// All or nothing: any invalid object rejects the import with a report of every failure.
+// Colliding IDs are remapped and the imported drawings stack above existing ones
+func (h *ObjectHandler) HandleImport(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	if rm.IsFrozen() {
+		return sendError(u, CodeBoardFrozen, nil)
+	}
+
+	board, ok := data["board"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("missing board")
+	}
+	if version, _ := board["version"].(float64); int(version) != object.BoardFormatVersion {
+		return sendError(u, CodeImportRejected, map[string]interface{}{
+			"reason": fmt.Sprintf("unsupported board version (expected %d)", object.BoardFormatVersion),
+		})
+	}
+
+	items, ok := board["objects"].([]interface{})
+	if !ok {
+		return fmt.Errorf("missing board objects")
+	}
+	if len(items) > maxAddBatch {
+		return sendError(u, CodeImportRejected, map[string]interface{}{"reason": fmt.Sprintf("too many objects (max %d)", maxAddBatch)})
+	}
+	if rm.ObjectCount()+len(items) > h.config.MaxObjects {
+		return sendError(u, CodeImportRejected, map[string]interface{}{"reason": "room at maximum object capacity"})
+	}
+
+	objs := make([]*object.Drawing, 0, len(items))
+	failures := make([]map[string]interface{}, 0)
+	for i, item := range items {
+		objectMsg, ok := item.(map[string]interface{})
+		var obj *object.Drawing
+		var err error
+		if !ok {
+			err = fmt.Errorf("missing object data")
+		} else {
+			obj, _, err = h.parseObject(ctx, objectMsg)
+		}
+		if err != nil {
+			if len(failures) < maxImportFailures {
+				failures = append(failures, map[string]interface{}{"index": i, "error": err.Error()})
+			}
+			continue
+		}
+		objs = append(objs, obj)
+	}
+	if len(objs) != len(items) {
+		return sendError(u, CodeImportRejected, map[string]interface{}{
+			"reason":   "invalid objects",
+			"failed":   len(items) - len(objs),
+			"failures": failures,
+		})
+	}
+
+	// Keep the board's stacking order, on top of what's already in the room
+	sort.SliceStable(objs, func(i, j int) bool { return objs[i].ZIndex < objs[j].ZIndex })
+
+	remapped := make(map[string]string)
+	taken := make(map[string]bool, len(objs))
+	onTop := make([]bool, len(objs))
+	for i, obj := range objs {
+		if taken[obj.ID] || rm.GetObject(obj.ID) != nil || rm.IsDeleted(obj.ID) {
+			newID := obj.ID + "-" + user.GenerateUUID()[:8]
+			remapped[obj.ID] = newID
+			obj.ID = newID
+		}
+		taken[obj.ID] = true
+		if obj.PageID != "" && !rm.HasPage(obj.PageID) {
+			obj.PageID = "" // unknown page, lands on the first one
+		}
+		obj.UserID = u.ID
+		onTop[i] = true
+	}
+
+	if err := rm.AddObjects(objs, onTop); err != nil {
+		return sendError(u, CodeImportRejected, map[string]interface{}{"reason": err.Error()})
+	}
+	auditHostAction(rm, u, "importObjects", fmt.Sprintf("%d objects", len(objs)))
+
+	added := make([]map[string]interface{}, 0, len(objs))
+	for _, obj := range objs {
+		added = append(added, map[string]interface{}{
+			"id":     obj.ID,
+			"type":   obj.Type,
+			"data":   obj.Data,
+			"zIndex": obj.ZIndex,
+			"pageId": obj.PageID,
+		})
+	}
+
+	// One message for the whole import, sender included (IDs may have changed)
+	msg, err := json.Marshal(map[string]interface{}{
+		"type":     "objectsAdded",
+		"objects":  added,
+		"userId":   u.ID,
+		"import":   true,
+		"revision": rm.Revision(),
+	})
+	if err != nil {
+		return fmt.Errorf("marshal broadcast message: %w", err)
+	}
+	h.broadcaster.Broadcast(ctx, rm, msg, nil, room.TagObject)
+
+	result, err := json.Marshal(map[string]interface{}{
+		"type":     "importResult",
+		"imported": len(objs),
+		"remapped": remapped, // original ID → new ID
+	})
+	if err != nil {
+		return fmt.Errorf("marshal import result: %w", err)
+	}
+	return u.WriteMessage(websocket.TextMessage, result)
+}
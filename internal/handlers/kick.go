@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"main/internal/room"
+	"main/internal/user"
+)
+
+// HandleKick: kickUser messages (moderate), {userId, ban}. Removes the user
+// from the room, sends them kicked and closes their connection, then tells
+// everyone else userLeft. With ban set they can't rejoin while the room exists
+func (h *HostHandler) HandleKick(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	target, ok := data["userId"].(string)
+	if !ok || target == "" {
+		return fmt.Errorf("missing userId")
+	}
+	ban, _ := data["ban"].(bool)
+
+	// Checked first so rejected kicks don't use up the host action budget
+	if err := rm.CheckKick(u.ID, target); err != nil {
+		return kickRejected(u, target, err)
+	}
+	if allowed, err := allowHostAction(rm, u, "kickUser"); !allowed {
+		return err
+	}
+
+	// The target may have left meanwhile
+	kicked, err := rm.Kick(u.ID, target, ban)
+	if err != nil {
+		return kickRejected(u, target, err)
+	}
+	auditHostAction(rm, u, "kickUser", fmt.Sprintf("removed %s (ban %t)", target, ban))
+
+	room.Dismiss(kicked, ban)
+	h.broadcaster.UserLeft(ctx, rm, target)
+	return nil
+}
+
+// kickRejected: replies kick_rejected for the room's reason (see room.Kick)
+func kickRejected(u *user.User, target string, err error) error {
+	if errors.Is(err, room.ErrKickSelf) || errors.Is(err, room.ErrKickHost) || errors.Is(err, room.ErrNotInRoom) {
+		return sendError(u, CodeKickRejected, map[string]interface{}{"userId": target, "reason": err.Error()})
+	}
+	return err
+}
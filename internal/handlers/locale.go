@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"main/internal/i18n"
+	"main/internal/room"
+	"main/internal/user"
+)
+
+// LocaleHandler: the room's default locale for system texts
+type LocaleHandler struct {
+	broadcaster *room.Broadcaster
+}
+
+func NewLocaleHandler(broadcaster *room.Broadcaster) *LocaleHandler {
+	return &LocaleHandler{
+		broadcaster: broadcaster,
+	}
+}
+
+// HandleSet: setRoomLocale messages (manage-settings), {locale: "es"}, "" resets to English
+// Only affects connections that didn't declare a locale in authenticate
+func (h *LocaleHandler) HandleSet(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	requested, ok := data["locale"].(string)
+	if !ok {
+		return fmt.Errorf("missing locale")
+	}
+
+	locale := i18n.Resolve(requested)
+	if locale == "" && requested != "" {
+		return sendError(u, CodeInvalidLocale, map[string]interface{}{"supported": i18n.Locales()})
+	}
+	rm.SetLocale(locale)
+	auditHostAction(rm, u, "setRoomLocale", fmt.Sprintf("%q", locale))
+
+	msg, err := json.Marshal(map[string]interface{}{
+		"type":   "roomLocaleChanged",
+		"locale": locale,
+		"userId": u.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal broadcast message: %w", err)
+	}
+	h.broadcaster.Broadcast(ctx, rm, msg, nil, room.TagRoom)
+	return nil
+}
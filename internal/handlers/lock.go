@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"main/internal/room"
+	"main/internal/user"
+)
+
+// HandleLock: lockObject messages, {objectId}. Soft-locks a drawing the sender
+// may edit (e.g. while dragging it) so others' updates are rejected, and
+// broadcasts objectLocked to everyone. Sending it again extends the lock
+func (h *ObjectHandler) HandleLock(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	if rm.IsFrozen() {
+		return sendError(u, CodeBoardFrozen, nil)
+	}
+
+	objectID, ok := data["objectId"].(string)
+	if !ok {
+		return fmt.Errorf("missing objectId")
+	}
+	existing := rm.GetObject(objectID)
+	if existing == nil {
+		return fmt.Errorf("object not found: %s", objectID)
+	}
+	if err := checkOwner(rm, u, objectID, room.CapEditOthers); err != nil {
+		return err
+	}
+
+	lock, err := rm.LockObject(objectID, u.ID, h.config.LockTimeout)
+	if errors.Is(err, room.ErrObjectLocked) {
+		return sendError(u, CodeObjectLocked, map[string]interface{}{"objectId": objectID, "lockedBy": lock.UserID})
+	}
+	if err != nil {
+		return err
+	}
+
+	// Sender included, expiresAt tells it when to lock again
+	msg, err := json.Marshal(map[string]interface{}{
+		"type":      "objectLocked",
+		"objectId":  objectID,
+		"userId":    u.ID,
+		"color":     rm.GetUserColor(u.ID),
+		"expiresAt": lock.Expires.UnixMilli(),
+	})
+	if err != nil {
+		return fmt.Errorf("marshal broadcast message: %w", err)
+	}
+	h.broadcaster.Broadcast(ctx, rm, msg, nil, room.ObjectTag(existing.PageID))
+	return nil
+}
+
+// HandleUnlock: unlockObject messages, {objectId}. Releases the sender's lock and
+// broadcasts objectUnlocked (nothing happens if they didn't hold it)
+func (h *ObjectHandler) HandleUnlock(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	objectID, ok := data["objectId"].(string)
+	if !ok {
+		return fmt.Errorf("missing objectId")
+	}
+	if !rm.UnlockObject(objectID, u.ID) {
+		return nil
+	}
+
+	msg, err := json.Marshal(map[string]interface{}{
+		"type":     "objectUnlocked",
+		"objectId": objectID,
+		"userId":   u.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal broadcast message: %w", err)
+	}
+	h.broadcaster.Broadcast(ctx, rm, msg, u.Connection, room.TagObject)
+	return nil
+}
@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"main/internal/logging"
+	"main/internal/middleware"
+	"main/internal/room"
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/time/rate"
+)
+
+// maxMergeBody: bytes of a merge request body
+const maxMergeBody = 4 * 1024
+
+// HTTP merges into one room: a burst of mergeBurst, then one per mergeInterval
+const (
+	mergeInterval = 10 * time.Second
+	mergeBurst    = 3
+)
+
+// RoomLookup: rooms a merge can copy from (the room manager)
+type RoomLookup interface {
+	GetRoom(roomCode string) (*room.Room, bool)
+}
+
+// TokenValidator: resolves a session token to its userID
+type TokenValidator interface {
+	ValidateToken(token string) (string, bool)
+}
+
+// MergeRequest: one source room to merge into a target room
+type MergeRequest struct {
+	Source       string  `json:"source"`
+	DX           float64 `json:"dx"` // offset for the source's drawings, so boards land side by side
+	DY           float64 `json:"dy"`
+	DeleteSource bool    `json:"deleteSource"` // clear the source board afterwards
+}
+
+// MergeResult: reply to a merge
+type MergeResult struct {
+	Source        string `json:"source"`
+	Merged        int    `json:"merged"`
+	SourceDeleted bool   `json:"sourceDeleted"`
+	Revision      uint64 `json:"revision"` // target's, after the merge
+}
+
+// mergeRejection: merge not attempted or rolled back, with the HTTP status for it
+type mergeRejection struct {
+	status int
+	reason string
+}
+
+func (e *mergeRejection) Error() string {
+	return e.reason
+}
+
+// mergeLimits: HTTP merge limiters per target room, so a host merging into
+// their room doesn't hold up merges into every other room
+type mergeLimits struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+// allow: whether a merge into roomCode may go ahead now
+func (ml *mergeLimits) allow(roomCode string) bool {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	limiter, exists := ml.limiters[roomCode]
+	if !exists {
+		// Limiters refilled to the burst allow what a new one would, drop them
+		// so rooms merged into once aren't tracked forever
+		for code, idle := range ml.limiters {
+			if idle.Tokens() >= mergeBurst {
+				delete(ml.limiters, code)
+			}
+		}
+		limiter = rate.NewLimiter(rate.Every(mergeInterval), mergeBurst)
+		ml.limiters[roomCode] = limiter
+	}
+	return limiter.Allow()
+}
+
+// MergeHandler: combines rooms' boards (e.g. breakout boards into a summary board),
+// for mergeFrom messages and POST /api/rooms/{target}/merge
+type MergeHandler struct {
+	rooms       RoomLookup // nil until EnableMerge
+	config      *middleware.RateLimit
+	broadcaster *room.Broadcaster
+}
+
+func NewMergeHandler(config *middleware.RateLimit, broadcaster *room.Broadcaster) *MergeHandler {
+	return &MergeHandler{
+		config:      config,
+		broadcaster: broadcaster,
+	}
+}
+
+// HandleMergeFrom: mergeFrom messages (host only), {source, dx, dy, deleteSource}
+// The sender must have joined the source room, and host it to delete its board
+func (h *MergeHandler) HandleMergeFrom(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	if rm.Role(u.ID) != room.RoleHost {
+		return sendError(u, CodeForbidden, map[string]interface{}{"messageType": "mergeFrom"})
+	}
+	if rm.IsFrozen() {
+		return sendError(u, CodeBoardFrozen, nil)
+	}
+
+	source, ok := data["source"].(string)
+	if !ok || source == "" {
+		return fmt.Errorf("missing source room")
+	}
+	req := MergeRequest{Source: source}
+	req.DX, _ = data["dx"].(float64)
+	req.DY, _ = data["dy"].(float64)
+	req.DeleteSource, _ = data["deleteSource"].(bool)
+
+	if allowed, err := allowHostAction(rm, u, "mergeFrom"); !allowed {
+		return err
+	}
+
+	result, err := h.merge(ctx, rm, req, u.ID)
+	var rejected *mergeRejection
+	if errors.As(err, &rejected) {
+		auditHostAction(rm, u, "mergeFrom", "rejected: "+rejected.reason)
+		return sendError(u, CodeMergeRejected, map[string]interface{}{"reason": rejected.reason, "source": source})
+	}
+	if err != nil {
+		return err
+	}
+	auditHostAction(rm, u, "mergeFrom", fmt.Sprintf("%d objects from %s (source deleted: %t)", result.Merged, source, result.SourceDeleted))
+
+	reply, err := json.Marshal(map[string]interface{}{
+		"type":          "mergeResult",
+		"source":        result.Source,
+		"merged":        result.Merged,
+		"sourceDeleted": result.SourceDeleted,
+		"revision":      result.Revision,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal merge result: %w", err)
+	}
+	return u.WriteMessage(websocket.TextMessage, reply)
+}
+
+// HTTPHandler: POST /api/rooms/{target}/merge with a MergeRequest body, authorized
+// by "Authorization: Bearer <token>" with the admin token (if set) or the session
+// token of the target's host (who must also have joined the source)
+func (h *MergeHandler) HTTPHandler(sessions TokenValidator, adminToken string) http.Handler {
+	limits := &mergeLimits{limiters: make(map[string]*rate.Limiter)}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || token == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		admin := adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+		actorID := ""
+		if !admin {
+			userID, valid := sessions.ValidateToken(token)
+			if !valid {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			actorID = userID
+		}
+
+		// Unknown rooms and rooms the user never joined look the same
+		target, exists := h.rooms.GetRoom(r.PathValue("target"))
+		if !exists || (!admin && target.GetUserColor(actorID) == "") {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		if !admin && target.Role(actorID) != room.RoleHost {
+			http.Error(w, "Only the room host can merge boards", http.StatusForbidden)
+			return
+		}
+
+		var req MergeRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMergeBody)).Decode(&req); err != nil || req.Source == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if !limits.allow(target.Code) {
+			http.Error(w, "Too many merges, try again shortly", http.StatusTooManyRequests)
+			return
+		}
+
+		result, err := h.merge(r.Context(), target, req, actorID)
+		var rejected *mergeRejection
+		if errors.As(err, &rejected) {
+			http.Error(w, rejected.reason, rejected.status)
+			return
+		}
+		if err != nil {
+			slog.Error("Merge failed", logging.KeyRoom, target.Code, "source", req.Source, "err", err)
+			http.Error(w, "Merge failed", http.StatusInternalServerError)
+			return
+		}
+		slog.Info("Audit", logging.KeyRoom, target.Code, "action", "mergeFrom", "by", actor(actorID),
+			"merged", result.Merged, "source", req.Source, "source_deleted", result.SourceDeleted)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+}
+
+// actor: userID for audit lines, operator for the admin token
+func actor(userID string) string {
+	if userID == "" {
+		return "operator"
+	}
+	return userID
+}
+
+// merge: copies req.Source's board into target and broadcasts it there as one
+// objectsAdded message. actorID is "" for the operator, who may merge any room
+func (h *MergeHandler) merge(ctx context.Context, target *room.Room, req MergeRequest, actorID string) (MergeResult, error) {
+	if h.rooms == nil {
+		return MergeResult{}, &mergeRejection{http.StatusServiceUnavailable, "merging is not enabled"}
+	}
+	if source, err := room.ValidateRoomCode(req.Source); err == nil && source == target.Code {
+		return MergeResult{}, &mergeRejection{http.StatusBadRequest, "a room can't be merged into itself"}
+	}
+	if target.IsFrozen() {
+		return MergeResult{}, &mergeRejection{http.StatusConflict, "board is frozen"}
+	}
+
+	source, exists := h.rooms.GetRoom(req.Source)
+	if !exists || (actorID != "" && source.GetUserColor(actorID) == "") {
+		return MergeResult{}, &mergeRejection{http.StatusNotFound, "source room not found"}
+	}
+	if req.DeleteSource {
+		if actorID != "" && source.Role(actorID) != room.RoleHost {
+			return MergeResult{}, &mergeRejection{http.StatusForbidden, "only the source room's host can delete its board"}
+		}
+		if source.IsFrozen() {
+			return MergeResult{}, &mergeRejection{http.StatusConflict, "source board is frozen"}
+		}
+	}
+
+	board := source.Export()
+	if len(board.Objects) == 0 {
+		return MergeResult{}, &mergeRejection{http.StatusUnprocessableEntity, "source board is empty"}
+	}
+	objs, err := target.Merge(board, source.Code, room.MergeOptions{
+		DX:         req.DX,
+		DY:         req.DY,
+		MaxObjects: h.config.MaxObjects,
+		MaxBytes:   h.config.MaxBoardBytes,
+	})
+	if err != nil {
+		return MergeResult{}, &mergeRejection{http.StatusUnprocessableEntity, err.Error()}
+	}
+
+	added := make([]map[string]interface{}, 0, len(objs))
+	for _, obj := range objs {
+		added = append(added, map[string]interface{}{
+			"id":     obj.ID,
+			"type":   obj.Type,
+			"data":   obj.Data,
+			"userId": obj.UserID,
+			"zIndex": obj.ZIndex,
+			"pageId": obj.PageID,
+			"origin": obj.Origin,
+		})
+	}
+
+	// One message for the whole merge, sender included (every ID is new)
+	result := MergeResult{Source: source.Code, Merged: len(objs), Revision: target.Revision()}
+	msg, err := json.Marshal(map[string]interface{}{
+		"type":     "objectsAdded",
+		"objects":  added,
+		"userId":   actorID,
+		"merge":    true,
+		"source":   source.Code,
+		"revision": result.Revision,
+	})
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("marshal broadcast message: %w", err)
+	}
+	h.broadcaster.Broadcast(ctx, target, msg, nil, room.TagObject)
+
+	if req.DeleteSource {
+		// Checkpointed, so the source host can still undoHostAction it
+		source.Checkpoint("mergeFrom", actorID)
+		source.ClearBoard("mergeFrom", actorID)
+		cleared, err := json.Marshal(map[string]interface{}{
+			"type":     "boardCleared",
+			"userId":   actorID,
+			"mergedTo": target.Code,
+			"revision": source.Revision(),
+		})
+		if err != nil {
+			return MergeResult{}, fmt.Errorf("marshal broadcast message: %w", err)
+		}
+		h.broadcaster.Broadcast(ctx, source, cleared, nil, room.TagObject)
+		result.SourceDeleted = true
+	}
+	return result, nil
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMergeLimitIsPerTargetRoom(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.join("alice")
+	if err := s.send(alice, stroke("s1", nil)); err != nil {
+		t.Fatal(err)
+	}
+	busy, err := s.rooms.CreateRoom(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quiet, err := s.rooms.CreateRoom(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := s.router.EnableMerge(s.rooms).HTTPHandler(s.sessions, "operator-token")
+
+	merge := func(target string) int {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, "/api/rooms/"+target+"/merge",
+			strings.NewReader(`{"source":"`+s.room.Code+`"}`))
+		r.SetPathValue("target", target)
+		r.Header.Set("Authorization", "Bearer operator-token")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	for i := 0; i < mergeBurst; i++ {
+		if code := merge(busy.Code); code != http.StatusOK {
+			t.Fatalf("merge %d into busy room = %d, want 200", i+1, code)
+		}
+	}
+	if code := merge(busy.Code); code != http.StatusTooManyRequests {
+		t.Errorf("merge past the burst = %d, want 429", code)
+	}
+	if code := merge(quiet.Code); code != http.StatusOK {
+		t.Errorf("merge into another room = %d, want 200 (limited by the busy room)", code)
+	}
+}
@@ -1,13 +1,29 @@
-package handlers 
+package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"time"
 
 	"main/internal/middleware"
 	"main/internal/object"
 	"main/internal/room"
+	"main/internal/tracing"
 	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	maxValidateBatch = 100 // max objects per validateObjects message
+	maxTransferBatch = 500 // max objects moved per transferOwnership message
+
+	// provisionalGrace: time a disconnected owner has to reconnect and finalize
+	// in-progress drawings before they are removed
+	provisionalGrace = time.Minute
 )
 
 // ObjectHandler: handles object-related messages (add, update, delete)
@@ -26,10 +42,15 @@ func NewObjectHandler(validator *object.Validator, config *middleware.RateLimit,
 }
 
 // HandleAdded: objectAdded messages
-func (h *ObjectHandler) HandleAdded(rm *room.Room, u *user.User, data map[string]interface{}) error {
+func (h *ObjectHandler) HandleAdded(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	// Board is read-only once a session timer expires
+	if rm.IsFrozen() {
+		return sendError(u, CodeBoardFrozen, nil)
+	}
+
 	// Check object limit before adding
 	if !h.config.CanAddObject(rm) {
-		return fmt.Errorf("room at maximum object capacity")
+		return NewError(CodeObjectLimit, "room at maximum object capacity")
 	}
 
 	objectMsg, ok := data["object"].(map[string]interface{})
@@ -37,61 +58,239 @@ func (h *ObjectHandler) HandleAdded(rm *room.Room, u *user.User, data map[string
 		return fmt.Errorf("missing object data")
 	}
 
+	obj, hasZIndex, err := h.parseObject(ctx, objectMsg)
+	if err != nil {
+		id, _ := objectMsg["id"].(string)
+		return rejectObject(u, id, err)
+	}
+	obj.UserID = u.ID
+
+	// Re-adding a just deleted ID must be deliberate (avoids resurrecting ghosts)
+	if revive, _ := objectMsg["revive"].(bool); !revive && rm.IsDeleted(obj.ID) {
+		return sendError(u, CodeObjectDeleted, map[string]interface{}{"objectId": obj.ID})
+	}
+
+	// Add to room, assigning zIndex server-side when client omitted it
+	if hasZIndex {
+		err = rm.AddObject(obj)
+	} else {
+		_, err = rm.AddObjectOnTop(obj)
+	}
+	if errors.Is(err, room.ErrObjectExists) {
+		return sendError(u, CodeObjectExists, map[string]interface{}{"objectId": obj.ID})
+	}
+	if err != nil {
+		return err
+	}
+	rm.Audit(room.AuditAdd, u.ID, obj.ID, obj.Type)
+
+	// Broadcast the stored (sanitized) drawing
+	msg, err := json.Marshal(newObjectAddedEvent(obj, rm.Revision(), data))
+	if err != nil {
+		return fmt.Errorf("marshal broadcast message: %w", err)
+	}
+	h.broadcaster.Broadcast(ctx, rm, msg, u.Connection, room.ObjectTag(obj.PageID))
+
+	// Sender doesn't receive the broadcast, ack so it learns the assigned zIndex
+	if !hasZIndex {
+		return h.sendAck(u, obj.ID, obj.ZIndex)
+	}
+	return nil
+}
+
+// parseObject: extracts, validates, and sanitizes an object from a message
+// Shared by real adds and dry-run validation so verdicts can't diverge
+func (h *ObjectHandler) parseObject(ctx context.Context, objectMsg map[string]interface{}) (*object.Drawing, bool, error) {
 	id, ok := objectMsg["id"].(string)
 	if !ok {
-		return fmt.Errorf("missing object id")
+		return nil, false, fmt.Errorf("missing object id")
 	}
 
 	objType, ok := objectMsg["type"].(string)
 	if !ok {
-		return fmt.Errorf("missing or invalid object type")
+		return nil, false, fmt.Errorf("missing or invalid object type")
 	}
 
 	objData, ok := objectMsg["data"].(map[string]interface{})
 	if !ok {
-		return fmt.Errorf("missing or invalid object data")
+		return nil, false, fmt.Errorf("missing or invalid object data")
+	}
+
+	// Size and complexity budgets before the more expensive schema validation
+	encoded, err := json.Marshal(objectMsg)
+	if err != nil {
+		return nil, false, fmt.Errorf("marshal object: %w", err)
+	}
+	if !h.config.ValidateMessageSize(len(encoded)) {
+		return nil, false, fmt.Errorf("object too large: %d bytes", len(encoded))
+	}
+	if err := h.config.ValidateObjectComplexity(objData); err != nil {
+		return nil, false, err
 	}
 
 	// Validate and sanitize object data using schema validation
+	sanitizedData, err := h.validateAndSanitize(ctx, objType, objData)
+	if err != nil {
+		return nil, false, fmt.Errorf("object validation failed: %w", err)
+	}
+
+	obj := &object.Drawing{
+		ID:   id,
+		Type: objType,
+		Data: sanitizedData,
+	}
+
+	// In-progress drawings are removed if the owner disconnects before finalizing
+	if provisional, _ := objectMsg["provisional"].(bool); provisional {
+		obj.Provisional = true
+	}
+
+	// Page existence is checked by the room when the object is added
+	if rawPageID, hasPageID := objectMsg["pageId"]; hasPageID {
+		pageID, ok := rawPageID.(string)
+		if !ok {
+			return nil, false, fmt.Errorf("invalid pageId")
+		}
+		obj.PageID = pageID
+	}
+
+	rawZIndex, hasZIndex := objectMsg["zIndex"]
+	if !hasZIndex {
+		if h.config.RequireZIndex {
+			return nil, false, NewError(CodeValidationFailed, "missing zIndex")
+		}
+		return obj, false, nil
+	}
+
+	zIndex, err := parseZIndex(rawZIndex)
+	if err != nil {
+		return nil, false, err
+	}
+	obj.ZIndex = zIndex
+	return obj, true, nil
+}
+
+// validateAndSanitize: schema validation wrapped in a tracing span
+func (h *ObjectHandler) validateAndSanitize(ctx context.Context, objType string, objData map[string]interface{}) (map[string]interface{}, error) {
+	_, span := tracing.Tracer().Start(ctx, "validate")
+	defer span.End()
+
 	sanitizedData, err := h.validator.ValidateAndSanitize(objType, objData)
 	if err != nil {
-		return fmt.Errorf("object validation failed: %w", err)
+		span.RecordError(err)
 	}
+	return sanitizedData, err
+}
 
-	zIndexFloat, ok := objectMsg["zIndex"].(float64)
+// validatePatch: partial update validation wrapped in a tracing span
+func (h *ObjectHandler) validatePatch(ctx context.Context, objType string, current, patch map[string]interface{}) (map[string]interface{}, error) {
+	_, span := tracing.Tracer().Start(ctx, "validate")
+	defer span.End()
+
+	fields, err := h.validator.ValidatePatch(objType, current, patch)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return fields, err
+}
+
+// HandleValidate: validateObjects messages (dry run, no room state is touched)
+func (h *ObjectHandler) HandleValidate(ctx context.Context, u *user.User, data map[string]interface{}) error {
+	objects, ok := data["objects"].([]interface{})
 	if !ok {
-		return fmt.Errorf("missing or invalid zIndex")
+		return fmt.Errorf("missing objects array")
 	}
 
-	// Create object with sanitized data
-	obj := &object.Drawing{
-		ID:     id,
-		Type:   objType,
-		Data:   sanitizedData,
-		UserID: u.ID,
-		ZIndex: int(zIndexFloat),
+	if len(objects) > maxValidateBatch {
+		return fmt.Errorf("too many objects to validate: %d (max %d)", len(objects), maxValidateBatch)
 	}
 
-	// Add to room
-	rm.AddObject(obj)
+	results := make([]map[string]interface{}, 0, len(objects))
+	for i, item := range objects {
+		result := map[string]interface{}{"index": i, "ok": true}
 
-	// Update the data object with sanitized data for broadcast
-	objectMsg["data"] = sanitizedData
-	objectMsg["id"] = id
-	data["object"] = objectMsg
-	data["userId"] = u.ID
+		objectMsg, ok := item.(map[string]interface{})
+		if !ok {
+			result["ok"] = false
+			result["error"] = "missing object data"
+		} else if _, _, err := h.parseObject(ctx, objectMsg); err != nil {
+			result["ok"] = false
+			result["error"] = err.Error()
+		}
+
+		results = append(results, result)
+	}
 
-	// Broadcast
-	msg, err := json.Marshal(data)
+	response := map[string]interface{}{
+		"type":    "validationResult",
+		"results": results,
+	}
+
+	msg, err := json.Marshal(response)
 	if err != nil {
-		return fmt.Errorf("marshal broadcast message: %w", err)
+		return fmt.Errorf("marshal validation result: %w", err)
 	}
-	h.broadcaster.Broadcast(rm, msg, u.Connection)
-	return nil
+	return u.WriteMessage(websocket.TextMessage, msg)
+}
+
+// rejectObject: reports link and image URL failures to the sender with a specific
+// code, other errors become validation_failed
+func rejectObject(u *user.User, id string, err error) error {
+	details := map[string]interface{}{"objectId": id, "reason": err.Error()}
+	var msgErr *MessageError
+	switch {
+	case errors.As(err, &msgErr):
+		if msgErr.Ref == "" {
+			msgErr.Ref = id
+		}
+		return msgErr
+	case errors.Is(err, object.ErrUnsafeLink):
+		return sendError(u, CodeUnsafeLink, details)
+	case errors.Is(err, object.ErrLinkNotAllowed):
+		return sendError(u, CodeLinkNotAllowed, details)
+	case errors.Is(err, object.ErrUnsafeImage):
+		return sendError(u, CodeUnsafeImage, details)
+	default:
+		return &MessageError{Code: CodeValidationFailed, Message: err.Error(), Ref: id, Err: err}
+	}
+}
+
+// parseZIndex: validates client supplied zIndex (whole number within bounds)
+func parseZIndex(raw interface{}) (int, error) {
+	zIndex, ok := raw.(float64)
+	if !ok {
+		return 0, NewError(CodeValidationFailed, "invalid zIndex: must be a number")
+	}
+	if zIndex != math.Trunc(zIndex) {
+		return 0, NewError(CodeValidationFailed, "invalid zIndex: must be a whole number")
+	}
+	if zIndex < object.MinZIndex || zIndex > object.MaxZIndex {
+		return 0, NewError(CodeValidationFailed, "invalid zIndex: out of allowed range")
+	}
+	return int(zIndex), nil
+}
+
+// sendAck: tells the sender the server-assigned zIndex for its object
+func (h *ObjectHandler) sendAck(u *user.User, id string, zIndex int) error {
+	ack := map[string]interface{}{
+		"type":     "objectAck",
+		"objectId": id,
+		"zIndex":   zIndex,
+	}
+
+	msg, err := json.Marshal(ack)
+	if err != nil {
+		return fmt.Errorf("marshal object ack: %w", err)
+	}
+	return u.WriteMessage(websocket.TextMessage, msg)
 }
 
 // HandleUpdated: objectUpdated messages
-func (h *ObjectHandler) HandleUpdated(rm *room.Room, u *user.User, data map[string]interface{}) error {
+func (h *ObjectHandler) HandleUpdated(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	if rm.IsFrozen() {
+		return sendError(u, CodeBoardFrozen, nil)
+	}
+
 	objectMsg, ok := data["object"].(map[string]interface{})
 	if !ok {
 		return fmt.Errorf("missing object data")
@@ -107,53 +306,200 @@ func (h *ObjectHandler) HandleUpdated(rm *room.Room, u *user.User, data map[stri
 		return fmt.Errorf("missing or invalid object data")
 	}
 
-	// Get the existing object to determine its type
-	existingObj := rm.GetObject(id)
-	if existingObj == nil {
+	// The patch is validated against the drawing as stored, under the room lock
+	// with the owner and lock checks, so nothing changes in between
+	partial, _ := objectMsg["partial"].(bool)
+	edited, err := rm.EditObject(id, u.ID, room.CapEditOthers, func(objType string, current map[string]interface{}) (map[string]interface{}, error) {
+		// partial: true (always for notes) sends only the fields that changed, they're
+		// merged field-wise so concurrent patches of different fields both apply
+		if partial || object.MergesUpdates(objType) {
+			fields, err := h.validatePatch(ctx, objType, current, objData)
+			if err != nil {
+				return nil, err
+			}
+			return mergeFields(current, fields), nil
+		}
+		// Validate and sanitize object data using schema validation
+		return h.validateAndSanitize(ctx, objType, objData)
+	})
+	switch {
+	case errors.Is(err, room.ErrNotOwner):
+		return ownerRejected(id, room.CapEditOthers, err)
+	case errors.Is(err, room.ErrObjectLocked):
+		return sendError(u, CodeObjectLocked, map[string]interface{}{"objectId": id, "lockedBy": rm.LockHolder(id)})
+	case err != nil:
+		return rejectObject(u, id, err)
+	case edited == nil:
+		if rm.IsDeleted(id) {
+			return sendError(u, CodeObjectDeleted, map[string]interface{}{"objectId": id})
+		}
 		return fmt.Errorf("object not found: %s", id)
 	}
+	rm.Audit(room.AuditUpdate, u.ID, id, edited.Type)
 
-	// Validate and sanitize object data using schema validation
-	sanitizedData, err := h.validator.ValidateAndSanitize(existingObj.Type, objData)
-	if err != nil {
-		return fmt.Errorf("object validation failed: %w", err)
+	event := ObjectUpdatedEvent{
+		Type:      "objectUpdated",
+		Object:    updatedObject{ID: id, Type: edited.Type, Data: edited.Data},
+		UserID:    u.ID,
+		Revision:  rm.Revision(),
+		eventTime: stampedTime(data),
 	}
 
-	// Update object in room with sanitized data
-	rm.UpdateObject(id, sanitizedData)
-
-	// Update the data object with sanitized data for broadcast
-	objectMsg["data"] = sanitizedData
-	objectMsg["id"] = id
-	data["object"] = objectMsg
-	data["userId"] = u.ID
+	// provisional: false finalizes an in-progress drawing
+	if provisional, ok := objectMsg["provisional"].(bool); ok && !provisional {
+		rm.FinalizeObject(id)
+		event.Object.Provisional = &provisional
+	}
 
-	// Broadcast
-	msg, err := json.Marshal(data)
+	msg, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("marshal broadcast message: %w", err)
 	}
-	h.broadcaster.Broadcast(rm, msg, u.Connection)
+	h.broadcaster.Broadcast(ctx, rm, msg, u.Connection, room.ObjectTag(edited.PageID))
 	return nil
 }
 
+// mergeFields: current with fields set, in a new map
+func mergeFields(current, fields map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(current)+len(fields))
+	for key, value := range current {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return merged
+}
+
 // HandleDeleted: objectDeleted messages
-func (h *ObjectHandler) HandleDeleted(rm *room.Room, u *user.User, data map[string]interface{}) error {
+func (h *ObjectHandler) HandleDeleted(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	if rm.IsFrozen() {
+		return sendError(u, CodeBoardFrozen, nil)
+	}
+
 	objectID, ok := data["objectId"].(string)
 	if !ok {
 		return fmt.Errorf("missing objectId")
 	}
 
-	// Delete object from room
-	rm.DeleteObject(objectID)
+	// Delete object from room, owner checked under the room lock
+	existing, err := rm.DeleteObject(objectID, u.ID, room.CapEraseOthers)
+	if err != nil {
+		return ownerRejected(objectID, room.CapEraseOthers, err)
+	}
+	pageID := "" // already gone: delivered regardless of page filters
+	if existing != nil {
+		pageID = existing.PageID
+		rm.Audit(room.AuditDelete, u.ID, objectID, existing.Type)
+	}
 
 	// Broadcast IDs
-	data["objectId"] = objectID
-	data["userId"] = u.ID
-	msg, err := json.Marshal(data)
+	msg, err := json.Marshal(ObjectDeletedEvent{
+		Type:      "objectDeleted",
+		ObjectID:  objectID,
+		UserID:    u.ID,
+		Revision:  rm.Revision(),
+		eventTime: stampedTime(data),
+	})
 	if err != nil {
 		return fmt.Errorf("marshal broadcast message: %w", err)
 	}
-	h.broadcaster.Broadcast(rm, msg, u.Connection)
+	h.broadcaster.Broadcast(ctx, rm, msg, u.Connection, room.ObjectTag(pageID))
+	return nil
+}
+
+// checkOwner: own drawings need only draw (checked by the router), others' need
+// capability, which the host always has (see room.CheckOwner)
+func checkOwner(rm *room.Room, u *user.User, id string, capability string) error {
+	return ownerRejected(id, capability, rm.CheckOwner(u.ID, id, capability))
+}
+
+// ownerRejected: room.ErrNotOwner as permission_denied, other errors as they are
+func ownerRejected(id string, capability string, err error) error {
+	if !errors.Is(err, room.ErrNotOwner) {
+		return err
+	}
+	return &MessageError{
+		Code:    CodePermissionDenied,
+		Message: fmt.Sprintf("drawing belongs to another user (%s required)", capability),
+		Ref:     id,
+		Err:     err,
+	}
+}
+
+// HandleLeft: schedules removal of the user's unfinished drawings once they disconnect
+func (h *ObjectHandler) HandleLeft(rm *room.Room, u *user.User) {
+	ids := rm.ProvisionalObjects(u.ID)
+	if len(ids) == 0 {
+		return
+	}
+
+	rm.Go(func(ctx context.Context) {
+		select {
+		case <-rm.After(provisionalGrace):
+		case <-ctx.Done():
+			return // room closed, drawings go with it
+		}
+
+		for _, id := range rm.DropProvisional(u.ID, ids) {
+			msg, err := json.Marshal(ObjectDeletedEvent{Type: "objectDeleted", ObjectID: id, UserID: u.ID, Revision: rm.Revision()})
+			if err != nil {
+				continue
+			}
+			h.broadcaster.Broadcast(ctx, rm, msg, nil, room.TagObject)
+		}
+	})
+}
+
+// HandleTransferOwnership: transferOwnership messages (manage-settings)
+// {fromUserId, toUserId} moves a user's drawings, {objectIds, toUserId} moves specific ones
+func (h *ObjectHandler) HandleTransferOwnership(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	if rm.IsFrozen() {
+		return sendError(u, CodeBoardFrozen, nil)
+	}
+
+	toUserID, ok := data["toUserId"].(string)
+	if !ok {
+		return fmt.Errorf("missing toUserId")
+	}
+
+	fromUserID, _ := data["fromUserId"].(string)
+	var objectIDs []string
+	if rawIDs, ok := data["objectIds"].([]interface{}); ok {
+		for _, rawID := range rawIDs {
+			id, ok := rawID.(string)
+			if !ok {
+				return fmt.Errorf("invalid objectIds")
+			}
+			objectIDs = append(objectIDs, id)
+		}
+	}
+	if fromUserID == "" && len(objectIDs) == 0 {
+		return fmt.Errorf("missing fromUserId or objectIds")
+	}
+
+	transferred, remaining, err := rm.TransferOwnership(fromUserID, objectIDs, toUserID, maxTransferBatch)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, len(transferred))
+	for i, moved := range transferred {
+		ids[i] = moved.ID
+		rm.Audit(room.AuditTransfer, u.ID, moved.ID, moved.Type)
+	}
+
+	notice := map[string]interface{}{
+		"type":      "ownershipChanged",
+		"toUserId":  toUserID,
+		"objectIds": ids,
+		"remaining": remaining, // > 0: send the same message again to continue
+		"userId":    u.ID,
+		"revision":  rm.Revision(),
+	}
+	msg, err := json.Marshal(notice)
+	if err != nil {
+		return fmt.Errorf("marshal ownership notice: %w", err)
+	}
+	h.broadcaster.Broadcast(ctx, rm, msg, nil, room.TagObject)
 	return nil
 }
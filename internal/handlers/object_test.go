@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// stroke: an objectAdded message for a small stroke, zIndex omitted when nil
+func stroke(id string, zIndex interface{}) map[string]interface{} {
+	obj := map[string]interface{}{
+		"id":   id,
+		"type": "stroke",
+		"data": map[string]interface{}{
+			"points": []map[string]int{{"x": 1, "y": 1}, {"x": 5, "y": 5}},
+			"color":  "#000000",
+			"width":  2,
+		},
+	}
+	if zIndex != nil {
+		obj["zIndex"] = zIndex
+	}
+	return map[string]interface{}{"type": "objectAdded", "object": obj}
+}
+
+func TestAddedWithZIndex(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.join("alice")
+	bob := s.join("bob")
+
+	if err := s.send(alice, stroke("s1", 7)); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.room.GetObject("s1"); got == nil || got.ZIndex != 7 {
+		t.Fatalf("stored object = %+v, want zIndex 7", got)
+	}
+	added := bob.next("objectAdded")
+	if obj := added["object"].(map[string]interface{}); obj["zIndex"] != float64(7) {
+		t.Errorf("broadcast zIndex = %v, want 7", obj["zIndex"])
+	}
+}
+
+func TestAddedWithoutZIndexIsBackfilled(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.join("alice")
+	bob := s.join("bob")
+
+	if err := s.send(alice, stroke("s1", 41)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.send(alice, stroke("s2", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.room.GetObject("s2"); got == nil || got.ZIndex != 42 {
+		t.Fatalf("stored object = %+v, want zIndex 42 (max+1)", got)
+	}
+	ack := alice.next("objectAck")
+	if ack["objectId"] != "s2" || ack["zIndex"] != float64(42) {
+		t.Errorf("ack = %v, want s2 at zIndex 42", ack)
+	}
+	bob.next("objectAdded") // s1
+	added := bob.next("objectAdded")
+	if obj := added["object"].(map[string]interface{}); obj["id"] != "s2" || obj["zIndex"] != float64(42) {
+		t.Errorf("broadcast object = %v, want s2 at zIndex 42", obj)
+	}
+}
+
+func TestAddedWithInvalidZIndex(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.join("alice")
+
+	for _, zIndex := range []interface{}{"3", 1.5, 2e6, -2e6} {
+		reply := s.reject(alice, stroke("s1", zIndex), CodeValidationFailed)
+		if reply["ref"] != "s1" {
+			t.Errorf("zIndex %v: ref = %v, want s1", zIndex, reply["ref"])
+		}
+		if s.room.GetObject("s1") != nil {
+			t.Fatalf("zIndex %v: object added", zIndex)
+		}
+	}
+}
+
+func TestRequireZIndex(t *testing.T) {
+	s := newTestServer(t)
+	s.config.RequireZIndex = true
+	alice := s.join("alice")
+
+	s.reject(alice, stroke("s1", nil), CodeValidationFailed)
+	if s.room.GetObject("s1") != nil {
+		t.Fatal("object without zIndex added in strict mode")
+	}
+	if err := s.send(alice, stroke("s1", 1)); err != nil {
+		t.Fatal(err)
+	}
+	if s.room.GetObject("s1") == nil {
+		t.Fatal("object with zIndex refused in strict mode")
+	}
+}
+
+// update: an objectUpdated message moving s1's stroke
+func update(id string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "objectUpdated",
+		"object": map[string]interface{}{
+			"id": id,
+			"data": map[string]interface{}{
+				"points": []map[string]int{{"x": 2, "y": 2}, {"x": 9, "y": 9}},
+				"color":  "#000000",
+				"width":  2,
+			},
+		},
+	}
+}
+
+func TestDeleteThenUpdateIsRejected(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.join("alice") // host, can edit everyone's drawings
+	bob := s.join("bob")
+	carol := s.join("carol")
+	if err := s.send(bob, stroke("s1", 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Bob deletes while alice's update is on the wire, the update arrives second
+	if err := s.send(bob, map[string]interface{}{"type": "objectDeleted", "objectId": "s1"}); err != nil {
+		t.Fatal(err)
+	}
+	reply := s.reject(alice, update("s1"), CodeObjectDeleted)
+	if reply["objectId"] != "s1" {
+		t.Errorf("objectId = %v, want s1", reply["objectId"])
+	}
+
+	if s.room.GetObject("s1") != nil {
+		t.Fatal("update resurrected the drawing")
+	}
+	// Carol sees the add and the delete, never the stale update
+	carol.next("objectAdded")
+	carol.next("objectDeleted")
+	if err := s.send(bob, stroke("marker", 2)); err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range carol.until("objectAdded") {
+		if msg["type"] == "objectUpdated" {
+			t.Errorf("stale update broadcast: %v", msg)
+		}
+	}
+}
+
+func TestUpdateThenDeleteBothApply(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.join("alice") // host, can edit everyone's drawings
+	bob := s.join("bob")
+	carol := s.join("carol")
+	if err := s.send(bob, stroke("s1", 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.send(alice, update("s1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.send(bob, map[string]interface{}{"type": "objectDeleted", "objectId": "s1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	carol.next("objectAdded")
+	carol.next("objectUpdated")
+	carol.next("objectDeleted")
+	if s.room.GetObject("s1") != nil {
+		t.Fatal("drawing still there after the delete")
+	}
+}
+
+func TestReaddingDeletedIDNeedsRevive(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.join("alice")
+	if err := s.send(alice, stroke("s1", 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.send(alice, map[string]interface{}{"type": "objectDeleted", "objectId": "s1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.reject(alice, stroke("s1", 1), CodeObjectDeleted)
+	if s.room.GetObject("s1") != nil {
+		t.Fatal("deleted ID re-added without revive")
+	}
+
+	revive := stroke("s1", 1)
+	revive["object"].(map[string]interface{})["revive"] = true
+	if err := s.send(alice, revive); err != nil {
+		t.Fatal(err)
+	}
+	if s.room.GetObject("s1") == nil {
+		t.Fatal("revive: true didn't re-add the drawing")
+	}
+	if s.room.IsDeleted("s1") {
+		t.Error("revived drawing still tombstoned")
+	}
+}
+
+// patch: an objectUpdated message with partial: true
+func patch(id string, fields map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type":   "objectUpdated",
+		"object": map[string]interface{}{"id": id, "data": fields, "partial": true},
+	}
+}
+
+// addRectangle: alice adds a rectangle r1
+func addRectangle(t *testing.T, s *testServer, alice *testClient) {
+	t.Helper()
+	err := s.send(alice, map[string]interface{}{
+		"type": "objectAdded",
+		"object": map[string]interface{}{
+			"id":   "r1",
+			"type": "rectangle",
+			"data": map[string]interface{}{"x1": 1, "y1": 2, "x2": 30, "y2": 40, "fill": "#ffffff", "color": "#000000"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPartialUpdateKeepsOtherFields(t *testing.T) {
+	s := newTestServer(t)
+	alice, bob := s.join("alice"), s.join("bob")
+	addRectangle(t, s, alice)
+
+	if err := s.send(alice, patch("r1", map[string]interface{}{"fill": "#ff0000"})); err != nil {
+		t.Fatal(err)
+	}
+	updated := bob.next("objectUpdated")["object"].(map[string]interface{})
+	data := updated["data"].(map[string]interface{})
+	if data["fill"] != "#ff0000" || data["x2"] != 30.0 || data["color"] != "#000000" {
+		t.Errorf("broadcast data = %v, want the merged rectangle", data)
+	}
+	if stored := s.room.GetObject("r1").Data; stored["fill"] != "#ff0000" || stored["y2"] != 40.0 {
+		t.Errorf("stored data = %v", stored)
+	}
+}
+
+func TestConcurrentPatchesApplyFieldWise(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.join("alice")
+	addRectangle(t, s, alice)
+
+	const rounds = 50
+	var wg sync.WaitGroup
+	for _, field := range []string{"fill", "color"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				value := fmt.Sprintf("#%s%02d", field[:1], i)
+				if err := s.send(alice, patch("r1", map[string]interface{}{field: value})); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	data := s.room.GetObject("r1").Data
+	want := fmt.Sprintf("%02d", rounds-1)
+	if data["fill"] != "#f"+want || data["color"] != "#c"+want || data["x1"] != 1.0 {
+		t.Errorf("data = %v, want both fields' last patch and the coordinates", data)
+	}
+}
+
+func TestPatchRejectsNestedFields(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.join("alice")
+	if err := s.send(alice, stroke("s1", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fields := range []map[string]interface{}{
+		{"points.0.x": 9},
+		{"points": map[string]interface{}{"0": map[string]interface{}{"x": 9, "y": 9}}},
+		{"points": []map[string]int{{"x": 9, "y": 9}}}, // whole field, but too short
+	} {
+		s.reject(alice, patch("s1", fields), CodeValidationFailed)
+	}
+	points := s.room.GetObject("s1").Data["points"].([]interface{})
+	if len(points) != 2 {
+		t.Errorf("stroke has %d points after rejected patches, want 2", len(points))
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"main/internal/object"
+	"main/internal/room"
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultMyObjectsLimit = 50
+	maxMyObjectsLimit     = 100 // max entries per getMyObjects page
+)
+
+// HandleGetMine: getMyObjects messages, lists the requester's drawings without data
+// Paginated by (createdAt, id), pass nextCursor back as cursor to continue
+func (h *ObjectHandler) HandleGetMine(rm *room.Room, u *user.User, data map[string]interface{}) error {
+	limit := defaultMyObjectsLimit
+	if rawLimit, ok := data["limit"].(float64); ok {
+		limit = int(rawLimit)
+		if limit < 1 || limit > maxMyObjectsLimit {
+			return fmt.Errorf("invalid limit: must be 1-%d", maxMyObjectsLimit)
+		}
+	}
+
+	var after *object.Drawing
+	if cursor, ok := data["cursor"].(string); ok && cursor != "" {
+		parsed, err := parseObjectCursor(cursor)
+		if err != nil {
+			return err
+		}
+		after = parsed
+	}
+
+	// Snapshot, so the listing is consistent even while the room keeps changing
+	owned := rm.ObjectsByUser(u.ID)
+	sort.Slice(owned, func(i, j int) bool {
+		return objectBefore(&owned[i], &owned[j])
+	})
+
+	start := 0
+	if after != nil {
+		start = sort.Search(len(owned), func(i int) bool {
+			return objectBefore(after, &owned[i])
+		})
+	}
+	end := min(start+limit, len(owned))
+
+	entries := make([]map[string]interface{}, 0, end-start)
+	for _, obj := range owned[start:end] {
+		entry := map[string]interface{}{
+			"id":        obj.ID,
+			"type":      obj.Type,
+			"pageId":    obj.PageID,
+			"zIndex":    obj.ZIndex,
+			"createdAt": obj.CreatedAt.UnixMilli(),
+			"updatedAt": obj.UpdatedAt.UnixMilli(),
+		}
+		if bounds, ok := object.BoundingBox(obj.Data); ok {
+			entry["bounds"] = bounds
+		}
+		entries = append(entries, entry)
+	}
+
+	response := map[string]interface{}{
+		"type":    "myObjects",
+		"objects": entries,
+		"total":   len(owned),
+	}
+	if end < len(owned) {
+		last := owned[end-1]
+		response["nextCursor"] = fmt.Sprintf("%d:%s", last.CreatedAt.UnixNano(), last.ID)
+	}
+
+	msg, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("marshal my objects: %w", err)
+	}
+	return u.WriteMessage(websocket.TextMessage, msg)
+}
+
+// HandleDeleteMine: deleteMyObjects messages, {objectIds} or {olderThan: "10m"}
+// Only the requester's drawings are deleted, each is broadcast like a normal delete
+func (h *ObjectHandler) HandleDeleteMine(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	if rm.IsFrozen() {
+		return sendError(u, CodeBoardFrozen, nil)
+	}
+
+	var objectIDs []string
+	if rawIDs, ok := data["objectIds"].([]interface{}); ok {
+		if len(rawIDs) > maxTransferBatch {
+			return fmt.Errorf("too many objects: %d (max %d)", len(rawIDs), maxTransferBatch)
+		}
+		for _, rawID := range rawIDs {
+			id, ok := rawID.(string)
+			if !ok {
+				return fmt.Errorf("invalid objectIds")
+			}
+			objectIDs = append(objectIDs, id)
+		}
+	}
+
+	var cutoff time.Time
+	if len(objectIDs) == 0 {
+		rawAge, ok := data["olderThan"].(string)
+		if !ok {
+			return fmt.Errorf("missing objectIds or olderThan")
+		}
+		age, err := time.ParseDuration(rawAge)
+		if err != nil || age < 0 {
+			return fmt.Errorf("invalid olderThan: %s", rawAge)
+		}
+		cutoff = time.Now().Add(-age)
+	}
+
+	deleted := rm.DeleteOwnedObjects(u.ID, objectIDs, cutoff)
+
+	// Everyone (sender included) gets the usual objectDeleted per drawing
+	for _, id := range deleted {
+		msg, err := json.Marshal(ObjectDeletedEvent{Type: "objectDeleted", ObjectID: id, UserID: u.ID, Revision: rm.Revision()})
+		if err != nil {
+			return fmt.Errorf("marshal broadcast message: %w", err)
+		}
+		h.broadcaster.Broadcast(ctx, rm, msg, nil, room.TagObject)
+	}
+	return nil
+}
+
+// objectBefore: listing order, oldest first, ID breaks ties
+func objectBefore(a, b *object.Drawing) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ID < b.ID
+}
+
+// parseObjectCursor: decodes "createdAtNanos:id" into a sort key
+func parseObjectCursor(cursor string) (*object.Drawing, error) {
+	nanos, id, found := strings.Cut(cursor, ":")
+	if !found {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &object.Drawing{ID: id, CreatedAt: time.Unix(0, n)}, nil
+}
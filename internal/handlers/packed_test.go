@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"main/internal/msgpack"
+	"main/internal/object"
+)
+
+// drawing: the object of a stroke message
+func drawing(id string) interface{} {
+	return stroke(id, nil)["object"]
+}
+
+// syncUserIDs: sorted userIds of a sync message's users
+func syncUserIDs(sync map[string]interface{}) []string {
+	var ids []string
+	for _, u := range sync["users"].([]interface{}) {
+		ids = append(ids, u.(map[string]interface{})["userId"].(string))
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// packedFixtures: a message of each type the way clients send it, without the
+// type field (types with no other fields have an empty one)
+var packedFixtures = map[string]map[string]interface{}{
+	"acceptTerms":     {"version": "2024-05"},
+	"cancelTimer":     {},
+	"chat":            {"text": "héllo ✏️"},
+	"clearBoard":      {},
+	"createPage":      {"name": "Sketches"},
+	"cursor":          {"x": 10.25, "y": -3, "timestamp": 1_700_000_000_123},
+	"deleteMyObjects": {"objectIds": []interface{}{"a", "b"}},
+	"deletePage":      {"pageId": "p1", "force": true},
+	"getMyObjects":    {"limit": 50, "cursor": "s1"},
+	"getRateStatus":   {},
+	"getSessionInfo":  {},
+	"getUserId":       {},
+	"importObjects": {"board": map[string]interface{}{
+		"version": object.BoardFormatVersion,
+		"objects": []interface{}{drawing("s1"), drawing("s2")},
+	}},
+	"kickUser":        {"userId": "bob", "ban": true},
+	"lockObject":      {"objectId": "s1"},
+	"mergeFrom":       {"source": "ABC123", "dx": 640, "dy": -12.5, "deleteSource": true},
+	"objectAdded":     {"object": stroke("s1", 3)["object"]},
+	"objectDeleted":   {"objectId": "s1"},
+	"objectReordered": {"objectId": "s1", "command": "front"},
+	"objectReplaced":  {"objectId": "s1", "objects": []interface{}{drawing("s1a"), drawing("s1b")}},
+	"objectUpdated": {"object": map[string]interface{}{
+		"id": "s1", "partial": true, "data": map[string]interface{}{"color": "#ff0000", "width": 2.5},
+	}},
+	"objectsAdded": {"objects": []interface{}{drawing("s1"), drawing("s2")}},
+	"objectsTransformed": {
+		"objectIds": []interface{}{"s1", "s2"},
+		"dx":        5, "dy": -5, "scale": 1.5, "rotation": -90,
+		"origin": map[string]interface{}{"x": 0.5, "y": 100},
+	},
+	"redo":       {},
+	"renamePage": {"pageId": "p1", "name": "Ideas"},
+	"replaceText": {
+		"find": "teh", "replace": "the", "caseSensitive": false, "dryRun": true,
+		"filter": map[string]interface{}{"userId": "alice", "pageId": "p1"},
+	},
+	"restoreLastClear":  {},
+	"revokeSession":     {},
+	"setName":           {"name": "Ada Lovelace"},
+	"setPermissions":    {"permissions": map[string]interface{}{"editor": map[string]interface{}{"draw": true, "erase-others": false}}},
+	"setRoomLocale":     {"locale": "es"},
+	"setSubscriptions":  {"cursors": false, "pageId": "p1"},
+	"startTimer":        {"duration": 300},
+	"switchPage":        {"pageId": "p1"},
+	"timeSync":          {"clientTime": 1_700_000_000_123.5},
+	"transferOwnership": {"objectIds": []interface{}{"s1"}, "fromUserId": "alice", "toUserId": "bob"},
+	"undo":              {},
+	"undoHostAction":    {},
+	"unlockObject":      {"objectId": "s1"},
+	"validateObjects":   {"objects": []interface{}{drawing("s1")}},
+}
+
+func TestEveryMessageTypeRoundTrips(t *testing.T) {
+	for _, spec := range Messages() {
+		fields, ok := packedFixtures[spec.Type]
+		if !ok {
+			t.Errorf("%s: no fixture", spec.Type)
+			continue
+		}
+		payload := map[string]interface{}{"type": spec.Type}
+		for key, value := range fields {
+			payload[key] = value
+		}
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var fromJSON interface{}
+		if err := json.Unmarshal(encoded, &fromJSON); err != nil {
+			t.Fatal(err)
+		}
+		packed, err := msgpack.FromJSON(encoded)
+		if err != nil {
+			t.Fatalf("%s: %v", spec.Type, err)
+		}
+		fromPacked, err := msgpack.Unmarshal(packed, 10, 1000)
+		if err != nil {
+			t.Fatalf("%s: %v", spec.Type, err)
+		}
+		if !reflect.DeepEqual(fromPacked, fromJSON) {
+			t.Errorf("%s: msgpack decodes to %v, JSON to %v", spec.Type, fromPacked, fromJSON)
+		}
+	}
+}
+
+func TestRoutePackedLikeJSON(t *testing.T) {
+	s := newTestServer(t)
+	alice, bob := s.join("alice"), s.join("bob")
+
+	encoded, err := json.Marshal(stroke("s1", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packed, err := msgpack.FromJSON(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.router.RoutePacked(t.Context(), s.room, alice.user, packed); err != nil {
+		t.Fatal(err)
+	}
+	alice.next("objectAck")
+	added := bob.next("objectAdded")["object"].(map[string]interface{})
+	if added["id"] != "s1" || s.room.GetObject("s1") == nil {
+		t.Errorf("objectAdded = %v", added)
+	}
+}
+
+func TestRoutePackedRejectsMalformed(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.join("alice")
+
+	list, err := msgpack.Marshal([]interface{}{"objectAdded"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, frame := range map[string][]byte{
+		"truncated": {0x82, 0xa4, 't', 'y'},
+		"not a map": list,
+	} {
+		err := s.router.RoutePacked(t.Context(), s.room, alice.user, frame)
+		var msgErr *MessageError
+		if !errors.As(err, &msgErr) || msgErr.Code != CodeInvalidMessage {
+			t.Errorf("%s: err = %v, want %s", name, err, CodeInvalidMessage)
+		}
+	}
+}
+
+func TestPackedConnectionReceivesServerFrames(t *testing.T) {
+	s := newTestServer(t)
+	alice, bob, carol := s.join("alice"), s.join("bob"), s.joinPacked("carol")
+	s.router.Joined(s.room, alice.user)
+
+	// replies to the sender, transcoded by the writer
+	encoded, err := json.Marshal(stroke("c1", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packed, err := msgpack.FromJSON(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.router.RoutePacked(t.Context(), s.room, carol.user, packed); err != nil {
+		t.Fatal(err)
+	}
+	added := bob.next("objectAdded")
+	zIndex := added["object"].(map[string]interface{})["zIndex"]
+	if ack := carol.next("objectAck"); ack["objectId"] != "c1" || ack["zIndex"] != zIndex {
+		t.Errorf("objectAck = %v, want c1 at zIndex %v", ack, zIndex)
+	}
+
+	if got := alice.next("objectAdded"); !reflect.DeepEqual(got, added) {
+		t.Errorf("objectAdded from a MessagePack connection: %v to alice, %v to bob", got, added)
+	}
+
+	// broadcasts, encoded once for every MessagePack connection
+	drawStrokes(t, s, alice, "a", 2)
+	for i := 0; i < 2; i++ {
+		if got, want := carol.next("objectAdded"), bob.next("objectAdded"); !reflect.DeepEqual(got, want) {
+			t.Errorf("objectAdded: MessagePack %v, JSON %v", got, want)
+		}
+	}
+
+	// cursor batches, moves between flushes become the trail
+	if err := s.send(alice, map[string]interface{}{"type": "cursor", "x": 0, "y": 0}); err != nil {
+		t.Fatal(err)
+	}
+	bob.next("cursors")
+	carol.next("cursors")
+	for i := 1; i <= 4; i++ {
+		if err := s.send(alice, map[string]interface{}{"type": "cursor", "x": 10 * i, "y": 5 * i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var want map[string]interface{}
+	batches := 0
+	for want == nil || want["cursors"].([]interface{})[0].(map[string]interface{})["x"] != 40.0 {
+		want = bob.next("cursors")
+		batches++
+	}
+	var got map[string]interface{}
+	for i := 0; i < batches; i++ {
+		got = carol.next("cursors")
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cursors: MessagePack %v, JSON %v", got, want)
+	}
+	if cursor := got["cursors"].([]interface{})[0].(map[string]interface{}); cursor["trail"] == nil {
+		t.Errorf("cursor = %v, want a trail", cursor)
+	}
+
+	// the full board, sent to each connection on a resync
+	for _, msg := range []map[string]interface{}{{"type": "clearBoard"}, {"type": "restoreLastClear"}} {
+		if err := s.send(alice, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, want = carol.next("sync"), bob.next("sync")
+	if gotUsers, wantUsers := syncUserIDs(got), syncUserIDs(want); !reflect.DeepEqual(gotUsers, wantUsers) {
+		t.Errorf("sync users: MessagePack %v, JSON %v", gotUsers, wantUsers)
+	}
+	delete(got, "users") // listed in no particular order
+	delete(want, "users")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sync: MessagePack %v, JSON %v", got, want)
+	}
+	if objects := got["objects"].([]interface{}); len(objects) != 3 {
+		t.Errorf("sync has %d objects, want 3", len(objects))
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"main/internal/object"
+	"main/internal/room"
+	"main/internal/user"
+)
+
+// maxPageNameLength: max characters in a page name
+const maxPageNameLength = 100
+
+// PageHandler: handles page (board tab) messages
+type PageHandler struct {
+	validator   *object.Validator
+	broadcaster *room.Broadcaster
+}
+
+func NewPageHandler(validator *object.Validator, broadcaster *room.Broadcaster) *PageHandler {
+	return &PageHandler{
+		validator:   validator,
+		broadcaster: broadcaster,
+	}
+}
+
+// HandleCreate: createPage messages, broadcast to everyone (sender learns the new ID)
+func (h *PageHandler) HandleCreate(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	name, err := h.pageName(data)
+	if err != nil {
+		return err
+	}
+
+	page, err := rm.CreatePage(name)
+	if err != nil {
+		return err
+	}
+
+	return h.broadcastAll(ctx, rm, map[string]interface{}{
+		"type":   "pageCreated",
+		"page":   page,
+		"userId": u.ID,
+	})
+}
+
+// HandleRename: renamePage messages
+func (h *PageHandler) HandleRename(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	pageID, ok := data["pageId"].(string)
+	if !ok {
+		return fmt.Errorf("missing pageId")
+	}
+
+	name, err := h.pageName(data)
+	if err != nil {
+		return err
+	}
+
+	if err := rm.RenamePage(pageID, name); err != nil {
+		return err
+	}
+
+	return h.broadcastAll(ctx, rm, map[string]interface{}{
+		"type":   "pageRenamed",
+		"page":   room.Page{ID: pageID, Name: name},
+		"userId": u.ID,
+	})
+}
+
+// HandleDelete: deletePage messages (clear), force required if page has objects
+func (h *PageHandler) HandleDelete(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	pageID, ok := data["pageId"].(string)
+	if !ok {
+		return fmt.Errorf("missing pageId")
+	}
+	force, _ := data["force"].(bool)
+
+	// Forced deletes can take drawings with them, keep a way back
+	if force {
+		if allowed, err := beginDestructive(rm, u, "deletePage"); !allowed {
+			return err
+		}
+	}
+
+	objectIDs, err := rm.DeletePage(pageID, force)
+	if err != nil {
+		return err
+	}
+
+	if objectIDs == nil {
+		objectIDs = []string{}
+	}
+	return h.broadcastAll(ctx, rm, map[string]interface{}{
+		"type":      "pageDeleted",
+		"pageId":    pageID,
+		"objectIds": objectIDs,
+		"userId":    u.ID,
+	})
+}
+
+// HandleSwitch: switchPage messages, only tracked server-side (used for cursor filtering)
+func (h *PageHandler) HandleSwitch(rm *room.Room, u *user.User, data map[string]interface{}) error {
+	pageID, ok := data["pageId"].(string)
+	if !ok {
+		return fmt.Errorf("missing pageId")
+	}
+	return rm.SwitchPage(u.ID, pageID)
+}
+
+// pageName: reads and sanitizes the name field
+func (h *PageHandler) pageName(data map[string]interface{}) (string, error) {
+	name, ok := data["name"].(string)
+	if !ok {
+		return "", fmt.Errorf("missing page name")
+	}
+
+	name = strings.TrimSpace(h.validator.SanitizeString(name))
+	if name == "" || len(name) > maxPageNameLength {
+		return "", fmt.Errorf("page name must be 1-%d characters", maxPageNameLength)
+	}
+	return name, nil
+}
+
+// broadcastAll: sends message to every user in the room, including the sender
+func (h *PageHandler) broadcastAll(ctx context.Context, rm *room.Room, payload map[string]interface{}) error {
+	payload["revision"] = rm.Revision()
+	msg, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal page message: %w", err)
+	}
+	h.broadcaster.Broadcast(ctx, rm, msg, nil, room.TagRoom)
+	return nil
+}
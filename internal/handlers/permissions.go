@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"main/internal/room"
+	"main/internal/user"
+)
+
+// requiredCapability: capability checked by the router before dispatching a message
+// Messages not listed (cursor, timeSync, reads, ...) are open to every role
+var requiredCapability = map[string]string{
+	"objectAdded":        room.CapDraw,
+	"objectsAdded":       room.CapDraw,
+	"objectUpdated":      room.CapDraw,
+	"objectDeleted":      room.CapDraw,
+	"objectReplaced":     room.CapDraw,
+	"objectReordered":    room.CapDraw,
+	"objectsTransformed": room.CapDraw,
+	"lockObject":         room.CapDraw,
+	"unlockObject":       room.CapDraw,
+	"deleteMyObjects":    room.CapDraw,
+	"undo":               room.CapDraw,
+	"redo":               room.CapDraw,
+	"createPage":         room.CapManagePages,
+	"renamePage":         room.CapManagePages,
+	"deletePage":         room.CapClear,
+	"clearBoard":         room.CapClear,
+	"undoHostAction":     room.CapClear,
+	"importObjects":      room.CapManageSettings,
+	"transferOwnership":  room.CapManageSettings,
+	"replaceText":        room.CapManageSettings,
+	"startTimer":         room.CapManageSettings,
+	"cancelTimer":        room.CapManageSettings,
+	"setRoomLocale":      room.CapManageSettings,
+	"setPermissions":     room.CapManageSettings,
+	"chat":               room.CapChat,
+	"kickUser":           room.CapModerate,
+}
+
+// spectatorDenied: ungated messages spectators can't send either (everything
+// gated is already denied, the spectator role has no capabilities)
+var spectatorDenied = map[string]bool{
+	"cursor":           true,
+	"restoreLastClear": true, // a user may restore their own purge without capabilities
+}
+
+// PermissionsHandler: host changes to the room's permission matrix
+type PermissionsHandler struct {
+	broadcaster *room.Broadcaster
+}
+
+func NewPermissionsHandler(broadcaster *room.Broadcaster) *PermissionsHandler {
+	return &PermissionsHandler{
+		broadcaster: broadcaster,
+	}
+}
+
+// HandleSet: setPermissions messages (manage-settings), {permissions: {role: {capability: bool}}}
+func (h *PermissionsHandler) HandleSet(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	raw, ok := data["permissions"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("missing permissions")
+	}
+
+	changes := make(map[string]map[string]bool, len(raw))
+	for role, rawGranted := range raw {
+		granted, ok := rawGranted.(map[string]interface{})
+		if !ok {
+			return sendError(u, CodeInvalidPermissions, map[string]interface{}{"reason": "invalid capabilities for " + role})
+		}
+		changes[role] = make(map[string]bool, len(granted))
+		for capability, rawAllowed := range granted {
+			allowed, ok := rawAllowed.(bool)
+			if !ok {
+				return sendError(u, CodeInvalidPermissions, map[string]interface{}{"reason": "invalid value for " + capability})
+			}
+			changes[role][capability] = allowed
+		}
+	}
+
+	if err := rm.SetPermissions(changes); err != nil {
+		return sendError(u, CodeInvalidPermissions, map[string]interface{}{"reason": err.Error()})
+	}
+	auditHostAction(rm, u, "setPermissions", "applied")
+
+	msg, err := json.Marshal(map[string]interface{}{
+		"type":        "permissionsChanged",
+		"permissions": rm.Permissions(),
+		"userId":      u.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal permissions: %w", err)
+	}
+	h.broadcaster.Broadcast(ctx, rm, msg, nil, room.TagRoom)
+	return nil
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"testing"
+)
+
+func TestCustomPermissionsMatrix(t *testing.T) {
+	s := newTestServer(t)
+	alice, bob := s.join("alice"), s.join("bob")
+	if err := s.send(alice, stroke("s1", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Editors may draw, but not erase others' drawings
+	if err := s.send(alice, map[string]interface{}{
+		"type":        "setPermissions",
+		"permissions": map[string]interface{}{"editor": map[string]interface{}{"draw": true, "erase-others": false}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	changed := bob.next("permissionsChanged")
+	editor := changed["permissions"].(map[string]interface{})["editor"].(map[string]interface{})
+	if editor["draw"] != true || editor["erase-others"] != false {
+		t.Errorf("broadcast editor permissions = %v", editor)
+	}
+
+	if err := s.send(bob, stroke("s2", nil)); err != nil {
+		t.Fatalf("editor drawing: %v", err)
+	}
+	s.reject(bob, map[string]interface{}{"type": "objectDeleted", "objectId": "s1"}, CodePermissionDenied)
+	if s.room.GetObject("s1") == nil {
+		t.Fatal("editor erased the host's drawing")
+	}
+	if err := s.send(bob, map[string]interface{}{"type": "objectDeleted", "objectId": "s2"}); err != nil {
+		t.Fatalf("editor erasing their own drawing: %v", err)
+	}
+
+	// Without draw, editors can't add anything
+	if err := s.send(alice, map[string]interface{}{
+		"type":        "setPermissions",
+		"permissions": map[string]interface{}{"editor": map[string]interface{}{"draw": false}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	s.reject(bob, stroke("s3", nil), CodeForbidden)
+}
+
+func TestSetPermissionsRejected(t *testing.T) {
+	s := newTestServer(t)
+	alice, bob := s.join("alice"), s.join("bob")
+
+	s.reject(bob, map[string]interface{}{
+		"type":        "setPermissions",
+		"permissions": map[string]interface{}{"editor": map[string]interface{}{"clear": true}},
+	}, CodeForbidden)
+	s.reject(alice, map[string]interface{}{
+		"type":        "setPermissions",
+		"permissions": map[string]interface{}{"editor": map[string]interface{}{"teleport": true}},
+	}, CodeInvalidPermissions)
+	s.reject(alice, map[string]interface{}{
+		"type":        "setPermissions",
+		"permissions": map[string]interface{}{"editor": map[string]interface{}{"clear": "yes"}},
+	}, CodeInvalidPermissions)
+
+	if s.room.Can(bob.user.ID, "clear") {
+		t.Error("rejected setPermissions applied")
+	}
+}
+
+func TestMatrixGatesHostActions(t *testing.T) {
+	s := newTestServer(t)
+	alice, bob := s.join("alice"), s.join("bob")
+	if err := s.send(alice, stroke("s1", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Editors have neither clear nor manage-settings by default
+	s.reject(bob, map[string]interface{}{"type": "clearBoard"}, CodeForbidden)
+	s.reject(bob, map[string]interface{}{"type": "undoHostAction"}, CodeForbidden)
+	s.reject(bob, map[string]interface{}{
+		"type":        "setPermissions",
+		"permissions": map[string]interface{}{"editor": map[string]interface{}{"clear": true}},
+	}, CodeForbidden)
+	if s.room.ObjectCount() != 1 {
+		t.Fatal("editor cleared the board")
+	}
+
+	if err := s.send(alice, map[string]interface{}{
+		"type":        "setPermissions",
+		"permissions": map[string]interface{}{"editor": map[string]interface{}{"clear": true, "manage-settings": true}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	bob.next("permissionsChanged")
+
+	if err := s.send(bob, map[string]interface{}{"type": "clearBoard"}); err != nil {
+		t.Fatal(err)
+	}
+	alice.next("boardCleared")
+	if err := s.send(bob, map[string]interface{}{"type": "undoHostAction"}); err != nil {
+		t.Fatal(err)
+	}
+	alice.next("hostActionUndone")
+	if s.room.GetObject("s1") == nil {
+		t.Error("undoHostAction didn't restore the drawing")
+	}
+	if err := s.send(bob, map[string]interface{}{
+		"type":        "setPermissions",
+		"permissions": map[string]interface{}{"editor": map[string]interface{}{"clear": false}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	alice.next("permissionsChanged")
+	s.reject(bob, map[string]interface{}{"type": "clearBoard"}, CodeForbidden)
+}
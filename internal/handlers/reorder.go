@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"main/internal/room"
+	"main/internal/user"
+)
+
+// reorderCommands: objectReordered commands, resolved to a zIndex by the room
+var reorderCommands = map[string]bool{
+	room.ZFront: true, room.ZBack: true, room.ZForward: true, room.ZBackward: true,
+}
+
+// HandleReordered: objectReordered messages, {objectId, command} (front, back,
+// forward, backward) or {objectId, zIndex}. Everyone, the sender included, gets
+// the resolved zIndex of every drawing that moved so all clients converge
+func (h *ObjectHandler) HandleReordered(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	if rm.IsFrozen() {
+		return sendError(u, CodeBoardFrozen, nil)
+	}
+
+	objectID, ok := data["objectId"].(string)
+	if !ok {
+		return fmt.Errorf("missing objectId")
+	}
+	command, hasCommand := data["command"].(string)
+	zIndex := 0
+	if hasCommand {
+		if !reorderCommands[command] {
+			return fmt.Errorf("invalid command: %s (allowed: front, back, forward, backward)", command)
+		}
+	} else {
+		rawZIndex, hasZIndex := data["zIndex"]
+		if !hasZIndex {
+			return fmt.Errorf("missing command or zIndex")
+		}
+		parsed, err := parseZIndex(rawZIndex)
+		if err != nil {
+			return err
+		}
+		zIndex = parsed
+	}
+
+	existing := rm.GetObject(objectID)
+	if existing == nil {
+		return sendError(u, CodeObjectDeleted, map[string]interface{}{"objectId": objectID})
+	}
+	if err := checkOwner(rm, u, objectID, room.CapEditOthers); err != nil {
+		return err
+	}
+	if holder := rm.LockHolder(objectID); holder != "" && holder != u.ID {
+		return sendError(u, CodeObjectLocked, map[string]interface{}{"objectId": objectID, "lockedBy": holder})
+	}
+
+	moved, found, err := rm.ReorderObject(objectID, command, zIndex)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return sendError(u, CodeObjectDeleted, map[string]interface{}{"objectId": objectID})
+	}
+
+	msg, err := json.Marshal(map[string]interface{}{
+		"type":     "objectReordered",
+		"objectId": objectID,
+		"zIndex":   moved[objectID],
+		"zIndexes": moved,
+		"userId":   u.ID,
+		"revision": rm.Revision(),
+	})
+	if err != nil {
+		return fmt.Errorf("marshal broadcast message: %w", err)
+	}
+	h.broadcaster.Broadcast(ctx, rm, msg, nil, room.ObjectTag(existing.PageID))
+	return nil
+}
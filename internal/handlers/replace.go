@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+
+	"main/internal/object"
+	"main/internal/room"
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxReplaceBatch: text objects scanned per replaceText message (continue with nextCursor)
+const maxReplaceBatch = 200
+
+// HandleReplaceText: replaceText messages (manage-settings)
+// {find, replace, caseSensitive, filter: {userId, pageId}, dryRun, cursor}
+func (h *ObjectHandler) HandleReplaceText(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	find, ok := data["find"].(string)
+	if !ok || find == "" {
+		return fmt.Errorf("missing find")
+	}
+	replace, _ := data["replace"].(string)
+	if len(find) > object.MaxStringLength || len(replace) > object.MaxStringLength {
+		return fmt.Errorf("find/replace too long")
+	}
+	caseSensitive, _ := data["caseSensitive"].(bool)
+	dryRun, _ := data["dryRun"].(bool)
+	cursor, _ := data["cursor"].(string)
+
+	if !dryRun && rm.IsFrozen() {
+		return sendError(u, CodeBoardFrozen, nil)
+	}
+	if !dryRun {
+		if allowed, err := beginDestructive(rm, u, "replaceText"); !allowed {
+			return err
+		}
+	}
+
+	filter, _ := data["filter"].(map[string]interface{})
+	filterUser, _ := filter["userId"].(string)
+	filterPage, _ := filter["pageId"].(string)
+	keep := func(obj *object.Drawing) bool {
+		return (filterUser == "" || obj.UserID == filterUser) && (filterPage == "" || obj.PageID == filterPage)
+	}
+
+	pattern := regexp.QuoteMeta(find)
+	if !caseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	re := regexp.MustCompile(pattern)
+
+	// Result must pass the same sanitizing and length limit as client-sent text
+	matches, skipped := 0, 0
+	rewrite := func(text string) (string, bool) {
+		found := len(re.FindAllStringIndex(text, -1))
+		if found == 0 {
+			return "", false
+		}
+		result := h.validator.SanitizeString(re.ReplaceAllLiteralString(text, replace))
+		if utf8.RuneCountInString(result) > object.MaxStringLength {
+			skipped++
+			return "", false
+		}
+		matches += found
+		return result, true
+	}
+
+	changed, next := rm.RewriteText(keep, rewrite, cursor, maxReplaceBatch, dryRun)
+
+	if !dryRun && len(changed) > 0 {
+		auditHostAction(rm, u, "replaceText", fmt.Sprintf("%d objects changed", len(changed)))
+
+		objects := make([]map[string]interface{}, 0, len(changed))
+		for _, obj := range changed {
+			objects = append(objects, map[string]interface{}{"id": obj.ID, "data": obj.Data})
+		}
+		msg, err := json.Marshal(map[string]interface{}{
+			"type":     "textReplaced",
+			"objects":  objects,
+			"userId":   u.ID,
+			"revision": rm.Revision(),
+		})
+		if err != nil {
+			return fmt.Errorf("marshal broadcast message: %w", err)
+		}
+		h.broadcaster.Broadcast(ctx, rm, msg, nil, room.TagObject)
+	}
+
+	result := map[string]interface{}{
+		"type":     "replaceResult",
+		"dryRun":   dryRun,
+		"modified": len(changed), // objects (that would be) changed
+		"matches":  matches,
+		"skipped":  skipped, // result would exceed the text length limit
+	}
+	if next != "" {
+		result["nextCursor"] = next
+	}
+
+	msg, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("marshal replace result: %w", err)
+	}
+	return u.WriteMessage(websocket.TextMessage, msg)
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"main/internal/room"
+)
+
+// provisionalStroke: an objectAdded for an unfinished stroke
+func provisionalStroke(id string) map[string]interface{} {
+	msg := stroke(id, nil)
+	msg["object"].(map[string]interface{})["provisional"] = true
+	return msg
+}
+
+// waiting: number of timers pending on the clock
+func (c *fakeClock) waiting() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+func TestReplacedConnectionLeavingKeepsDrawings(t *testing.T) {
+	s, clock := timedServer(t)
+	bob := s.join("bob")
+	first := s.join("alice")
+	if err := s.send(first, provisionalStroke("draft")); err != nil {
+		t.Fatal(err)
+	}
+	first.next("objectAck")
+
+	// A second tab of the session takes over, then the first one's cleanup runs
+	second := s.join("alice")
+	if reply := first.next("error"); reply["code"] != room.CodeSignedInElsewhere {
+		t.Errorf("first tab got %v, want %s", reply["code"], room.CodeSignedInElsewhere)
+	}
+	present := s.room.Leave(first.user)
+	s.router.Left(s.room, first.user, present)
+	if present || !s.room.Connected(second.user) {
+		t.Fatalf("first tab's leave: present %v, second tab connected %v", present, s.room.Connected(second.user))
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := clock.waiting(); n != 0 {
+		t.Fatalf("%d cleanups scheduled for a replaced connection", n)
+	}
+
+	// Once the second tab leaves too, the grace runs out as usual
+	s.router.Left(s.room, second.user, s.room.Leave(second.user))
+	clock.advance(t, provisionalGrace, provisionalGrace)
+	if deleted := bob.next("objectDeleted"); deleted["objectId"] != "draft" {
+		t.Errorf("objectDeleted = %v", deleted)
+	}
+}
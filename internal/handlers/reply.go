@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+)
+
+// sendError: replies to the sender with an error message (not broadcast)
+// message is the code's text in the sender's locale, details fill its placeholders
+func sendError(u *user.User, code string, details map[string]interface{}) error {
+	response := map[string]interface{}{
+		"type": "error",
+		"code": code,
+	}
+	for k, v := range details {
+		response[k] = v
+	}
+	response["message"] = u.Text(code, details)
+
+	msg, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("marshal error response: %w", err)
+	}
+	return u.WriteMessage(websocket.TextMessage, msg)
+}
@@ -1,59 +1,363 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"sort"
+	"time"
 
+	"main/internal/metrics"
 	"main/internal/middleware"
+	"main/internal/msgpack"
 	internalObject "main/internal/object"
-	internalUser "main/internal/user"
 	"main/internal/room"
+	"main/internal/tracing"
+	internalUser "main/internal/user"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"golang.org/x/time/rate"
 )
 
 // MessageRouter routes incoming messages to appropriate handlers
 type MessageRouter struct {
-	objectHandler *ObjectHandler
-	cursorHandler *CursorHandler
-	userHandler   *UserHandler
+	objectHandler  *ObjectHandler
+	cursorHandler  *CursorHandler
+	userHandler    *UserHandler
+	pageHandler    *PageHandler
+	chatHandler    *ChatHandler
+	clockHandler   *ClockHandler
+	timerHandler   *TimerHandler
+	historyHandler *HistoryHandler
+	permsHandler   *PermissionsHandler
+	localeHandler  *LocaleHandler
+	hostHandler    *HostHandler
+	mergeHandler   *MergeHandler
+	broadcaster    *room.Broadcaster
+	config         *middleware.RateLimit
 }
 
 func NewMessageRouter(
 	validator *internalObject.Validator,
 	config *middleware.RateLimit,
-	sessionMgr SessionProvider,
 	broadcaster *room.Broadcaster,
+	synchronizer *room.Synchronizer,
+	sessions *internalUser.SessionManager,
 ) *MessageRouter {
 	return &MessageRouter{
-		objectHandler: NewObjectHandler(validator, config, broadcaster),
-		cursorHandler: NewCursorHandler(sessionMgr, broadcaster),
-		userHandler:   NewUserHandler(),
+		objectHandler:  NewObjectHandler(validator, config, broadcaster),
+		cursorHandler:  NewCursorHandler(broadcaster),
+		userHandler:    NewUserHandler(config, sessions, validator, broadcaster),
+		pageHandler:    NewPageHandler(validator, broadcaster),
+		chatHandler:    NewChatHandler(validator, broadcaster),
+		clockHandler:   NewClockHandler(),
+		timerHandler:   NewTimerHandler(broadcaster),
+		historyHandler: NewHistoryHandler(config, broadcaster),
+		permsHandler:   NewPermissionsHandler(broadcaster),
+		localeHandler:  NewLocaleHandler(broadcaster),
+		hostHandler:    NewHostHandler(config, broadcaster, synchronizer),
+		mergeHandler:   NewMergeHandler(config, broadcaster),
+		broadcaster:    broadcaster,
+		config:         config,
 	}
 }
 
+// EnableMerge: lets hosts merge other rooms' boards into theirs (mergeFrom),
+// rooms is where sources are looked up. Returns the handler for the HTTP endpoint
+// Must be called before serving
+func (mr *MessageRouter) EnableMerge(rooms RoomLookup) *MergeHandler {
+	mr.mergeHandler.rooms = rooms
+	return mr.mergeHandler
+}
+
 // Route: process a message via appropriate handler
-func (mr *MessageRouter) Route(rm *room.Room, u *internalUser.User, msg []byte) error {
+// Returned errors are MessageErrors for the sender (see ReplyError)
+func (mr *MessageRouter) Route(ctx context.Context, rm *room.Room, u *internalUser.User, msg []byte) error {
 	var data map[string]interface{}
 	if err := json.Unmarshal(msg, &data); err != nil {
-		return fmt.Errorf("unmarshal base message: %w", err)
+		return &MessageError{Code: CodeInvalidMessage, Message: "invalid JSON", Err: err}
+	}
+	return mr.route(ctx, rm, u, data, len(msg))
+}
+
+// RouteBinary: process a binary frame (see decodeBinary), it's then handled
+// exactly like its JSON equivalent
+func (mr *MessageRouter) RouteBinary(ctx context.Context, rm *room.Room, u *internalUser.User, frame []byte) error {
+	data, err := decodeBinary(frame)
+	if err != nil {
+		metrics.MessagesRejected.WithLabelValues(metrics.RejectProtocol).Inc()
+		return err
+	}
+	return mr.route(ctx, rm, u, data, len(frame))
+}
+
+// RoutePacked: process a MessagePack encoded message (connections that chose
+// that encoding), it's then handled exactly like its JSON equivalent
+func (mr *MessageRouter) RoutePacked(ctx context.Context, rm *room.Room, u *internalUser.User, frame []byte) error {
+	decoded, err := msgpack.Unmarshal(frame, mr.config.MaxJSONDepth, mr.config.MaxJSONTokens)
+	if err != nil {
+		metrics.MessagesRejected.WithLabelValues(metrics.RejectProtocol).Inc()
+		return &MessageError{Code: CodeInvalidMessage, Message: "invalid msgpack", Err: err}
+	}
+	data, ok := decoded.(map[string]interface{})
+	if !ok {
+		return NewError(CodeInvalidMessage, "message must be a map")
+	}
+	return mr.route(ctx, rm, u, data, len(frame))
+}
+
+// route: rate limits, role check and dispatch for a decoded message of size bytes
+func (mr *MessageRouter) route(ctx context.Context, rm *room.Room, u *internalUser.User, data map[string]interface{}, size int) error {
+	// The room was closed by an operator or the sender removed from it (kicked),
+	// the connection is being closed
+	if rm.Context().Err() != nil || !rm.Connected(u) {
+		return nil
 	}
 
 	messageType, ok := data["type"].(string)
 	if !ok {
-		return fmt.Errorf("missing message type")
+		return NewError(CodeInvalidMessage, "missing message type")
+	}
+
+	// Unknown types are rejected before they use up any rate budget
+	limiter, known := messageLimiters[messageType]
+	if !known {
+		metrics.MessagesReceived.WithLabelValues("unknown").Inc()
+		return NewError(CodeUnknownType, "unknown message type: %s", messageType)
 	}
+	metrics.MessagesReceived.WithLabelValues(messageType).Inc()
+	if !limiter.of(u).Allow() {
+		metrics.MessagesRejected.WithLabelValues(metrics.RejectRateLimit).Inc()
+		u.Logger().Warn("Rate limit exceeded", "type", messageType)
+		// One notice per second at most, a flood shouldn't get a reply per message
+		if !u.NoticeAllowed(time.Second) {
+			return nil
+		}
+		return mr.userHandler.Throttled(u, messageType)
+	}
+
+	// Deployments with terms only take control messages until they're accepted
+	if mr.userHandler.TermsPending(u, messageType) {
+		return mr.userHandler.TermsRequired(u, messageType)
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "message "+messageType)
+	defer span.End()
+	if span.IsRecording() {
+		span.SetAttributes(attribute.String("message.type", messageType), attribute.Int("message.size", size))
+	}
+
+	// Client timestamps are corrected before any handler (or broadcast) sees them
+	mr.clockHandler.StampTime(u, data)
+
+	// Role check once here, handlers only do finer checks (e.g. whose drawing)
+	if capability, gated := requiredCapability[messageType]; gated && !rm.Can(u.ID, capability) {
+		span.SetAttributes(attribute.String("denied.capability", capability))
+		return sendError(u, CodeForbidden, map[string]interface{}{"capability": capability, "messageType": messageType})
+	}
+	// Spectators only watch, their cursor isn't shown either
+	if spectatorDenied[messageType] && u.Spectator {
+		return sendError(u, CodeForbidden, map[string]interface{}{"role": room.RoleSpectator, "messageType": messageType})
+	}
+
+	err := mr.dispatch(ctx, rm, u, messageType, data)
+	if err != nil {
+		var msgErr *MessageError
+		if errors.As(err, &msgErr) && msgErr.Code == CodeValidationFailed {
+			metrics.MessagesRejected.WithLabelValues(metrics.RejectValidation).Inc()
+		}
+		span.SetStatus(codes.Error, err.Error())
+		return withRef(err, data)
+	}
+	return nil
+}
+
+// Joined: called once a user has joined the room and received its state
+func (mr *MessageRouter) Joined(rm *room.Room, u *internalUser.User) {
+	mr.cursorHandler.Start(rm)
+	mr.broadcaster.UserJoined(context.Background(), rm, u.ID)
+}
+
+// Left: called once a user's connection to the room has closed
+// present is false if the user was already removed (and announced) by a failed
+// broadcast, or replaced by a newer connection of the session
+func (mr *MessageRouter) Left(rm *room.Room, u *internalUser.User, present bool) {
+	if present {
+		mr.broadcaster.UserLeft(context.Background(), rm, u.ID)
+	}
+	if !present && rm.HasUser(u.ID) {
+		return // replaced, the newer connection may still finish the user's drawings
+	}
+	mr.objectHandler.HandleLeft(rm, u)
+}
+
+// Rate limiter each message type draws from, cursor moves have their own so a
+// flood of them can't starve edits (and vice versa), and so does chat. The
+// object and chat limiters are the session's (shared by its devices), the
+// cursor limiter the connection's
+// Every type handled by dispatch needs an entry (it's also the list of message
+// types in the protocol manifest)
+var (
+	objectLimiter = rateClass{"object", func(u *internalUser.User) *rate.Limiter { return u.Session.ObjectRateLimiter }}
+	cursorLimiter = rateClass{"cursor", func(u *internalUser.User) *rate.Limiter { return u.CursorRateLimiter }}
+	chatLimiter   = rateClass{"chat", func(u *internalUser.User) *rate.Limiter { return u.Session.ChatRateLimiter }}
+
+	messageLimiters = map[string]rateClass{
+		"timeSync":           objectLimiter,
+		"getUserId":          objectLimiter,
+		"getRateStatus":      objectLimiter,
+		"getSessionInfo":     objectLimiter,
+		"acceptTerms":        objectLimiter,
+		"revokeSession":      objectLimiter,
+		"setSubscriptions":   objectLimiter,
+		"objectAdded":        objectLimiter,
+		"objectsAdded":       objectLimiter,
+		"importObjects":      objectLimiter,
+		"objectUpdated":      objectLimiter,
+		"validateObjects":    objectLimiter,
+		"objectDeleted":      objectLimiter,
+		"objectReplaced":     objectLimiter,
+		"objectReordered":    objectLimiter,
+		"objectsTransformed": objectLimiter,
+		"lockObject":         objectLimiter,
+		"unlockObject":       objectLimiter,
+		"getMyObjects":       objectLimiter,
+		"deleteMyObjects":    objectLimiter,
+		"replaceText":        objectLimiter,
+		"undo":               objectLimiter,
+		"redo":               objectLimiter,
+		"transferOwnership":  objectLimiter,
+		"createPage":         objectLimiter,
+		"renamePage":         objectLimiter,
+		"deletePage":         objectLimiter,
+		"switchPage":         objectLimiter,
+		"startTimer":         objectLimiter,
+		"cancelTimer":        objectLimiter,
+		"setPermissions":     objectLimiter,
+		"setRoomLocale":      objectLimiter,
+		"undoHostAction":     objectLimiter,
+		"clearBoard":         objectLimiter,
+		"restoreLastClear":   objectLimiter,
+		"mergeFrom":          objectLimiter,
+		"cursor":             cursorLimiter,
+		"chat":               chatLimiter,
+		"setName":            objectLimiter,
+		"kickUser":           objectLimiter,
+	}
+)
+
+// rateClass: a named limiter, the name is what getRateStatus and the manifest report
+type rateClass struct {
+	name string
+	of   func(*internalUser.User) *rate.Limiter
+}
+
+// MessageSpec: a client message type as described in the protocol manifest
+type MessageSpec struct {
+	Type       string `json:"type"`
+	RateLimit  string `json:"rateLimit"`            // limiter the message draws from
+	Capability string `json:"capability,omitempty"` // role capability required, none if empty
+}
+
+// Messages: every message type the router handles, sorted by type
+func Messages() []MessageSpec {
+	specs := make([]MessageSpec, 0, len(messageLimiters))
+	for messageType, limiter := range messageLimiters {
+		specs = append(specs, MessageSpec{
+			Type:       messageType,
+			RateLimit:  limiter.name,
+			Capability: requiredCapability[messageType],
+		})
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Type < specs[j].Type })
+	return specs
+}
 
+// dispatch: calls the handler for a message type
+func (mr *MessageRouter) dispatch(ctx context.Context, rm *room.Room, u *internalUser.User, messageType string, data map[string]interface{}) error {
 	switch messageType {
+	case "timeSync":
+		return mr.clockHandler.HandleTimeSync(u, data)
 	case "getUserId":
 		return mr.userHandler.HandleGetUserID(u)
+	case "getRateStatus":
+		return mr.userHandler.HandleGetRateStatus(u)
+	case "getSessionInfo":
+		return mr.userHandler.HandleGetSessionInfo(u)
+	case "revokeSession":
+		return mr.userHandler.HandleRevokeSession(u)
+	case "acceptTerms":
+		return mr.userHandler.HandleAcceptTerms(u, data)
+	case "setSubscriptions":
+		return mr.userHandler.HandleSetSubscriptions(u, data)
 	case "objectAdded":
-		return mr.objectHandler.HandleAdded(rm, u, data)
+		return mr.objectHandler.HandleAdded(ctx, rm, u, data)
+	case "objectsAdded":
+		return mr.objectHandler.HandleBulkAdded(ctx, rm, u, data)
+	case "importObjects":
+		return mr.objectHandler.HandleImport(ctx, rm, u, data)
 	case "objectUpdated":
-		return mr.objectHandler.HandleUpdated(rm, u, data)
+		return mr.objectHandler.HandleUpdated(ctx, rm, u, data)
+	case "validateObjects":
+		return mr.objectHandler.HandleValidate(ctx, u, data)
 	case "objectDeleted":
-		return mr.objectHandler.HandleDeleted(rm, u, data)
+		return mr.objectHandler.HandleDeleted(ctx, rm, u, data)
+	case "objectReordered":
+		return mr.objectHandler.HandleReordered(ctx, rm, u, data)
+	case "objectReplaced":
+		return mr.objectHandler.HandleReplaced(ctx, rm, u, data)
+	case "objectsTransformed":
+		return mr.objectHandler.HandleTransformed(ctx, rm, u, data)
+	case "lockObject":
+		return mr.objectHandler.HandleLock(ctx, rm, u, data)
+	case "unlockObject":
+		return mr.objectHandler.HandleUnlock(ctx, rm, u, data)
+	case "getMyObjects":
+		return mr.objectHandler.HandleGetMine(rm, u, data)
+	case "deleteMyObjects":
+		return mr.objectHandler.HandleDeleteMine(ctx, rm, u, data)
+	case "replaceText":
+		return mr.objectHandler.HandleReplaceText(ctx, rm, u, data)
+	case "undo":
+		return mr.historyHandler.HandleUndo(ctx, rm, u)
+	case "redo":
+		return mr.historyHandler.HandleRedo(ctx, rm, u)
+	case "transferOwnership":
+		return mr.objectHandler.HandleTransferOwnership(ctx, rm, u, data)
+	case "createPage":
+		return mr.pageHandler.HandleCreate(ctx, rm, u, data)
+	case "renamePage":
+		return mr.pageHandler.HandleRename(ctx, rm, u, data)
+	case "deletePage":
+		return mr.pageHandler.HandleDelete(ctx, rm, u, data)
+	case "switchPage":
+		return mr.pageHandler.HandleSwitch(rm, u, data)
+	case "startTimer":
+		return mr.timerHandler.HandleStart(rm, u, data)
+	case "cancelTimer":
+		return mr.timerHandler.HandleCancel(ctx, rm, u)
+	case "setPermissions":
+		return mr.permsHandler.HandleSet(ctx, rm, u, data)
+	case "setRoomLocale":
+		return mr.localeHandler.HandleSet(ctx, rm, u, data)
+	case "undoHostAction":
+		return mr.hostHandler.HandleUndo(ctx, rm, u)
+	case "clearBoard":
+		return mr.hostHandler.HandleClearBoard(ctx, rm, u)
+	case "restoreLastClear":
+		return mr.hostHandler.HandleRestoreLastClear(ctx, rm, u)
+	case "mergeFrom":
+		return mr.mergeHandler.HandleMergeFrom(ctx, rm, u, data)
 	case "cursor":
-		return mr.cursorHandler.Handle(rm, u, data)
+		return mr.cursorHandler.Handle(ctx, rm, u, data)
+	case "chat":
+		return mr.chatHandler.Handle(ctx, rm, u, data)
+	case "setName":
+		return mr.userHandler.HandleSetName(ctx, rm, u, data)
+	case "kickUser":
+		return mr.hostHandler.HandleKick(ctx, rm, u, data)
 	default:
-		return fmt.Errorf("unknown message type: %s", messageType)
+		return NewError(CodeUnknownType, "unknown message type: %s", messageType)
 	}
 }
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"golang.org/x/time/rate"
+)
+
+func TestSpansForDrawnObject(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithSpanProcessor(recorder),
+	)
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	s := newTestServer(t)
+	alice := s.join("alice")
+	bob := s.join("bob")
+	if err := s.send(alice, stroke("s1", 1)); err != nil {
+		t.Fatal(err)
+	}
+	bob.next("objectAdded")
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	message, ok := spans["message objectAdded"]
+	if !ok {
+		t.Fatalf("no message span, got %v", spanNames(recorder.Ended()))
+	}
+	for _, name := range []string{"validate", "broadcast"} {
+		child, ok := spans[name]
+		if !ok {
+			t.Errorf("no %s span, got %v", name, spanNames(recorder.Ended()))
+			continue
+		}
+		if child.Parent().SpanID() != message.SpanContext().SpanID() {
+			t.Errorf("%s span isn't a child of the message span", name)
+		}
+	}
+}
+
+func spanNames(spans []sdktrace.ReadOnlySpan) []string {
+	var names []string
+	for _, span := range spans {
+		names = append(names, span.Name())
+	}
+	return names
+}
+
+func TestCursorFloodDoesNotBlockObjects(t *testing.T) {
+	s := newTestServer(t)
+	alice, bob := s.join("alice"), s.join("bob")
+	alice.user.Session.ObjectRateLimiter = rate.NewLimiter(0.01, 2)
+	alice.user.CursorRateLimiter = rate.NewLimiter(0.01, 5)
+
+	for i := 0; i < 100; i++ {
+		if err := s.send(alice, map[string]interface{}{"type": "cursor", "x": float64(i), "y": 1.0}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tokens := alice.user.RateStatus()["cursor"].Tokens; tokens != 0 {
+		t.Fatalf("cursor budget after a flood = %v, want 0", tokens)
+	}
+
+	if err := s.send(alice, stroke("s1", nil)); err != nil {
+		t.Fatalf("objectAdded after a cursor flood: %v", err)
+	}
+	if got := bob.next("objectAdded"); got["object"].(map[string]interface{})["id"] != "s1" {
+		t.Errorf("bob received %v", got)
+	}
+}
+
+func TestObjectFloodDoesNotBlockCursors(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.join("alice")
+	alice.user.Session.ObjectRateLimiter = rate.NewLimiter(0.01, 2)
+	alice.user.CursorRateLimiter = rate.NewLimiter(0.01, 5)
+
+	for i := 0; i < 10; i++ {
+		s.send(alice, stroke(fmt.Sprintf("s%d", i), nil))
+	}
+	if s.room.ObjectCount() != 2 {
+		t.Fatalf("%d strokes added, want the burst of 2", s.room.ObjectCount())
+	}
+	if err := s.send(alice, map[string]interface{}{"type": "cursor", "x": 1.0, "y": 1.0}); err != nil {
+		t.Fatal(err)
+	}
+	if tokens := alice.user.RateStatus()["cursor"].Tokens; tokens != 4 {
+		t.Errorf("cursor budget = %v, want 4 (the cursor drew from its own limiter)", tokens)
+	}
+}
+
+func TestUnknownTypeUsesNoBudget(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.join("alice")
+	alice.user.Session.ObjectRateLimiter = rate.NewLimiter(0.01, 2)
+
+	for i := 0; i < 5; i++ {
+		err := s.send(alice, map[string]interface{}{"type": "teleport"})
+		var msgErr *MessageError
+		if !errors.As(err, &msgErr) || msgErr.Code != CodeUnknownType {
+			t.Fatalf("unknown type = %v, want %s", err, CodeUnknownType)
+		}
+	}
+	for _, class := range []string{"object", "cursor", "chat"} {
+		status := alice.user.RateStatus()[class]
+		if status.Tokens != float64(status.Burst) {
+			t.Errorf("%s budget = %v of %d after unknown types", class, status.Tokens, status.Burst)
+		}
+	}
+}
+
+func TestEveryGatedTypeHasALimiter(t *testing.T) {
+	for messageType := range requiredCapability {
+		if _, ok := messageLimiters[messageType]; !ok {
+			t.Errorf("%s needs a capability but has no rate limiter", messageType)
+		}
+	}
+	for _, spec := range Messages() {
+		if spec.RateLimit == "" {
+			t.Errorf("%s has an unnamed limiter", spec.Type)
+		}
+	}
+}
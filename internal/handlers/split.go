@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"main/internal/object"
+	"main/internal/room"
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+)
+
+// HandleReplaced: objectReplaced messages, {objectId, objects} replaces a drawing
+// with others in one step (an eraser splitting a stroke, objects may be empty).
+// Replacing someone else's drawing needs erase-others, the pieces stay theirs.
+// Any invalid replacement rejects the whole message (error carries its index)
+func (h *ObjectHandler) HandleReplaced(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	if rm.IsFrozen() {
+		return sendError(u, CodeBoardFrozen, nil)
+	}
+
+	objectID, ok := data["objectId"].(string)
+	if !ok {
+		return fmt.Errorf("missing objectId")
+	}
+	items, ok := data["objects"].([]interface{})
+	if !ok {
+		return fmt.Errorf("missing objects array")
+	}
+	if len(items) > maxAddBatch {
+		return sendError(u, CodeBatchTooLarge, map[string]interface{}{"max": maxAddBatch})
+	}
+
+	existing := rm.GetObject(objectID)
+	if existing == nil {
+		return sendError(u, CodeObjectDeleted, map[string]interface{}{"objectId": objectID})
+	}
+	if err := checkOwner(rm, u, objectID, room.CapEraseOthers); err != nil {
+		return err
+	}
+
+	objs := make([]*object.Drawing, 0, len(items))
+	hasZIndex := make([]bool, 0, len(items))
+	seen := make(map[string]bool, len(items))
+	for i, item := range items {
+		objectMsg, ok := item.(map[string]interface{})
+		if !ok {
+			return rejectBatch(u, i, fmt.Errorf("missing object data"))
+		}
+
+		obj, zIndexSet, err := h.parseObject(ctx, objectMsg)
+		if err != nil {
+			return rejectBatch(u, i, err)
+		}
+		if seen[obj.ID] {
+			return rejectBatch(u, i, fmt.Errorf("duplicate object id: %s", obj.ID))
+		}
+		seen[obj.ID] = true
+		if revive, _ := objectMsg["revive"].(bool); !revive && obj.ID != objectID && rm.IsDeleted(obj.ID) {
+			return rejectBatch(u, i, fmt.Errorf("object was deleted: %s", obj.ID))
+		}
+
+		objs = append(objs, obj)
+		hasZIndex = append(hasZIndex, zIndexSet)
+	}
+
+	// Existence, lock, limit and pages are re-checked under the room lock
+	original, err := rm.ReplaceObject(objectID, objs, hasZIndex, u.ID, h.config.MaxObjects)
+	switch {
+	case errors.Is(err, room.ErrReplacedMissing):
+		return sendError(u, CodeObjectDeleted, map[string]interface{}{"objectId": objectID})
+	case errors.Is(err, room.ErrObjectLocked):
+		return sendError(u, CodeObjectLocked, map[string]interface{}{"objectId": objectID, "lockedBy": rm.LockHolder(objectID)})
+	case errors.Is(err, room.ErrReplaceLimit):
+		return sendError(u, CodeObjectLimit, map[string]interface{}{"reason": err.Error()})
+	case err != nil:
+		return sendError(u, CodeInvalidBatch, map[string]interface{}{"reason": err.Error()})
+	}
+
+	replacements := make([]map[string]interface{}, 0, len(objs))
+	assigned := make([]map[string]interface{}, 0)
+	for i, obj := range objs {
+		entry := map[string]interface{}{
+			"id":     obj.ID,
+			"type":   obj.Type,
+			"data":   obj.Data,
+			"zIndex": obj.ZIndex,
+			"pageId": obj.PageID,
+			"userId": obj.UserID,
+		}
+		if obj.Provisional {
+			entry["provisional"] = true
+		}
+		replacements = append(replacements, entry)
+		if !hasZIndex[i] {
+			assigned = append(assigned, map[string]interface{}{"objectId": obj.ID, "zIndex": obj.ZIndex})
+		}
+	}
+
+	msg, err := json.Marshal(map[string]interface{}{
+		"type":     "objectReplaced",
+		"objectId": objectID,
+		"pageId":   original.PageID,
+		"objects":  replacements,
+		"userId":   u.ID,
+		"revision": rm.Revision(),
+	})
+	if err != nil {
+		return fmt.Errorf("marshal broadcast message: %w", err)
+	}
+	h.broadcaster.Broadcast(ctx, rm, msg, u.Connection, room.TagObject)
+
+	// Sender doesn't receive the broadcast, ack so it learns the zIndexes taken
+	// from the original
+	ack, err := json.Marshal(map[string]interface{}{
+		"type":    "objectsAck",
+		"count":   len(objs),
+		"objects": assigned,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal objects ack: %w", err)
+	}
+	return u.WriteMessage(websocket.TextMessage, ack)
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"testing"
+)
+
+func TestSetSubscriptionsMutesCursors(t *testing.T) {
+	s := newTestServer(t)
+	alice, bob, carol := s.join("alice"), s.join("bob"), s.join("carol")
+	s.router.Joined(s.room, alice.user)
+
+	if err := s.send(bob, map[string]interface{}{"type": "setSubscriptions", "cursors": false}); err != nil {
+		t.Fatal(err)
+	}
+	bob.next("subscriptionsSet")
+
+	if err := s.send(alice, map[string]interface{}{"type": "cursor", "x": 1.0, "y": 1.0}); err != nil {
+		t.Fatal(err)
+	}
+	carol.next("cursors")
+	if err := s.send(alice, stroke("s1", nil)); err != nil {
+		t.Fatal(err)
+	}
+	carol.next("objectAdded")
+
+	for _, msg := range bob.until("objectAdded") {
+		if msg["type"] == "cursors" {
+			t.Fatalf("cursors delivered with cursors muted: %v", msg)
+		}
+	}
+
+	// subscriptions replace each other, an empty one lifts the mute
+	if err := s.send(bob, map[string]interface{}{"type": "setSubscriptions"}); err != nil {
+		t.Fatal(err)
+	}
+	bob.next("subscriptionsSet")
+	if err := s.send(alice, map[string]interface{}{"type": "cursor", "x": 2.0, "y": 2.0}); err != nil {
+		t.Fatal(err)
+	}
+	bob.next("cursors")
+}
+
+func TestSetSubscriptionsPageFilter(t *testing.T) {
+	s := newTestServer(t)
+	alice, bob := s.join("alice"), s.join("bob")
+
+	if err := s.send(bob, map[string]interface{}{"type": "setSubscriptions", "pageId": "elsewhere"}); err != nil {
+		t.Fatal(err)
+	}
+	bob.next("subscriptionsSet")
+
+	if err := s.send(alice, stroke("s1", nil)); err != nil {
+		t.Fatal(err)
+	}
+	// room events aren't page specific and still arrive
+	if err := s.send(alice, map[string]interface{}{"type": "chat", "text": "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range bob.until("chat") {
+		if msg["type"] == "objectAdded" {
+			t.Fatalf("object on another page delivered: %v", msg)
+		}
+	}
+}
+
+func TestSetSubscriptionsRejectsInvalid(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.join("alice")
+
+	s.reject(alice, map[string]interface{}{"type": "setSubscriptions", "cursors": "off"}, CodeInvalidMessage)
+	s.reject(alice, map[string]interface{}{"type": "setSubscriptions", "pageId": 3}, CodeInvalidMessage)
+	if sub := alice.user.Subscription(); sub.Muted != 0 || sub.PageID != "" {
+		t.Errorf("rejected subscriptions applied: %+v", sub)
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+)
+
+// termsExempt: messages allowed before the session accepted the terms (with
+// config.TermsVersion set), everything else gets a terms_required error
+var termsExempt = map[string]bool{
+	"acceptTerms":      true,
+	"timeSync":         true,
+	"getUserId":        true,
+	"getRateStatus":    true,
+	"setSubscriptions": true,
+	"getSessionInfo":   true,
+	"revokeSession":    true,
+}
+
+// TermsPending: messageType is held back until u's session accepts the terms
+func (h *UserHandler) TermsPending(u *user.User, messageType string) bool {
+	return h.config.TermsVersion != "" && !termsExempt[messageType] &&
+		!h.sessions.TermsAccepted(u.ID, h.config.TermsVersion)
+}
+
+// TermsRequired: tells the sender to accept the current terms first
+// (at most once per second, like Throttled, clients keep sending cursor moves)
+func (h *UserHandler) TermsRequired(u *user.User, messageType string) error {
+	if !u.NoticeAllowed(time.Second) {
+		return nil
+	}
+	return sendError(u, CodeTermsRequired, map[string]interface{}{
+		"messageType": messageType,
+		"version":     h.config.TermsVersion,
+		"url":         h.config.TermsURL,
+	})
+}
+
+// HandleAcceptTerms: acceptTerms messages, {version} must be the current terms
+// version. Accepting is per session, its other connections are let through too
+func (h *UserHandler) HandleAcceptTerms(u *user.User, data map[string]interface{}) error {
+	if h.config.TermsVersion == "" {
+		return fmt.Errorf("no terms to accept")
+	}
+	version, _ := data["version"].(string)
+	if version != h.config.TermsVersion {
+		return sendError(u, CodeTermsRequired, map[string]interface{}{
+			"version": h.config.TermsVersion,
+			"url":     h.config.TermsURL,
+		})
+	}
+
+	accepted, err := h.sessions.AcceptTerms(u.ID, version)
+	if err != nil {
+		return err
+	}
+
+	responseMsg, err := json.Marshal(map[string]interface{}{
+		"type":       "termsAccepted",
+		"version":    accepted.Version,
+		"acceptedAt": accepted.AcceptedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal terms response: %w", err)
+	}
+	return u.WriteMessage(websocket.TextMessage, responseMsg)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"testing"
+)
+
+// termsServer: a test server whose deployment requires terms version v1
+func termsServer(t *testing.T) *testServer {
+	s := newTestServer(t)
+	s.config.TermsVersion, s.config.TermsURL = "v1", "https://example.com/terms"
+	return s
+}
+
+func TestBlockedUntilTermsAccepted(t *testing.T) {
+	s := termsServer(t)
+	alice := s.join("alice")
+
+	reply := s.reject(alice, stroke("s1", nil), CodeTermsRequired)
+	if reply["version"] != "v1" || reply["url"] != "https://example.com/terms" || reply["messageType"] != "objectAdded" {
+		t.Errorf("terms_required = %v", reply)
+	}
+	if s.room.ObjectCount() != 0 {
+		t.Fatal("drawing added before the terms were accepted")
+	}
+
+	// control messages go through meanwhile
+	if err := s.send(alice, map[string]interface{}{"type": "getUserId"}); err != nil {
+		t.Fatal(err)
+	}
+	alice.next("userId")
+
+	s.reject(alice, map[string]interface{}{"type": "acceptTerms", "version": "v0"}, CodeTermsRequired)
+	if err := s.send(alice, map[string]interface{}{"type": "acceptTerms", "version": "v1"}); err != nil {
+		t.Fatal(err)
+	}
+	if accepted := alice.next("termsAccepted"); accepted["version"] != "v1" {
+		t.Errorf("termsAccepted = %v", accepted)
+	}
+
+	if err := s.send(alice, stroke("s1", nil)); err != nil {
+		t.Fatal(err)
+	}
+	alice.next("objectAck")
+}
+
+func TestTermsVersionBumpPromptsAgain(t *testing.T) {
+	s := termsServer(t)
+	alice := s.join("alice")
+	if err := s.send(alice, map[string]interface{}{"type": "acceptTerms", "version": "v1"}); err != nil {
+		t.Fatal(err)
+	}
+	alice.next("termsAccepted")
+
+	s.config.TermsVersion = "v2"
+	if reply := s.reject(alice, stroke("s1", nil), CodeTermsRequired); reply["version"] != "v2" {
+		t.Errorf("terms_required version = %v, want v2", reply["version"])
+	}
+	if err := s.send(alice, map[string]interface{}{"type": "acceptTerms", "version": "v2"}); err != nil {
+		t.Fatal(err)
+	}
+	alice.next("termsAccepted")
+	if err := s.send(alice, stroke("s1", nil)); err != nil {
+		t.Fatal(err)
+	}
+	alice.next("objectAck")
+}
+
+func TestNoTermsGateByDefault(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.join("alice")
+	if err := s.send(alice, stroke("s1", nil)); err != nil {
+		t.Fatal(err)
+	}
+	alice.next("objectAck")
+	if err := s.send(alice, map[string]interface{}{"type": "acceptTerms", "version": "v1"}); err == nil {
+		t.Error("acceptTerms accepted without a terms version configured")
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"main/internal/logging"
+	"main/internal/room"
+	"main/internal/user"
+)
+
+const (
+	maxTimerDuration = 4 * time.Hour
+	timerTick        = 30 * time.Second // remaining-time updates are coarse, clients count down locally
+)
+
+// TimerHandler: host-run countdowns that freeze the board when they expire
+type TimerHandler struct {
+	broadcaster *room.Broadcaster
+}
+
+func NewTimerHandler(broadcaster *room.Broadcaster) *TimerHandler {
+	return &TimerHandler{
+		broadcaster: broadcaster,
+	}
+}
+
+// HandleStart: startTimer messages {duration: seconds} (manage-settings)
+func (h *TimerHandler) HandleStart(rm *room.Room, u *user.User, data map[string]interface{}) error {
+	seconds, ok := data["duration"].(float64)
+	if !ok || seconds < 1 {
+		return fmt.Errorf("invalid duration")
+	}
+	duration := time.Duration(seconds * float64(time.Second)).Round(time.Second)
+	if duration > maxTimerDuration {
+		return fmt.Errorf("timer too long: max %s", maxTimerDuration)
+	}
+
+	// Ticks outlive this message, they run under the room's context
+	onTick := func(remaining time.Duration) {
+		h.broadcast(rm.Context(), rm, map[string]interface{}{
+			"type":      "timerUpdate",
+			"remaining": remaining.Round(time.Second).Seconds(),
+		})
+	}
+	onExpire := func() {
+		h.broadcaster.BroadcastSystem(rm.Context(), rm, map[string]interface{}{
+			"type":   "timerExpired",
+			"frozen": true,
+		}, "timer_expired", nil)
+	}
+
+	state, err := rm.StartTimer(duration, timerTick, onTick, onExpire)
+	if err != nil {
+		return sendError(u, CodeTimerActive, map[string]interface{}{"reason": err.Error()})
+	}
+	auditHostAction(rm, u, "startTimer", duration.String())
+
+	msg := TimerMessage(state)
+	msg["type"] = "timerStarted"
+	msg["userId"] = u.ID
+	h.broadcast(context.Background(), rm, msg)
+	return nil
+}
+
+// HandleCancel: cancelTimer messages (manage-settings), also lifts an expired timer's freeze
+func (h *TimerHandler) HandleCancel(ctx context.Context, rm *room.Room, u *user.User) error {
+	if err := rm.CancelTimer(); err != nil {
+		return sendError(u, CodeNoTimer, map[string]interface{}{"reason": err.Error()})
+	}
+	auditHostAction(rm, u, "cancelTimer", "cancelled")
+
+	h.broadcast(ctx, rm, map[string]interface{}{
+		"type":   "timerCancelled",
+		"frozen": false,
+		"userId": u.ID,
+	})
+	return nil
+}
+
+// broadcast: sends to everyone in the room, sender included
+func (h *TimerHandler) broadcast(ctx context.Context, rm *room.Room, message map[string]interface{}) {
+	msg, err := json.Marshal(message)
+	if err != nil {
+		slog.Error("Marshal timer message failed", logging.KeyRoom, rm.Code, "err", err)
+		return
+	}
+	h.broadcaster.Broadcast(ctx, rm, msg, nil, room.TagRoom)
+}
+
+// TimerMessage: timer fields for room_joined / timerStarted
+func TimerMessage(state room.TimerState) map[string]interface{} {
+	msg := map[string]interface{}{
+		"active": state.Active,
+		"frozen": state.Frozen,
+	}
+	if state.Active {
+		msg["duration"] = state.Duration.Seconds()
+		msg["endsAt"] = state.EndsAt.UnixMilli()
+		msg["remaining"] = state.Remaining.Round(time.Second).Seconds()
+	}
+	return msg
+}
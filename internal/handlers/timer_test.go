@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+// timedServer: a test server whose room timers run on a fake clock
+func timedServer(t *testing.T) (*testServer, *fakeClock) {
+	t.Helper()
+	s := newTestServer(t)
+	clock := &fakeClock{now: time.UnixMilli(1_700_000_000_000)}
+	s.rooms.SetClock(clock)
+
+	s.room.Close()
+	rm, err := s.rooms.CreateRoom(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.room = rm
+	return s, clock
+}
+
+func TestTimerExpiryFreezesBoard(t *testing.T) {
+	s, clock := timedServer(t)
+	alice, bob := s.join("alice"), s.join("bob")
+
+	if err := s.send(alice, map[string]interface{}{"type": "startTimer", "duration": 60}); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*testClient{alice, bob} {
+		started := c.next("timerStarted")
+		if started["remaining"] != float64(60) || started["endsAt"] != float64(clock.Now().Add(time.Minute).UnixMilli()) {
+			t.Errorf("timerStarted = %v", started)
+		}
+	}
+
+	clock.advance(t, timerTick, timerTick)
+	if update := bob.next("timerUpdate"); update["remaining"] != float64(30) {
+		t.Errorf("timerUpdate remaining = %v, want 30", update["remaining"])
+	}
+	if err := s.send(bob, stroke("before", nil)); err != nil {
+		t.Fatalf("drawing before expiry: %v", err)
+	}
+
+	clock.advance(t, timerTick, timerTick)
+	if expired := bob.next("timerExpired"); expired["frozen"] != true {
+		t.Errorf("timerExpired = %v", expired)
+	}
+	s.reject(bob, stroke("after", nil), CodeBoardFrozen)
+	if s.room.GetObject("after") != nil {
+		t.Error("drawing added to a frozen board")
+	}
+
+	// Cancelling lifts the freeze
+	if err := s.send(alice, map[string]interface{}{"type": "cancelTimer"}); err != nil {
+		t.Fatal(err)
+	}
+	if cancelled := bob.next("timerCancelled"); cancelled["frozen"] != false {
+		t.Errorf("timerCancelled = %v", cancelled)
+	}
+	if err := s.send(bob, stroke("later", nil)); err != nil {
+		t.Fatalf("drawing after cancel: %v", err)
+	}
+}
+
+func TestTimerErrors(t *testing.T) {
+	s, _ := timedServer(t)
+	alice, bob := s.join("alice"), s.join("bob")
+
+	s.reject(alice, map[string]interface{}{"type": "cancelTimer"}, CodeNoTimer)
+	s.reject(bob, map[string]interface{}{"type": "startTimer", "duration": 60}, CodeForbidden)
+
+	if err := s.send(alice, map[string]interface{}{"type": "startTimer", "duration": 60}); err != nil {
+		t.Fatal(err)
+	}
+	s.reject(alice, map[string]interface{}{"type": "startTimer", "duration": 120}, CodeTimerActive)
+	if state := s.room.Timer(); state.Duration != time.Minute {
+		t.Errorf("running timer = %v, want the first one", state.Duration)
+	}
+}
+
+func TestTimerMessageForJoiners(t *testing.T) {
+	s, clock := timedServer(t)
+	alice := s.join("alice")
+	if err := s.send(alice, map[string]interface{}{"type": "startTimer", "duration": 600}); err != nil {
+		t.Fatal(err)
+	}
+	clock.advance(t, 2*time.Minute, timerTick)
+
+	// What someone (re)joining now is told, in room_joined
+	msg := TimerMessage(s.room.Timer())
+	if msg["active"] != true || msg["remaining"] != float64(480) || msg["duration"] != float64(600) {
+		t.Errorf("timer for joiners = %v, want active with 480s of 600s left", msg)
+	}
+	if msg["endsAt"] != clock.Now().Add(8*time.Minute).UnixMilli() {
+		t.Errorf("endsAt = %v, want %d", msg["endsAt"], clock.Now().Add(8*time.Minute).UnixMilli())
+	}
+}
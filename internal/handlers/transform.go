@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"main/internal/object"
+	"main/internal/room"
+	"main/internal/user"
+)
+
+const (
+	maxTransformBatch = 500 // max objects per objectsTransformed message
+	maxTransformScale = 100 // scale factor limit (and 1/100 the other way)
+)
+
+// HandleTransformed: objectsTransformed messages, {objectIds, dx, dy, scale?,
+// rotation?, origin?: {x, y}} moves, resizes or rotates a selection in one message.
+// Scale and rotation are around origin, the selection's center if omitted.
+// Drawings that are gone, someone else's, locked or would leave the board are
+// skipped and reported in a transform_skipped error, the rest are transformed
+// and the message (origin resolved) is broadcast as is
+func (h *ObjectHandler) HandleTransformed(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	if rm.IsFrozen() {
+		return sendError(u, CodeBoardFrozen, nil)
+	}
+
+	rawIDs, ok := data["objectIds"].([]interface{})
+	if !ok || len(rawIDs) == 0 {
+		return fmt.Errorf("missing objectIds")
+	}
+	if len(rawIDs) > maxTransformBatch {
+		return sendError(u, CodeBatchTooLarge, map[string]interface{}{"max": maxTransformBatch})
+	}
+
+	transform, err := parseTransform(data)
+	if err != nil {
+		return err
+	}
+
+	// Sender's rights are checked up front, the room re-checks existence
+	skipped := make([]map[string]interface{}, 0)
+	skip := func(id string, reason string) {
+		skipped = append(skipped, map[string]interface{}{"objectId": id, "reason": reason})
+	}
+	ids := make([]string, 0, len(rawIDs))
+	seen := make(map[string]bool, len(rawIDs))
+	selection := object.Bounds{MinX: math.Inf(1), MinY: math.Inf(1), MaxX: math.Inf(-1), MaxY: math.Inf(-1)}
+	for _, raw := range rawIDs {
+		id, ok := raw.(string)
+		if !ok || seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		obj := rm.GetObject(id)
+		switch {
+		case obj == nil:
+			skip(id, "not_found")
+			continue
+		case checkOwner(rm, u, id, room.CapEditOthers) != nil:
+			skip(id, "not_owned")
+			continue
+		}
+		if holder := rm.LockHolder(id); holder != "" && holder != u.ID {
+			skip(id, "locked")
+			continue
+		}
+		if bounds, found := object.BoundingBox(obj.Data); found {
+			selection.MinX, selection.MaxX = math.Min(selection.MinX, bounds.MinX), math.Max(selection.MaxX, bounds.MaxX)
+			selection.MinY, selection.MaxY = math.Min(selection.MinY, bounds.MinY), math.Max(selection.MaxY, bounds.MaxY)
+		}
+		ids = append(ids, id)
+	}
+
+	if _, hasOrigin := data["origin"]; !hasOrigin && !math.IsInf(selection.MinX, 1) {
+		transform.OriginX = (selection.MinX + selection.MaxX) / 2
+		transform.OriginY = (selection.MinY + selection.MaxY) / 2
+	}
+
+	transformed, missing, outOfBounds := rm.TransformObjects(ids, transform)
+	for _, id := range missing {
+		skip(id, "not_found")
+	}
+	for _, id := range outOfBounds {
+		skip(id, "out_of_bounds")
+	}
+
+	if len(transformed) > 0 {
+		msg, err := json.Marshal(map[string]interface{}{
+			"type":      "objectsTransformed",
+			"objectIds": transformed,
+			"dx":        transform.DX,
+			"dy":        transform.DY,
+			"scale":     transform.Scale,
+			"rotation":  transform.Rotation,
+			"origin":    map[string]interface{}{"x": transform.OriginX, "y": transform.OriginY},
+			"userId":    u.ID,
+			"revision":  rm.Revision(),
+		})
+		if err != nil {
+			return fmt.Errorf("marshal broadcast message: %w", err)
+		}
+		h.broadcaster.Broadcast(ctx, rm, msg, u.Connection, room.TagObject)
+	}
+
+	if len(skipped) > 0 {
+		return sendError(u, CodeTransformSkipped, map[string]interface{}{
+			"skipped":     skipped,
+			"transformed": len(transformed),
+		})
+	}
+	return nil
+}
+
+// parseTransform: the transform fields of an objectsTransformed message
+func parseTransform(data map[string]interface{}) (object.SelectionTransform, error) {
+	transform := object.SelectionTransform{Scale: 1}
+	transform.DX, _ = data["dx"].(float64)
+	transform.DY, _ = data["dy"].(float64)
+
+	if raw, hasScale := data["scale"]; hasScale {
+		scale, ok := raw.(float64)
+		if !ok || scale < 1.0/maxTransformScale || scale > maxTransformScale {
+			return transform, fmt.Errorf("invalid scale: must be between %v and %d", 1.0/maxTransformScale, maxTransformScale)
+		}
+		transform.Scale = scale
+	}
+	if raw, hasRotation := data["rotation"]; hasRotation {
+		rotation, ok := raw.(float64)
+		if !ok || rotation < -360 || rotation > 360 {
+			return transform, fmt.Errorf("invalid rotation: must be between -360 and 360 degrees")
+		}
+		transform.Rotation = rotation
+	}
+	if raw, hasOrigin := data["origin"]; hasOrigin {
+		origin, ok := raw.(map[string]interface{})
+		x, okX := origin["x"].(float64)
+		y, okY := origin["y"].(float64)
+		if !ok || !okX || !okY {
+			return transform, fmt.Errorf("invalid origin: must be {x, y}")
+		}
+		transform.OriginX, transform.OriginY = x, y
+	}
+	return transform, nil
+}
@@ -1,18 +1,70 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
+	"main/internal/middleware"
+	"main/internal/object"
+	"main/internal/room"
 	"main/internal/user"
 
 	"github.com/gorilla/websocket"
 )
 
-type UserHandler struct{}
+type UserHandler struct {
+	config      *middleware.RateLimit
+	sessions    *user.SessionManager
+	validator   *object.Validator
+	broadcaster *room.Broadcaster
+}
+
+func NewUserHandler(config *middleware.RateLimit, sessions *user.SessionManager, validator *object.Validator, broadcaster *room.Broadcaster) *UserHandler {
+	return &UserHandler{
+		config:      config,
+		sessions:    sessions,
+		validator:   validator,
+		broadcaster: broadcaster,
+	}
+}
 
-func NewUserHandler() *UserHandler {
-	return &UserHandler{}
+// maxNameLength: characters in a display name (after sanitizing)
+const maxNameLength = 32
+
+// HandleSetName: setName messages, {name}. The name is kept on the session
+// (reconnects and other rooms joined later use it) and announced to the room
+// with userRenamed, suffixed if another user here already has it
+func (h *UserHandler) HandleSetName(ctx context.Context, rm *room.Room, u *user.User, data map[string]interface{}) error {
+	name, ok := data["name"].(string)
+	if !ok {
+		return fmt.Errorf("missing name")
+	}
+	if strings.IndexFunc(name, unicode.IsControl) != -1 {
+		return NewError(CodeInvalidMessage, "name must not contain control characters")
+	}
+	name = strings.TrimSpace(h.validator.SanitizeString(name))
+	if length := utf8.RuneCountInString(name); length == 0 || length > maxNameLength {
+		return NewError(CodeInvalidMessage, "name must be 1-%d characters", maxNameLength)
+	}
+
+	u.Session.SetName(name)
+	shown := rm.SetUserName(u.ID, name)
+
+	msg, err := json.Marshal(map[string]interface{}{
+		"type":   "userRenamed",
+		"userId": u.ID,
+		"name":   shown,
+		"color":  rm.GetUserColor(u.ID),
+	})
+	if err != nil {
+		return fmt.Errorf("marshal userRenamed: %w", err)
+	}
+	h.broadcaster.Broadcast(ctx, rm, msg, nil, room.TagPresence)
+	return nil
 }
 
 // HandleGetUserID: processes getUserId messages and returns the user ID
@@ -29,3 +81,95 @@ func (h *UserHandler) HandleGetUserID(u *user.User) error {
 
 	return u.WriteMessage(websocket.TextMessage, responseMsg)
 }
+
+// HandleSetSubscriptions: setSubscriptions messages, replaces the sender's
+// broadcast filters ({cursors, objectsOnly, pageId}, see room.ParseSubscription)
+func (h *UserHandler) HandleSetSubscriptions(u *user.User, data map[string]interface{}) error {
+	sub, err := room.ParseSubscription(data)
+	if err != nil {
+		return NewError(CodeInvalidMessage, "invalid subscriptions: %v", err)
+	}
+	u.SetSubscription(sub)
+
+	responseMsg, err := json.Marshal(map[string]interface{}{"type": "subscriptionsSet"})
+	if err != nil {
+		return fmt.Errorf("marshal subscriptions response: %w", err)
+	}
+	return u.WriteMessage(websocket.TextMessage, responseMsg)
+}
+
+// HandleGetRateStatus: getRateStatus messages, the sender's remaining rate limit budget
+// (lets clients slow down before messages are dropped)
+func (h *UserHandler) HandleGetRateStatus(u *user.User) error {
+	response := map[string]interface{}{
+		"type":       "rateStatus",
+		"rateStatus": u.RateStatus(),
+	}
+
+	responseMsg, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("marshal rate status response: %w", err)
+	}
+
+	return u.WriteMessage(websocket.TextMessage, responseMsg)
+}
+
+// Throttled: tells the sender a message was dropped by the rate limiter
+func (h *UserHandler) Throttled(u *user.User, messageType string) error {
+	return sendError(u, CodeRateLimited, map[string]interface{}{
+		"messageType": messageType,
+		"rateStatus":  u.RateStatus(),
+	})
+}
+
+// HandleGetSessionInfo: getSessionInfo messages, the sender's session (created,
+// last seen, recent rooms, and how many other connections use its token)
+func (h *UserHandler) HandleGetSessionInfo(u *user.User) error {
+	info, ok := h.sessions.Info(u)
+	if !ok {
+		return fmt.Errorf("session not found")
+	}
+
+	responseMsg, err := json.Marshal(map[string]interface{}{
+		"type":    "sessionInfo",
+		"session": info,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal session info: %w", err)
+	}
+	return u.WriteMessage(websocket.TextMessage, responseMsg)
+}
+
+// HandleRevokeSession: revokeSession messages, for a token that may have leaked.
+// The token stops working at once, every other connection using it is closed
+// (user.CloseSessionRevoked) and the sender gets a fresh token in the reply
+func (h *UserHandler) HandleRevokeSession(u *user.User) error {
+	token, others, err := h.sessions.Revoke(u)
+	if err != nil {
+		return err
+	}
+	u.Logger().Info("Audit", "action", "revokeSession", "closing", len(others), "agent", u.Info.UserAgent)
+	for _, other := range others {
+		go revoked(other) // not from this connection's read loop, the writes can block
+	}
+
+	responseMsg, err := json.Marshal(map[string]interface{}{
+		"type":   "sessionRevoked",
+		"token":  token,
+		"closed": len(others),
+	})
+	if err != nil {
+		return fmt.Errorf("marshal revoke response: %w", err)
+	}
+	return u.WriteMessage(websocket.TextMessage, responseMsg)
+}
+
+// revoked: tells a connection its session token was revoked and closes it
+// Its cleanup (leaving the room, detaching) runs when its read loop exits
+func revoked(u *user.User) {
+	sendError(u, CodeSessionRevoked, nil)
+	closeMsg := websocket.FormatCloseMessage(user.CloseSessionRevoked, "session revoked")
+	u.WriteMessage(websocket.CloseMessage, closeMsg)
+	u.StopWriter() // waits until both are sent
+	u.Connection.Close()
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// objectTokens: the object budget getRateStatus reports to c
+func objectTokens(t *testing.T, s *testServer, c *testClient) float64 {
+	t.Helper()
+	if err := s.send(c, map[string]interface{}{"type": "getRateStatus"}); err != nil {
+		t.Fatal(err)
+	}
+	status := c.next("rateStatus")["rateStatus"].(map[string]interface{})
+	return status["object"].(map[string]interface{})["tokens"].(float64)
+}
+
+func TestGetRateStatusFallsAsMessagesAreSent(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.join("alice")
+	alice.user.Session.ObjectRateLimiter = rate.NewLimiter(0.01, 20)
+
+	// getRateStatus draws from the object budget too
+	last := objectTokens(t, s, alice)
+	if last != 19 {
+		t.Fatalf("fresh budget = %v, want 19 (20 less the status request)", last)
+	}
+	for i := 0; i < 3; i++ {
+		if err := s.send(alice, stroke(fmt.Sprintf("s%d", i), nil)); err != nil {
+			t.Fatal(err)
+		}
+		tokens := objectTokens(t, s, alice)
+		if tokens != last-2 {
+			t.Errorf("after stroke %d: %v tokens, want %v", i, tokens, last-2)
+		}
+		last = tokens
+	}
+}
+
+func TestThrottledReplyCarriesRateStatus(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.join("alice")
+	alice.user.Session.ObjectRateLimiter = rate.NewLimiter(0.01, 1)
+
+	if err := s.send(alice, stroke("s1", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.send(alice, stroke("s2", nil)); err != nil {
+		t.Fatal(err)
+	}
+	reply := alice.next("error")
+	if reply["code"] != CodeRateLimited {
+		t.Fatalf("error code = %v, want %s", reply["code"], CodeRateLimited)
+	}
+	status, ok := reply["rateStatus"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("throttled reply without rateStatus: %v", reply)
+	}
+	object := status["object"].(map[string]interface{})
+	if object["tokens"] != float64(0) || object["burst"] != float64(1) {
+		t.Errorf("object budget = %v, want 0 tokens of 1", object)
+	}
+	if s.room.GetObject("s2") != nil {
+		t.Error("throttled stroke was added")
+	}
+}
@@ -0,0 +1,99 @@
+// Package i18n: message catalog for system texts sent to clients, keyed by the
+// same stable codes clients branch on (error codes, system events)
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Fallback: locale used for missing entries and unknown locales
+const Fallback = "en"
+
+//go:embed catalog/*.json
+var files embed.FS
+
+// catalog: locale → code → template, loaded once at startup
+var catalog = mustLoad()
+
+func mustLoad() map[string]map[string]string {
+	loaded, err := load()
+	if err != nil {
+		panic(fmt.Sprintf("i18n: %v", err)) // embedded at build time, can only fail for a broken build
+	}
+	return loaded
+}
+
+// load: one file per locale, catalog/<locale>.json holding {"code": "template"}
+func load() (map[string]map[string]string, error) {
+	entries, err := files.ReadDir("catalog")
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := make(map[string]map[string]string, len(entries))
+	for _, entry := range entries {
+		raw, err := files.ReadFile(path.Join("catalog", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var templates map[string]string
+		if err := json.Unmarshal(raw, &templates); err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		loaded[strings.TrimSuffix(entry.Name(), ".json")] = templates
+	}
+	if loaded[Fallback] == nil {
+		return nil, fmt.Errorf("missing %s catalog", Fallback)
+	}
+	return loaded, nil
+}
+
+// Resolve: catalog locale for a client locale tag ("es-MX" → "es"), "" if unsupported
+func Resolve(tag string) string {
+	tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	if _, ok := catalog[tag]; ok {
+		return tag
+	}
+	if base, _, found := strings.Cut(tag, "-"); found {
+		if _, ok := catalog[base]; ok {
+			return base
+		}
+	}
+	return ""
+}
+
+// Locales: supported locales, sorted
+func Locales() []string {
+	locales := make([]string, 0, len(catalog))
+	for locale := range catalog {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Text: the text for code in locale, with {name} placeholders filled from params
+// Falls back to English for unknown locales or missing entries, then to code itself
+func Text(locale string, code string, params map[string]interface{}) string {
+	template, ok := catalog[locale][code]
+	if !ok {
+		template, ok = catalog[Fallback][code]
+	}
+	if !ok {
+		return code
+	}
+
+	if len(params) == 0 || !strings.Contains(template, "{") {
+		return template
+	}
+	replacements := make([]string, 0, len(params)*2)
+	for name, value := range params {
+		replacements = append(replacements, "{"+name+"}", fmt.Sprint(value))
+	}
+	return strings.NewReplacer(replacements...).Replace(template)
+}
@@ -0,0 +1,49 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Attribute keys shared by every connection log line, so one connection can be
+// followed from upgrade to disconnect
+const (
+	KeyConnID   = "conn_id"   // random per WebSocket connection (see NewConnID)
+	KeyUserID   = "user_id"   // once authenticated
+	KeyRoom     = "room"      // canonical room code
+	KeyRemoteIP = "remote_ip" // client IP, after trusted proxies
+)
+
+// ParseLevel: LOG_LEVEL value (debug, info, warn or error, any case), "" is info
+func ParseLevel(value string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q (debug, info, warn or error)", value)
+}
+
+// Setup: JSON logs to w at level and up, made the default logger. Lines still
+// written with the log package go through it too (at info)
+func Setup(w io.Writer, level slog.Level) *slog.Logger {
+	logger := slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+	slog.SetDefault(logger)
+	return logger
+}
+
+// NewConnID: random ID for a connection's log lines
+func NewConnID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,66 @@
+// Package metrics: Prometheus collectors for connections, messages, broadcasts
+// and rooms. Collectors are lock-free to update, callers never take a room lock
+// just to record something. Nothing is exported until Register is called
+package metrics
+
+import (
+	"main/internal/analytics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Rejection reasons (messages_rejected_total)
+const (
+	RejectRateLimit  = "rate_limit" // dropped by a rate limiter
+	RejectSize       = "size"       // over the size, nesting or token limits
+	RejectValidation = "validation" // object data failed schema validation
+	RejectProtocol   = "protocol"   // binary frame of an unknown type or malformed
+)
+
+var (
+	ActiveConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "whiteboard_active_connections",
+		Help: "WebSocket connections in their message loop.",
+	})
+	ActiveRooms = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "whiteboard_active_rooms",
+		Help: "Rooms in memory.",
+	})
+	MessagesReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "whiteboard_messages_received_total",
+		Help: "Messages received by type (unregistered types count as unknown).",
+	}, []string{"type"})
+	MessagesRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "whiteboard_messages_rejected_total",
+		Help: "Messages rejected by reason.",
+	}, []string{"reason"})
+	BroadcastDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "whiteboard_broadcast_duration_seconds",
+		Help:    "Time to deliver a broadcast to every recipient.",
+		Buckets: []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+	})
+	SlowConsumers = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "whiteboard_slow_consumers_total",
+		Help: "Connections dropped because their send queue filled up.",
+	})
+	objectsPerRoom = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "whiteboard_objects_per_room",
+		Help: "Drawings per room, labeled by anonymized room code.",
+	}, []string{"room"})
+)
+
+// Register: registers every collector with reg
+func Register(reg prometheus.Registerer) {
+	reg.MustRegister(ActiveConnections, ActiveRooms, MessagesReceived, MessagesRejected, BroadcastDuration, SlowConsumers, objectsPerRoom)
+}
+
+// RoomObjects: the objects_per_room series of a room
+// Room codes are enough to join a room, so they're never used as label values
+func RoomObjects(roomCode string) prometheus.Gauge {
+	return objectsPerRoom.WithLabelValues(analytics.AnonymizeID(roomCode))
+}
+
+// ForgetRoom: drops a removed room's objects_per_room series
+func ForgetRoom(roomCode string) {
+	objectsPerRoom.DeleteLabelValues(analytics.AnonymizeID(roomCode))
+}
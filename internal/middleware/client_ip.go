@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// TrustedProxies: reverse proxies whose X-Forwarded-For entries are believed
+// Empty trusts none, the client is always RemoteAddr
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies: comma separated CIDRs (e.g. "10.0.0.0/8,::1/128"), a
+// bare address is a single host
+func ParseTrustedProxies(list string) (TrustedProxies, error) {
+	var proxies TrustedProxies
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			addr = addr.Unmap()
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// trusts: addr is one of the proxies
+func (tp TrustedProxies) trusts(addr netip.Addr) bool {
+	for _, prefix := range tp {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHop: an address from RemoteAddr or an X-Forwarded-For entry, with or
+// without a port ("203.0.113.7", "203.0.113.7:4711", "[2001:db8::1]:4711")
+func parseHop(hop string) (netip.Addr, bool) {
+	hop = strings.TrimSpace(hop)
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		hop = host
+	}
+	addr, err := netip.ParseAddr(strings.Trim(hop, "[]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
+
+// ClientIP: the address the request came from. Behind a trusted proxy that's
+// the first untrusted hop walking X-Forwarded-For from the right (entries left
+// of it are client supplied and can be spoofed). A malformed entry ends the
+// walk at the last trusted hop
+func (tp TrustedProxies) ClientIP(r *http.Request) string {
+	client, ok := parseHop(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr
+	}
+	if !tp.trusts(client) {
+		return client.String()
+	}
+
+	// Repeated headers are one list, in order
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := parseHop(hops[i])
+		if !ok {
+			break
+		}
+		client = hop
+		if !tp.trusts(hop) {
+			break
+		}
+	}
+	return client.String()
+}
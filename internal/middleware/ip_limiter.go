@@ -1,41 +1,56 @@
 package middleware
 
 import (
+	"net/http"
 	"sync"
 	"time"
 
 	"golang.org/x/time/rate"
 )
 
-// ipLimiterEntry: tracks a rate limiter and its last use time
+// ipLimiterEntry: tracks a rate limiter, open connections and last use time
 type ipLimiterEntry struct {
 	limiter  *rate.Limiter
+	open     int // connections acquired and not yet released
 	lastSeen time.Time
 }
 
-// IPRateLimit: manages rate limiters per IP address
+// IPRateLimit: manages rate limiters and open connection counts per IP address
 type IPRateLimit struct {
 	limiters map[string]*ipLimiterEntry
 	mu       sync.RWMutex
+	rate     rate.Limit
+	burst    int
+	maxOpen  int            // open connections per IP
+	proxies  TrustedProxies // whose X-Forwarded-For says who the client is
 }
 
-// NewIPRateLimit: creates a new IPRateLimit
-func NewIPRateLimit() *IPRateLimit {
+// NewIPRateLimit: creates a new IPRateLimit allowing each IP perMinute
+// connections per minute, burst at once, and maxOpen open at a time. Requests
+// from proxies are counted against the client they forward for
+func NewIPRateLimit(perMinute float64, burst int, maxOpen int, proxies TrustedProxies) *IPRateLimit {
 	return &IPRateLimit{
 		limiters: make(map[string]*ipLimiterEntry),
+		rate:     rate.Limit(perMinute / 60),
+		burst:    burst,
+		maxOpen:  maxOpen,
+		proxies:  proxies,
 	}
 }
 
-// Allow: checks if an IP is allowed to make a request
-func (iprl *IPRateLimit) Allow(ip string) bool {
-	iprl.mu.Lock()
-	defer iprl.mu.Unlock()
+// ClientIP: the request's client address, the key Allow expects (see
+// TrustedProxies.ClientIP)
+func (iprl *IPRateLimit) ClientIP(r *http.Request) string {
+	return iprl.proxies.ClientIP(r)
+}
 
+// entry: the IP's entry, created if missing
+// caller must hold write lock
+func (iprl *IPRateLimit) entry(ip string) *ipLimiterEntry {
 	entry, exists := iprl.limiters[ip]
 	if !exists {
-		// New IP: 10 connections per minute, burst of 5
 		entry = &ipLimiterEntry{
-			limiter:  rate.NewLimiter(rate.Every(6*time.Second), 5),
+			limiter:  rate.NewLimiter(iprl.rate, iprl.burst),
 			lastSeen: time.Now(),
 		}
 		iprl.limiters[ip] = entry
@@ -43,11 +58,66 @@ func (iprl *IPRateLimit) Allow(ip string) bool {
 		// Update last seen time
 		entry.lastSeen = time.Now()
 	}
+	return entry
+}
+
+// Allow: checks if an IP is allowed to make a request
+func (iprl *IPRateLimit) Allow(ip string) bool {
+	iprl.mu.Lock()
+	defer iprl.mu.Unlock()
+
+	return iprl.entry(ip).limiter.Allow()
+}
+
+// Acquire: counts an open connection from ip, false (and not counted) if the IP
+// already has the maximum open. Balanced by Release, deferred right after
+func (iprl *IPRateLimit) Acquire(ip string) bool {
+	iprl.mu.Lock()
+	defer iprl.mu.Unlock()
+
+	entry := iprl.entry(ip)
+	if entry.open >= iprl.maxOpen {
+		return false
+	}
+	entry.open++
+	return true
+}
+
+// Release: a connection counted by Acquire closed
+func (iprl *IPRateLimit) Release(ip string) {
+	iprl.mu.Lock()
+	defer iprl.mu.Unlock()
+
+	if entry, exists := iprl.limiters[ip]; exists && entry.open > 0 {
+		entry.open--
+		entry.lastSeen = time.Now()
+	}
+}
+
+// OpenConnections: open connection count of every IP with any open
+func (iprl *IPRateLimit) OpenConnections() map[string]int {
+	iprl.mu.RLock()
+	defer iprl.mu.RUnlock()
+
+	open := make(map[string]int)
+	for ip, entry := range iprl.limiters {
+		if entry.open > 0 {
+			open[ip] = entry.open
+		}
+	}
+	return open
+}
+
+// Count: number of IPs currently tracked
+func (iprl *IPRateLimit) Count() int {
+	iprl.mu.RLock()
+	defer iprl.mu.RUnlock()
 
-	return entry.limiter.Allow()
+	return len(iprl.limiters)
 }
 
-// Cleanup: removes old IP limiters that haven't been used recently
+// Cleanup: removes old IP limiters that haven't been used recently, never one
+// with open connections (its count would be lost)
 func (iprl *IPRateLimit) Cleanup() {
 	iprl.mu.Lock()
 	defer iprl.mu.Unlock()
@@ -56,7 +126,7 @@ func (iprl *IPRateLimit) Cleanup() {
 	threshold := 1 * time.Hour
 
 	for ip, entry := range iprl.limiters {
-		if now.Sub(entry.lastSeen) > threshold {
+		if entry.open == 0 && now.Sub(entry.lastSeen) > threshold {
 			delete(iprl.limiters, ip)
 		}
 	}
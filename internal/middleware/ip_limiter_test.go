@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"testing"
+)
+
+func TestIPRateLimitUsesConfiguredBurst(t *testing.T) {
+	iprl := NewIPRateLimit(0.001, 3, 20, nil)
+	for i := 0; i < 3; i++ {
+		if !iprl.Allow("10.0.0.1") {
+			t.Fatalf("connection %d refused within the burst", i+1)
+		}
+	}
+	if iprl.Allow("10.0.0.1") {
+		t.Error("connection past the burst allowed")
+	}
+	if !iprl.Allow("10.0.0.2") {
+		t.Error("another IP shares the first one's budget")
+	}
+}
+
+func TestIPRateLimitCapsOpenConnections(t *testing.T) {
+	iprl := NewIPRateLimit(1e6, 1e6, 2, nil)
+	if !iprl.Acquire("10.0.0.1") || !iprl.Acquire("10.0.0.1") {
+		t.Fatal("connections refused under the cap")
+	}
+	if iprl.Acquire("10.0.0.1") {
+		t.Fatal("third open connection allowed")
+	}
+	iprl.Release("10.0.0.1")
+	if !iprl.Acquire("10.0.0.1") {
+		t.Error("connection refused after a release")
+	}
+}
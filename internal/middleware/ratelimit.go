@@ -1,7 +1,12 @@
 package middleware
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"time"
 )
 
 // ObjectCounter interface for counting objects (avoids import cycle with room)
@@ -9,29 +14,74 @@ type ObjectCounter interface {
 	ObjectCount() int
 }
 
-//  configuration for rate limiting
+// configuration for rate limiting
 type RateLimit struct {
-	MaxRoomSize       int
-	MaxObjects        int
-	MaxMessageSize    int
-	MaxRooms          int
-	MaxObjectDepth    int
-	MaxObjectElements int
-	MessagesPerSecond float64
-	BurstSize         int
+	MaxRoomSize        int
+	MaxSpectators      int // view-only connections per room, on top of MaxRoomSize
+	MaxObjects         int
+	MaxMessageSize     int
+	MaxRooms           int
+	MaxObjectDepth     int
+	MaxObjectElements  int
+	MessagesPerSecond  float64 // per session, every message type except cursor
+	BurstSize          int
+	CursorPerSecond    float64 // per session, cursor moves (separate so they can't starve edits)
+	CursorBurstSize    int
+	ChatPerSecond      float64 // per session, chat messages
+	ChatBurstSize      int
+	HostActionInterval time.Duration // per session, destructive actions (page deletes, replaces, restores)
+	HostActionBurst    int
+	RequireZIndex      bool // reject objects without zIndex instead of assigning one
+	StrictRooms        bool // only room codes issued by POST /rooms can be joined
+	LegacyAuthColor    bool // include session color in "authenticated" for old clients
+	MaxRoomsPerSession int  // rooms one session may have open at once (tabs)
+	MaxJSONDepth       int  // nesting limit for the pre-decode scan of raw messages
+	MaxJSONTokens      int  // token limit for the pre-decode scan (10k point stroke ≈ 60k)
+	MaxSyncSize        int  // sync payloads larger than this (bytes) are sent in chunks
+	MaxBoardBytes      int  // encoded size a board merge may grow a room's drawings to
+	JoinQueueSize      int  // users parked per full room waiting for a slot (0 disables)
+	JoinQueueTimeout   time.Duration
+	LockTimeout        time.Duration // soft object locks expire this long after lockObject
+	ClearRestoreWindow time.Duration // restoreLastClear works this long after a clear or purge
+	SessionTokenTTL    time.Duration // a session token expires this long after it was issued
+	Compression        bool          // offer permessage-deflate (used if the client asks for it)
+	CompressionLevel   int           // flate level of compressed messages, 1 (fastest) to 9
+	TermsVersion       string        // sessions must acceptTerms with this version to do more than control messages ("" disables)
+	TermsURL           string        // where clients show the terms
+	Banner             string        // deployment notice sent with "authenticated" ("" for none)
 }
 
+// ErrProtocolViolation: message is malformed or pathological (rejected before decoding)
+var ErrProtocolViolation = errors.New("protocol violation")
+
 // NewRateLimit: creates a new RateLimit configuration
 func NewRateLimit(maxRoomSize, maxObjects, maxMessageSize, maxRooms, maxObjectDepth, maxObjectElements int, messagesPerSecond float64, burstSize int) *RateLimit {
 	return &RateLimit{
-		MaxRoomSize:       maxRoomSize,
-		MaxObjects:        maxObjects,
-		MaxMessageSize:    maxMessageSize,
-		MaxRooms:          maxRooms,
-		MaxObjectDepth:    maxObjectDepth,
-		MaxObjectElements: maxObjectElements,
-		MessagesPerSecond: messagesPerSecond,
-		BurstSize:         burstSize,
+		MaxRoomSize:        maxRoomSize,
+		MaxSpectators:      50,
+		MaxObjects:         maxObjects,
+		MaxMessageSize:     maxMessageSize,
+		MaxRooms:           maxRooms,
+		MaxObjectDepth:     maxObjectDepth,
+		MaxObjectElements:  maxObjectElements,
+		MessagesPerSecond:  messagesPerSecond,
+		BurstSize:          burstSize,
+		CursorPerSecond:    60,
+		CursorBurstSize:    20,
+		ChatPerSecond:      1,
+		ChatBurstSize:      5,
+		HostActionInterval: 10 * time.Second,
+		HostActionBurst:    3,
+		MaxJSONDepth:       16,
+		MaxJSONTokens:      200000,
+		MaxRoomsPerSession: 5,
+		SessionTokenTTL:    24 * time.Hour,
+		MaxSyncSize:        512 * 1024,
+		MaxBoardBytes:      8 * 1024 * 1024,
+		JoinQueueTimeout:   30 * time.Second,
+		LockTimeout:        30 * time.Second,
+		ClearRestoreWindow: 2 * time.Minute,
+		CompressionLevel:   1,
 	}
 }
 
@@ -45,6 +95,44 @@ func (rl *RateLimit) ValidateMessageSize(msgSize int) bool {
 	return msgSize <= rl.MaxMessageSize
 }
 
+// ScanJSON: streams over raw JSON tokens enforcing depth and token limits
+// Runs before any full decode so pathological nesting never gets allocated
+func (rl *RateLimit) ScanJSON(msg []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(msg))
+	decoder.UseNumber() // avoid float parsing, only structure matters here
+
+	depth, tokens := 0, 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF && depth > 0 {
+			return fmt.Errorf("%w: invalid JSON: unexpected end", ErrProtocolViolation)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: invalid JSON: %v", ErrProtocolViolation, err)
+		}
+
+		tokens++
+		if tokens > rl.MaxJSONTokens {
+			return fmt.Errorf("%w: more than %d JSON tokens", ErrProtocolViolation, rl.MaxJSONTokens)
+		}
+
+		if delim, ok := token.(json.Delim); ok {
+			switch delim {
+			case '{', '[':
+				depth++
+				if depth > rl.MaxJSONDepth {
+					return fmt.Errorf("%w: JSON nested deeper than %d", ErrProtocolViolation, rl.MaxJSONDepth)
+				}
+			case '}', ']':
+				depth--
+			}
+		}
+	}
+}
+
 // ValidateObjectComplexity: validates object data complexity
 // Checks nesting depth and unique key count (not array lengths)
 func (rl *RateLimit) ValidateObjectComplexity(data map[string]interface{}) error {
@@ -62,30 +150,33 @@ func (rl *RateLimit) ValidateObjectComplexity(data map[string]interface{}) error
 }
 
 // validateComplexity: recursively checks depth and counts unique keys
+// Keys repeated across array elements (e.g. x/y of each point) count once
 func validateComplexity(data interface{}, currentDepth int) (int, int) {
+	keys := make(map[string]struct{})
+	maxDepth := collectComplexity(data, currentDepth, keys)
+	return maxDepth, len(keys)
+}
+
+// collectComplexity: walks data recording key names, returns max depth reached
+func collectComplexity(data interface{}, currentDepth int, keys map[string]struct{}) int {
 	maxDepth := currentDepth
-	keyCount := 0
 
 	switch v := data.(type) {
 	case map[string]interface{}:
-		keyCount = len(v) 
-		for _, val := range v {
-			subDepth, subKeys := validateComplexity(val, currentDepth+1)
-			if subDepth > maxDepth {
+		for key, val := range v {
+			keys[key] = struct{}{}
+			if subDepth := collectComplexity(val, currentDepth+1, keys); subDepth > maxDepth {
 				maxDepth = subDepth
 			}
-			keyCount += subKeys
 		}
 	case []interface{}:
 		// Don't count array length
 		for _, val := range v {
-			subDepth, subKeys := validateComplexity(val, currentDepth+1)
-			if subDepth > maxDepth {
+			if subDepth := collectComplexity(val, currentDepth+1, keys); subDepth > maxDepth {
 				maxDepth = subDepth
 			}
-			keyCount += subKeys
 		}
 	}
 
-	return maxDepth, keyCount
+	return maxDepth
 }
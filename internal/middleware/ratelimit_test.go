@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testLimits: the default limits (see config.Defaults)
+func testLimits() *RateLimit {
+	return NewRateLimit(10, 1000, 250000, 100, 5, 1000, 30, 60)
+}
+
+// longStroke: an objectAdded message for a stroke with n points, as a drawing
+// app sends it
+func longStroke(n int) []byte {
+	points := make([]map[string]int, n)
+	for i := range points {
+		points[i] = map[string]int{"x": 100 + i%900, "y": 200 + (i*7)%700}
+	}
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type": "objectAdded",
+		"object": map[string]interface{}{
+			"id":     "stroke-1",
+			"type":   "stroke",
+			"zIndex": 1,
+			"data":   map[string]interface{}{"points": points, "color": "#222222", "width": 3},
+		},
+	})
+	return msg
+}
+
+func TestScanJSONAcceptsLongStroke(t *testing.T) {
+	rl := testLimits()
+	msg := longStroke(10000)
+	if !rl.ValidateMessageSize(len(msg)) {
+		t.Fatalf("10,000 point stroke is %d bytes, over the message size limit", len(msg))
+	}
+	if err := rl.ScanJSON(msg); err != nil {
+		t.Fatalf("ScanJSON: %v", err)
+	}
+
+	var decoded struct {
+		Object struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"object"`
+	}
+	if err := json.Unmarshal(msg, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if err := rl.ValidateObjectComplexity(decoded.Object.Data); err != nil {
+		t.Fatalf("ValidateObjectComplexity: %v", err)
+	}
+}
+
+func TestScanJSONRejectsDeepNesting(t *testing.T) {
+	rl := testLimits()
+	for _, msg := range []string{
+		strings.Repeat("[", 100000) + strings.Repeat("]", 100000),
+		`{"type":"objectAdded","object":` + strings.Repeat(`{"a":`, 20) + "1" + strings.Repeat("}", 20) + "}",
+	} {
+		err := rl.ScanJSON([]byte(msg))
+		if !errors.Is(err, ErrProtocolViolation) {
+			t.Errorf("ScanJSON(%.40s...) = %v, want ErrProtocolViolation", msg, err)
+		}
+	}
+
+	// Right at the limit is fine
+	atLimit := strings.Repeat("[", rl.MaxJSONDepth) + strings.Repeat("]", rl.MaxJSONDepth)
+	if err := rl.ScanJSON([]byte(atLimit)); err != nil {
+		t.Errorf("depth %d: %v", rl.MaxJSONDepth, err)
+	}
+}
+
+func TestScanJSONRejectsTooManyTokens(t *testing.T) {
+	rl := testLimits()
+	rl.MaxJSONTokens = 1000
+	msg := "[" + strings.TrimSuffix(strings.Repeat("1,", 1000), ",") + "]"
+	if err := rl.ScanJSON([]byte(msg)); !errors.Is(err, ErrProtocolViolation) {
+		t.Errorf("1002 tokens = %v, want ErrProtocolViolation", err)
+	}
+}
+
+func TestScanJSONRejectsInvalidJSON(t *testing.T) {
+	rl := testLimits()
+	for _, msg := range []string{`{"type":`, `{"type" "x"}`, `]`} {
+		if err := rl.ScanJSON([]byte(msg)); !errors.Is(err, ErrProtocolViolation) {
+			t.Errorf("ScanJSON(%q) = %v, want ErrProtocolViolation", msg, err)
+		}
+	}
+}
+
+func TestValidateObjectComplexity(t *testing.T) {
+	rl := testLimits()
+	deep := map[string]interface{}{"v": 1}
+	for i := 0; i < rl.MaxObjectDepth+1; i++ {
+		deep = map[string]interface{}{"nested": deep}
+	}
+	if err := rl.ValidateObjectComplexity(deep); err == nil {
+		t.Error("nesting past MaxObjectDepth accepted")
+	}
+
+	wide := make(map[string]interface{})
+	for i := 0; i <= rl.MaxObjectElements; i++ {
+		wide[fmt.Sprintf("k%d", i)] = i
+	}
+	if err := rl.ValidateObjectComplexity(wide); err == nil {
+		t.Error("more unique keys than MaxObjectElements accepted")
+	}
+}
+
+func BenchmarkScanJSONCursor(b *testing.B) {
+	rl := testLimits()
+	msg := []byte(`{"type":"cursor","x":512.5,"y":384.25,"timestamp":1700000000000}`)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := rl.ScanJSON(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDecodeCursor: the full decode ScanJSON runs before, for comparison
+func BenchmarkDecodeCursor(b *testing.B) {
+	msg := []byte(`{"type":"cursor","x":512.5,"y":384.25,"timestamp":1700000000000}`)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var data map[string]interface{}
+		if err := json.Unmarshal(msg, &data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScanJSONStroke(b *testing.B) {
+	rl := testLimits()
+	msg := longStroke(200)
+	b.SetBytes(int64(len(msg)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := rl.ScanJSON(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
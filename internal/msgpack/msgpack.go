@@ -0,0 +1,371 @@
+package msgpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// MessagePack (https://msgpack.org) for the values JSON messages hold: nil,
+// bool, numbers, strings, arrays and string-keyed maps. Extension types aren't
+// supported, binary strings decode as strings
+
+var (
+	// ErrTruncated: the data ends inside a value
+	ErrTruncated = errors.New("msgpack: unexpected end of data")
+	// ErrTooDeep: nesting or item count over the decode limits
+	ErrTooDeep = errors.New("msgpack: too deeply nested or too many items")
+)
+
+// FromJSON: the MessagePack encoding of a JSON document (whole numbers are
+// encoded as integers, the rest as float64)
+func FromJSON(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("msgpack: decode json: %w", err)
+	}
+	return Marshal(value)
+}
+
+// Marshal: encodes a JSON-like value (as produced by encoding/json with
+// interface{} targets), map keys are written sorted
+func Marshal(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encode(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case string:
+		encodeString(buf, v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			encodeInt(buf, i)
+			return nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return fmt.Errorf("msgpack: invalid number %q", v)
+		}
+		encodeFloat(buf, f)
+	case float64:
+		encodeFloat(buf, v)
+	case float32:
+		encodeFloat(buf, float64(v))
+	case int:
+		encodeInt(buf, int64(v))
+	case int64:
+		encodeInt(buf, v)
+	case uint64:
+		if v > math.MaxInt64 {
+			buf.WriteByte(0xcf)
+			buf.Write(binary.BigEndian.AppendUint64(nil, v))
+			return nil
+		}
+		encodeInt(buf, int64(v))
+	case []interface{}:
+		encodeLength(buf, len(v), 0x90, 0xdc, 0xdd)
+		for _, item := range v {
+			if err := encode(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		encodeLength(buf, len(keys), 0x80, 0xde, 0xdf)
+		for _, key := range keys {
+			encodeString(buf, key)
+			if err := encode(buf, v[key]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %T", value)
+	}
+	return nil
+}
+
+// encodeLength: array or map header, fix is the fixarray/fixmap prefix
+func encodeLength(buf *bytes.Buffer, n int, fix, prefix16, prefix32 byte) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(prefix16)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	default:
+		buf.WriteByte(prefix32)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	}
+}
+
+func encodeString(buf *bytes.Buffer, s string) {
+	switch n := len(s); {
+	case n < 32:
+		buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(0xd9)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xda)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	default:
+		buf.WriteByte(0xdb)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	}
+	buf.WriteString(s)
+}
+
+// encodeFloat: whole numbers that are exact as float64 become integers
+func encodeFloat(buf *bytes.Buffer, f float64) {
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		encodeInt(buf, int64(f))
+		return
+	}
+	buf.WriteByte(0xcb)
+	buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(f)))
+}
+
+// encodeInt: smallest integer format holding i
+func encodeInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i <= 127:
+		buf.WriteByte(byte(i))
+	case i < 0 && i >= -32:
+		buf.WriteByte(byte(int8(i)))
+	case i >= 0 && i <= math.MaxUint8:
+		buf.WriteByte(0xcc)
+		buf.WriteByte(byte(i))
+	case i >= 0 && i <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(i)))
+	case i >= 0 && i <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(i)))
+	case i >= 0:
+		buf.WriteByte(0xcf)
+		buf.Write(binary.BigEndian.AppendUint64(nil, uint64(i)))
+	case i >= math.MinInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(int16(i))))
+	case i >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(int32(i))))
+	default:
+		buf.WriteByte(0xd3)
+		buf.Write(binary.BigEndian.AppendUint64(nil, uint64(i)))
+	}
+}
+
+// Unmarshal: decodes one value the way encoding/json decodes into interface{}
+// (numbers are float64, maps map[string]interface{}). maxDepth bounds nesting
+// and maxItems the total number of values, like the JSON pre-decode scan
+func Unmarshal(data []byte, maxDepth, maxItems int) (interface{}, error) {
+	d := &decoder{data: data, maxDepth: maxDepth, itemsLeft: maxItems}
+	value, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("msgpack: %d trailing bytes", len(d.data)-d.pos)
+	}
+	return value, nil
+}
+
+type decoder struct {
+	data      []byte
+	pos       int
+	maxDepth  int
+	itemsLeft int
+}
+
+// take: the next n bytes
+func (d *decoder) take(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.pos < n {
+		return nil, ErrTruncated
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// uint: big endian unsigned integer of size bytes
+func (d *decoder) uint(size int) (uint64, error) {
+	b, err := d.take(size)
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+func (d *decoder) value(depth int) (interface{}, error) {
+	if d.itemsLeft--; d.itemsLeft < 0 || depth > d.maxDepth {
+		return nil, ErrTooDeep
+	}
+	prefix, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c := prefix[0]; {
+	case c <= 0x7f:
+		return float64(c), nil
+	case c >= 0xe0:
+		return float64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.mapOf(int(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return d.arrayOf(int(c&0x0f), depth)
+	case c&0xe0 == 0xa0:
+		return d.str(int(c & 0x1f))
+	}
+
+	switch c := prefix[0]; c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6, 0xd9, 0xda, 0xdb: // bin and str 8/16/32
+		n, err := d.uint(sizeOf(c))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+	case 0xca:
+		n, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return finite(float64(math.Float32frombits(uint32(n))))
+	case 0xcb:
+		n, err := d.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return finite(math.Float64frombits(n))
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := d.uint(1 << (c - 0xcc))
+		return float64(n), err
+	case 0xd0:
+		n, err := d.uint(1)
+		return float64(int8(n)), err
+	case 0xd1:
+		n, err := d.uint(2)
+		return float64(int16(n)), err
+	case 0xd2:
+		n, err := d.uint(4)
+		return float64(int32(n)), err
+	case 0xd3:
+		n, err := d.uint(8)
+		return float64(int64(n)), err
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.arrayOf(int(n), depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapOf(int(n), depth)
+	default:
+		return nil, fmt.Errorf("msgpack: unsupported format 0x%02x", c)
+	}
+}
+
+// finite: f, or an error for NaN and infinities (JSON can't carry them, and
+// range checks don't catch NaN)
+func finite(f float64) (interface{}, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("msgpack: number must be finite")
+	}
+	return f, nil
+}
+
+// sizeOf: length field size of a bin or str format
+func sizeOf(c byte) int {
+	switch c {
+	case 0xc4, 0xd9:
+		return 1
+	case 0xc5, 0xda:
+		return 2
+	default:
+		return 4
+	}
+}
+
+func (d *decoder) str(n int) (string, error) {
+	b, err := d.take(n)
+	return string(b), err
+}
+
+func (d *decoder) arrayOf(n int, depth int) ([]interface{}, error) {
+	if n > len(d.data)-d.pos { // every item takes at least a byte
+		return nil, ErrTruncated
+	}
+	items := make([]interface{}, n)
+	for i := range items {
+		item, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = item
+	}
+	return items, nil
+}
+
+func (d *decoder) mapOf(n int, depth int) (map[string]interface{}, error) {
+	if n > (len(d.data)-d.pos)/2 { // every entry takes at least two bytes
+		return nil, ErrTruncated
+	}
+	entries := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		key, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		name, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("msgpack: map key must be a string, got %T", key)
+		}
+		value, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		entries[name] = value
+	}
+	return entries, nil
+}
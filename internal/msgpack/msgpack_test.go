@@ -0,0 +1,108 @@
+package msgpack
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// roundTrip: doc through FromJSON and Unmarshal, checked against encoding/json
+func roundTrip(t *testing.T, doc string) {
+	t.Helper()
+	var want interface{}
+	if err := json.Unmarshal([]byte(doc), &want); err != nil {
+		t.Fatal(err)
+	}
+	packed, err := FromJSON([]byte(doc))
+	if err != nil {
+		t.Fatalf("%.60s: %v", doc, err)
+	}
+	got, err := Unmarshal(packed, 100, 1<<20)
+	if err != nil {
+		t.Fatalf("%.60s: %v", doc, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%.60s: decoded %v, want %v", doc, got, want)
+	}
+}
+
+func TestRoundTripValues(t *testing.T) {
+	for _, doc := range []string{
+		`null`, `true`, `false`, `""`, `"héllo"`,
+		`0`, `1`, `127`, `128`, `255`, `256`, `65535`, `65536`, `4294967295`, `4294967296`, `9007199254740991`,
+		`-1`, `-32`, `-33`, `-128`, `-129`, `-32768`, `-32769`, `-2147483648`, `-2147483649`, `-9007199254740991`,
+		`0.5`, `-1.25`, `3.141592653589793`, `1e300`, `1e-300`, `12345678901234567890`,
+		`[]`, `[1,"a",null,[true,{}]]`, `{}`, `{"a":{"b":{"c":[1.5]}}}`,
+		fmt.Sprintf(`"%s"`, strings.Repeat("x", 31)),
+		fmt.Sprintf(`"%s"`, strings.Repeat("x", 32)),
+		fmt.Sprintf(`"%s"`, strings.Repeat("x", 256)),
+		fmt.Sprintf(`"%s"`, strings.Repeat("x", 70000)),
+	} {
+		roundTrip(t, doc)
+	}
+
+	// array and map headers past the fix and 16-bit sizes
+	for _, n := range []int{15, 16, 65535, 65536} {
+		items := make([]string, n)
+		entries := make([]string, n)
+		for i := range items {
+			items[i] = fmt.Sprint(i)
+			entries[i] = fmt.Sprintf(`"k%d":%d`, i, i)
+		}
+		roundTrip(t, "["+strings.Join(items, ",")+"]")
+		roundTrip(t, "{"+strings.Join(entries, ",")+"}")
+	}
+}
+
+func TestMarshalGoValues(t *testing.T) {
+	packed, err := Marshal(map[string]interface{}{"i": 3, "i64": int64(-7), "f32": float32(0.5), "s": []interface{}{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Unmarshal(packed, 10, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"i": 3.0, "i64": -7.0, "f32": 0.5, "s": []interface{}{"a"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded %v, want %v", got, want)
+	}
+
+	if _, err := Marshal(struct{}{}); err == nil {
+		t.Error("struct encoded")
+	}
+}
+
+func TestUnmarshalRejects(t *testing.T) {
+	nan := append([]byte{0xcb}, make([]byte, 8)...)
+	bits := math.Float64bits(math.NaN())
+	for i := 0; i < 8; i++ {
+		nan[1+i] = byte(bits >> (56 - 8*i))
+	}
+
+	for name, tc := range map[string]struct {
+		data []byte
+		want error
+	}{
+		"empty":           {nil, ErrTruncated},
+		"short string":    {[]byte{0xa5, 'a'}, ErrTruncated},
+		"short uint16":    {[]byte{0xcd, 1}, ErrTruncated},
+		"array past data": {[]byte{0xdd, 0xff, 0xff, 0xff, 0xff}, ErrTruncated},
+		"map past data":   {[]byte{0x81, 0xa1, 'a'}, ErrTruncated},
+		"too deep":        {[]byte{0x91, 0x91, 0x91, 0x91, 0x01}, ErrTooDeep},
+		"too many items":  {[]byte{0x9f, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}, ErrTooDeep},
+		"nan":             {nan, nil},
+		"int map key":     {[]byte{0x81, 0x01, 0x02}, nil},
+		"extension":       {[]byte{0xd4, 0x01, 0x02}, nil},
+		"trailing bytes":  {[]byte{0x01, 0x02}, nil},
+	} {
+		_, err := Unmarshal(tc.data, 3, 10)
+		if err == nil || (tc.want != nil && !errors.Is(err, tc.want)) {
+			t.Errorf("%s: err = %v, want %v", name, err, tc.want)
+		}
+	}
+}
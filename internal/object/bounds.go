@@ -0,0 +1,68 @@
+package object
+
+import "math"
+
+// Bounds: axis-aligned bounding box of a drawing
+type Bounds struct {
+	MinX float64 `json:"minX"`
+	MinY float64 `json:"minY"`
+	MaxX float64 `json:"maxX"`
+	MaxY float64 `json:"maxY"`
+}
+
+// BoundingBox: computes bounds from the coordinate fields of object data
+// (x/y, x1/y1/x2/y2, cx/cy with rx/ry, points), false if data has no coordinates
+func BoundingBox(data map[string]interface{}) (Bounds, bool) {
+	b := Bounds{MinX: math.Inf(1), MinY: math.Inf(1), MaxX: math.Inf(-1), MaxY: math.Inf(-1)}
+	found := false
+
+	add := func(x, y float64) {
+		b.MinX, b.MaxX = math.Min(b.MinX, x), math.Max(b.MaxX, x)
+		b.MinY, b.MaxY = math.Min(b.MinY, y), math.Max(b.MaxY, y)
+		found = true
+	}
+
+	for _, pair := range [][2]string{{"x", "y"}, {"x1", "y1"}, {"x2", "y2"}, {"cx", "cy"}} {
+		x, okX := data[pair[0]].(float64)
+		y, okY := data[pair[1]].(float64)
+		if okX && okY {
+			add(x, y)
+		}
+	}
+
+	if points, ok := data["points"].([]interface{}); ok {
+		for _, p := range points {
+			point, ok := p.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			x, okX := point["x"].(float64)
+			y, okY := point["y"].(float64)
+			if okX && okY {
+				add(x, y)
+			}
+		}
+	}
+
+	// Ellipses around cx/cy, a rotated one fits in the circle of its larger radius
+	cx, okX := data["cx"].(float64)
+	cy, okY := data["cy"].(float64)
+	rx, okRX := data["rx"].(float64)
+	ry, okRY := data["ry"].(float64)
+	if okX && okY && okRX && okRY {
+		if rotation, _ := data["rotation"].(float64); math.Mod(rotation, 180) != 0 {
+			rx, ry = math.Max(rx, ry), math.Max(rx, ry)
+		}
+		add(cx-rx, cy-ry)
+		add(cx+rx, cy+ry)
+	}
+
+	// Sized shapes anchored at x/y
+	if width, ok := data["width"].(float64); ok && found && data["x1"] == nil {
+		if height, ok := data["height"].(float64); ok {
+			add(b.MinX+width, b.MinY+height)
+		}
+	}
+
+	return b, found
+}
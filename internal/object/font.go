@@ -0,0 +1,109 @@
+package object
+
+import (
+	"math"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// DefaultFontFamilies: web-safe families text may use unless configured otherwise
+var DefaultFontFamilies = []string{
+	"sans-serif", "serif", "monospace",
+	"Arial", "Helvetica", "Verdana", "Georgia", "Times New Roman", "Courier New",
+}
+
+// FontPolicy: font families text objects may use and the font sizes they snap to
+type FontPolicy struct {
+	Families  []string  `json:"families"`  // allowed families, the first is the default. Empty allows any
+	Strict    bool      `json:"strict"`    // reject unknown families instead of using the default
+	SizeSteps []float64 `json:"sizeSteps"` // font sizes snap to the nearest step, empty keeps them as sent
+}
+
+// DefaultFontPolicy: web-safe families, unknown ones replaced, sizes unchanged
+func DefaultFontPolicy() FontPolicy {
+	return FontPolicy{Families: DefaultFontFamilies}
+}
+
+// SetFontPolicy: replaces the font allowlist and size steps applied to text
+func (v *Validator) SetFontPolicy(policy FontPolicy) {
+	v.fontPolicy = policy
+}
+
+// Default: family used for unknown families ("" when any family is allowed)
+func (p FontPolicy) Default() string {
+	if len(p.Families) == 0 {
+		return ""
+	}
+	return p.Families[0]
+}
+
+// Allowed: family is on the allowlist (case-insensitive)
+func (p FontPolicy) Allowed(family string) bool {
+	_, ok := p.lookup(family)
+	return ok
+}
+
+// Resolve: the allowlisted spelling of family, or the default family
+func (p FontPolicy) Resolve(family string) string {
+	if allowed, ok := p.lookup(family); ok {
+		return allowed
+	}
+	return p.Default()
+}
+
+// Snap: size moved to the nearest size step
+func (p FontPolicy) Snap(size float64) float64 {
+	snapped := size
+	for i, step := range p.SizeSteps {
+		if i == 0 || math.Abs(step-size) < math.Abs(snapped-size) {
+			snapped = step
+		}
+	}
+	return snapped
+}
+
+// lookup: allowlist entry matching family, any family matches an empty list
+func (p FontPolicy) lookup(family string) (string, bool) {
+	if len(p.Families) == 0 {
+		return family, true
+	}
+	for _, allowed := range p.Families {
+		if strings.EqualFold(strings.TrimSpace(family), allowed) {
+			return allowed, true
+		}
+	}
+	return "", false
+}
+
+// validateFont: "font" validate tag, the family is on the allowlist
+func (v *Validator) validateFont(fl validator.FieldLevel) bool {
+	return v.fontPolicy.Allowed(fl.Field().String())
+}
+
+// applyFontPolicy: copy of text data with its family resolved (unless the policy
+// is strict, the "font" tag rejects unknown families then) and its size snapped
+// (notes have only a size). Other types are returned as is
+func (v *Validator) applyFontPolicy(objType string, data map[string]interface{}) map[string]interface{} {
+	if objType != "text" && objType != "note" {
+		return data
+	}
+	family, hasFamily := data["fontFamily"].(string)
+	size, hasSize := data["fontSize"].(float64)
+
+	applied := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		applied[key] = value
+	}
+	if hasFamily && family != "" {
+		if allowed, ok := v.fontPolicy.lookup(family); ok {
+			applied["fontFamily"] = allowed
+		} else if !v.fontPolicy.Strict {
+			applied["fontFamily"] = v.fontPolicy.Default()
+		}
+	}
+	if hasSize && size != 0 && len(v.fontPolicy.SizeSteps) > 0 {
+		applied["fontSize"] = v.fontPolicy.Snap(size)
+	}
+	return applied
+}
@@ -0,0 +1,118 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ErrUnsafeImage: image URL isn't https (or an allowed data: image), or points
+// at a private, loopback or otherwise internal address
+var ErrUnsafeImage = errors.New("unsafe image url")
+
+// ImagePolicy: limits on image object sources
+type ImagePolicy struct {
+	DataURIBytes int // data: URIs up to this length are allowed, 0 allows none
+}
+
+// SetImagePolicy: replaces the limits applied to image URLs
+func (v *Validator) SetImagePolicy(policy ImagePolicy) {
+	v.imagePolicy = policy
+}
+
+// dataImage: base64 data URI of a raster image format browsers render safely
+// (no SVG, it can carry scripts)
+var dataImage = regexp.MustCompile(`^data:image/(png|jpeg|gif|webp);base64,[A-Za-z0-9+/]+={0,2}$`)
+
+// internalHosts: host names (and their subdomains) that only resolve inside a network
+var internalHosts = []string{"localhost", "local", "internal", "lan", "home.arpa"}
+
+// validateImageURL: checks an image's "url" and returns it normalized. Like links
+// it bypasses HTML sanitizing, so characters that could break out of an
+// attribute are rejected. Host names aren't resolved here: whatever fetches
+// images server-side must check the address it connects to as well
+func (v *Validator) validateImageURL(raw interface{}) (string, error) {
+	src, ok := raw.(string)
+	if !ok || src == "" {
+		return "", fmt.Errorf("'url' is required")
+	}
+
+	if strings.HasPrefix(strings.ToLower(src), "data:") {
+		if v.imagePolicy.DataURIBytes == 0 {
+			return "", fmt.Errorf("%w: data URIs are not allowed", ErrUnsafeImage)
+		}
+		if len(src) > v.imagePolicy.DataURIBytes {
+			return "", fmt.Errorf("%w: data URI over %d bytes", ErrUnsafeImage, v.imagePolicy.DataURIBytes)
+		}
+		if !dataImage.MatchString(src) {
+			return "", fmt.Errorf("%w: data URI must be a base64 png, jpeg, gif or webp image", ErrUnsafeImage)
+		}
+		return src, nil
+	}
+
+	if len(src) > MaxURLLength {
+		return "", fmt.Errorf("'url' value out of allowed range")
+	}
+	if strings.ContainsAny(src, "<>\"'` \\") {
+		return "", fmt.Errorf("%w: invalid characters", ErrUnsafeImage)
+	}
+	for _, r := range src {
+		if r < 0x20 || r == 0x7f {
+			return "", fmt.Errorf("%w: invalid characters", ErrUnsafeImage)
+		}
+	}
+
+	parsed, err := url.Parse(src)
+	if err != nil {
+		return "", fmt.Errorf("'url' must be a valid URL")
+	}
+	if !strings.EqualFold(parsed.Scheme, "https") {
+		return "", fmt.Errorf("%w: scheme %q", ErrUnsafeImage, parsed.Scheme)
+	}
+	if parsed.Host == "" || parsed.User != nil {
+		return "", fmt.Errorf("%w: invalid host", ErrUnsafeImage)
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	if ip := net.ParseIP(host); ip != nil {
+		if !publicIP(ip) {
+			return "", fmt.Errorf("%w: internal address %s", ErrUnsafeImage, host)
+		}
+	} else if !strings.Contains(host, ".") || matchesHost(host, internalHosts) {
+		return "", fmt.Errorf("%w: internal host %s", ErrUnsafeImage, host)
+	} else if numericLabel(host[strings.LastIndex(host, ".")+1:]) {
+		// 0x7f.1 or 127.1 reach loopback too, top level domains are never numeric
+		return "", fmt.Errorf("%w: non-canonical address %s", ErrUnsafeImage, host)
+	}
+
+	parsed.Scheme = "https"
+	return parsed.String(), nil
+}
+
+// numericLabel: label is a decimal, octal or hex number
+func numericLabel(label string) bool {
+	digits := "0123456789"
+	if hex, isHex := strings.CutPrefix(label, "0x"); isHex {
+		label, digits = hex, "0123456789abcdef"
+	}
+	for _, r := range label {
+		if !strings.ContainsRune(digits, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// publicIP: ip is routable on the internet (not loopback, private, link-local,
+// unspecified, multicast or carrier-grade NAT)
+func publicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	_, cgnat, _ := net.ParseCIDR("100.64.0.0/10")
+	return !cgnat.Contains(ip)
+}
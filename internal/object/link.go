@@ -0,0 +1,87 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrUnsafeLink: link uses a scheme other than https (javascript:, data:, ...)
+	ErrUnsafeLink = errors.New("unsafe link")
+	// ErrLinkNotAllowed: link host is denied (or not allowed) by the link policy
+	ErrLinkNotAllowed = errors.New("link not allowed")
+)
+
+// LinkPolicy: hosts objects may link to, subdomains match too ("example.com"
+// covers "docs.example.com"). Empty Allow permits every host not in Deny
+type LinkPolicy struct {
+	Allow []string
+	Deny  []string
+}
+
+// SetLinkPolicy: replaces the host allow/deny lists applied to object links
+func (v *Validator) SetLinkPolicy(policy LinkPolicy) {
+	v.linkPolicy = policy
+}
+
+// validateLink: checks an object's optional "link" (https only, within policy)
+// and returns it normalized. Links bypass HTML sanitizing (it would escape "&")
+// so characters that could break out of an attribute are rejected instead
+func (v *Validator) validateLink(raw interface{}) (string, error) {
+	link, ok := raw.(string)
+	if !ok {
+		return "", fmt.Errorf("'link' must be a string")
+	}
+	if link == "" {
+		return "", nil // no link
+	}
+	if len(link) > MaxURLLength {
+		return "", fmt.Errorf("'link' value out of allowed range")
+	}
+	if strings.ContainsAny(link, "<>\"'` \\") {
+		return "", fmt.Errorf("%w: invalid characters", ErrUnsafeLink)
+	}
+	for _, r := range link {
+		if r < 0x20 || r == 0x7f {
+			return "", fmt.Errorf("%w: invalid characters", ErrUnsafeLink)
+		}
+	}
+
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("'link' must be a valid URL")
+	}
+	if !strings.EqualFold(parsed.Scheme, "https") {
+		return "", fmt.Errorf("%w: scheme %q", ErrUnsafeLink, parsed.Scheme)
+	}
+	if parsed.Host == "" || parsed.User != nil {
+		return "", fmt.Errorf("%w: invalid host", ErrUnsafeLink)
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	if matchesHost(host, v.linkPolicy.Deny) {
+		return "", fmt.Errorf("%w: %s", ErrLinkNotAllowed, host)
+	}
+	if len(v.linkPolicy.Allow) > 0 && !matchesHost(host, v.linkPolicy.Allow) {
+		return "", fmt.Errorf("%w: %s", ErrLinkNotAllowed, host)
+	}
+
+	parsed.Scheme = "https"
+	return parsed.String(), nil
+}
+
+// matchesHost: host equals or is a subdomain of one of domains
+func matchesHost(host string, domains []string) bool {
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain == "" {
+			continue
+		}
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,9 +1,28 @@
-package object 
+package object
+
+import "time"
 
 type Drawing struct {
-	ID     string                 `json:"id"`
-	Type   string                 `json:"type"`
-	Data   map[string]interface{} `json:"data"`
-	UserID string                 `json:"userId"`
-	ZIndex int                    `json:"zIndex"`
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	Data      map[string]interface{} `json:"data"`
+	UserID    string                 `json:"userId"`
+	ZIndex    int                    `json:"zIndex"`
+	PageID    string                 `json:"pageId"`
+	CreatedAt time.Time              `json:"createdAt"`
+	UpdatedAt time.Time              `json:"updatedAt"`
+
+	// Provisional: in-progress (e.g. stroke being drawn), removed if the owner
+	// disconnects without finalizing it
+	Provisional bool `json:"provisional,omitempty"`
+
+	// Origin: where a drawing merged in from another room came from (UserID
+	// stays its author)
+	Origin *Origin `json:"origin,omitempty"`
+}
+
+// Origin: source room and drawing ID of a merged drawing
+type Origin struct {
+	Room     string `json:"room"`
+	ObjectID string `json:"objectId"`
 }
@@ -5,20 +5,46 @@ const (
 	MaxStringLength  = 1000
 	MaxURLLength     = 2048
 	MaxPointsInPath  = 10000
+	MaxPolygonPoints = 1000
+	MinNoteSide      = 20
+	MaxNoteSide      = 2000
+	MaxNoteText      = 2000
 	MaxCoordinate    = 1000000
 	MinCoordinate    = -1000000
 	MaxStrokeWidth   = 1000
 	MaxFontSize      = 500
 	MaxColorLength   = 50
+	MaxZIndex        = 1000000
+	MinZIndex        = -1000000
 )
 
+// BoardFormatVersion: version of the board JSON format accepted by imports
+const BoardFormatVersion = 1
+
 var AllowedObjectTypes = map[string]bool{
 	"rectangle": true,
 	"circle":    true,
 	"line":      true,
 	"path":      true,
+	"brush":     true,
 	"text":      true,
 	"stroke":    true,
+	"arrow":     true,
+	"ellipse":   true,
+	"polygon":   true,
+	"image":     true,
+	"note":      true,
+}
+
+// mergedUpdateTypes: updates to these send only the fields that changed
+// (e.g. a note's text), merged into the current data
+var mergedUpdateTypes = map[string]bool{
+	"note": true,
+}
+
+// MergesUpdates: objType's updates are partial, see mergedUpdateTypes
+func MergesUpdates(objType string) bool {
+	return mergedUpdateTypes[objType]
 }
 
 func GetSchemaForType(objType string) interface{} {
@@ -29,12 +55,22 @@ func GetSchemaForType(objType string) interface{} {
 		return &CircleData{}
 	case "line":
 		return &LineData{}
-	case "brush":
+	case "brush", "path": // a path is a brush stroke with its styling
 		return &BrushData{}
 	case "stroke":
 		return &StrokeData{}
 	case "text":
 		return &TextData{}
+	case "arrow":
+		return &ArrowData{}
+	case "ellipse":
+		return &EllipseData{}
+	case "polygon":
+		return &PolygonData{}
+	case "image":
+		return &ImageData{}
+	case "note":
+		return &NoteData{}
 	default:
 		return nil
 	}
@@ -44,25 +80,25 @@ func GetSchemaForType(objType string) interface{} {
 // Common Embedded Structs
 // =============================================================================
 
-//  x,y coordinates for positioning shapes on the canvas
+// x,y coordinates for positioning shapes on the canvas
 type Position struct {
 	X float64 `json:"x" validate:"required,min=-1000000,max=1000000"`
 	Y float64 `json:"y" validate:"required,min=-1000000,max=1000000"`
 }
 
-//  center x,y coordinates (cx, cy) for circular shapes
+// center x,y coordinates (cx, cy) for circular shapes
 type CenterPosition struct {
 	CX float64 `json:"cx" validate:"required,min=-1000000,max=1000000"`
 	CY float64 `json:"cy" validate:"required,min=-1000000,max=1000000"`
 }
 
-//  width and height dimensions
+// width and height dimensions
 type Size struct {
 	Width  float64 `json:"width" validate:"required,min=0,max=1000000"`
 	Height float64 `json:"height" validate:"required,min=0,max=1000000"`
 }
 
-//  start and end points for line-based shapes
+// start and end points for line-based shapes
 type LineCoordinates struct {
 	X1 float64 `json:"x1" validate:"required,min=-1000000,max=1000000"`
 	Y1 float64 `json:"y1" validate:"required,min=-1000000,max=1000000"`
@@ -70,7 +106,7 @@ type LineCoordinates struct {
 	Y2 float64 `json:"y2" validate:"required,min=-1000000,max=1000000"`
 }
 
-//  common styling properties for shapes
+// common styling properties for shapes
 type StyleProps struct {
 	Fill        string  `json:"fill,omitempty" validate:"omitempty,max=50"`
 	Stroke      string  `json:"stroke,omitempty" validate:"omitempty,max=50"`
@@ -78,12 +114,12 @@ type StyleProps struct {
 	Opacity     float64 `json:"opacity,omitempty" validate:"omitempty,min=0,max=1"`
 }
 
-//  transformation properties for shapes
+// transformation properties for shapes
 type Transform struct {
 	Rotation float64 `json:"rotation,omitempty" validate:"omitempty,min=-360,max=360"`
 }
 
-//  single point in a path or polygon
+// single point in a path or polygon
 type Point struct {
 	X float64 `json:"x" validate:"required,min=-1000000,max=1000000"`
 	Y float64 `json:"y" validate:"required,min=-1000000,max=1000000"`
@@ -107,6 +143,14 @@ type CircleData struct {
 	Fill  string  `json:"fill,omitempty" validate:"omitempty,max=50"`
 }
 
+type EllipseData struct {
+	CenterPosition
+	RX float64 `json:"rx" validate:"required,min=0,max=1000000"`
+	RY float64 `json:"ry" validate:"required,min=0,max=1000000"`
+	StyleProps
+	Transform
+}
+
 // =============================================================================
 // Line-Based Shape Types
 // =============================================================================
@@ -117,6 +161,16 @@ type LineData struct {
 	Width float64 `json:"width,omitempty" validate:"omitempty,min=0,max=1000"`
 }
 
+// arrow from x1,y1 to x2,y2, the end head is drawn unless set to none
+type ArrowData struct {
+	LineCoordinates
+	Color     string  `json:"color,omitempty" validate:"omitempty,max=50"`
+	Width     float64 `json:"width,omitempty" validate:"omitempty,min=0,max=1000"`
+	HeadStart string  `json:"headStart,omitempty" validate:"omitempty,oneof=none triangle open circle"`
+	HeadEnd   string  `json:"headEnd,omitempty" validate:"omitempty,oneof=none triangle open circle"`
+	HeadSize  float64 `json:"headSize,omitempty" validate:"omitempty,min=1,max=1000"`
+}
+
 // =============================================================================
 // Complex Shape Types
 // =============================================================================
@@ -130,6 +184,11 @@ type BrushData struct {
 	Smooth      bool    `json:"smooth,omitempty"`
 }
 
+type PolygonData struct {
+	Points []Point `json:"points" validate:"required,min=3,max=1000,dive"`
+	StyleProps
+}
+
 type StrokeData struct {
 	Points []Point `json:"points" validate:"required,min=2,max=10000,dive"`
 	Color  string  `json:"color,omitempty" validate:"omitempty,max=50"`
@@ -140,15 +199,33 @@ type StrokeData struct {
 // Content Shape Types
 // =============================================================================
 
+// image at x,y scaled to width x height, url is checked by validateImageURL
+type ImageData struct {
+	Position
+	Size
+	URL     string  `json:"url" validate:"required"`
+	Alt     string  `json:"alt,omitempty" validate:"omitempty,max=1000"`
+	Opacity float64 `json:"opacity,omitempty" validate:"omitempty,min=0,max=1"`
+}
+
+// sticky note at x,y, the text wraps to its width (laid out by clients)
+type NoteData struct {
+	Position
+	Width      float64 `json:"width" validate:"required,min=20,max=2000"`
+	Height     float64 `json:"height" validate:"required,min=20,max=2000"`
+	Text       string  `json:"text" validate:"max=2000"`
+	Background string  `json:"background,omitempty" validate:"omitempty,max=50"`
+	Color      string  `json:"color,omitempty" validate:"omitempty,max=50"`
+	FontSize   float64 `json:"fontSize,omitempty" validate:"omitempty,min=1,max=500"`
+}
+
 type TextData struct {
 	Position
 	Text       string  `json:"text" validate:"required,max=1000"`
 	FontSize   float64 `json:"fontSize,omitempty" validate:"omitempty,min=1,max=500"`
-	FontFamily string  `json:"fontFamily,omitempty" validate:"omitempty,max=100"`
+	FontFamily string  `json:"fontFamily,omitempty" validate:"omitempty,max=100,font"`
 	Color      string  `json:"color,omitempty" validate:"omitempty,max=50"`
 	Bold       bool    `json:"bold,omitempty"`
 	Italic     bool    `json:"italic,omitempty"`
 	Background string  `json:"background,omitempty" validate:"omitempty,max=50"`
 }
-
-
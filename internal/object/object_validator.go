@@ -3,6 +3,8 @@ package object
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/microcosm-cc/bluemonday"
@@ -10,25 +12,31 @@ import (
 
 // Validator: validation and sanitization of drawing objects
 type Validator struct {
-	validate  *validator.Validate
-	sanitizer *bluemonday.Policy
+	validate    *validator.Validate
+	sanitizer   *bluemonday.Policy
+	linkPolicy  LinkPolicy
+	fontPolicy  FontPolicy
+	imagePolicy ImagePolicy
 }
 
 func NewValidator() *Validator {
 	// removes all HTML/scripts
 	policy := bluemonday.StrictPolicy()
 
-	return &Validator{
-		validate:  validator.New(validator.WithRequiredStructEnabled()),
-		sanitizer: policy,
+	v := &Validator{
+		validate:   validator.New(validator.WithRequiredStructEnabled()),
+		sanitizer:  policy,
+		fontPolicy: DefaultFontPolicy(),
 	}
+	v.validate.RegisterValidation("font", v.validateFont)
+	return v
 }
 
 // ValidateAndSanitize: validates object data against its schemas, sanitizes string fields
 func (v *Validator) ValidateAndSanitize(objType string, data map[string]interface{}) (map[string]interface{}, error) {
 	// object type is in whitelist
 	if !AllowedObjectTypes[objType] {
-		return nil, fmt.Errorf("invalid object type: %s (allowed types: rectangle, circle, line, path, text, stroke)", objType)
+		return nil, fmt.Errorf("invalid object type: %s (allowed types: %s)", objType, allowedTypeList())
 	}
 
 	//  schema struct for this object type
@@ -37,12 +45,15 @@ func (v *Validator) ValidateAndSanitize(objType string, data map[string]interfac
 		return nil, fmt.Errorf("no schema found for object type: %s", objType)
 	}
 
+	// Text fonts within the font policy (family allowlist, size steps)
+	data = v.applyFontPolicy(objType, data)
+
 	// Convert map[string]interface{} to typed struct
 	if err := mapToStruct(data, schema); err != nil {
 		return nil, fmt.Errorf("failed to parse object data: %w", err)
 	}
 
-	// Validate the struct 
+	// Validate the struct
 	if err := v.validate.Struct(schema); err != nil {
 		if validationErrors, ok := err.(validator.ValidationErrors); ok {
 			return nil, formatValidationErrors(validationErrors)
@@ -50,12 +61,56 @@ func (v *Validator) ValidateAndSanitize(objType string, data map[string]interfac
 		return nil, fmt.Errorf("validation failed: %w", err)
 	}
 
+	// Optional hyperlink, allowed on every object type
+	var link string
+	if rawLink, hasLink := data["link"]; hasLink {
+		validLink, err := v.validateLink(rawLink)
+		if err != nil {
+			return nil, err
+		}
+		link = validLink
+	}
+
+	// Image source, checked here rather than by the schema (data: URIs may be
+	// longer than other URLs)
+	var imageURL string
+	if objType == "image" {
+		validURL, err := v.validateImageURL(data["url"])
+		if err != nil {
+			return nil, err
+		}
+		imageURL = validURL
+	}
+
 	// Sanitize all string fields in original data map
 	sanitizedData := v.sanitizeMap(data)
+	if link != "" {
+		sanitizedData["link"] = link
+	}
+	if imageURL != "" {
+		sanitizedData["url"] = imageURL
+	}
 
 	return sanitizedData, nil
 }
 
+// SanitizeString: strips HTML/scripts from a free-text value (e.g. names)
+func (v *Validator) SanitizeString(value string) string {
+	return v.sanitizer.Sanitize(value)
+}
+
+// allowedTypeList: AllowedObjectTypes for error messages, sorted
+func allowedTypeList() string {
+	types := make([]string, 0, len(AllowedObjectTypes))
+	for objType, allowed := range AllowedObjectTypes {
+		if allowed {
+			types = append(types, objType)
+		}
+	}
+	sort.Strings(types)
+	return strings.Join(types, ", ")
+}
+
 // mapToStruct: converts a map[string]interface{} to a typed struct using JSON marshaling
 func mapToStruct(data map[string]interface{}, target interface{}) error {
 	// Marshal map to JSON
@@ -131,6 +186,10 @@ func formatSingleError(err validator.FieldError) string {
 		return fmt.Sprintf("'%s' value out of allowed range", field)
 	case "url":
 		return fmt.Sprintf("'%s' must be a valid URL", field)
+	case "oneof":
+		return fmt.Sprintf("'%s' must be one of: %s", field, err.Param())
+	case "font":
+		return fmt.Sprintf("'%s' is not an allowed font", field)
 	default:
 		return fmt.Sprintf("'%s' is invalid", field)
 	}
@@ -0,0 +1,69 @@
+package object
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ValidatePatch: validates a partial update of a drawing of objType whose data is
+// current. Each field of patch replaces the whole top-level field (a point of a
+// stroke can't be patched on its own, "points" is sent whole), the merged data
+// must pass ValidateAndSanitize. Returns the sanitized patch fields only, the
+// rest of current was sanitized when it was stored
+func (v *Validator) ValidatePatch(objType string, current, patch map[string]interface{}) (map[string]interface{}, error) {
+	if len(patch) == 0 {
+		return nil, fmt.Errorf("empty patch")
+	}
+	fields := schemaFields(GetSchemaForType(objType))
+	for key := range patch {
+		if !fields[key] && key != "link" {
+			return nil, fmt.Errorf("'%s' is not a field of %s (patches replace whole top-level fields)", key, objType)
+		}
+	}
+
+	merged := make(map[string]interface{}, len(current)+len(patch))
+	for key, value := range current {
+		merged[key] = value
+	}
+	for key, value := range patch {
+		merged[key] = value
+	}
+	sanitized, err := v.ValidateAndSanitize(objType, merged)
+	if err != nil {
+		return nil, err
+	}
+
+	patched := make(map[string]interface{}, len(patch))
+	for key := range patch {
+		if value, kept := sanitized[key]; kept {
+			patched[key] = value
+		}
+	}
+	return patched, nil
+}
+
+// schemaFields: JSON names of a schema's top-level fields (embedded structs'
+// fields included), nil for no schema
+func schemaFields(schema interface{}) map[string]bool {
+	if schema == nil {
+		return nil
+	}
+	fields := make(map[string]bool)
+	var add func(t reflect.Type)
+	add = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				add(field.Type)
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name != "" && name != "-" {
+				fields[name] = true
+			}
+		}
+	}
+	add(reflect.TypeOf(schema).Elem())
+	return fields
+}
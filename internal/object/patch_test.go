@@ -0,0 +1,46 @@
+package object
+
+import (
+	"testing"
+)
+
+func rectangleData() map[string]interface{} {
+	return map[string]interface{}{"x1": 1.0, "y1": 2.0, "x2": 30.0, "y2": 40.0, "fill": "#ffffff"}
+}
+
+func TestValidatePatchReturnsOnlyPatchedFields(t *testing.T) {
+	v := NewValidator()
+	patched, err := v.ValidatePatch("rectangle", rectangleData(), map[string]interface{}{"fill": "#ff0000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patched) != 1 || patched["fill"] != "#ff0000" {
+		t.Errorf("patched = %v, want only the fill", patched)
+	}
+}
+
+func TestValidatePatchRejects(t *testing.T) {
+	v := NewValidator()
+	stroke := map[string]interface{}{
+		"points": []interface{}{map[string]interface{}{"x": 1.0, "y": 1.0}, map[string]interface{}{"x": 5.0, "y": 5.0}},
+		"color":  "#000000",
+	}
+
+	for name, tc := range map[string]struct {
+		objType string
+		current map[string]interface{}
+		patch   map[string]interface{}
+	}{
+		"empty":              {"rectangle", rectangleData(), map[string]interface{}{}},
+		"unknown field":      {"rectangle", rectangleData(), map[string]interface{}{"radius": 3.0}},
+		"nested path":        {"stroke", stroke, map[string]interface{}{"points.0.x": 3.0}},
+		"nested point":       {"stroke", stroke, map[string]interface{}{"points": map[string]interface{}{"0": map[string]interface{}{"x": 3.0, "y": 3.0}}}},
+		"merged invalid":     {"stroke", stroke, map[string]interface{}{"points": []interface{}{map[string]interface{}{"x": 1.0, "y": 1.0}}}},
+		"wrong field type":   {"rectangle", rectangleData(), map[string]interface{}{"x1": "left"}},
+		"out of range value": {"rectangle", rectangleData(), map[string]interface{}{"x2": 2e7}},
+	} {
+		if patched, err := v.ValidatePatch(tc.objType, tc.current, tc.patch); err == nil {
+			t.Errorf("%s: accepted as %v", name, patched)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package object
+
+import "math"
+
+// SelectionTransform: move, resize and rotate applied to a selection of drawings
+// Scale and rotation are around the origin, the offset is applied last
+type SelectionTransform struct {
+	DX, DY           float64
+	Scale            float64 // size factor, 0 is treated as 1
+	Rotation         float64 // degrees, clockwise on screen (y grows downwards)
+	OriginX, OriginY float64
+}
+
+// Translate: copy of object data with every coordinate field shifted by dx, dy,
+// false if that moves a coordinate out of range. data isn't modified
+func Translate(data map[string]interface{}, dx, dy float64) (map[string]interface{}, bool) {
+	return SelectionTransform{DX: dx, DY: dy}.Apply("", data)
+}
+
+// Apply: copy of data (of a drawing of objType) transformed, false if a coordinate
+// ends up out of range. data isn't modified
+// Rectangles and circles have no rotation of their own, rotating one moves its
+// center and keeps it axis-aligned. Ellipses scale their radii and turn with the
+// selection. Images and notes scale their size (a note within its side limits).
+// Text (and a note's text) is resized through its font size
+func (t SelectionTransform) Apply(objType string, data map[string]interface{}) (map[string]interface{}, bool) {
+	scale := t.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	sin, cos := math.Sincos(t.Rotation * math.Pi / 180)
+
+	ok := true
+	move := func(x, y float64) (float64, float64) {
+		x, y = (x-t.OriginX)*scale, (y-t.OriginY)*scale
+		x, y = x*cos-y*sin+t.OriginX+t.DX, x*sin+y*cos+t.OriginY+t.DY
+		if x < MinCoordinate || x > MaxCoordinate || y < MinCoordinate || y > MaxCoordinate {
+			ok = false
+		}
+		return x, y
+	}
+
+	moved := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		moved[key] = value
+	}
+
+	switch objType {
+	case "rectangle", "circle":
+		x1, _ := data["x1"].(float64)
+		y1, _ := data["y1"].(float64)
+		x2, _ := data["x2"].(float64)
+		y2, _ := data["y2"].(float64)
+		cx, cy := move((x1+x2)/2, (y1+y2)/2)
+		halfW, halfH := (x2-x1)/2*scale, (y2-y1)/2*scale
+		moved["x1"], moved["y1"] = cx-halfW, cy-halfH
+		moved["x2"], moved["y2"] = cx+halfW, cy+halfH
+		for _, v := range []float64{cx - halfW, cx + halfW, cy - halfH, cy + halfH} {
+			if v < MinCoordinate || v > MaxCoordinate {
+				ok = false
+			}
+		}
+	case "image", "note":
+		movePairs(data, moved, move)
+		minSide, maxSide := 0.0, float64(MaxCoordinate)
+		if objType == "note" {
+			minSide, maxSide = MinNoteSide, MaxNoteSide
+		}
+		for _, side := range []string{"width", "height"} {
+			if length, isNum := data[side].(float64); isNum {
+				moved[side] = length * scale
+				if length*scale < minSide || length*scale > maxSide {
+					ok = false
+				}
+			}
+		}
+	case "ellipse":
+		movePairs(data, moved, move)
+		for _, radius := range []string{"rx", "ry"} {
+			if r, isNum := data[radius].(float64); isNum {
+				moved[radius] = r * scale
+				if r*scale > MaxCoordinate {
+					ok = false
+				}
+			}
+		}
+		if t.Rotation != 0 {
+			rotation, _ := data["rotation"].(float64)
+			moved["rotation"] = math.Mod(rotation+t.Rotation, 360)
+		}
+	default:
+		movePairs(data, moved, move)
+	}
+
+	if (objType == "text" || objType == "note") && scale != 1 {
+		if fontSize, isNum := data["fontSize"].(float64); isNum {
+			moved["fontSize"] = math.Min(math.Max(fontSize*scale, 1), MaxFontSize)
+		}
+	}
+
+	if !ok {
+		return nil, false
+	}
+	return moved, true
+}
+
+// movePairs: sets every coordinate pair of data (x/y, x1/y1, x2/y2, cx/cy,
+// points) in moved to where move takes it
+func movePairs(data, moved map[string]interface{}, move func(x, y float64) (float64, float64)) {
+	for _, pair := range [][2]string{{"x", "y"}, {"x1", "y1"}, {"x2", "y2"}, {"cx", "cy"}} {
+		x, okX := data[pair[0]].(float64)
+		y, okY := data[pair[1]].(float64)
+		if okX && okY {
+			moved[pair[0]], moved[pair[1]] = move(x, y)
+		}
+	}
+
+	points, ok := data["points"].([]interface{})
+	if !ok {
+		return
+	}
+	shifted := make([]interface{}, len(points))
+	for i, p := range points {
+		point, isPoint := p.(map[string]interface{})
+		x, okX := point["x"].(float64)
+		y, okY := point["y"].(float64)
+		if !isPoint || !okX || !okY {
+			shifted[i] = p
+			continue
+		}
+		copied := make(map[string]interface{}, len(point))
+		for key, value := range point {
+			copied[key] = value
+		}
+		copied["x"], copied["y"] = move(x, y)
+		shifted[i] = copied
+	}
+	moved["points"] = shifted
+}
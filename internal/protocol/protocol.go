@@ -0,0 +1,204 @@
+// Package protocol: machine-readable description of the WebSocket protocol
+// (message types, object schemas, error and close codes) for client codegen.
+// Built from the registries the server runs on, so it can't drift from them
+package protocol
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"main/internal/handlers"
+	"main/internal/i18n"
+	"main/internal/middleware"
+	"main/internal/object"
+	transport "main/internal/websocket"
+)
+
+// Manifest: served at GET /api/protocol and written by -dump-protocol
+type Manifest struct {
+	BoardFormatVersion int                    `json:"boardFormatVersion"`
+	Messages           []handlers.MessageSpec `json:"messages"`
+	Objects            map[string]*Schema     `json:"objects"` // object type → schema of its data
+	ErrorCodes         []ErrorCode            `json:"errorCodes"`
+	CloseCodes         []transport.CloseCode  `json:"closeCodes"`
+	Limits             Limits                 `json:"limits"`
+	Fonts              object.FontPolicy      `json:"fonts"` // for font pickers, no families means any
+}
+
+// ErrorCode: an error code with its English text (other locales: see i18n)
+type ErrorCode struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Limits: server limits a client should stay within
+type Limits struct {
+	MaxMessageSize int   `json:"maxMessageSize"` // bytes
+	MaxObjects     int   `json:"maxObjects"`     // per room
+	MaxRoomSize    int   `json:"maxRoomSize"`    // connections per room
+	MaxSpectators  int   `json:"maxSpectators"`  // view-only connections per room
+	LockTimeout    int64 `json:"lockTimeoutMs"`  // lockObject locks expire after this
+}
+
+// Schema: the subset of JSON Schema the validate tags map to
+type Schema struct {
+	Type       string             `json:"type"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	Minimum    *float64           `json:"minimum,omitempty"`
+	Maximum    *float64           `json:"maximum,omitempty"`
+	MinLength  *float64           `json:"minLength,omitempty"`
+	MaxLength  *float64           `json:"maxLength,omitempty"`
+	MinItems   *float64           `json:"minItems,omitempty"`
+	MaxItems   *float64           `json:"maxItems,omitempty"`
+	Pattern    string             `json:"pattern,omitempty"`
+	Enum       []string           `json:"enum,omitempty"`
+}
+
+// Build: the manifest for this server, its limits and font policy
+func Build(config *middleware.RateLimit, fonts object.FontPolicy) *Manifest {
+	manifest := &Manifest{
+		BoardFormatVersion: object.BoardFormatVersion,
+		Messages:           handlers.Messages(),
+		Objects:            make(map[string]*Schema),
+		CloseCodes:         transport.CloseCodes,
+		Limits: Limits{
+			MaxMessageSize: config.MaxMessageSize,
+			MaxObjects:     config.MaxObjects,
+			MaxRoomSize:    config.MaxRoomSize,
+			MaxSpectators:  config.MaxSpectators,
+			LockTimeout:    config.LockTimeout.Milliseconds(),
+		},
+		Fonts: fonts,
+	}
+
+	// Types without a schema are rejected by the validator, so they aren't listed
+	for objType, allowed := range object.AllowedObjectTypes {
+		schema := object.GetSchemaForType(objType)
+		if !allowed || schema == nil {
+			continue
+		}
+		data := schemaFor(reflect.TypeOf(schema).Elem())
+		maxLink := float64(object.MaxURLLength)
+		data.Properties["link"] = &Schema{Type: "string", MaxLength: &maxLink, Pattern: "^https://"}
+		manifest.Objects[objType] = data
+	}
+
+	for _, code := range handlers.ErrorCodes {
+		manifest.ErrorCodes = append(manifest.ErrorCodes, ErrorCode{Code: code, Message: i18n.Text(i18n.Fallback, code, nil)})
+	}
+	return manifest
+}
+
+// JSON: the manifest, indented
+func (m *Manifest) JSON() ([]byte, error) {
+	return json.MarshalIndent(m, "", "  ")
+}
+
+// Handler: GET /api/protocol
+func Handler(manifest *Manifest) http.Handler {
+	body, err := manifest.JSON()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			http.Error(w, "Protocol unavailable", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
+
+// schemaFor: schema of a Go type, constraints taken from its validate tags
+// Embedded structs are flattened, like encoding/json does
+func schemaFor(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.Struct:
+		schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+		addFields(schema, t)
+		sort.Strings(schema.Required)
+		return schema
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: schemaFor(t.Elem())}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer"}
+	default:
+		return &Schema{Type: "number"}
+	}
+}
+
+// addFields: adds t's fields (and those of its embedded structs) to schema
+func addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			addFields(schema, field.Type)
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := schemaFor(field.Type)
+		if constrain(property, field.Tag.Get("validate")) {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = property
+	}
+}
+
+// constrain: applies validate rules (min, max, oneof) to schema, true if required
+// Rules after "dive" apply to slice elements, which carry their own tags
+func constrain(schema *Schema, rules string) bool {
+	required := false
+	for _, rule := range strings.Split(rules, ",") {
+		name, value, _ := strings.Cut(rule, "=")
+		switch name {
+		case "dive":
+			return required
+		case "required":
+			required = true
+		case "min", "max":
+			limit, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			*bound(schema, name == "min") = &limit
+		case "oneof":
+			schema.Enum = strings.Fields(value)
+		}
+	}
+	return required
+}
+
+// bound: the schema field min/max maps to for its type
+func bound(schema *Schema, min bool) **float64 {
+	switch schema.Type {
+	case "string":
+		if min {
+			return &schema.MinLength
+		}
+		return &schema.MaxLength
+	case "array":
+		if min {
+			return &schema.MinItems
+		}
+		return &schema.MaxItems
+	}
+	if min {
+		return &schema.Minimum
+	}
+	return &schema.Maximum
+}
@@ -0,0 +1,219 @@
+package protocol
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"main/internal/middleware"
+	"main/internal/object"
+)
+
+func testManifest() *Manifest {
+	return Build(middleware.NewRateLimit(10, 1000, 250000, 100, 5, 1000, 30, 60), object.DefaultFontPolicy())
+}
+
+// parseDir: the non-test Go files of a package directory (relative to this one)
+func parseDir(t *testing.T, dir string) []*ast.File {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join("..", dir, "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []*ast.File
+	fset := token.NewFileSet()
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// constants: name → literal value of the constants in dir named prefix...,
+// "pkg.Name" for ones defined as another package's constant
+func constants(t *testing.T, dir string, prefix string) map[string]string {
+	t.Helper()
+	found := make(map[string]string)
+	for _, file := range parseDir(t, dir) {
+		ast.Inspect(file, func(n ast.Node) bool {
+			decl, ok := n.(*ast.GenDecl)
+			if !ok || decl.Tok != token.CONST {
+				return true
+			}
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.ValueSpec)
+				for i, name := range spec.Names {
+					if !strings.HasPrefix(name.Name, prefix) || i >= len(spec.Values) {
+						continue
+					}
+					switch value := spec.Values[i].(type) {
+					case *ast.BasicLit:
+						found[name.Name] = value.Value
+					case *ast.SelectorExpr:
+						if pkg, ok := value.X.(*ast.Ident); ok {
+							found[name.Name] = pkg.Name + "." + value.Sel.Name
+						}
+					}
+				}
+			}
+			return false
+		})
+	}
+	return found
+}
+
+func TestManifestHasEveryErrorCode(t *testing.T) {
+	listed := make(map[string]string)
+	for _, code := range testManifest().ErrorCodes {
+		listed[code.Code] = code.Message
+	}
+
+	codes := constants(t, "handlers", "Code")
+	if len(codes) == 0 {
+		t.Fatal("no error code constants found")
+	}
+	for name, literal := range codes {
+		if pkg, other, ok := strings.Cut(literal, "."); ok {
+			literal = constants(t, pkg, other)[other]
+		}
+		code, err := strconv.Unquote(literal)
+		if err != nil {
+			t.Errorf("%s: can't resolve %s", name, codes[name])
+			continue
+		}
+		message, ok := listed[code]
+		if !ok {
+			t.Errorf("%s (%s) missing from the manifest", name, code)
+		} else if message == code {
+			t.Errorf("%s has no English text", code)
+		}
+	}
+	if len(listed) != len(codes) {
+		t.Errorf("manifest lists %d error codes, handlers defines %d", len(listed), len(codes))
+	}
+}
+
+// dispatchedTypes: the message types the router's dispatch switch handles
+func dispatchedTypes(t *testing.T) map[string]bool {
+	t.Helper()
+	types := make(map[string]bool)
+	for _, file := range parseDir(t, "handlers") {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Name.Name != "dispatch" || fn.Recv == nil {
+				continue
+			}
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				if clause, ok := n.(*ast.CaseClause); ok {
+					for _, expr := range clause.List {
+						if lit, ok := expr.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+							messageType, _ := strconv.Unquote(lit.Value)
+							types[messageType] = true
+						}
+					}
+				}
+				return true
+			})
+		}
+	}
+	if len(types) == 0 {
+		t.Fatal("no dispatched message types found")
+	}
+	return types
+}
+
+func TestManifestHasEveryMessageType(t *testing.T) {
+	dispatched := dispatchedTypes(t)
+	listed := make(map[string]bool)
+	for _, spec := range testManifest().Messages {
+		listed[spec.Type] = true
+		if !dispatched[spec.Type] {
+			t.Errorf("%s is in the manifest but not handled", spec.Type)
+		}
+		if spec.RateLimit == "" {
+			t.Errorf("%s has no rate limit class", spec.Type)
+		}
+	}
+	for messageType := range dispatched {
+		if !listed[messageType] {
+			t.Errorf("%s is handled but missing from the manifest", messageType)
+		}
+	}
+}
+
+func TestManifestHasEveryCloseCode(t *testing.T) {
+	listed := make(map[int]bool)
+	for _, code := range testManifest().CloseCodes {
+		if code.Meaning == "" {
+			t.Errorf("close code %d has no meaning", code.Code)
+		}
+		listed[code.Code] = true
+	}
+	for _, dir := range []string{"room", "user", "websocket"} {
+		for name, literal := range constants(t, dir, "Close") {
+			code, err := strconv.Atoi(literal)
+			if err != nil || code < 4000 {
+				continue
+			}
+			if !listed[code] {
+				t.Errorf("%s.%s (%d) missing from the manifest", dir, name, code)
+			}
+		}
+	}
+}
+
+func TestManifestObjectSchemas(t *testing.T) {
+	manifest := testManifest()
+	for objType, allowed := range object.AllowedObjectTypes {
+		if allowed && object.GetSchemaForType(objType) != nil && manifest.Objects[objType] == nil {
+			t.Errorf("no schema for %s", objType)
+		}
+	}
+
+	text := manifest.Objects["text"]
+	if text == nil {
+		t.Fatal("no text schema")
+	}
+	content := text.Properties["text"]
+	if content == nil || content.Type != "string" || content.MaxLength == nil || *content.MaxLength != 1000 {
+		t.Errorf("text.text = %+v, want a string of at most 1000", content)
+	}
+	if size := text.Properties["fontSize"]; size == nil || size.Minimum == nil || *size.Minimum != 1 || *size.Maximum != 500 {
+		t.Errorf("text.fontSize = %+v, want 1 to 500", size)
+	}
+	// Embedded Position fields are flattened
+	if text.Properties["x"] == nil || text.Properties["y"] == nil {
+		t.Errorf("text schema is missing x/y: %v", text.Properties)
+	}
+	required := strings.Join(text.Required, ",")
+	if !strings.Contains(required, "text") || strings.Contains(required, "fontSize") {
+		t.Errorf("text required = %v", text.Required)
+	}
+}
+
+func TestHandlerServesManifest(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler(testManifest()).ServeHTTP(rec, httptest.NewRequest("GET", "/api/protocol", nil))
+	if rec.Code != 200 || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("GET /api/protocol: %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var served Manifest
+	if err := json.Unmarshal(rec.Body.Bytes(), &served); err != nil {
+		t.Fatal(err)
+	}
+	if served.Limits.MaxObjects != 1000 || len(served.Messages) != len(testManifest().Messages) {
+		t.Errorf("served manifest = %+v", served.Limits)
+	}
+}
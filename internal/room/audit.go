@@ -0,0 +1,62 @@
+package room
+
+import "time"
+
+// maxAuditEvents: object events kept per room for moderation, oldest dropped first
+const maxAuditEvents = 10000
+
+// Audit actions
+const (
+	AuditAdd      = "add"
+	AuditUpdate   = "update"
+	AuditDelete   = "delete"
+	AuditTransfer = "transfer" // transferOwnership, userID is who moved it
+)
+
+// AuditEvent: who changed which drawing and when (no object data, so the log
+// stays small however large the drawings are)
+type AuditEvent struct {
+	Time       time.Time `json:"time"`
+	Action     string    `json:"action"`
+	UserID     string    `json:"userId"`
+	ObjectID   string    `json:"objectId"`
+	ObjectType string    `json:"objectType"`
+}
+
+// auditLog: ring of the latest maxAuditEvents events
+type auditLog struct {
+	events []AuditEvent
+	next   int // slot the next event overwrites once full
+}
+
+// Audit: appends an object event to the room's audit log
+func (r *Room) Audit(action, userID, objectID, objectType string) {
+	event := AuditEvent{Time: time.Now(), Action: action, UserID: userID, ObjectID: objectID, ObjectType: objectType}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.audit.events) < maxAuditEvents {
+		r.audit.events = append(r.audit.events, event)
+		return
+	}
+	r.audit.events[r.audit.next] = event
+	r.audit.next = (r.audit.next + 1) % maxAuditEvents
+}
+
+// AuditLog: logged events from since to until (zero: unbounded), oldest first
+func (r *Room) AuditLog(since, until time.Time) []AuditEvent {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	count := len(r.audit.events)
+	events := make([]AuditEvent, 0, count)
+	for i := 0; i < count; i++ {
+		event := r.audit.events[(r.audit.next+i)%count]
+		if (!since.IsZero() && event.Time.Before(since)) || (!until.IsZero() && event.Time.After(until)) {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events
+}
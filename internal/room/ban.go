@@ -0,0 +1,98 @@
+package room
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+)
+
+// Sent to a user removed by kickUser: message type, then close code
+const (
+	CodeKicked  = "kicked"
+	CloseKicked = 4008
+)
+
+var (
+	// ErrBanned: the user was kicked with a ban and can't rejoin while the room exists
+	ErrBanned = errors.New("banned from this room")
+	// ErrKickSelf: a moderator tried to kick themselves
+	ErrKickSelf = errors.New("can't kick yourself")
+	// ErrKickHost: the host can't be kicked
+	ErrKickHost = errors.New("can't kick the host")
+	// ErrNotInRoom: the user to kick isn't connected (e.g. already left)
+	ErrNotInRoom = errors.New("user not in the room")
+)
+
+// Kick: removes userID from the room on behalf of by, banning them until the
+// room is removed if ban is set. Returns the removed connection for the caller
+// to notify and close (see Dismiss). Its cleanup then finds it no longer in the
+// room, so the caller announces userLeft
+func (r *Room) Kick(by string, userID string, ban bool) (*user.User, error) {
+	r.mu.Lock()
+	if err := r.kickable(by, userID); err != nil {
+		r.mu.Unlock()
+		return nil, err
+	}
+	kicked := r.Connections[userID]
+
+	delete(r.Connections, userID)
+	r.releaseLocks(userID)
+	r.forgetCursor(userID)
+	delete(r.names, userID)
+	if ban {
+		r.banned[userID] = true
+	}
+	r.LastActive = time.Now()
+	moved := r.admitWaiters()
+	r.mu.Unlock()
+
+	if moved {
+		r.notifyQueue()
+	}
+	return kicked, nil
+}
+
+// CheckKick: the error Kick would return right now, nil if by can kick userID
+func (r *Room) CheckKick(by string, userID string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.kickable(by, userID)
+}
+
+// kickable: caller must hold lock
+func (r *Room) kickable(by string, userID string) error {
+	switch {
+	case userID == by:
+		return ErrKickSelf
+	case userID == r.HostID:
+		return ErrKickHost
+	case r.Connections[userID] == nil:
+		return ErrNotInRoom
+	}
+	return nil
+}
+
+// IsBanned: the user was kicked from the room with a ban
+func (r *Room) IsBanned(userID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.banned[userID]
+}
+
+// Dismiss: sends a kicked user {"type":"kicked","banned"} and closes their
+// connection with CloseKicked
+func Dismiss(u *user.User, banned bool) {
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":    CodeKicked,
+		"banned":  banned,
+		"message": u.Text(CodeKicked, nil),
+	})
+	u.WriteMessage(websocket.TextMessage, msg)
+	closeConnection(u, CloseKicked, "kicked")
+}
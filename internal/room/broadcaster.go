@@ -1,19 +1,26 @@
 package room
 
 import (
-	"log"
-	"sync"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
 
+	"main/internal/metrics"
+	"main/internal/msgpack"
+	"main/internal/tracing"
 	"main/internal/user"
 
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // RoomState: minimum interface for broadcasting
 type RoomConnections interface {
 	GetConnections() map[string]*user.User
-	RemoveConnection(userID string)
+	RemoveConnection(u *user.User) bool
 	GetUserColor(userID string) string
+	UserName(userID string) string
 }
 
 // Broadcaster: handles broadcasting messages to room users
@@ -24,45 +31,103 @@ func NewBroadcaster() *Broadcaster {
 	return &Broadcaster{}
 }
 
-// Broadcast: sends a message to all users in a room (except the sender)
-func (b *Broadcaster) Broadcast(rm RoomConnections, msg []byte, sender *websocket.Conn) {
+// Broadcast: sends a message to all users in a room (except the sender) whose
+// subscription wants what tag says the message is about
+func (b *Broadcaster) Broadcast(ctx context.Context, rm RoomConnections, msg []byte, sender *websocket.Conn, tag Tag) {
+	b.deliver(ctx, rm, sender, tag, func(*user.User) []byte { return msg })
+}
+
+// BroadcastSystem: sends payload to everyone in the room with "message" set to
+// the code's text in each recipient's locale (see user.Text), encoded once per locale
+func (b *Broadcaster) BroadcastSystem(ctx context.Context, rm RoomConnections, payload map[string]interface{}, code string, params map[string]interface{}) {
+	encoded := make(map[string][]byte)
+
+	b.deliver(ctx, rm, nil, TagSystem, func(u *user.User) []byte {
+		locale := u.Locale()
+		if msg, done := encoded[locale]; done {
+			return msg
+		}
+		localized := make(map[string]interface{}, len(payload)+1)
+		for k, v := range payload {
+			localized[k] = v
+		}
+		localized["message"] = u.Text(code, params)
+		msg, err := json.Marshal(localized)
+		if err != nil {
+			slog.Error("Marshal broadcast", "code", code, "err", err)
+		}
+		encoded[locale] = msg
+		return msg
+	})
+}
+
+// packCache: MessagePack encodings of the JSON messages of one broadcast, so
+// each is transcoded once however many recipients use MessagePack
+type packCache struct {
+	encoded map[*byte][]byte // first byte of the JSON message → its encoding
+}
+
+// get: msg as MessagePack, nil if it can't be encoded
+func (c *packCache) get(msg []byte) []byte {
+	if packed, done := c.encoded[&msg[0]]; done {
+		return packed
+	}
+	packed, err := msgpack.FromJSON(msg)
+	if err != nil {
+		slog.Error("Encode broadcast as msgpack", "err", err)
+	}
+	c.encoded[&msg[0]] = packed
+	return packed
+}
+
+// deliver: writes render(u) to all users in a room (except the sender and those
+// filtering tag out), dropping connections the write fails for. A nil message is skipped
+// Writes only queue (see user.Deliver), so recipients are served in turn
+func (b *Broadcaster) deliver(ctx context.Context, rm RoomConnections, sender *websocket.Conn, tag Tag, render func(*user.User) []byte) {
+	_, span := tracing.Tracer().Start(ctx, "broadcast")
+	defer span.End()
+	start := time.Now()
+
 	// snapshot of connections
 	connections := rm.GetConnections()
 
 	// list of users to broadcast to
 	users := make([]*user.User, 0, len(connections))
 	for _, u := range connections {
-		if u.Connection != sender {
+		if u.Connection != sender && tag.wantedBy(u.Subscription()) {
 			users = append(users, u)
 		}
 	}
 
-	// Concurrent write to all users
-	var wg sync.WaitGroup
-	var mu sync.Mutex
 	var failedUsers []*user.User
+	packed := &packCache{encoded: make(map[*byte][]byte)}
 
 	for _, u := range users {
-		wg.Add(1)
-		go func(usr *user.User) {
-			defer wg.Done()
-
-			if err := usr.WriteMessage(websocket.TextMessage, msg); err != nil {
-				log.Printf("Broadcast failed for user %s: %v", usr.ID, err)
-				mu.Lock()
-				failedUsers = append(failedUsers, usr)
-				mu.Unlock()
-			}
-		}(u)
+		msg := render(u)
+		if len(msg) > 0 && u.Msgpack() {
+			msg = packed.get(msg)
+		}
+		if msg == nil {
+			continue
+		}
+		if err := u.Deliver(msg); err != nil {
+			u.Logger().Warn("Broadcast failed", "err", err) // the recipient's logger, with its user_id
+			failedUsers = append(failedUsers, u)
+		}
 	}
 
-	wg.Wait()
+	metrics.BroadcastDuration.Observe(time.Since(start).Seconds())
+	span.SetAttributes(attribute.Int("recipients", len(users)), attribute.Int("failed", len(failedUsers)))
 
 	// Clean up failed connections
 	for _, u := range failedUsers {
-		// remove from room 
-		rm.RemoveConnection(u.ID)
+		// remove from room
+		removed := rm.RemoveConnection(u)
 		// Close WebSocket connection
 		u.Connection.Close()
+		// Tell the rest (their read loop's cleanup finds them already gone)
+		if removed {
+			b.UserLeft(ctx, rm, u.ID)
+		}
 	}
 }
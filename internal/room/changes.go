@@ -0,0 +1,98 @@
+package room
+
+import (
+	"time"
+)
+
+// Change log limits: a reconnecting client is sent only what changed since its
+// last known revision (syncDelta) while that's still in the log, else a full sync
+const (
+	maxChanges       = 500  // revisions kept, oldest dropped first
+	maxChangeObjects = 1000 // objects one revision may touch and still be replayed
+
+	// reorderWindow: broadcasts of concurrent changes can reach a client out of
+	// revision order, so a delta also covers changes made this long before the
+	// client's revision (resending a drawing is harmless, missing one isn't)
+	reorderWindow = 5 * time.Second
+)
+
+// change: what one revision touched
+type change struct {
+	revision  uint64
+	at        time.Time
+	objectIDs []string // added, updated or deleted
+	reset     bool     // not replayable (e.g. board cleared), needs a full sync
+}
+
+// ResumePoint: where a reconnecting client left off (sent in authenticate)
+type ResumePoint struct {
+	Epoch    string // room instance the revision belongs to (revisions restart with the room)
+	Revision uint64
+}
+
+// recordChange: logs the objects a revision touched
+// caller must hold write lock
+func (r *Room) recordChange(objectIDs []string, reset bool) {
+	if len(objectIDs) > maxChangeObjects {
+		objectIDs, reset = nil, true
+	}
+	if len(r.changes) >= maxChanges {
+		r.changes = r.changes[1:]
+	}
+	r.changes = append(r.changes, change{
+		revision:  r.revision,
+		at:        time.Now(),
+		objectIDs: objectIDs,
+		reset:     reset,
+	})
+}
+
+// changedSince: IDs of objects touched after the resume point (and within
+// reorderWindow before it), false if that can't be told for certain
+// caller must hold lock
+func (r *Room) changedSince(from ResumePoint) ([]string, bool) {
+	if from.Epoch != r.epoch || from.Revision > r.revision {
+		return nil, false
+	}
+	if from.Revision == 0 && r.revision == 0 {
+		return nil, true // nothing ever changed
+	}
+	if len(r.changes) == 0 {
+		return nil, false
+	}
+
+	// Revisions in the log are consecutive, the client's must still be in it
+	first := r.changes[0].revision
+	if from.Revision < first {
+		return nil, false
+	}
+	start := int(from.Revision - first)
+	cutoff := r.changes[start].at.Add(-reorderWindow)
+	for start > 0 && !r.changes[start-1].at.Before(cutoff) {
+		start--
+	}
+	if start == 0 && r.changes[0].revision > 1 && !r.changes[0].at.Before(cutoff) {
+		return nil, false // the window reaches past the oldest change kept
+	}
+
+	seen := make(map[string]bool)
+	var ids []string
+	for _, c := range r.changes[start:] {
+		if c.reset {
+			return nil, false
+		}
+		for _, id := range c.objectIDs {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, true
+}
+
+// Epoch: identifies this room instance, sent with every sync so clients can
+// tell a recreated room (whose revisions restarted) apart
+func (r *Room) Epoch() string {
+	return r.epoch // set at creation, never changes
+}
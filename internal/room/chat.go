@@ -0,0 +1,34 @@
+package room
+
+// maxChatHistory: chat messages kept per room, sent to joining users
+const maxChatHistory = 100
+
+// ChatMessage: a chat line as broadcast and kept in the room's history
+type ChatMessage struct {
+	UserID     string `json:"userId"`
+	Color      string `json:"color"`
+	Text       string `json:"text"`       // sanitized
+	ServerTime int64  `json:"serverTime"` // unix ms, when the server received it
+}
+
+// AddChat: stamps msg with the sender's room color and keeps it in the
+// history (oldest dropped past maxChatHistory). Returns the stamped message
+func (r *Room) AddChat(msg ChatMessage) ChatMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	msg.Color = r.UserColors[msg.UserID]
+	if len(r.chat) >= maxChatHistory {
+		r.chat = append(r.chat[:0], r.chat[len(r.chat)-maxChatHistory+1:]...)
+	}
+	r.chat = append(r.chat, msg)
+	return msg
+}
+
+// chatHistory: copy of the recent chat, oldest first
+// caller must hold lock
+func (r *Room) chatHistory() []ChatMessage {
+	history := make([]ChatMessage, len(r.chat))
+	copy(history, r.chat)
+	return history
+}
@@ -0,0 +1,83 @@
+package room
+
+import (
+	"errors"
+	"time"
+
+	"main/internal/object"
+)
+
+// Checkpoint limits: a room keeps a few boards from before destructive host
+// actions, oldest dropped first when either limit is exceeded
+const (
+	maxCheckpoints       = 5
+	maxCheckpointObjects = 10000 // drawings across all of a room's checkpoints
+)
+
+// ErrNoCheckpoint: no destructive action recent enough to undo
+var ErrNoCheckpoint = errors.New("no recent host action to undo")
+
+// checkpoint: board as it was before a destructive action
+type checkpoint struct {
+	action  string
+	userID  string
+	takenAt time.Time
+	board   *Board
+}
+
+// Checkpoint: saves the board before a destructive action by userID
+func (r *Room) Checkpoint(action string, userID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checkpoints = append(r.checkpoints, &checkpoint{
+		action:  action,
+		userID:  userID,
+		takenAt: time.Now(),
+		board:   r.board(),
+	})
+
+	total := 0
+	for _, cp := range r.checkpoints {
+		total += len(cp.board.Objects)
+	}
+	for len(r.checkpoints) > maxCheckpoints || (len(r.checkpoints) > 1 && total > maxCheckpointObjects) {
+		total -= len(r.checkpoints[0].board.Objects)
+		r.checkpoints = r.checkpoints[1:]
+	}
+}
+
+// RestoreCheckpoint: reverts the board to the latest checkpoint taken within
+// window and returns the action it undid. Anything drawn since is lost
+func (r *Room) RestoreCheckpoint(window time.Duration) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.checkpoints) == 0 {
+		return "", ErrNoCheckpoint
+	}
+	cp := r.checkpoints[len(r.checkpoints)-1]
+	if time.Since(cp.takenAt) > window {
+		return "", ErrNoCheckpoint
+	}
+	r.checkpoints = r.checkpoints[:len(r.checkpoints)-1]
+
+	r.Pages = make([]Page, len(cp.board.Pages))
+	copy(r.Pages, cp.board.Pages)
+	r.Objects = make(map[string]*object.Drawing, len(cp.board.Objects))
+	for _, obj := range cp.board.Objects {
+		restored := *obj
+		r.Objects[obj.ID] = &restored
+		delete(r.tombstones, obj.ID)
+	}
+	r.unfinished = make(map[string]map[string]bool) // in-progress drawings aren't checkpointed
+
+	for userID, current := range r.userPages {
+		if r.pageIndex(current) == -1 {
+			r.userPages[userID] = r.Pages[0].ID
+		}
+	}
+	r.LastActive = time.Now()
+	r.changedAll()
+	return cp.action, nil
+}
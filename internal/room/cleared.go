@@ -0,0 +1,102 @@
+package room
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"main/internal/object"
+)
+
+// Restore errors, nothing was restored when one is returned
+var (
+	ErrNoClear       = errors.New("no recent clear to restore")
+	ErrClearNotYours = errors.New("only the host or whoever cleared can restore it")
+	ErrRestoreLimit  = errors.New("restoring would exceed the room's limits")
+)
+
+// clearedBoard: drawings removed by the most recent clear or purge
+type clearedBoard struct {
+	action  string
+	userID  string
+	at      time.Time
+	objects []*object.Drawing
+	bytes   int // encoded size, counted against the room's byte budget while held
+}
+
+// RestoreLimits: what the room may hold after RestoreLastClear
+type RestoreLimits struct {
+	Window     time.Duration // how long after the clear it can be restored
+	MaxObjects int
+	MaxBytes   int
+}
+
+// keepCleared: holds drawings removed by userID's clear or purge for
+// RestoreLastClear, replacing any earlier one (only one is restorable at a time)
+// In-progress drawings aren't kept, like checkpoints
+// caller must hold write lock
+func (r *Room) keepCleared(action string, userID string, removed []*object.Drawing) {
+	kept := &clearedBoard{action: action, userID: userID, at: r.clock.Now()}
+	for _, obj := range removed {
+		if obj.Provisional {
+			continue
+		}
+		if encoded, err := json.Marshal(obj); err == nil {
+			kept.bytes += len(encoded)
+		}
+		kept.objects = append(kept.objects, obj)
+	}
+	r.lastClear = kept
+}
+
+// RestoreLastClear: brings back the drawings of the most recent clear or purge,
+// if it was done within limits.Window (on the room's clock) and userID did it
+// (or isHost). Drawings added since are kept, restored ones whose page was
+// deleted meanwhile land on the first page. The clear can be restored once,
+// returns its action
+func (r *Room) RestoreLastClear(userID string, isHost bool, limits RestoreLimits) (string, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clock.Now()
+	cleared := r.lastClear
+	if cleared == nil || now.Sub(cleared.at) > limits.Window {
+		return "", 0, ErrNoClear
+	}
+	if cleared.userID != userID && !isHost {
+		return "", 0, ErrClearNotYours
+	}
+
+	restore := make([]*object.Drawing, 0, len(cleared.objects))
+	for _, obj := range cleared.objects {
+		if _, exists := r.Objects[obj.ID]; !exists {
+			restore = append(restore, obj)
+		}
+	}
+	if len(r.Objects)+len(restore) > limits.MaxObjects {
+		return "", 0, ErrRestoreLimit
+	}
+	size := cleared.bytes
+	for _, existing := range r.Objects {
+		encoded, err := json.Marshal(existing)
+		if err != nil {
+			return "", 0, err
+		}
+		size += len(encoded)
+	}
+	if size > limits.MaxBytes {
+		return "", 0, ErrRestoreLimit
+	}
+
+	r.lastClear = nil
+	for _, obj := range restore {
+		if r.pageIndex(obj.PageID) == -1 {
+			obj.PageID = r.Pages[0].ID
+		}
+		r.Objects[obj.ID] = obj
+		delete(r.tombstones, obj.ID)
+	}
+	r.LastActive = now
+	r.changedAll()
+	return cleared.action, len(restore), nil
+}
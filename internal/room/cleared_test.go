@@ -0,0 +1,133 @@
+package room
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var testRestoreLimits = RestoreLimits{Window: 2 * time.Minute, MaxObjects: 1000, MaxBytes: 1 << 20}
+
+// skip: moves the clock by d, for code that reads it without waiting on it
+func (c *fakeClock) skip(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// clearedRoom: a room on clock holding n of alice's drawings, cleared by alice
+func clearedRoom(t *testing.T, clock Clock, n int) *Room {
+	t.Helper()
+	r := timerRoom(t, clock)
+	for i := 0; i < n; i++ {
+		if err := r.AddObject(drawing(fmt.Sprintf("s%d", i), "alice")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cleared := r.ClearBoard("clearBoard", "alice"); cleared != n {
+		t.Fatalf("cleared %d drawings, want %d", cleared, n)
+	}
+	return r
+}
+
+func TestRestoreLastClearOnce(t *testing.T) {
+	clock := newFakeClock()
+	r := clearedRoom(t, clock, 3)
+	if err := r.AddObject(drawing("after", "bob")); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.skip(time.Minute)
+	action, restored, err := r.RestoreLastClear("alice", false, testRestoreLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action != "clearBoard" || restored != 3 {
+		t.Errorf("restored %d from %q, want 3 from clearBoard", restored, action)
+	}
+	if r.ObjectCount() != 4 || r.IsDeleted("s0") {
+		t.Errorf("%d drawings after restore, want 4 (the drawing added since is kept)", r.ObjectCount())
+	}
+
+	if _, _, err := r.RestoreLastClear("alice", false, testRestoreLimits); !errors.Is(err, ErrNoClear) {
+		t.Errorf("second restore: %v, want ErrNoClear", err)
+	}
+}
+
+func TestRestoreWindowOnRoomClock(t *testing.T) {
+	clock := newFakeClock()
+	r := clearedRoom(t, clock, 2)
+
+	clock.skip(testRestoreLimits.Window + time.Second)
+	if _, _, err := r.RestoreLastClear("alice", true, testRestoreLimits); !errors.Is(err, ErrNoClear) {
+		t.Errorf("restore after the window: %v, want ErrNoClear", err)
+	}
+	if r.ObjectCount() != 0 {
+		t.Error("expired clear restored")
+	}
+}
+
+func TestRestoreLastClearWho(t *testing.T) {
+	r := clearedRoom(t, newFakeClock(), 2)
+
+	if _, _, err := r.RestoreLastClear("bob", false, testRestoreLimits); !errors.Is(err, ErrClearNotYours) {
+		t.Fatalf("restore by a bystander: %v, want ErrClearNotYours", err)
+	}
+	// refused attempts don't consume it
+	if _, restored, err := r.RestoreLastClear("bob", true, testRestoreLimits); err != nil || restored != 2 {
+		t.Errorf("restore by the host = %d, %v, want 2", restored, err)
+	}
+}
+
+func TestSecondClearReplacesRestorable(t *testing.T) {
+	r := clearedRoom(t, newFakeClock(), 3)
+	if err := r.AddObject(drawing("b1", "bob")); err != nil {
+		t.Fatal(err)
+	}
+	if deleted := r.DeleteOwnedObjects("bob", []string{"b1"}, time.Time{}); len(deleted) != 1 {
+		t.Fatalf("deleted %v", deleted)
+	}
+	if r.lastClear.action != "clearBoard" {
+		t.Error("single delete replaced the restorable clear")
+	}
+
+	if cleared := r.ClearBoard("clearBoard", "bob"); cleared != 0 {
+		t.Fatalf("cleared %d from an empty board", cleared)
+	}
+	if err := r.AddObject(drawing("b2", "bob")); err != nil {
+		t.Fatal(err)
+	}
+	r.ClearBoard("clearBoard", "bob")
+
+	_, restored, err := r.RestoreLastClear("bob", false, testRestoreLimits)
+	if err != nil || restored != 1 || r.GetObject("b2") == nil || r.GetObject("s0") != nil {
+		t.Errorf("restored %d (%v), want only bob's later clear", restored, err)
+	}
+}
+
+func TestRestoreWithinRoomLimits(t *testing.T) {
+	r := clearedRoom(t, newFakeClock(), 3)
+	for i := 0; i < 2; i++ {
+		if err := r.AddObject(drawing(fmt.Sprintf("new%d", i), "bob")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	limits := testRestoreLimits
+	limits.MaxObjects = 4
+	if _, _, err := r.RestoreLastClear("alice", false, limits); !errors.Is(err, ErrRestoreLimit) {
+		t.Fatalf("restore over MaxObjects: %v, want ErrRestoreLimit", err)
+	}
+	limits = testRestoreLimits
+	limits.MaxBytes = r.lastClear.bytes
+	if _, _, err := r.RestoreLastClear("alice", false, limits); !errors.Is(err, ErrRestoreLimit) {
+		t.Fatalf("restore over MaxBytes: %v, want ErrRestoreLimit", err)
+	}
+	if r.ObjectCount() != 2 {
+		t.Fatal("refused restore changed the board")
+	}
+	if _, restored, err := r.RestoreLastClear("alice", false, testRestoreLimits); err != nil || restored != 3 {
+		t.Errorf("restore within limits = %d, %v", restored, err)
+	}
+}
@@ -0,0 +1,192 @@
+package room
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"main/internal/logging"
+	"main/internal/middleware"
+)
+
+// maxRoomCodeLength: longest room code accepted from clients
+const maxRoomCodeLength = 64
+
+// roomCodePattern: characters a room code may have, codes are also file names
+var roomCodePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ErrInvalidRoomCode: room code empty, too long or with other characters than
+// letters, digits, - and _
+var ErrInvalidRoomCode = errors.New("invalid room code")
+
+// ValidateRoomCode: the canonical form of a room code from a client, upper case
+// so codes differing only in case are the same room. Surrounding spaces are
+// dropped, any other character outside [A-Za-z0-9_-] (control characters,
+// unicode look-alikes) rejects the code
+func ValidateRoomCode(code string) (string, error) {
+	code = strings.TrimSpace(code)
+	if len(code) == 0 || len(code) > maxRoomCodeLength {
+		return "", fmt.Errorf("%w: must be 1-%d characters", ErrInvalidRoomCode, maxRoomCodeLength)
+	}
+	if !roomCodePattern.MatchString(code) {
+		return "", fmt.Errorf("%w: only letters, digits, - and _ are allowed", ErrInvalidRoomCode)
+	}
+	return strings.ToUpper(code), nil
+}
+
+// Room codes the server issues (POST /rooms): Crockford base32, so there's no
+// I, L, O or U to misread
+const (
+	codeAlphabet    = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	codeLength      = 6
+	maxCodeAttempts = 10 // collisions are rare, 32^6 codes
+)
+
+// Room lifetimes: rooms expire after this long without activity (see Lifetime),
+// issued rooms may ask for another idle lifetime within the bounds
+const (
+	DefaultRoomTTL = 24 * time.Hour
+	MinRoomTTL     = time.Hour
+	MaxRoomTTL     = 7 * 24 * time.Hour
+)
+
+var (
+	// ErrInvalidTTL: the requested lifetime is outside MinRoomTTL..MaxRoomTTL
+	ErrInvalidTTL = fmt.Errorf("room lifetime must be between %s and %s", MinRoomTTL, MaxRoomTTL)
+	// ErrUnknownRoom: STRICT_ROOMS is set and the code wasn't issued by the server
+	ErrUnknownRoom = errors.New("unknown room code")
+	// ErrNoFreeCode: every generated code was taken
+	ErrNoFreeCode = errors.New("no free room code")
+)
+
+// generateCode: a random code from codeAlphabet (256 is a multiple of 32, so
+// taking each byte mod 32 is unbiased)
+func generateCode() string {
+	code := make([]byte, codeLength)
+	rand.Read(code)
+	for i, b := range code {
+		code[i] = codeAlphabet[int(b)%len(codeAlphabet)]
+	}
+	return string(code)
+}
+
+// CreateRoom: creates a room under a new server-issued code, expiring after ttl
+// without activity (the manager's idle lifetime if 0). Codes already in use, in
+// memory or saved, are skipped
+func (rm *Manager) CreateRoom(ttl time.Duration, maxRooms int) (*Room, error) {
+	if ttl != 0 && (ttl < MinRoomTTL || ttl > MaxRoomTTL) {
+		return nil, ErrInvalidTTL
+	}
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if ttl == 0 {
+		ttl = rm.lifetime.Idle
+	}
+
+	for attempt := 0; attempt < maxCodeAttempts; attempt++ {
+		code := generateCode()
+		if rm.codeTaken(code) {
+			continue
+		}
+		rm.issued[code] = time.Now().Add(ttl)
+		room, err := rm.createRoom(code, nil, maxRooms)
+		if err != nil {
+			delete(rm.issued, code)
+			return nil, err
+		}
+		room.mu.Lock()
+		room.lifetime.Idle = ttl
+		room.mu.Unlock()
+		slog.Info("Issued room code", logging.KeyRoom, code, "idle_ttl", ttl.String())
+		return room, nil
+	}
+	return nil, ErrNoFreeCode
+}
+
+// codeTaken: a room uses the code (or is being retired), or was issued it, or has
+// a board saved under it
+// caller must hold write lock
+func (rm *Manager) codeTaken(code string) bool {
+	if _, issued := rm.issued[code]; issued || rm.rooms[code] != nil || rm.retiring[code] != nil {
+		return true
+	}
+	if rm.store == nil {
+		return false
+	}
+	board, err := rm.store.Load(code)
+	return err != nil || board != nil
+}
+
+// isIssued: the server issued the code and it hasn't expired (a saved board may
+// say so, e.g. after a restart)
+// caller must hold write lock
+func (rm *Manager) isIssued(code string) bool {
+	if _, issued := rm.issued[code]; issued {
+		return true
+	}
+	if rm.store == nil {
+		return false
+	}
+	board, err := rm.store.Load(code)
+	return err == nil && board != nil && board.ExpiresAt.After(time.Now())
+}
+
+// maxCreateBody: bytes of a POST /rooms body
+const maxCreateBody = 1024
+
+// CreateHandler: POST /rooms, optionally with {"ttlSeconds": n}. Replies 201
+// with {"code","expiresAt"}, activity moves expiresAt on (see Lifetime). Counted
+// against the client IP's connection rate
+func (rm *Manager) CreateHandler(config *middleware.RateLimit, ips *middleware.IPRateLimit) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ips.Allow(ips.ClientIP(r)) {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		var req struct {
+			TTLSeconds int64 `json:"ttlSeconds"` // 0 for the default idle lifetime
+		}
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCreateBody)).Decode(&req)
+		if err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		// Checked in seconds first, a huge value would overflow the Duration
+		if req.TTLSeconds < 0 || req.TTLSeconds > int64(MaxRoomTTL/time.Second) {
+			http.Error(w, ErrInvalidTTL.Error(), http.StatusBadRequest)
+			return
+		}
+
+		room, err := rm.CreateRoom(time.Duration(req.TTLSeconds)*time.Second, config.MaxRooms)
+		switch {
+		case errors.Is(err, ErrInvalidTTL):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, ErrServerFull), errors.Is(err, ErrNoFreeCode):
+			http.Error(w, "No room available, try again later", http.StatusServiceUnavailable)
+			return
+		case err != nil:
+			slog.Error("Create room", "err", err)
+			http.Error(w, "Room could not be created", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"code":      room.Code,
+			"expiresAt": room.ExpiresAt(),
+		})
+	})
+}
@@ -0,0 +1,112 @@
+package room
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"main/internal/middleware"
+)
+
+func TestValidateRoomCode(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		code string
+		want string // "" for rejected
+	}{
+		{"mixed case", "MixedRoom", "MIXEDROOM"},
+		{"surrounding spaces", "  mixedroom\t", "MIXEDROOM"},
+		{"single character", "a", "A"},
+		{"dash and underscore", "team-board_2", "TEAM-BOARD_2"},
+		{"longest", strings.Repeat("a", maxRoomCodeLength), strings.Repeat("A", maxRoomCodeLength)},
+		{"empty", "", ""},
+		{"empty after trim", " \t\n ", ""},
+		{"over length", strings.Repeat("a", maxRoomCodeLength+1), ""},
+		{"huge", strings.Repeat("a", 10000), ""},
+		{"cyrillic look-alike", "rооm", ""},
+		{"accented", "café", ""},
+		{"fullwidth", "ａbc", ""},
+		{"control character", "room\x00", ""},
+		{"inner space", "my room", ""},
+		{"path", "../boards", ""},
+		{"dot", "room.json", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ValidateRoomCode(tc.code)
+			if tc.want == "" {
+				if !errors.Is(err, ErrInvalidRoomCode) {
+					t.Errorf("ValidateRoomCode = %q, %v, want ErrInvalidRoomCode", got, err)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Errorf("ValidateRoomCode = %q, %v, want %q", got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestJoinRoomNormalizesCode(t *testing.T) {
+	rm := NewManager(nil)
+	sessions := testSessions()
+	rl := middleware.NewRateLimit(10, 1000, 250000, 100, 5, 1000, 30, 60)
+
+	first, err := rm.JoinRoom("MixedRoom", "", member(sessions, "alice", ""), rl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := rm.JoinRoom(" mixedroom ", "", member(sessions, "bob", ""), rl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second || first.Code != "MIXEDROOM" {
+		t.Fatalf("joined %s and %s, want one room MIXEDROOM", first.Code, second.Code)
+	}
+	if found, ok := rm.GetRoom("mixedROOM"); !ok || found != first {
+		t.Error("GetRoom in another case didn't find the room")
+	}
+
+	for _, code := range []string{"", "   ", "rооm", strings.Repeat("x", 10000)} {
+		if _, err := rm.JoinRoom(code, "", member(sessions, "carol", ""), rl); !errors.Is(err, ErrInvalidRoomCode) {
+			t.Errorf("JoinRoom(%.20q) = %v, want ErrInvalidRoomCode", code, err)
+		}
+	}
+	if rm.RoomCount() != 1 {
+		t.Errorf("%d rooms, invalid codes created rooms", rm.RoomCount())
+	}
+}
+
+func TestFileStoreRenamesLegacyCodes(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"legacyBoard.json": "legacy",
+		"SAVED.json":       "saved",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := NewFileStore(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"LEGACYBOARD.json": "legacy",
+		"SAVED.json":       "saved",
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(want) {
+		t.Errorf("%d files after opening, want %d", len(entries), len(want))
+	}
+	for name, content := range want {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(got) != content {
+			t.Errorf("%s = %q, %v, want %q", name, got, err, content)
+		}
+	}
+}
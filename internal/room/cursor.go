@@ -0,0 +1,216 @@
+package room
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// CursorInterval: how often a room flushes changed cursors, one batch per flush
+const CursorInterval = 33 * time.Millisecond
+
+const (
+	maxTrailPoints  = 4     // positions in a cursor trail
+	maxCursorBuffer = 16    // raw positions kept between flushes, thinned when full
+	minTrailMove    = 2     // no trail unless a position is this far from the last sent one
+	maxTrailDelta   = 32767 // jumps larger than this are sent without a trail
+)
+
+// cursorPoint: a raw cursor position
+type cursorPoint struct {
+	X, Y float64
+}
+
+// cursorSlot: a user's cursor between flushes
+type cursorSlot struct {
+	latest  cursorPoint   // newest position, sent by the next flush
+	meta    interface{}   // caller's data for latest (see MoveCursor)
+	sent    cursorPoint   // position sent by the last flush
+	hasSent bool          // sent is set (no trail before the first flush)
+	buffer  []cursorPoint // positions replaced by a newer one since the last flush
+	dirty   bool          // moved since the last flush
+}
+
+// cursorSlots: cursor positions waiting for the room's flusher. Own lock, so
+// cursor moves don't contend for the room lock (lock order: room, then cursors)
+type cursorSlots struct {
+	slots map[string]*cursorSlot // userID → cursor
+	stop  chan struct{}          // closed to stop the flusher, nil if none runs
+	mu    sync.Mutex
+}
+
+// CursorMove: a cursor to send, as taken by a flush
+type CursorMove struct {
+	UserID string
+	X, Y   float64
+	Color  string
+	Name   string // display name, "" if none
+	PageID string
+	// Trail: positions since the previous flush of this cursor, oldest first, as
+	// rounded deltas (see encodeTrail), nil if it barely moved
+	Trail [][2]int
+	Meta  interface{} // as passed to MoveCursor with the latest position
+}
+
+// MoveCursor: records a cursor position, sent with the room's next flush.
+// meta (e.g. the move's timestamps) comes back with it in the CursorMove
+func (r *Room) MoveCursor(userID string, x, y float64, meta interface{}) {
+	r.cursors.mu.Lock()
+	defer r.cursors.mu.Unlock()
+
+	if r.cursors.slots == nil {
+		r.cursors.slots = make(map[string]*cursorSlot)
+	}
+	slot := r.cursors.slots[userID]
+	if slot == nil {
+		slot = &cursorSlot{}
+		r.cursors.slots[userID] = slot
+	}
+	if slot.dirty {
+		if len(slot.buffer) >= maxCursorBuffer {
+			slot.buffer = thinCursor(slot.buffer)
+		}
+		slot.buffer = append(slot.buffer, slot.latest)
+	}
+	slot.latest = cursorPoint{X: x, Y: y}
+	slot.meta = meta
+	slot.dirty = true
+}
+
+// StartCursors: starts the room's cursor flusher unless it's running. flush is
+// called every interval with the cursors moved since the last call (never
+// empty). It stops when the last user leaves or the room closes
+func (r *Room) StartCursors(interval time.Duration, flush func(ctx context.Context, moves []CursorMove)) {
+	r.cursors.mu.Lock()
+	defer r.cursors.mu.Unlock()
+
+	if r.cursors.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	r.cursors.stop = stop
+
+	r.Go(func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if moves := r.takeCursors(); len(moves) > 0 {
+					flush(ctx, moves)
+				}
+			}
+		}
+	})
+}
+
+// forgetCursor: drops a leaving user's cursor, and stops the flusher if the
+// room is now empty
+// caller must hold write lock
+func (r *Room) forgetCursor(userID string) {
+	r.cursors.mu.Lock()
+	defer r.cursors.mu.Unlock()
+
+	delete(r.cursors.slots, userID)
+	if len(r.Connections) == 0 && r.cursors.stop != nil {
+		close(r.cursors.stop)
+		r.cursors.stop = nil
+	}
+}
+
+// takeCursors: the cursors moved since the last call, of users still in the room
+func (r *Room) takeCursors() []CursorMove {
+	r.cursors.mu.Lock()
+	var moves []CursorMove
+	for userID, slot := range r.cursors.slots {
+		if !slot.dirty {
+			continue
+		}
+		var trail [][2]int
+		if slot.hasSent {
+			trail = encodeTrail(slot.sent, sampleCursor(slot.buffer, maxTrailPoints))
+		}
+		moves = append(moves, CursorMove{UserID: userID, X: slot.latest.X, Y: slot.latest.Y, Trail: trail, Meta: slot.meta})
+		slot.sent = slot.latest
+		slot.hasSent = true
+		slot.buffer = slot.buffer[:0]
+		slot.meta = nil
+		slot.dirty = false
+	}
+	r.cursors.mu.Unlock() // before the room lock, see cursorSlots
+
+	if len(moves) == 0 {
+		return nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	present := moves[:0]
+	for _, move := range moves {
+		if r.Connections[move.UserID] == nil {
+			continue // left meanwhile
+		}
+		move.Color = r.UserColors[move.UserID]
+		move.Name = r.names[move.UserID]
+		move.PageID = r.userPage(move.UserID)
+		present = append(present, move)
+	}
+	return present
+}
+
+// encodeTrail: points as integer deltas, each from the previous point as the
+// client will reconstruct it (the first from from), so rounding doesn't add
+// up: every decoded point is within half a unit of the raw one on each axis.
+// nil if no point moved more than minTrailMove from from, or one jumped too far
+func encodeTrail(from cursorPoint, points []cursorPoint) [][2]int {
+	moved := false
+	for _, p := range points {
+		if math.Abs(p.X-from.X) > minTrailMove || math.Abs(p.Y-from.Y) > minTrailMove {
+			moved = true
+			break
+		}
+	}
+	if !moved {
+		return nil
+	}
+
+	trail := make([][2]int, 0, len(points))
+	prev := from
+	for _, p := range points {
+		dx, dy := math.Round(p.X-prev.X), math.Round(p.Y-prev.Y)
+		if math.Abs(dx) > maxTrailDelta || math.Abs(dy) > maxTrailDelta {
+			return nil
+		}
+		trail = append(trail, [2]int{int(dx), int(dy)})
+		prev = cursorPoint{X: prev.X + dx, Y: prev.Y + dy}
+	}
+	return trail
+}
+
+// sampleCursor: at most n of points, evenly spread, ending with the last
+func sampleCursor(points []cursorPoint, n int) []cursorPoint {
+	if len(points) <= n {
+		return points
+	}
+	sampled := make([]cursorPoint, 0, n)
+	for i := 1; i <= n; i++ {
+		sampled = append(sampled, points[i*len(points)/n-1])
+	}
+	return sampled
+}
+
+// thinCursor: every other position of a full buffer, keeping the newest
+func thinCursor(points []cursorPoint) []cursorPoint {
+	kept := points[:0]
+	for i := (len(points) + 1) % 2; i < len(points); i += 2 {
+		kept = append(kept, points[i])
+	}
+	return kept
+}
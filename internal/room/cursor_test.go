@@ -0,0 +1,119 @@
+package room
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// decodeTrail: the positions a client reconstructs from trail (see the
+// client's cursorTrail)
+func decodeTrail(from cursorPoint, trail [][2]int) []cursorPoint {
+	points := make([]cursorPoint, 0, len(trail))
+	for _, delta := range trail {
+		from = cursorPoint{X: from.X + float64(delta[0]), Y: from.Y + float64(delta[1])}
+		points = append(points, from)
+	}
+	return points
+}
+
+func TestTrailReconstructsRawPositions(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for walk := 0; walk < 1000; walk++ {
+		from := cursorPoint{X: rng.Float64() * 2000, Y: rng.Float64() * 2000}
+		points := make([]cursorPoint, 1+rng.Intn(maxTrailPoints))
+		p := from
+		for i := range points {
+			p = cursorPoint{X: p.X + rng.NormFloat64()*20, Y: p.Y + rng.NormFloat64()*20}
+			points[i] = p
+		}
+
+		trail := encodeTrail(from, points)
+		if trail == nil {
+			continue // barely moved
+		}
+		decoded := decodeTrail(from, trail)
+		if len(decoded) != len(points) {
+			t.Fatalf("%d points decoded, want %d", len(decoded), len(points))
+		}
+		for i := range points {
+			if math.Abs(decoded[i].X-points[i].X) > 0.5 || math.Abs(decoded[i].Y-points[i].Y) > 0.5 {
+				t.Fatalf("walk %d point %d: decoded %v, raw %v", walk, i, decoded[i], points[i])
+			}
+		}
+	}
+}
+
+func TestTrailOmitted(t *testing.T) {
+	from := cursorPoint{X: 100, Y: 100}
+	if trail := encodeTrail(from, []cursorPoint{{101, 99}, {102, 100.5}}); trail != nil {
+		t.Errorf("trail %v for a cursor that barely moved", trail)
+	}
+	if trail := encodeTrail(from, []cursorPoint{{50000, 100}}); trail != nil {
+		t.Errorf("trail %v for a jump past the delta range", trail)
+	}
+	if trail := encodeTrail(from, nil); trail != nil {
+		t.Errorf("trail %v without buffered positions", trail)
+	}
+}
+
+func TestSampleAndThinCursor(t *testing.T) {
+	points := make([]cursorPoint, maxCursorBuffer)
+	for i := range points {
+		points[i] = cursorPoint{X: float64(i)}
+	}
+
+	sampled := sampleCursor(points, maxTrailPoints)
+	if len(sampled) != maxTrailPoints || sampled[len(sampled)-1] != points[len(points)-1] {
+		t.Errorf("sampled %v, want %d points ending with the newest", sampled, maxTrailPoints)
+	}
+	if short := sampleCursor(points[:2], maxTrailPoints); len(short) != 2 {
+		t.Errorf("sampled %d of 2 points, want both", len(short))
+	}
+
+	thinned := thinCursor(append([]cursorPoint(nil), points...))
+	if len(thinned) != maxCursorBuffer/2 || thinned[len(thinned)-1] != points[len(points)-1] {
+		t.Errorf("thinned to %v, want half ending with the newest", thinned)
+	}
+}
+
+func TestFlushCarriesTrail(t *testing.T) {
+	r := newTestRoom(t)
+	alice := member(testSessions(), "alice", "")
+	if err := r.Join(alice, 10, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	r.MoveCursor("alice", 10, 10, nil)
+	first := r.takeCursors()
+	if len(first) != 1 || first[0].Trail != nil {
+		t.Fatalf("first flush = %+v, want one move without a trail", first)
+	}
+
+	raw := []cursorPoint{{20.4, 10}, {30, 15.6}, {40, 20}}
+	for _, p := range raw {
+		r.MoveCursor("alice", p.X, p.Y, nil)
+	}
+	second := r.takeCursors()
+	if len(second) != 1 {
+		t.Fatalf("second flush = %+v, want one move", second)
+	}
+	move := second[0]
+	if move.X != 40 || move.Y != 20 {
+		t.Errorf("position = %v, %v, want the latest", move.X, move.Y)
+	}
+	// the trail covers the positions the latest replaced
+	decoded := decodeTrail(cursorPoint{X: 10, Y: 10}, move.Trail)
+	if len(decoded) != 2 {
+		t.Fatalf("trail %v, want the 2 replaced positions", move.Trail)
+	}
+	for i, p := range decoded {
+		if math.Abs(p.X-raw[i].X) > 0.5 || math.Abs(p.Y-raw[i].Y) > 0.5 {
+			t.Errorf("trail point %d = %v, want %v", i, p, raw[i])
+		}
+	}
+
+	if moves := r.takeCursors(); moves != nil {
+		t.Errorf("flush without moves = %+v", moves)
+	}
+}
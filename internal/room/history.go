@@ -0,0 +1,87 @@
+package room
+
+import (
+	"errors"
+	"time"
+
+	"main/internal/object"
+)
+
+// maxHistory: undo/redo steps remembered per user
+const maxHistory = 100
+
+var (
+	// ErrNothingToUndo: user has no drawing left in this room to undo
+	ErrNothingToUndo = errors.New("nothing to undo")
+	// ErrNothingToRedo: nothing undone since the user last drew
+	ErrNothingToRedo = errors.New("nothing to redo")
+)
+
+// pushHistory: records an added drawing for undo, new drawing invalidates redo
+// caller must hold write lock
+func (r *Room) pushHistory(obj *object.Drawing) {
+	stack := append(r.history[obj.UserID], obj.ID)
+	if len(stack) > maxHistory {
+		stack = stack[len(stack)-maxHistory:]
+	}
+	r.history[obj.UserID] = stack
+	delete(r.redo, obj.UserID)
+}
+
+// Undo: removes userID's most recently added drawing that still exists and is theirs
+func (r *Room) Undo(userID string) (*object.Drawing, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stack := r.history[userID]
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		obj, exists := r.Objects[id]
+		if !exists || obj.UserID != userID {
+			continue // deleted or transferred since
+		}
+
+		r.history[userID] = stack
+		r.untrackObject(obj)
+		delete(r.Objects, id)
+		r.addTombstone(id)
+		r.redo[userID] = append(r.redo[userID], obj)
+		r.LastActive = time.Now()
+		r.changed(obj.ID)
+		return obj, nil
+	}
+
+	delete(r.history, userID)
+	return nil, ErrNothingToUndo
+}
+
+// Redo: restores userID's most recently undone drawing
+func (r *Room) Redo(userID string) (*object.Drawing, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stack := r.redo[userID]
+	for len(stack) > 0 {
+		obj := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		// ID reused meanwhile, or its page is gone
+		if _, exists := r.Objects[obj.ID]; exists || r.pageIndex(obj.PageID) == -1 {
+			continue
+		}
+
+		r.redo[userID] = stack
+		r.trackObject(obj)
+		r.Objects[obj.ID] = obj
+		delete(r.tombstones, obj.ID)
+		r.history[userID] = append(r.history[userID], obj.ID)
+		r.LastActive = time.Now()
+		r.changed(obj.ID)
+		return obj, nil
+	}
+
+	delete(r.redo, userID)
+	return nil, ErrNothingToRedo
+}
@@ -0,0 +1,125 @@
+package room
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"main/internal/logging"
+	"main/internal/metrics"
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+)
+
+// closeTimeout: how long Close waits for room workers to stop
+const closeTimeout = 2 * time.Second
+
+// disconnectTimeout: how long Disconnect waits for clients to answer the close
+// frame before dropping their connections
+const disconnectTimeout = 5 * time.Second
+
+// Go: runs fn as a room-scoped worker, ctx is cancelled when the room closes
+// Workers started after Close get an already cancelled context
+func (r *Room) Go(fn func(ctx context.Context)) {
+	r.workers.Add(1)
+	go func() {
+		defer r.workers.Done()
+		fn(r.ctx)
+	}()
+}
+
+// Context: cancelled once the room is closed
+func (r *Room) Context() context.Context {
+	return r.ctx
+}
+
+// Close: stops all room workers, waiting up to closeTimeout for them to exit
+func (r *Room) Close() {
+	r.cancel()
+	metrics.ForgetRoom(r.Code)
+
+	r.mu.Lock()
+	r.audit = auditLog{}
+	r.mu.Unlock()
+
+	r.cursors.mu.Lock()
+	r.cursors.slots = nil
+	r.cursors.stop = nil // the flusher exits with the room context
+	r.cursors.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(closeTimeout):
+		slog.Warn("Room workers still running after close", logging.KeyRoom, r.Code, "timeout", closeTimeout.String())
+	}
+}
+
+// Sent to everyone in a room an operator closes: message type, then close code
+const (
+	CodeRoomClosed  = "room_closed"
+	CloseRoomClosed = 4007
+)
+
+// ErrRoomClosed: the room was closed (e.g. by an operator) after it was looked up
+var ErrRoomClosed = errors.New("room closed")
+
+// CloseRoom: removes a room for good (an operator closing it). It's closed, so
+// joins and messages are refused from now on, and its saved board is deleted.
+// The caller notifies its connections and closes them (see Disconnect)
+func (rm *Manager) CloseRoom(roomCode string) (*Room, error) {
+	roomCode, err := ValidateRoomCode(roomCode)
+	if err != nil {
+		return nil, err
+	}
+
+	rm.mu.Lock()
+	room := rm.rooms[roomCode]
+	if room == nil {
+		rm.mu.Unlock()
+		return nil, ErrUnknownRoom
+	}
+	finish := rm.retire(room, true)
+	delete(rm.issued, roomCode)
+	metrics.ActiveRooms.Set(float64(len(rm.rooms)))
+	rm.mu.Unlock()
+
+	finish()
+	slog.Info("Closed room", logging.KeyRoom, roomCode)
+	return room, nil
+}
+
+// Disconnect: closes every connection in the room, and those waiting in its
+// join queue, with closeCode. The close frame is queued behind messages already
+// sent (e.g. room_closed, see closeConnection). Returns how many were closed
+func (r *Room) Disconnect(closeCode int, reason string) int {
+	r.mu.Lock()
+	users := make([]*user.User, 0, len(r.Connections)+len(r.queue))
+	for _, u := range r.Connections {
+		users = append(users, u)
+	}
+	for _, w := range r.queue {
+		users = append(users, w.user)
+	}
+	r.queue = nil
+	r.mu.Unlock()
+
+	for _, u := range users {
+		closeConnection(u, closeCode, reason)
+	}
+	return len(users)
+}
+
+// closeConnection: queues a close frame, the read loop ends when the client
+// answers it. The connection is dropped after disconnectTimeout if it doesn't
+func closeConnection(u *user.User, closeCode int, reason string) {
+	u.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, reason))
+	time.AfterFunc(disconnectTimeout, func() { u.Connection.Close() })
+}
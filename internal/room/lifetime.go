@@ -0,0 +1,116 @@
+package room
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"main/internal/logging"
+)
+
+// Lifetime: when rooms expire (see Cleanup). A room expires once it has been
+// empty and unchanged for Idle (joins and edits start the clock again), or
+// MaxAge after it was created if that comes first (0 for no cap). A room
+// pinned by ExtendRoom lasts at least until the pin, and a room with anyone
+// connected never expires
+type Lifetime struct {
+	Idle   time.Duration
+	MaxAge time.Duration
+}
+
+// DefaultLifetime: rooms expire after DefaultRoomTTL without activity, no cap
+func DefaultLifetime() Lifetime {
+	return Lifetime{Idle: DefaultRoomTTL}
+}
+
+// expiresAt: when a room created at createdAt, last active at lastActive and
+// pinned until pinnedUntil (zero if never extended) expires
+func (l Lifetime) expiresAt(createdAt, lastActive, pinnedUntil time.Time) time.Time {
+	expiresAt := lastActive.Add(l.Idle)
+	if l.MaxAge > 0 && createdAt.Add(l.MaxAge).Before(expiresAt) {
+		expiresAt = createdAt.Add(l.MaxAge)
+	}
+	if pinnedUntil.After(expiresAt) {
+		expiresAt = pinnedUntil
+	}
+	return expiresAt
+}
+
+// SetLifetime: expiry policy for rooms created from now on (issued rooms keep
+// the idle lifetime they asked for)
+func (rm *Manager) SetLifetime(lifetime Lifetime) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.lifetime = lifetime
+}
+
+// expiry: when the room expires if nobody joins or edits it before then
+// caller must hold lock
+func (r *Room) expiry() time.Time {
+	return r.lifetime.expiresAt(r.CreatedAt, r.LastActive, r.pinnedUntil)
+}
+
+// ExpiresAt: when the room expires if nobody joins or edits it before then
+func (r *Room) ExpiresAt() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.expiry()
+}
+
+// expired: the saved board's room expired while it wasn't in memory
+func (b *Board) expired(lifetime Lifetime, now time.Time) bool {
+	if b.LastActive.IsZero() {
+		return false // saved before activity was recorded
+	}
+	if b.TTLSeconds > 0 {
+		lifetime.Idle = time.Duration(b.TTLSeconds) * time.Second
+	}
+	return now.After(lifetime.expiresAt(b.CreatedAt, b.LastActive, b.PinnedUntil))
+}
+
+// ErrInvalidExtension: ExtendRoom was asked for less than a minute or more than MaxRoomTTL
+var ErrInvalidExtension = fmt.Errorf("extension must be between %s and %s", time.Minute, MaxRoomTTL)
+
+// ExtendRoom: keeps a room for at least d past its current expiry (or now, if
+// that's later), e.g. a workshop that breaks for longer than the idle lifetime.
+// Only rooms in memory can be extended (ErrUnknownRoom otherwise). Returns the
+// new expiry
+func (rm *Manager) ExtendRoom(roomCode string, d time.Duration) (time.Time, error) {
+	if d < time.Minute || d > MaxRoomTTL {
+		return time.Time{}, ErrInvalidExtension
+	}
+	roomCode, err := ValidateRoomCode(roomCode)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	room := rm.rooms[roomCode]
+	if room == nil {
+		return time.Time{}, ErrUnknownRoom
+	}
+
+	room.mu.Lock()
+	room.pinnedUntil = later(room.expiry(), time.Now()).Add(d)
+	room.dirty = true // the pin is saved with the board
+	expiresAt := room.expiry()
+	room.mu.Unlock()
+
+	if room.issued {
+		rm.issued[roomCode] = expiresAt
+	}
+	slog.Info("Extended room", logging.KeyRoom, roomCode, "expires_at", expiresAt)
+	return expiresAt, nil
+}
+
+// later: the later of a and b
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
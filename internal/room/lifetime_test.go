@@ -0,0 +1,201 @@
+package room
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"main/internal/middleware"
+	"main/internal/object"
+	"main/internal/user"
+)
+
+// visitedRoom: a room someone joined and left, now empty
+func visitedRoom(t *testing.T, rm *Manager, code string) *Room {
+	t.Helper()
+	rl := middleware.NewRateLimit(10, 1000, 250000, 100, 5, 1000, 30, 60)
+	visitor := member(testSessions(), "visitor", "")
+	r, err := rm.JoinRoom(code, "", visitor, rl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Leave(visitor)
+	return r
+}
+
+// age: backdates the room's creation and last activity
+func age(r *Room, created, idle time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.CreatedAt = time.Now().Add(-created)
+	r.LastActive = time.Now().Add(-idle)
+}
+
+// occupy: puts a connection in the room without touching its activity
+func occupy(r *Room) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Connections["alice"] = &user.User{ID: "alice"}
+}
+
+func TestCleanupExpiresIdleRooms(t *testing.T) {
+	rm := NewManager(nil)
+
+	fresh := visitedRoom(t, rm, "fresh")
+	age(fresh, 23*time.Hour, 23*time.Hour)
+	stale := visitedRoom(t, rm, "stale")
+	age(stale, 25*time.Hour, 25*time.Hour)
+	connected := visitedRoom(t, rm, "connected")
+	age(connected, 25*time.Hour, 25*time.Hour)
+	occupy(connected)
+	workshop := visitedRoom(t, rm, "workshop") // three days of drawing
+	age(workshop, 72*time.Hour, time.Hour)
+	pinned := visitedRoom(t, rm, "pinned")
+	age(pinned, 25*time.Hour, 25*time.Hour)
+	if _, err := rm.ExtendRoom("pinned", 2*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	rm.Cleanup()
+	for _, tc := range []struct {
+		room *Room
+		kept bool
+	}{
+		{fresh, true},
+		{stale, false},
+		{connected, true},
+		{workshop, true},
+		{pinned, true},
+	} {
+		if _, exists := rm.GetRoom(tc.room.Code); exists != tc.kept {
+			t.Errorf("room %s kept = %v, want %v", tc.room.Code, exists, tc.kept)
+		}
+	}
+}
+
+func TestCleanupAgeCap(t *testing.T) {
+	rm := NewManager(nil)
+	rm.SetLifetime(Lifetime{Idle: 24 * time.Hour, MaxAge: 48 * time.Hour})
+
+	capped := visitedRoom(t, rm, "capped")
+	age(capped, 49*time.Hour, time.Minute)
+	connected := visitedRoom(t, rm, "connected")
+	age(connected, 49*time.Hour, time.Minute)
+	occupy(connected)
+	young := visitedRoom(t, rm, "young")
+	age(young, 47*time.Hour, time.Minute)
+
+	rm.Cleanup()
+	if _, exists := rm.GetRoom("capped"); exists {
+		t.Error("empty room past the age cap kept")
+	}
+	for _, code := range []string{"connected", "young"} {
+		if _, exists := rm.GetRoom(code); !exists {
+			t.Errorf("room %s removed", code)
+		}
+	}
+}
+
+func TestJoinRefreshesActivity(t *testing.T) {
+	rm := NewManager(nil)
+	r := visitedRoom(t, rm, "rejoined")
+	age(r, 30*time.Hour, 23*time.Hour)
+
+	if err := r.Join(member(testSessions(), "bob", ""), 10, 10); err != nil {
+		t.Fatal(err)
+	}
+	if left := time.Until(r.ExpiresAt()); left < DefaultRoomTTL-time.Minute {
+		t.Errorf("expires in %v after a join, want the full idle lifetime", left)
+	}
+}
+
+func TestCleanupWithStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rm := NewManager(store)
+
+	unloaded := visitedRoom(t, rm, "unloaded")
+	if err := unloaded.AddObject(drawing("s1", "visitor")); err != nil {
+		t.Fatal(err)
+	}
+	age(unloaded, 2*time.Hour, 2*time.Hour)
+	if _, err := rm.ExtendRoom("unloaded", 48*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	expired := visitedRoom(t, rm, "expired")
+	if err := expired.AddObject(drawing("s2", "visitor")); err != nil {
+		t.Fatal(err)
+	}
+	age(expired, 25*time.Hour, 25*time.Hour)
+
+	// Idle for an hour: saved and unloaded, with its pin. Expired: discarded
+	rm.Cleanup()
+	if rm.RoomCount() != 0 {
+		t.Fatalf("%d rooms in memory after cleanup, want 0", rm.RoomCount())
+	}
+	board, err := store.Load("UNLOADED")
+	if err != nil || board == nil || len(board.Objects) != 1 || board.PinnedUntil.IsZero() {
+		t.Fatalf("saved board = %+v, %v, want its drawing and pin", board, err)
+	}
+	if board, err := store.Load("EXPIRED"); err != nil || board != nil {
+		t.Errorf("expired room's board = %+v, %v, want it deleted", board, err)
+	}
+	if restored := visitedRoom(t, rm, "unloaded"); restored.GetObject("s1") == nil {
+		t.Error("unloaded room not restored on the next join")
+	}
+
+	// A board that expires while unloaded isn't restored
+	board.LastActive = time.Now().Add(-25 * time.Hour)
+	board.PinnedUntil = time.Time{}
+	if err := store.Save("STALE", board); err != nil {
+		t.Fatal(err)
+	}
+	if stale := visitedRoom(t, rm, "stale"); stale.ObjectCount() != 0 {
+		t.Errorf("stale board restored with %d objects", stale.ObjectCount())
+	}
+	if board, _ := store.Load("STALE"); board != nil {
+		t.Error("stale board not deleted")
+	}
+}
+
+func TestExtendRoom(t *testing.T) {
+	rm := NewManager(nil)
+	r := visitedRoom(t, rm, "extended")
+	before := r.ExpiresAt()
+
+	expiresAt, err := rm.ExtendRoom("Extended", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expiresAt.Equal(before.Add(time.Hour)) || !r.ExpiresAt().Equal(expiresAt) {
+		t.Errorf("expires at %v, want an hour after %v", expiresAt, before)
+	}
+	// Extensions add up
+	if again, _ := rm.ExtendRoom("extended", time.Hour); !again.Equal(expiresAt.Add(time.Hour)) {
+		t.Errorf("second extension expires at %v, want %v", again, expiresAt.Add(time.Hour))
+	}
+
+	for _, tc := range []struct {
+		code string
+		d    time.Duration
+		want error
+	}{
+		{"extended", 30 * time.Second, ErrInvalidExtension},
+		{"extended", MaxRoomTTL + time.Hour, ErrInvalidExtension},
+		{"missing", time.Hour, ErrUnknownRoom},
+		{"not a code", time.Hour, ErrInvalidRoomCode},
+	} {
+		if _, err := rm.ExtendRoom(tc.code, tc.d); !errors.Is(err, tc.want) {
+			t.Errorf("ExtendRoom(%q, %v) = %v, want %v", tc.code, tc.d, err, tc.want)
+		}
+	}
+}
+
+func TestUnsetActivityNeverExpiresSavedBoard(t *testing.T) {
+	board := &Board{CreatedAt: time.Now().Add(-100 * time.Hour), Objects: []*object.Drawing{drawing("s1", "alice")}}
+	if board.expired(DefaultLifetime(), time.Now()) {
+		t.Error("board saved before activity was recorded counted as expired")
+	}
+}
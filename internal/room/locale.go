@@ -0,0 +1,21 @@
+package room
+
+// Locale: the room's default locale for system texts ("" = English)
+func (r *Room) Locale() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.locale
+}
+
+// SetLocale: changes the default locale (already resolved, see i18n.Resolve)
+// Connections that declared their own locale keep it
+func (r *Room) SetLocale(locale string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.locale = locale
+	for _, conn := range r.Connections {
+		conn.SetRoomLocale(locale)
+	}
+}
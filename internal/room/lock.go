@@ -0,0 +1,96 @@
+package room
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrObjectLocked: the drawing is locked by another user
+var ErrObjectLocked = errors.New("object locked by another user")
+
+// objectLock: soft lock while a user drags or edits a drawing, others' updates
+// are rejected until it's released or expires. A user's locks are released when
+// they leave the room (userLeft stands in for their objectUnlocked messages)
+type objectLock struct {
+	userID  string
+	expires time.Time
+}
+
+// Lock: a held lock
+type Lock struct {
+	ObjectID string
+	UserID   string
+	Expires  time.Time
+}
+
+// LockObject: locks drawing id for userID until ttl from now (locking it again
+// extends the lock). ErrObjectLocked, with the other user's lock, if it's held
+func (r *Room) LockObject(id string, userID string, ttl time.Duration) (Lock, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.Objects[id]; !exists {
+		return Lock{}, fmt.Errorf("object not found: %s", id)
+	}
+
+	now := time.Now()
+	r.pruneLocks(now)
+	if held, locked := r.locks[id]; locked && held.userID != userID {
+		return Lock{ObjectID: id, UserID: held.userID, Expires: held.expires}, ErrObjectLocked
+	}
+
+	lock := objectLock{userID: userID, expires: now.Add(ttl)}
+	r.locks[id] = lock
+	return Lock{ObjectID: id, UserID: userID, Expires: lock.expires}, nil
+}
+
+// UnlockObject: releases userID's lock on id, false if they didn't hold one
+func (r *Room) UnlockObject(id string, userID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	held, locked := r.locks[id]
+	if !locked || held.userID != userID || !time.Now().Before(held.expires) {
+		return false
+	}
+	delete(r.locks, id)
+	return true
+}
+
+// LockHolder: user holding an unexpired lock on id, "" if none
+func (r *Room) LockHolder(id string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.lockHolder(id, time.Now())
+}
+
+// lockHolder: caller must hold lock
+func (r *Room) lockHolder(id string, now time.Time) string {
+	held, locked := r.locks[id]
+	if !locked || !now.Before(held.expires) {
+		return ""
+	}
+	return held.userID
+}
+
+// pruneLocks: drops expired locks and locks on deleted drawings
+// caller must hold write lock
+func (r *Room) pruneLocks(now time.Time) {
+	for id, held := range r.locks {
+		if _, exists := r.Objects[id]; !exists || !now.Before(held.expires) {
+			delete(r.locks, id)
+		}
+	}
+}
+
+// releaseLocks: drops every lock userID holds
+// caller must hold write lock
+func (r *Room) releaseLocks(userID string) {
+	for id, held := range r.locks {
+		if held.userID == userID {
+			delete(r.locks, id)
+		}
+	}
+}
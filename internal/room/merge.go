@@ -0,0 +1,93 @@
+package room
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"main/internal/object"
+	"main/internal/user"
+)
+
+// Merge errors, nothing was added when one is returned
+var (
+	ErrMergeObjectLimit = errors.New("merge would exceed the room's object limit")
+	ErrMergeByteLimit   = errors.New("merge would exceed the room's size budget")
+	ErrMergeOutOfBounds = errors.New("offset moves drawings out of bounds")
+)
+
+// MergeOptions: placement and limits for Merge
+type MergeOptions struct {
+	DX, DY     float64 // offset applied to every merged drawing
+	MaxObjects int     // drawings the room may hold afterwards
+	MaxBytes   int     // encoded size the room's drawings may reach afterwards
+}
+
+// Merge: copies a source board (see Export) into the room with fresh IDs, shifted
+// by DX/DY and stacked above every existing drawing in source order. Copies keep
+// their author and record the drawing they came from in Origin. Source pages map
+// to the room's pages by position, pages past the room's last land on the first
+// All or nothing, returns the added drawings
+func (r *Room) Merge(source *Board, sourceCode string, opts MergeOptions) ([]*object.Drawing, error) {
+	pageIndex := make(map[string]int, len(source.Pages))
+	for i, page := range source.Pages {
+		pageIndex[page.ID] = i
+	}
+
+	// Copies (and their size) are built before taking the lock
+	objs := make([]*object.Drawing, 0, len(source.Objects))
+	pages := make([]int, 0, len(source.Objects))
+	size := 0
+	for _, original := range source.Objects {
+		data, ok := object.Translate(original.Data, opts.DX, opts.DY)
+		if !ok {
+			return nil, ErrMergeOutOfBounds
+		}
+		obj := &object.Drawing{
+			ID:     user.GenerateUUID(),
+			Type:   original.Type,
+			Data:   data,
+			UserID: original.UserID,
+			Origin: &object.Origin{Room: sourceCode, ObjectID: original.ID},
+		}
+		encoded, err := json.Marshal(obj)
+		if err != nil {
+			return nil, fmt.Errorf("encode merged drawing: %w", err)
+		}
+		size += len(encoded)
+		objs = append(objs, obj)
+		pages = append(pages, pageIndex[original.PageID])
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.Objects)+len(objs) > opts.MaxObjects {
+		return nil, ErrMergeObjectLimit
+	}
+	for _, existing := range r.Objects {
+		encoded, err := json.Marshal(existing)
+		if err != nil {
+			return nil, fmt.Errorf("encode drawing: %w", err)
+		}
+		size += len(encoded)
+	}
+	if r.lastClear != nil {
+		size += r.lastClear.bytes // held for restoreLastClear, it may come back
+	}
+	if size > opts.MaxBytes {
+		return nil, ErrMergeByteLimit
+	}
+
+	onTop := make([]bool, len(objs))
+	for i, obj := range objs {
+		if pages[i] < len(r.Pages) {
+			obj.PageID = r.Pages[pages[i]].ID
+		}
+		onTop[i] = true
+	}
+	if err := r.addObjects(objs, onTop); err != nil {
+		return nil, err
+	}
+	return objs, nil
+}
@@ -0,0 +1,47 @@
+package room
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SetUserName: sets the name the user is shown with in this room, name with a
+// numeric suffix if another user here already has it. Returns the name shown
+func (r *Room) SetUserName(userID string, name string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.setUserName(userID, name)
+}
+
+// setUserName: caller must hold write lock
+func (r *Room) setUserName(userID string, name string) string {
+	if r.names == nil {
+		r.names = make(map[string]string)
+	}
+	shown := name
+	for n := 2; r.nameTaken(userID, shown); n++ {
+		shown = fmt.Sprintf("%s (%d)", name, n)
+	}
+	r.names[userID] = shown
+	return shown
+}
+
+// nameTaken: another user in the room is shown as name (ignoring case)
+// caller must hold lock
+func (r *Room) nameTaken(userID string, name string) bool {
+	for other, shown := range r.names {
+		if other != userID && strings.EqualFold(shown, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// UserName: the name the user is shown with in this room, "" if they have none
+func (r *Room) UserName(userID string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.names[userID]
+}
@@ -0,0 +1,79 @@
+package room
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+)
+
+// Notice limits: recent notices are replayed to users joining shortly after
+const (
+	maxNotices = 10
+	noticeTTL  = 5 * time.Minute
+)
+
+// Notice: operator announcement (e.g. maintenance window)
+type Notice struct {
+	Message  string    `json:"message"`
+	Severity string    `json:"severity"`
+	SentAt   time.Time `json:"-"`
+}
+
+// MarshalMessage: systemNotice wire message for the notice
+func (n Notice) MarshalMessage() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"type":     "systemNotice",
+		"message":  n.Message,
+		"severity": n.Severity,
+		"sentAt":   n.SentAt.UnixMilli(),
+	})
+}
+
+// AddNotice: records notice for replay, dropping expired and oldest entries
+func (r *Room) AddNotice(n Notice) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.notices = append(r.recentNotices(), n)
+	if len(r.notices) > maxNotices {
+		r.notices = r.notices[len(r.notices)-maxNotices:]
+	}
+}
+
+// RecentNotices: notices sent within the replay window, oldest first
+func (r *Room) RecentNotices() []Notice {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.recentNotices()
+}
+
+// recentNotices: copy of unexpired notices
+// caller must hold lock
+func (r *Room) recentNotices() []Notice {
+	recent := make([]Notice, 0, len(r.notices))
+	for _, n := range r.notices {
+		if time.Since(n.SentAt) <= noticeTTL {
+			recent = append(recent, n)
+		}
+	}
+	return recent
+}
+
+// SendNotices: replays recent notices to a newly joined user
+func (s *Synchronizer) SendNotices(rm *Room, u *user.User) error {
+	for _, n := range rm.RecentNotices() {
+		msg, err := n.MarshalMessage()
+		if err != nil {
+			return fmt.Errorf("failed to marshal notice: %w", err)
+		}
+		if err := u.WriteMessage(websocket.TextMessage, msg); err != nil {
+			return fmt.Errorf("failed to send notice: %w", err)
+		}
+	}
+	return nil
+}
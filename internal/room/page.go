@@ -0,0 +1,154 @@
+package room
+
+import (
+	"errors"
+	"fmt"
+
+	"main/internal/user"
+)
+
+// Page limits
+const (
+	MaxPages      = 50
+	DefaultPageID = "page-1"
+)
+
+// Page: a single board (tab) within a room
+type Page struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// GetPages: returns copy of the ordered page list
+func (r *Room) GetPages() []Page {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pages := make([]Page, len(r.Pages))
+	copy(pages, r.Pages)
+	return pages
+}
+
+// HasPage: checks if a page exists in the room
+func (r *Room) HasPage(pageID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.pageIndex(pageID) != -1
+}
+
+// pageIndex: position of page in r.Pages, -1 if missing
+// caller must hold lock
+func (r *Room) pageIndex(pageID string) int {
+	for i, page := range r.Pages {
+		if page.ID == pageID {
+			return i
+		}
+	}
+	return -1
+}
+
+// CreatePage: appends a new page to the room
+func (r *Room) CreatePage(name string) (Page, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.Pages) >= MaxPages {
+		return Page{}, fmt.Errorf("room at maximum page count (%d)", MaxPages)
+	}
+
+	page := Page{ID: user.GenerateUUID(), Name: name}
+	r.Pages = append(r.Pages, page)
+	r.changed()
+	return page, nil
+}
+
+// RenamePage: changes a page's name
+func (r *Room) RenamePage(pageID string, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.pageIndex(pageID)
+	if i == -1 {
+		return fmt.Errorf("page not found: %s", pageID)
+	}
+	r.Pages[i].Name = name
+	r.changed()
+	return nil
+}
+
+// DeletePage: removes a page, deleting its objects only when force is set
+// Returns the IDs of deleted objects. Users on the page move to the first page
+func (r *Room) DeletePage(pageID string, force bool) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.pageIndex(pageID)
+	if i == -1 {
+		return nil, fmt.Errorf("page not found: %s", pageID)
+	}
+	if len(r.Pages) == 1 {
+		return nil, errors.New("cannot delete the last page")
+	}
+
+	var objectIDs []string
+	for id, obj := range r.Objects {
+		if obj.PageID == pageID {
+			objectIDs = append(objectIDs, id)
+		}
+	}
+	if len(objectIDs) > 0 && !force {
+		return nil, fmt.Errorf("page has %d objects (set force to delete them)", len(objectIDs))
+	}
+
+	for _, id := range objectIDs {
+		r.untrackObject(r.Objects[id])
+		delete(r.Objects, id)
+		r.addTombstone(id)
+	}
+	r.Pages = append(r.Pages[:i], r.Pages[i+1:]...)
+	r.changed(objectIDs...)
+
+	for userID, current := range r.userPages {
+		if current == pageID {
+			r.userPages[userID] = r.Pages[0].ID
+		}
+	}
+	return objectIDs, nil
+}
+
+// SwitchPage: sets the page a user is currently viewing
+func (r *Room) SwitchPage(userID string, pageID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pageIndex(pageID) == -1 {
+		return fmt.Errorf("page not found: %s", pageID)
+	}
+	r.userPages[userID] = pageID
+	return nil
+}
+
+// UserPage: returns the page a user is viewing (first page by default)
+func (r *Room) UserPage(userID string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.userPage(userID)
+}
+
+// userPage: caller must hold lock
+func (r *Room) userPage(userID string) string {
+	if pageID, exists := r.userPages[userID]; exists {
+		return pageID
+	}
+	return r.Pages[0].ID
+}
+
+// IsHost: checks if user is the room host (first user to join)
+func (r *Room) IsHost(userID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.role(userID) == RoleHost
+}
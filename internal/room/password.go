@@ -0,0 +1,55 @@
+package room
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPasswordLength: bcrypt ignores anything past 72 bytes
+const maxPasswordLength = 72
+
+var (
+	// ErrWrongPassword: room is protected and the password didn't match
+	ErrWrongPassword = errors.New("wrong room password")
+	// ErrPasswordTooLong: password over maxPasswordLength bytes
+	ErrPasswordTooLong = errors.New("room password too long")
+)
+
+// hashPassword: the hash protecting a new room, nil for an empty password (open)
+// Slow by design, call without holding room or manager locks
+func hashPassword(password string) ([]byte, error) {
+	if password == "" {
+		return nil, nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("hash room password: %w", err)
+	}
+	return hash, nil
+}
+
+// checkPassword: nil if the room is open or password matches its hash
+// Slow by design, call without holding room or manager locks where possible
+func (r *Room) checkPassword(password string) error {
+	r.mu.RLock()
+	hash := r.passwordHash
+	r.mu.RUnlock()
+
+	if hash == nil {
+		return nil
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+// Protected: whether joining needs a password
+func (r *Room) Protected() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.passwordHash != nil
+}
@@ -0,0 +1,145 @@
+package room
+
+import (
+	"errors"
+	"fmt"
+
+	"main/internal/object"
+)
+
+// Roles: host is the first user to join and moderates the room (keeps the role
+// across reconnects with the same session token), everyone else is an editor,
+// except connections that joined as spectators (view only, even the host's)
+const (
+	RoleHost      = "host"
+	RoleEditor    = "editor"
+	RoleSpectator = "spectator"
+)
+
+// Capabilities checked by the message router
+const (
+	CapDraw           = "draw"         // add, change, and delete own drawings
+	CapEditOthers     = "edit-others"  // change other users' drawings
+	CapEraseOthers    = "erase-others" // delete other users' drawings
+	CapClear          = "clear"        // bulk removal (clearing the board and undoing it, deleting a page with content)
+	CapChat           = "chat"
+	CapReact          = "react"
+	CapManagePages    = "manage-pages"    // create and rename pages
+	CapManageSettings = "manage-settings" // timers, imports, ownership, find-and-replace, locale, permissions
+	CapModerate       = "moderate"        // kick and ban users
+)
+
+var capabilities = map[string]bool{
+	CapDraw: true, CapEditOthers: true, CapEraseOthers: true, CapClear: true, CapChat: true,
+	CapReact: true, CapManagePages: true, CapManageSettings: true, CapModerate: true,
+}
+
+// DefaultPermissions: role → capabilities granted to it
+// Editors only change and delete their own drawings unless the host allows more
+func DefaultPermissions() map[string]map[string]bool {
+	host := make(map[string]bool, len(capabilities))
+	for capability := range capabilities {
+		host[capability] = true
+	}
+	return map[string]map[string]bool{
+		RoleHost: host,
+		RoleEditor: {
+			CapDraw:        true,
+			CapChat:        true,
+			CapReact:       true,
+			CapManagePages: true,
+		},
+		RoleSpectator: {},
+	}
+}
+
+// Role: the user's role in this room
+func (r *Room) Role(userID string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.role(userID)
+}
+
+// role: caller must hold lock
+func (r *Room) role(userID string) string {
+	if conn := r.Connections[userID]; conn != nil && conn.Spectator {
+		return RoleSpectator
+	}
+	if userID == r.HostID {
+		return RoleHost
+	}
+	return RoleEditor
+}
+
+// Can: checks if the user's role grants capability
+func (r *Room) Can(userID string, capability string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.permissions[r.role(userID)][capability]
+}
+
+// ErrNotOwner: the drawing is someone else's and the user's role lacks the capability
+var ErrNotOwner = errors.New("drawing belongs to another user")
+
+// CheckOwner: nil if userID may change drawing id, their own or anyone's with
+// capability (the host always has it). Unknown IDs pass, callers report those
+func (r *Room) CheckOwner(userID string, id string, capability string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.checkOwner(userID, r.Objects[id], capability)
+}
+
+// checkOwner: caller must hold lock
+func (r *Room) checkOwner(userID string, obj *object.Drawing, capability string) error {
+	if obj == nil || obj.UserID == userID || r.permissions[r.role(userID)][capability] {
+		return nil
+	}
+	return ErrNotOwner
+}
+
+// Permissions: copy of the room's permission matrix
+func (r *Room) Permissions() map[string]map[string]bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matrix := make(map[string]map[string]bool, len(r.permissions))
+	for role, granted := range r.permissions {
+		matrix[role] = make(map[string]bool, len(granted))
+		for capability, allowed := range granted {
+			matrix[role][capability] = allowed
+		}
+	}
+	return matrix
+}
+
+// SetPermissions: updates capabilities of non-host roles (the host keeps everything,
+// so a room can't be locked out of its own settings). Unknown roles or capabilities
+// reject the whole change
+func (r *Room) SetPermissions(changes map[string]map[string]bool) error {
+	for role, granted := range changes {
+		if role == RoleHost || role == RoleSpectator {
+			return fmt.Errorf("%s permissions cannot be changed", role)
+		}
+		if role != RoleEditor {
+			return fmt.Errorf("unknown role: %s", role)
+		}
+		for capability := range granted {
+			if !capabilities[capability] {
+				return fmt.Errorf("unknown capability: %s", capability)
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for role, granted := range changes {
+		for capability, allowed := range granted {
+			r.permissions[role][capability] = allowed
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package room
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDefaultPermissions(t *testing.T) {
+	r := newTestRoom(t)
+	r.mu.Lock()
+	r.HostID = "alice"
+	r.mu.Unlock()
+
+	for capability := range capabilities {
+		if !r.Can("alice", capability) {
+			t.Errorf("host lacks %s", capability)
+		}
+	}
+	for capability, want := range map[string]bool{
+		CapDraw: true, CapChat: true, CapReact: true, CapManagePages: true,
+		CapEditOthers: false, CapEraseOthers: false, CapClear: false, CapManageSettings: false, CapModerate: false,
+	} {
+		if got := r.Can("bob", capability); got != want {
+			t.Errorf("editor %s = %v, want %v", capability, got, want)
+		}
+	}
+}
+
+func TestSetPermissionsRejectsWholeChange(t *testing.T) {
+	r := newTestRoom(t)
+	before := r.Permissions()
+
+	for name, changes := range map[string]map[string]map[string]bool{
+		"host role":          {RoleHost: {CapDraw: false}},
+		"spectator role":     {RoleSpectator: {CapDraw: true}},
+		"unknown role":       {"admin": {CapDraw: true}},
+		"unknown capability": {RoleEditor: {CapClear: true, "fly": true}},
+	} {
+		if err := r.SetPermissions(changes); err == nil {
+			t.Errorf("%s accepted", name)
+		}
+	}
+	if after := r.Permissions(); !reflect.DeepEqual(after, before) {
+		t.Errorf("rejected changes applied: %v", after)
+	}
+}
+
+func TestSetPermissionsCustomMatrix(t *testing.T) {
+	r := newTestRoom(t)
+	if err := r.AddObject(drawing("s1", "alice")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Editors may draw and edit anyone's drawings, but not erase them
+	if err := r.SetPermissions(map[string]map[string]bool{
+		RoleEditor: {CapDraw: true, CapEditOthers: true, CapEraseOthers: false},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CheckOwner("bob", "s1", CapEditOthers); err != nil {
+		t.Errorf("editor editing another's drawing: %v", err)
+	}
+	if err := r.CheckOwner("bob", "s1", CapEraseOthers); !errors.Is(err, ErrNotOwner) {
+		t.Errorf("editor erasing another's drawing = %v, want ErrNotOwner", err)
+	}
+	if err := r.CheckOwner("alice", "s1", CapEraseOthers); err != nil {
+		t.Errorf("owner erasing their own drawing: %v", err)
+	}
+
+	// Permissions returns a copy
+	r.Permissions()[RoleEditor][CapClear] = true
+	if r.Can("bob", CapClear) {
+		t.Error("changing the copy changed the room")
+	}
+}
@@ -0,0 +1,89 @@
+package room
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+)
+
+// Presence: connected user entry in sync "users" and presence messages
+type Presence struct {
+	UserID    string `json:"userId"`
+	Color     string `json:"color"`
+	Name      string `json:"name,omitempty"`      // display name, if the user set one (setName)
+	Spectator bool   `json:"spectator,omitempty"` // watching only, not editing
+	// RTTMillis: the connection's ping round trip (rolling average), omitted
+	// until measured
+	RTTMillis float64 `json:"rttMs,omitempty"`
+}
+
+// Presence: everyone currently connected, with their room color
+func (r *Room) Presence() []Presence {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.presence()
+}
+
+// presence: caller must hold lock
+func (r *Room) presence() []Presence {
+	users := make([]Presence, 0, len(r.Connections))
+	for userID, conn := range r.Connections {
+		users = append(users, Presence{UserID: userID, Color: r.UserColors[userID], Name: r.names[userID], Spectator: conn.Spectator, RTTMillis: conn.RTTMillis()})
+	}
+	return users
+}
+
+// UserJoined: tells everyone but the joining user that they arrived
+func (b *Broadcaster) UserJoined(ctx context.Context, rm RoomConnections, userID string) {
+	connections := rm.GetConnections()
+	joined, ok := connections[userID]
+	if !ok {
+		return
+	}
+
+	event := map[string]interface{}{
+		"type":   "userJoined",
+		"userId": userID,
+		"color":  rm.GetUserColor(userID),
+	}
+	if name := rm.UserName(userID); name != "" {
+		event["name"] = name
+	}
+	if joined.Spectator {
+		event["spectator"] = true
+	}
+	msg, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Marshal userJoined", "err", err)
+		return
+	}
+	b.Broadcast(ctx, rm, msg, joined.Connection, TagPresence)
+}
+
+// PresenceUpdate: sends the room everyone connected, with their latency (for
+// connection quality indicators), sent periodically
+func (b *Broadcaster) PresenceUpdate(ctx context.Context, rm *Room) {
+	msg, err := json.Marshal(map[string]interface{}{
+		"type":  "presence",
+		"users": rm.Presence(),
+	})
+	if err != nil {
+		slog.Error("Marshal presence", "err", err)
+		return
+	}
+	b.Broadcast(ctx, rm, msg, nil, TagPresence)
+}
+
+// UserLeft: tells the room a user is gone (call only once they're removed)
+func (b *Broadcaster) UserLeft(ctx context.Context, rm RoomConnections, userID string) {
+	msg, err := json.Marshal(map[string]interface{}{
+		"type":   "userLeft",
+		"userId": userID,
+	})
+	if err != nil {
+		slog.Error("Marshal userLeft", "err", err)
+		return
+	}
+	b.Broadcast(ctx, rm, msg, nil, TagPresence)
+}
@@ -0,0 +1,79 @@
+package room
+
+import "main/internal/object"
+
+// trackObject: records an added drawing as unfinished if it's provisional,
+// replacing tracking for a drawing it overwrites, and its zIndex in the bounds
+// caller must hold write lock
+func (r *Room) trackObject(obj *object.Drawing) {
+	r.noteZ(obj.ZIndex)
+	if existing, exists := r.Objects[obj.ID]; exists {
+		r.untrackObject(existing)
+	}
+	if !obj.Provisional {
+		return
+	}
+	if r.unfinished[obj.UserID] == nil {
+		r.unfinished[obj.UserID] = make(map[string]bool)
+	}
+	r.unfinished[obj.UserID][obj.ID] = true
+}
+
+// untrackObject: caller must hold write lock
+func (r *Room) untrackObject(obj *object.Drawing) {
+	ids := r.unfinished[obj.UserID]
+	if ids == nil {
+		return
+	}
+	delete(ids, obj.ID)
+	if len(ids) == 0 {
+		delete(r.unfinished, obj.UserID)
+	}
+}
+
+// FinalizeObject: marks a provisional drawing as finished (kept on disconnect)
+func (r *Room) FinalizeObject(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if obj, exists := r.Objects[id]; exists && obj.Provisional {
+		r.untrackObject(obj)
+		obj.Provisional = false
+		r.changed(id)
+	}
+}
+
+// ProvisionalObjects: IDs of userID's unfinished drawings
+func (r *Room) ProvisionalObjects(userID string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := make([]string, 0, len(r.unfinished[userID]))
+	for id := range r.unfinished[userID] {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// DropProvisional: deletes those of ids that are still userID's unfinished drawings
+// Returns the IDs actually deleted
+func (r *Room) DropProvisional(userID string, ids []string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dropped := make([]string, 0, len(ids))
+	for _, id := range ids {
+		obj, exists := r.Objects[id]
+		if !exists || !obj.Provisional || obj.UserID != userID {
+			continue
+		}
+		r.untrackObject(obj)
+		delete(r.Objects, id)
+		r.addTombstone(id)
+		dropped = append(dropped, id)
+	}
+	if len(dropped) > 0 {
+		r.changed(dropped...)
+	}
+	return dropped
+}
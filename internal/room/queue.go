@@ -0,0 +1,102 @@
+package room
+
+import (
+	"encoding/json"
+	"errors"
+
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	// ErrRoomFull: room has no free connection slot
+	ErrRoomFull = errors.New("room is full")
+	// ErrQueueFull: room is full and its join queue has no space either
+	ErrQueueFull = errors.New("room join queue is full")
+)
+
+// waiter: user parked until a slot frees up
+type waiter struct {
+	user     *user.User
+	admitted chan struct{} // closed once the user has been added to the room
+}
+
+// Enqueue: parks user until a slot frees (admitted is closed once they're in the room)
+// If a slot is already free the user is admitted immediately (position 0), a
+// closed room refuses them (ErrRoomClosed)
+func (r *Room) Enqueue(u *user.User, maxQueue int) (<-chan struct{}, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ctx.Err() != nil {
+		return nil, 0, ErrRoomClosed
+	}
+
+	w := &waiter{user: u, admitted: make(chan struct{})}
+	if r.seats(false, nil) < r.capacity && len(r.queue) == 0 {
+		r.addConnection(u)
+		close(w.admitted)
+		return w.admitted, 0, nil
+	}
+
+	if len(r.queue) >= maxQueue {
+		return nil, 0, ErrQueueFull
+	}
+
+	r.queue = append(r.queue, w)
+	return w.admitted, len(r.queue), nil
+}
+
+// Dequeue: removes a waiting user, false if they were already admitted
+func (r *Room) Dequeue(userID string) bool {
+	r.mu.Lock()
+	removed := false
+	for i, w := range r.queue {
+		if w.user.ID == userID {
+			r.queue = append(r.queue[:i], r.queue[i+1:]...)
+			removed = true
+			break
+		}
+	}
+	r.mu.Unlock()
+
+	if removed {
+		r.notifyQueue()
+	}
+	return removed
+}
+
+// admitWaiters: moves waiters into free slots in arrival order, true if the queue moved
+// caller must hold write lock
+func (r *Room) admitWaiters() bool {
+	moved := false
+	for len(r.queue) > 0 && r.seats(false, nil) < r.capacity {
+		w := r.queue[0]
+		r.queue = r.queue[1:]
+		r.addConnection(w.user)
+		close(w.admitted)
+		moved = true
+	}
+	return moved
+}
+
+// notifyQueue: sends each remaining waiter its current position
+func (r *Room) notifyQueue() {
+	r.mu.RLock()
+	waiters := make([]*user.User, len(r.queue))
+	for i, w := range r.queue {
+		waiters[i] = w.user
+	}
+	r.mu.RUnlock()
+
+	for i, u := range waiters {
+		msg, _ := json.Marshal(map[string]interface{}{
+			"type":     "queued",
+			"position": i + 1,
+		})
+		if err := u.WriteMessage(websocket.TextMessage, msg); err != nil {
+			u.Logger().Debug("Send queue position", "err", err)
+		}
+	}
+}
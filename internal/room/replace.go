@@ -0,0 +1,61 @@
+package room
+
+import (
+	"sort"
+	"time"
+
+	"main/internal/object"
+)
+
+// RewriteText: applies rewrite to the "text" of text-bearing drawings accepted by keep,
+// at most limit drawings per call in ID order starting after cursor. Returns copies of the
+// rewritten drawings and the cursor to continue from ("" when done). dryRun changes nothing
+func (r *Room) RewriteText(keep func(*object.Drawing) bool, rewrite func(string) (string, bool), cursor string, limit int, dryRun bool) ([]object.Drawing, string) {
+	if dryRun {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+	} else {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+	}
+
+	ids := make([]string, 0)
+	for id, obj := range r.Objects {
+		if _, isText := obj.Data["text"].(string); isText && id > cursor && keep(obj) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	next := ""
+	if len(ids) > limit {
+		ids = ids[:limit]
+		next = ids[limit-1]
+	}
+
+	changed := make([]object.Drawing, 0)
+	now := time.Now()
+	for _, id := range ids {
+		obj := r.Objects[id]
+		text, ok := rewrite(obj.Data["text"].(string))
+		if !ok {
+			continue
+		}
+
+		updated := *obj
+		updated.Data = make(map[string]interface{}, len(obj.Data))
+		for k, v := range obj.Data {
+			updated.Data[k] = v
+		}
+		updated.Data["text"] = text
+		updated.UpdatedAt = now
+
+		if !dryRun {
+			*obj = updated
+			r.LastActive = now
+			r.changed(id)
+		}
+		changed = append(changed, updated)
+	}
+	return changed, next
+}
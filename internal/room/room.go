@@ -1,93 +1,640 @@
-package room 
+package room
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"main/internal/user"
 	"main/internal/object"
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // Room represents a collaborative whiteboard room
 type Room struct {
+	Code           string
 	Connections    map[string]*user.User
 	Objects        map[string]*object.Drawing
 	UserColors     map[string]string // userID → color (room-specific)
+	names          map[string]string // userID → display name shown here (see SetUserName)
+	Pages          []Page            // ordered, always at least one
+	HostID         string            // first user to join the room
+	passwordHash   []byte            // bcrypt hash, nil for open rooms
+	userPages      map[string]string // userID → page currently viewed
 	colorGenerator *user.ColorGenerator
 	LastActive     time.Time
 	CreatedAt      time.Time
+	lifetime       Lifetime                     // expiry policy (see expiry)
+	clock          Clock                        // time source for timers (see SetClock)
+	pinnedUntil    time.Time                    // kept at least until this (see ExtendRoom)
+	issued         bool                         // code issued by the server (see CreateRoom)
+	banned         map[string]bool              // userID → kicked with a ban, until the room is removed (see Kick)
+	tombstones     map[string]time.Time         // recently deleted objectID → deletion time
+	provisional    map[string]bool              // userID → color assigned by a join not yet confirmed
+	lastSyncSize   atomic.Int64                 // bytes of the most recent full sync payload
+	capacity       int                          // max editor connections (from the last Join)
+	queue          []*waiter                    // users waiting for a slot, in arrival order
+	notices        []Notice                     // recent operator notices, replayed on join
+	timer          *roomTimer                   // running countdown (host started), nil if none
+	frozen         bool                         // board read-only after the timer expired
+	unfinished     map[string]map[string]bool   // userID → provisional objectIDs
+	locks          map[string]objectLock        // objectID → soft edit lock
+	history        map[string][]string          // userID → added objectIDs, oldest first (undo)
+	redo           map[string][]*object.Drawing // userID → undone drawings (redo)
+	dirty          bool                         // changed since last saved to the store
+	revision       uint64                       // bumped on every content change
+	changes        []change                     // recent revisions, oldest first (delta sync)
+	epoch          string                       // random per room instance, revisions restart with it
+	checkpoints    []*checkpoint                // boards before destructive host actions, oldest first
+	zOrder         zBounds                      // lowest and highest zIndex in use (see raiseZ)
+	lastClear      *clearedBoard                // drawings of the latest clear or purge (restoreLastClear)
+	audit          auditLog                     // recent object events for moderation (see Audit)
+	chat           []ChatMessage                // recent chat, oldest first (see AddChat)
+	cursors        cursorSlots                  // cursor moves waiting for the flusher (see StartCursors)
+	permissions    map[string]map[string]bool   // role → capability → allowed
+	locale         string                       // default locale for system texts, "" = English
+	objectsMetric  prometheus.Gauge             // objects_per_room series, set on every change
+	ctx            context.Context              // cancelled by Close, parent of every room worker
+	cancel         context.CancelFunc
+	workers        sync.WaitGroup
 	mu             sync.RWMutex
 }
 
+// Tombstone limits: deleted IDs are remembered briefly to catch crossing update/delete
+const (
+	maxTombstones = 500
+	tombstoneTTL  = 2 * time.Minute
+)
 
 // Join: adds user to room and assigns a unique color
-func (r *Room) Join(u *user.User, maxRoomSize int) error {
+// A connection of the same session already in the room (another device) is
+// replaced and signed out, it doesn't count against the room size
+// Spectators have their own limit, maxSpectators. A closed room refuses joins
+// (ErrRoomClosed), and so does a room the user was banned from (ErrBanned)
+func (r *Room) Join(u *user.User, maxRoomSize, maxSpectators int) error {
 	r.mu.Lock()
-	defer r.mu.Unlock()
+	if r.ctx.Err() != nil {
+		r.mu.Unlock()
+		return ErrRoomClosed
+	}
+	if r.banned[u.ID] {
+		r.mu.Unlock()
+		return ErrBanned
+	}
+	r.capacity = maxRoomSize
+	replaced := r.Connections[u.ID]
+	limit := maxRoomSize
+	if u.Spectator {
+		limit = maxSpectators
+	}
+	if r.seats(u.Spectator, replaced) >= limit {
+		r.mu.Unlock()
+		return ErrRoomFull
+	}
+
+	r.addConnection(u)
+	r.LastActive = time.Now() // joining keeps the room from expiring (see Lifetime)
+	r.dirty = true            // saved with the board, so it still does after a restart
+	r.mu.Unlock()
 
-	if len(r.Connections) >= maxRoomSize {
-		return errors.New("room is full")
+	if replaced != nil && replaced != u {
+		go signOut(replaced) // not under the manager lock, the write can block
 	}
+	return nil
+}
+
+// seats: connections of the kind (spectators or editors) in the room, not
+// counting except (a connection about to be replaced)
+// caller must hold lock
+func (r *Room) seats(spectators bool, except *user.User) int {
+	count := 0
+	for _, conn := range r.Connections {
+		if conn.Spectator == spectators && conn != except {
+			count++
+		}
+	}
+	return count
+}
+
+// Sent to a connection replaced by Join: error code, then close code
+const (
+	CodeSignedInElsewhere = "signed_in_elsewhere"
+	CloseSuperseded       = 4005
+)
+
+// signOut: closes a connection replaced by the same session joining from elsewhere
+// Its cleanup then finds it no longer in the room, so no userLeft is sent
+func signOut(u *user.User) {
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":    "error",
+		"code":    CodeSignedInElsewhere,
+		"message": u.Text(CodeSignedInElsewhere, nil),
+	})
+	if err := u.WriteMessage(websocket.TextMessage, msg); err != nil {
+		u.Logger().Debug("Notify replaced connection", "err", err)
+	}
+
+	closeMsg := websocket.FormatCloseMessage(CloseSuperseded, "signed in elsewhere")
+	u.WriteMessage(websocket.CloseMessage, closeMsg)
+	u.StopWriter() // waits until both are sent
+	u.Connection.Close()
+}
 
+// addConnection: adds user and assigns a color if they don't have one in this room yet
+// (kept across reconnects, seeded from the session color unless taken)
+// caller must hold write lock
+func (r *Room) addConnection(u *user.User) {
 	r.Connections[u.ID] = u
+	u.SetRoomLocale(r.locale)
+	if r.HostID == "" && !u.Spectator {
+		r.HostID = u.ID
+	}
 
-	// Assign color if user doesn't have one in this room yet
 	if _, hasColor := r.UserColors[u.ID]; !hasColor {
-		r.UserColors[u.ID] = r.colorGenerator.NextColor()
+		r.UserColors[u.ID] = r.pickColor(u)
+		r.provisional[u.ID] = true
+	}
+	if u.Session != nil && u.Session.Name() != "" {
+		r.setUserName(u.ID, u.Session.Name())
 	}
-
-	return nil
 }
 
-// Leave: remove  user from room
-func (r *Room) Leave(u *user.User) {
+// ConfirmJoin: join completed (user received room state), keep their color
+func (r *Room) ConfirmJoin(userID string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	delete(r.provisional, userID)
+}
+
+// AbortJoin: undoes a join that failed part way, freeing a color assigned by it
+func (r *Room) AbortJoin(u *user.User) {
+	r.mu.Lock()
+	if r.Connections[u.ID] != u {
+		r.mu.Unlock()
+		return // replaced by another connection of the session, which keeps the color
+	}
 	delete(r.Connections, u.ID)
+	r.forgetCursor(u.ID)
+	delete(r.names, u.ID)
+	if r.provisional[u.ID] {
+		delete(r.UserColors, u.ID)
+		delete(r.provisional, u.ID)
+	}
+	moved := r.admitWaiters()
+	r.mu.Unlock()
+
+	if moved {
+		r.notifyQueue()
+	}
+}
+
+// pickColor: session color if no one else in the room has it, else the next generated color
+// caller must hold write lock
+func (r *Room) pickColor(u *user.User) string {
+	if u.Session != nil && u.Session.Color != "" {
+		taken := false
+		for _, color := range r.UserColors {
+			if color == u.Session.Color {
+				taken = true
+				break
+			}
+		}
+		if !taken {
+			return u.Session.Color
+		}
+	}
+	return r.colorGenerator.NextColor()
+}
+
+// Leave: remove  user from room, false if they were already gone
+// (e.g. dropped after a failed broadcast, or replaced by another connection)
+func (r *Room) Leave(u *user.User) bool {
+	r.mu.Lock()
+	present := r.Connections[u.ID] == u
+	if present {
+		delete(r.Connections, u.ID)
+		r.releaseLocks(u.ID)
+		r.forgetCursor(u.ID)
+		delete(r.names, u.ID)
+	}
+	r.LastActive = time.Now()
+	moved := r.admitWaiters()
+	r.mu.Unlock()
 
+	if moved {
+		r.notifyQueue()
+	}
+	return present
+}
+
+// ErrObjectExists: an add used the ID of a drawing already in the room, adds
+// never replace (that's an update, with its owner and lock checks)
+var ErrObjectExists = errors.New("object already exists")
+
+// AddObject: adds drawing to room (on the first page if none given)
+func (r *Room) AddObject(obj *object.Drawing) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkNew(obj); err != nil {
+		return err
+	}
+
+	obj.CreatedAt = time.Now()
+	obj.UpdatedAt = obj.CreatedAt
+	r.trackObject(obj)
+	r.pushHistory(obj)
+	r.keepObject(obj)
+	delete(r.tombstones, obj.ID)
 	r.LastActive = time.Now()
+	r.changed(obj.ID)
+	return nil
 }
 
+// keepObject: stores a copy of obj, the caller goes on reading obj (e.g. to
+// broadcast it) without the lock while the room's copy changes
+// caller must hold write lock
+func (r *Room) keepObject(obj *object.Drawing) {
+	kept := *obj
+	r.Objects[obj.ID] = &kept
+}
+
+// checkNew: rejects a drawing whose ID is taken, then resolves its page
+// caller must hold write lock
+func (r *Room) checkNew(obj *object.Drawing) error {
+	if _, exists := r.Objects[obj.ID]; exists {
+		return fmt.Errorf("%w: %s", ErrObjectExists, obj.ID)
+	}
+	return r.resolvePage(obj)
+}
+
+// resolvePage: defaults drawing to the first page, rejects unknown pages
+// caller must hold write lock
+func (r *Room) resolvePage(obj *object.Drawing) error {
+	if obj.PageID == "" {
+		obj.PageID = r.Pages[0].ID
+		return nil
+	}
+	if r.pageIndex(obj.PageID) == -1 {
+		return fmt.Errorf("page not found: %s", obj.PageID)
+	}
+	return nil
+}
 
-// AddObject: adds drawing to room
-func (r *Room) AddObject(obj *object.Drawing) {
+// AddObjectOnTop: adds drawing above all existing drawings (max zIndex + 1)
+// zIndex is assigned under the room lock so concurrent adds never collide
+func (r *Room) AddObjectOnTop(obj *object.Drawing) (int, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	r.Objects[obj.ID] = obj
+	if err := r.checkNew(obj); err != nil {
+		return 0, err
+	}
+
+	next, err := r.raiseZ()
+	if err != nil {
+		return 0, err
+	}
+
+	obj.ZIndex = next
+	obj.CreatedAt = time.Now()
+	obj.UpdatedAt = obj.CreatedAt
+	r.trackObject(obj)
+	r.pushHistory(obj)
+	r.keepObject(obj)
+	delete(r.tombstones, obj.ID)
 	r.LastActive = time.Now()
+	r.changed(obj.ID)
+	return next, nil
+}
+
+// AddObjects: adds drawings all-or-nothing (a bad page or a taken ID rejects the whole batch)
+// Drawings with onTop[i] set are stacked above everything, in batch order
+func (r *Room) AddObjects(objs []*object.Drawing, onTop []bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.addObjects(objs, onTop)
+}
+
+// addObjects: caller must hold write lock
+func (r *Room) addObjects(objs []*object.Drawing, onTop []bool) error {
+	for _, obj := range objs {
+		if err := r.checkNew(obj); err != nil {
+			return err
+		}
+	}
+
+	next := 0
+	if slices.Contains(onTop, true) {
+		first, err := r.raiseZ()
+		if err != nil {
+			return err
+		}
+		if first+len(objs) > object.MaxZIndex {
+			return ErrZIndexRange
+		}
+		next = first
+	}
+
+	now := time.Now()
+	ids := make([]string, len(objs))
+	for i, obj := range objs {
+		if onTop[i] {
+			obj.ZIndex = next
+			next++
+		}
+		obj.CreatedAt = now
+		obj.UpdatedAt = now
+		r.trackObject(obj)
+		r.pushHistory(obj)
+		r.keepObject(obj)
+		delete(r.tombstones, obj.ID)
+		ids[i] = obj.ID
+	}
+	r.LastActive = now
+	r.changed(ids...)
+	return nil
+}
+
+// EditObject: changes drawing id for userID in one step under the room lock.
+// The drawing must be theirs or their role have capability (ErrNotOwner), and
+// not locked by someone else (ErrObjectLocked). edit then gets its type and
+// current data and returns the data to store, or an error to leave it as is.
+// edit runs under the lock, it mustn't call back into the room. The data map
+// is replaced rather than modified, syncs and broadcasts may still be encoding
+// the old one. Returns a copy of the changed drawing, nil if it doesn't exist
+func (r *Room) EditObject(id string, userID string, capability string, edit func(objType string, current map[string]interface{}) (map[string]interface{}, error)) (*object.Drawing, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	obj, exists := r.Objects[id]
+	if !exists {
+		return nil, nil
+	}
+	if err := r.checkOwner(userID, obj, capability); err != nil {
+		return nil, err
+	}
+	if holder := r.lockHolder(id, time.Now()); holder != "" && holder != userID {
+		return nil, ErrObjectLocked
+	}
+
+	data, err := edit(obj.Type, obj.Data)
+	if err != nil {
+		return nil, err
+	}
+	obj.Data = data
+	obj.UpdatedAt = time.Now()
+	r.LastActive = obj.UpdatedAt
+	r.changed(id)
+
+	edited := *obj
+	return &edited, nil
 }
 
-// UpdateObject: updates drawing in room
-func (r *Room) UpdateObject(id string, data map[string]interface{}) bool {
+// TransformObjects: applies t to the drawings ids as one change. Returns the IDs
+// transformed, and the rest: deleted meanwhile or moved out of bounds by t
+func (r *Room) TransformObjects(ids []string, t object.SelectionTransform) (transformed []string, missing []string, outOfBounds []string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if obj, exists := r.Objects[id]; exists {
+	now := time.Now()
+	for _, id := range ids {
+		obj, exists := r.Objects[id]
+		if !exists {
+			missing = append(missing, id)
+			continue
+		}
+		data, ok := t.Apply(obj.Type, obj.Data)
+		if !ok {
+			outOfBounds = append(outOfBounds, id)
+			continue
+		}
 		obj.Data = data
-		r.LastActive = time.Now()
-		return true
+		obj.UpdatedAt = now
+		transformed = append(transformed, id)
+	}
+	if len(transformed) > 0 {
+		r.LastActive = now
+		r.changed(transformed...)
+	}
+	return transformed, missing, outOfBounds
+}
+
+// DeleteObject: removes drawing from room on behalf of userID, who needs
+// capability for someone else's (ErrNotOwner). Returns the removed drawing,
+// nil if it was already gone
+func (r *Room) DeleteObject(id string, userID string, capability string) (*object.Drawing, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	obj, exists := r.Objects[id]
+	if err := r.checkOwner(userID, obj, capability); err != nil {
+		return nil, err
 	}
-	return false
+	if exists {
+		r.untrackObject(obj)
+		delete(r.Objects, id)
+		r.addTombstone(id)
+		r.changed(id)
+	}
+	r.LastActive = time.Now()
+	return obj, nil
 }
 
-// DeleteObject: removes drawing from room
-func (r *Room) DeleteObject(id string) {
+// ClearBoard: removes every drawing on every page (in-progress ones too), for
+// action by userID. Returns how many were removed. Pages are kept, the drawings
+// are held for RestoreLastClear
+func (r *Room) ClearBoard(action string, userID string) int {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	delete(r.Objects, id)
+	cleared := len(r.Objects)
+	removed := make([]*object.Drawing, 0, cleared)
+	for id, obj := range r.Objects {
+		r.addTombstone(id)
+		removed = append(removed, obj)
+	}
+	if cleared > 0 {
+		r.keepCleared(action, userID, removed)
+	}
+	r.Objects = make(map[string]*object.Drawing)
+	r.unfinished = make(map[string]map[string]bool)
 	r.LastActive = time.Now()
+	if cleared > 0 {
+		r.changedAll()
+	}
+	return cleared
+}
+
+// addTombstone: records deleted ID, evicting the oldest when at capacity
+// caller must hold write lock
+func (r *Room) addTombstone(id string) {
+	if len(r.tombstones) >= maxTombstones {
+		var oldestID string
+		var oldest time.Time
+		for tid, deletedAt := range r.tombstones {
+			if oldestID == "" || deletedAt.Before(oldest) {
+				oldestID, oldest = tid, deletedAt
+			}
+		}
+		delete(r.tombstones, oldestID)
+	}
+	r.tombstones[id] = time.Now()
+}
+
+// IsDeleted: checks if object was deleted recently (within tombstone window)
+func (r *Room) IsDeleted(id string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	deletedAt, exists := r.tombstones[id]
+	return exists && time.Since(deletedAt) <= tombstoneTTL
+}
+
+// PruneTombstones: removes expired tombstones
+func (r *Room) PruneTombstones() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for id, deletedAt := range r.tombstones {
+		if now.Sub(deletedAt) > tombstoneTTL {
+			delete(r.tombstones, id)
+		}
+	}
+}
+
+// ObjectsByUser: snapshot (copies) of the drawings owned by userID
+func (r *Room) ObjectsByUser(userID string) []object.Drawing {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var owned []object.Drawing
+	for _, obj := range r.Objects {
+		if obj.UserID == userID {
+			owned = append(owned, *obj)
+		}
+	}
+	return owned
 }
 
-// GetObject: retrieves drawing from room (by ID)
+// DeleteOwnedObjects: deletes userID's drawings, either the listed IDs (others'
+// drawings are skipped) or, with no IDs, those created before olderThan
+// Returns the IDs actually deleted. More than one is a purge, held for RestoreLastClear
+func (r *Room) DeleteOwnedObjects(userID string, ids []string, olderThan time.Time) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleted := make([]string, 0)
+	removed := make([]*object.Drawing, 0)
+	remove := func(obj *object.Drawing) {
+		r.untrackObject(obj)
+		delete(r.Objects, obj.ID)
+		r.addTombstone(obj.ID)
+		deleted = append(deleted, obj.ID)
+		removed = append(removed, obj)
+	}
+
+	if len(ids) > 0 {
+		for _, id := range ids {
+			if obj, exists := r.Objects[id]; exists && obj.UserID == userID {
+				remove(obj)
+			}
+		}
+	} else {
+		for _, obj := range r.Objects {
+			if obj.UserID == userID && obj.CreatedAt.Before(olderThan) {
+				remove(obj)
+			}
+		}
+	}
+
+	if len(removed) > 1 {
+		r.keepCleared("deleteMyObjects", userID, removed)
+	}
+	if len(deleted) > 0 {
+		r.LastActive = time.Now()
+		r.changed(deleted...)
+	}
+	return deleted
+}
+
+// TransferOwnership: reassigns drawings to toUserID, either all of fromUserID's
+// drawings or the listed objectIDs. At most limit objects move per call, remaining
+// reports how many of fromUserID's drawings are left (repeat the call to continue)
+// Returns the moved drawings' IDs and types
+func (r *Room) TransferOwnership(fromUserID string, objectIDs []string, toUserID string, limit int) ([]Transferred, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Target must be known to this room
+	if _, known := r.UserColors[toUserID]; !known {
+		return nil, 0, fmt.Errorf("unknown user: %s", toUserID)
+	}
+
+	transferred := make([]Transferred, 0)
+	defer func() { // every return below, even without a transfer
+		ids := make([]string, len(transferred))
+		for i, moved := range transferred {
+			ids[i] = moved.ID
+		}
+		r.changed(ids...)
+	}()
+	if len(objectIDs) > 0 {
+		if len(objectIDs) > limit {
+			return nil, 0, fmt.Errorf("too many objects: %d (max %d)", len(objectIDs), limit)
+		}
+		for _, id := range objectIDs {
+			if obj, exists := r.Objects[id]; exists {
+				obj.UserID = toUserID
+				transferred = append(transferred, Transferred{ID: id, Type: obj.Type})
+			}
+		}
+		return transferred, 0, nil
+	}
+
+	remaining := 0
+	for id, obj := range r.Objects {
+		if obj.UserID != fromUserID {
+			continue
+		}
+		if len(transferred) >= limit {
+			remaining++
+			continue
+		}
+		obj.UserID = toUserID
+		transferred = append(transferred, Transferred{ID: id, Type: obj.Type})
+	}
+	return transferred, remaining, nil
+}
+
+// Transferred: a drawing moved by TransferOwnership
+type Transferred struct {
+	ID   string
+	Type string
+}
+
+// GetObject: copy of drawing id as it is now, nil if there's none. Safe to
+// read without the lock, changes to it don't reach the room
 func (r *Room) GetObject(id string) *object.Drawing {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	return r.Objects[id]
+	obj, exists := r.Objects[id]
+	if !exists {
+		return nil
+	}
+	copied := *obj
+	return &copied
 }
 
 // GetObjectCount: returns number of objects in room
@@ -98,6 +645,23 @@ func (r *Room) ObjectCount() int {
 	return len(r.Objects)
 }
 
+// HasUser: true if a connection of the user is in the room
+func (r *Room) HasUser(userID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.Connections[userID] != nil
+}
+
+// Connected: the connection is (still) the user's connection to the room, false
+// once it was kicked, replaced or dropped
+func (r *Room) Connected(u *user.User) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.Connections[u.ID] == u
+}
+
 // GetConnectionCount: returns number of connections in room
 func (r *Room) ConnectionCount() int {
 	r.mu.RLock()
@@ -120,11 +684,28 @@ func (r *Room) GetConnections() map[string]*user.User {
 }
 
 // RemoveConnection: removes user connection from room (cleanup after failed broadcast)
-func (r *Room) RemoveConnection(userID string) {
+// false if they were already gone (or replaced by another connection)
+func (r *Room) RemoveConnection(u *user.User) bool {
 	r.mu.Lock()
-	defer r.mu.Unlock()
+	present := r.Connections[u.ID] == u
+	if present {
+		delete(r.Connections, u.ID)
+		r.releaseLocks(u.ID)
+		r.forgetCursor(u.ID)
+		delete(r.names, u.ID)
+	}
+	moved := r.admitWaiters()
+	r.mu.Unlock()
+
+	if moved {
+		r.notifyQueue()
+	}
+	return present
+}
 
-	delete(r.Connections, userID)
+// SyncSize: size in bytes of the last sync payload sent for this room (0 if none yet)
+func (r *Room) SyncSize() int64 {
+	return r.lastSyncSize.Load()
 }
 
 // GetUserColor: returns the user's color in this room
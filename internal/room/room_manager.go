@@ -1,52 +1,102 @@
 package room
 
 import (
+	"bytes"
+	"context"
 	"errors"
-	"fmt"
-	"regexp"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"main/internal/logging"
+	"main/internal/metrics"
 	"main/internal/middleware"
 	"main/internal/object"
 	"main/internal/user"
 )
 
+// ErrServerFull: the server has its maximum number of rooms (none could be evicted)
+var ErrServerFull = errors.New("server at maximum room capacity")
+
+// shellRoomMinAge: empty rooms without objects younger than this are never evicted
+const shellRoomMinAge = 5 * time.Minute
+
 // Manager manages all rooms in the application
 type Manager struct {
-	rooms map[string]*Room
+	rooms        map[string]*Room
 	synchronizer *Synchronizer
-	mu    sync.RWMutex
-
+	evicted      atomic.Uint64            // shell rooms evicted to make space
+	store        Store                    // nil keeps rooms in memory only
+	issued       map[string]time.Time     // server-issued code → expiry (see CreateRoom)
+	lifetime     Lifetime                 // expiry policy for new rooms (see SetLifetime)
+	clock        Clock                    // time source for new rooms' timers (see SetClock)
+	retiring     map[string]chan struct{} // rooms being closed and saved, closed when done (see retire)
+	mu           sync.RWMutex
 }
 
-// NewManager creates a new room manager
-func NewManager() *Manager {
+// NewManager creates a new room manager, boards are persisted to store (nil for none)
+func NewManager(store Store) *Manager {
 	return &Manager{
 		rooms:        make(map[string]*Room),
-		synchronizer: NewSynchronizer(),
+		synchronizer: NewSynchronizer(DefaultMaxSyncSize),
+		store:        store,
+		issued:       make(map[string]time.Time),
+		lifetime:     DefaultLifetime(),
+		clock:        wallClock{},
+		retiring:     make(map[string]chan struct{}),
 	}
 }
 
-
-// CreateRoom: helper to join 
+// CreateRoom: helper to join
 // no need to check roomCode or lock, this should only be called from join
-func (rm *Manager) createRoom(roomCode string, maxRooms int) (*Room, error) {
+// passwordHash (see hashPassword) protects the room if it's new (and wasn't
+// saved with one)
+func (rm *Manager) createRoom(roomCode string, passwordHash []byte, maxRooms int) (*Room, error) {
 
 	if rm.rooms[roomCode] == nil {
 		// Check global room limit before creating new room
-		if len(rm.rooms) >= maxRooms {
-			return nil, errors.New("server at maximum room capacity")
+		if len(rm.rooms) >= maxRooms && !rm.evictShellRoom() {
+			return nil, ErrServerFull
 		}
 
+		ctx, cancel := context.WithCancel(context.Background())
 		rm.rooms[roomCode] = &Room{
+			Code:           roomCode,
 			Connections:    make(map[string]*user.User),
 			Objects:        make(map[string]*object.Drawing),
 			UserColors:     make(map[string]string),
+			Pages:          []Page{{ID: DefaultPageID, Name: "Page 1"}},
+			userPages:      make(map[string]string),
 			colorGenerator: user.NewColorGenerator(),
 			LastActive:     time.Now(),
 			CreatedAt:      time.Now(),
+			tombstones:     make(map[string]time.Time),
+			banned:         make(map[string]bool),
+			provisional:    make(map[string]bool),
+			unfinished:     make(map[string]map[string]bool),
+			locks:          make(map[string]objectLock),
+			history:        make(map[string][]string),
+			redo:           make(map[string][]*object.Drawing),
+			permissions:    DefaultPermissions(),
+			lifetime:       rm.lifetime,
+			clock:          rm.clock,
+			objectsMetric:  metrics.RoomObjects(roomCode),
+			epoch:          user.GenerateUUID(),
+			ctx:            ctx,
+			cancel:         cancel,
 		}
+		rm.load(rm.rooms[roomCode])
+
+		if _, issued := rm.issued[roomCode]; issued {
+			rm.rooms[roomCode].issued = true
+		}
+
+		if created := rm.rooms[roomCode]; created.passwordHash == nil {
+			created.passwordHash = passwordHash
+		}
+		rm.rooms[roomCode].objectsMetric.Set(float64(len(rm.rooms[roomCode].Objects))) // not joined yet, no room lock needed
+		metrics.ActiveRooms.Set(float64(len(rm.rooms)))
 	}
 
 	room := rm.rooms[roomCode]
@@ -54,62 +104,290 @@ func (rm *Manager) createRoom(roomCode string, maxRooms int) (*Room, error) {
 	return room, nil
 }
 
+// evictShellRoom: removes the oldest room with no connections and no objects
+// (e.g. created by a typo'd room code), returns false if none qualify
+// caller must hold write lock
+func (rm *Manager) evictShellRoom() bool {
+	now := time.Now()
+	var oldestCode string
+	var oldest time.Time
+
+	for code, room := range rm.rooms {
+		room.mu.RLock()
+		shell := len(room.Connections) == 0 && len(room.Objects) == 0 && now.Sub(room.CreatedAt) > shellRoomMinAge
+		createdAt := room.CreatedAt
+		room.mu.RUnlock()
+
+		if shell && (oldestCode == "" || createdAt.Before(oldest)) {
+			oldestCode, oldest = code, createdAt
+		}
+	}
+
+	if oldestCode == "" {
+		return false
+	}
+
+	go rm.retire(rm.rooms[oldestCode], true)() // not holding up the join that needs the space
+	metrics.ActiveRooms.Set(float64(len(rm.rooms)))
+	rm.evicted.Add(1)
+	slog.Info("Evicted empty room to make space", logging.KeyRoom, oldestCode, "age", now.Sub(oldest).Round(time.Second).String())
+	return true
+}
+
+// retire: takes a room out of memory, refusing joins and messages at once. The
+// returned func stops its workers and saves its board (deletes it when discard
+// is set), run it after releasing the lock, both can take seconds. Until it
+// has, a join of the same code waits (see awaitRetired) rather than restore
+// the board from before
+// caller must hold write lock
+func (rm *Manager) retire(room *Room, discard bool) func() {
+	delete(rm.rooms, room.Code)
+	room.cancel()
+	done := make(chan struct{})
+	rm.retiring[room.Code] = done
+
+	return func() {
+		room.Close()
+		rm.persist(room, discard)
+
+		rm.mu.Lock()
+		delete(rm.retiring, room.Code)
+		rm.mu.Unlock()
+		close(done)
+	}
+}
+
+// awaitRetired: waits until no room with the code is being retired
+// caller must hold write lock, it's released while waiting
+func (rm *Manager) awaitRetired(roomCode string) {
+	for done := rm.retiring[roomCode]; done != nil; done = rm.retiring[roomCode] {
+		rm.mu.Unlock()
+		<-done
+		rm.mu.Lock()
+	}
+}
+
+// load: restores a saved board into a newly created room
+// caller must hold write lock
+func (rm *Manager) load(room *Room) {
+	if rm.store == nil {
+		return
+	}
+
+	board, err := rm.store.Load(room.Code)
+	if err != nil {
+		slog.Error("Load room", logging.KeyRoom, room.Code, "err", err)
+		return
+	}
+	if board != nil && board.expired(room.lifetime, time.Now()) {
+		if err := rm.store.Delete(room.Code); err != nil {
+			slog.Error("Delete saved room", logging.KeyRoom, room.Code, "err", err)
+		}
+		delete(rm.issued, room.Code)
+		slog.Info("Discarded saved room, it expired while unloaded", logging.KeyRoom, room.Code)
+		return
+	}
+	if board != nil {
+		room.restore(board)
+		if room.issued {
+			rm.issued[room.Code] = room.expiry() // e.g. issued before a restart
+		}
+		slog.Info("Restored room", logging.KeyRoom, room.Code, "objects", len(board.Objects))
+	}
+}
+
+// persist: saves a room being dropped from memory, or deletes its saved board
+// when discard is set (expired) or it has nothing worth keeping
+func (rm *Manager) persist(room *Room, discard bool) {
+	if rm.store == nil {
+		return
+	}
+
+	if discard || room.ObjectCount() == 0 {
+		if err := rm.store.Delete(room.Code); err != nil {
+			slog.Error("Delete saved room", logging.KeyRoom, room.Code, "err", err)
+		}
+		return
+	}
+	rm.save(room)
+}
+
+// save: writes the room to the store if it changed since the last save
+func (rm *Manager) save(room *Room) {
+	board := room.snapshot()
+	if board == nil {
+		return
+	}
+	if err := rm.store.Save(room.Code, board); err != nil {
+		room.markDirty() // retry on the next flush
+		slog.Error("Save room", logging.KeyRoom, room.Code, "err", err)
+	}
+}
+
+// Flush: saves every room changed since its last save
+func (rm *Manager) Flush() {
+	if rm.store == nil {
+		return
+	}
+	for _, room := range rm.Rooms() {
+		rm.save(room)
+	}
+}
+
+// EvictedCount: number of empty rooms evicted under capacity pressure
+func (rm *Manager) EvictedCount() uint64 {
+	return rm.evicted.Load()
+}
+
 // JoinRoom adds a user to a room, creating it if necessary
-func (rm *Manager) JoinRoom(roomCode string, session *user.UserSession, u *user.User, rl *middleware.RateLimit) (*Room, error) {
+// A new room is protected by password (if set), an existing protected room
+// must be given the matching password or ErrWrongPassword is returned
+// With rl.StrictRooms only codes from CreateRoom can be joined (ErrUnknownRoom)
+func (rm *Manager) JoinRoom(roomCode string, password string, u *user.User, rl *middleware.RateLimit) (*Room, error) {
 
-	if err := rm.validateRoomCode(roomCode); err != nil {
-		return nil, errors.New("invalid room code")
+	roomCode, err := ValidateRoomCode(roomCode)
+	if err != nil {
+		return nil, err
+	}
+	if len(password) > maxPasswordLength {
+		return nil, ErrPasswordTooLong
 	}
 
-	rm.mu.Lock()
-	defer rm.mu.Unlock()
+	// bcrypt is slow, so the password is checked (or hashed for a new room)
+	// before taking the lock
+	verified, exists := rm.GetRoom(roomCode)
+	if exists {
+		if err := verified.checkPassword(password); err != nil {
+			return nil, err
+		}
+	}
+	var hash []byte
+	for {
+		if verified == nil && hash == nil && password != "" {
+			if hash, err = hashPassword(password); err != nil {
+				return nil, err
+			}
+		}
 
-	// Check if user is rejoining their last room and it still exists
-	if session.LastRoom == roomCode {
-		if existingRoom, active := rm.rooms[roomCode]; active {
-			if err := existingRoom.Join(u, rl.MaxRoomSize); err != nil {
+		room, err := rm.joinVerified(roomCode, verified, hash, u, rl)
+		switch {
+		case errors.Is(err, errUnverified):
+			// Replaced (expired and recreated, or restored with a saved password)
+			// since it was verified, checked again and retried
+			if err := room.checkPassword(password); err != nil {
 				return nil, err
 			}
-			return existingRoom, nil
+			verified = room
+		case errors.Is(err, errRoomGone):
+			verified = nil // created anew, hashing the password first
+		default:
+			return room, err
 		}
 	}
+}
 
-	// Either joining: different room, first time, room expired -> create/join new
-	room, err := rm.createRoom(roomCode, rl.MaxRooms)
-	if err != nil {
-		return nil, err
+var (
+	// errUnverified: the room joinVerified found isn't the one the password was
+	// checked against
+	errUnverified = errors.New("room password not verified")
+	// errRoomGone: the verified room expired before joinVerified got to it
+	errRoomGone = errors.New("verified room gone")
+)
+
+// joinVerified: joins u to the room if it's verified (the password was checked
+// against it) or is created with passwordHash. Otherwise returns the room with
+// errUnverified, or errRoomGone if the verified room is no longer there, for
+// JoinRoom to do the slow part outside the lock and retry
+func (rm *Manager) joinVerified(roomCode string, verified *Room, passwordHash []byte, u *user.User, rl *middleware.RateLimit) (*Room, error) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.awaitRetired(roomCode)
+	if rl.StrictRooms && !rm.isIssued(roomCode) {
+		return nil, ErrUnknownRoom
 	}
 
-	if err := room.Join(u, rl.MaxRoomSize); err != nil {
-		return nil, err
+	room := rm.rooms[roomCode]
+	if room == nil {
+		if verified != nil {
+			return nil, errRoomGone
+		}
+		// Creates the room if it's new (or expired)
+		created, err := rm.createRoom(roomCode, passwordHash, rl.MaxRooms)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(created.passwordHash, passwordHash) {
+			return created, errUnverified // restored with a saved password
+		}
+		verified, room = created, created
+	}
+	if room != verified {
+		return room, errUnverified
 	}
 
+	if err := room.Join(u, rl.MaxRoomSize, rl.MaxSpectators); err != nil {
+		return nil, err
+	}
 	return room, nil
 }
 
 // Cleanup removes expired rooms
 func (rm *Manager) Cleanup() {
+	// Closing and saving happens once the lock is released
+	for _, finish := range rm.expire() {
+		finish()
+	}
+}
+
+// expire: retires expired rooms (see Cleanup), returns what's left to do for them
+func (rm *Manager) expire() []func() {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
 
 	now := time.Now()
+	var retired []func()
 
-	// Room removed if 1 hour empty or 24 hours old
+	// Empty rooms are removed past their expiry (see Lifetime), and with a store
+	// also after 1 hour without activity (saved, restored on the next join)
 	for code, room := range rm.rooms {
 		room.mu.RLock()
 		empty := len(room.Connections) == 0
 		inactive := now.Sub(room.LastActive) > 1*time.Hour
-		expired := now.Sub(room.CreatedAt) > 24*time.Hour
+		expiresAt := room.expiry()
 		room.mu.RUnlock()
 
-		if (inactive && empty) || expired {
-			delete(rm.rooms, code)
+		expired := empty && now.After(expiresAt)
+		if expired || (inactive && empty && rm.store != nil) {
+			retired = append(retired, rm.retire(room, expired))
+			if expired {
+				delete(rm.issued, code)
+			}
+			continue
+		}
+		if room.issued {
+			rm.issued[code] = expiresAt
+		}
+
+		room.PruneTombstones()
+	}
+	for code, expiresAt := range rm.issued {
+		if rm.rooms[code] == nil && now.After(expiresAt) {
+			delete(rm.issued, code)
 		}
 	}
+	metrics.ActiveRooms.Set(float64(len(rm.rooms)))
+	return retired
 }
 
-// GetRoom: checks if a room exists and returns it
+// GetRoom: checks if a room exists and returns it (any case of its code works,
+// see ValidateRoomCode)
 func (rm *Manager) GetRoom(roomCode string) (*Room, bool) {
+	roomCode, err := ValidateRoomCode(roomCode)
+	if err != nil {
+		return nil, false
+	}
+
 	rm.mu.RLock()
 	defer rm.mu.RUnlock()
 
@@ -117,6 +395,18 @@ func (rm *Manager) GetRoom(roomCode string) (*Room, bool) {
 	return room, exists
 }
 
+// Rooms: snapshot of all rooms
+func (rm *Manager) Rooms() []*Room {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	rooms := make([]*Room, 0, len(rm.rooms))
+	for _, room := range rm.rooms {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
 // GetRoomCount returns the total number of rooms
 func (rm *Manager) RoomCount() int {
 	rm.mu.RLock()
@@ -125,12 +415,22 @@ func (rm *Manager) RoomCount() int {
 	return len(rm.rooms)
 }
 
-func (rm *Manager) validateRoomCode(code string) error {
-    if len(code) < 3 || len(code) > 50 {
-        return fmt.Errorf("invalid room code length")
-    }
-    if !regexp.MustCompile(`^[a-zA-Z0-9-_]+$`).MatchString(code) {
-        return fmt.Errorf("invalid room code format")
-    }
-    return nil
+// ConnectionCount returns the total number of connections across all rooms
+// Counted from Summaries, joins and cleanup aren't held up meanwhile
+func (rm *Manager) ConnectionCount() int {
+	total := 0
+	for _, summary := range rm.Summaries() {
+		total += summary.Connections
+	}
+	return total
+}
+
+// ObjectCount returns the total number of drawings across all rooms
+// Counted from Summaries, like ConnectionCount
+func (rm *Manager) ObjectCount() int {
+	total := 0
+	for _, summary := range rm.Summaries() {
+		total += summary.Objects
+	}
+	return total
 }
@@ -0,0 +1,223 @@
+package room
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"main/internal/middleware"
+	"main/internal/user"
+)
+
+// blockingStore: a Store whose Delete waits for release, to hold a room
+// mid-retirement
+type blockingStore struct {
+	deleting chan string
+	release  chan struct{}
+
+	mu     sync.Mutex
+	boards map[string]*Board
+}
+
+func newBlockingStore() *blockingStore {
+	return &blockingStore{
+		deleting: make(chan string, 1),
+		release:  make(chan struct{}),
+		boards:   make(map[string]*Board),
+	}
+}
+
+func (s *blockingStore) Save(roomCode string, board *Board) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.boards[roomCode] = board
+	return nil
+}
+
+func (s *blockingStore) Load(roomCode string) (*Board, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.boards[roomCode], nil
+}
+
+func (s *blockingStore) Delete(roomCode string) error {
+	s.deleting <- roomCode
+	<-s.release
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.boards, roomCode)
+	return nil
+}
+
+func TestCloseRoomPersistsOutsideManagerLock(t *testing.T) {
+	store := newBlockingStore()
+	rm := NewManager(store)
+
+	closing, err := rm.CreateRoom(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rm.CreateRoom(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closed := make(chan error, 1)
+	go func() {
+		_, err := rm.CloseRoom(closing.Code)
+		closed <- err
+	}()
+	if code := <-store.deleting; code != closing.Code {
+		t.Fatalf("deleted %q, want %q", code, closing.Code)
+	}
+
+	// The store is stuck, lookups and new rooms must not wait for it
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, ok := rm.GetRoom(other.Code); !ok {
+			t.Error("other room not found while one is closing")
+		}
+		if _, ok := rm.GetRoom(closing.Code); ok {
+			t.Error("closing room still found")
+		}
+		if room, err := rm.CreateRoom(0, 10); err != nil {
+			t.Errorf("CreateRoom while one is closing: %v", err)
+		} else if room.Code == closing.Code {
+			t.Error("reissued the code of a room being closed")
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("manager blocked while a room was being closed")
+	}
+
+	close(store.release)
+	if err := <-closed; err != nil {
+		t.Fatalf("CloseRoom: %v", err)
+	}
+
+	rm.mu.RLock()
+	retiring := len(rm.retiring)
+	rm.mu.RUnlock()
+	if retiring != 0 {
+		t.Errorf("%d rooms still retiring after CloseRoom returned", retiring)
+	}
+}
+
+func TestAwaitRetiredWaitsForFinish(t *testing.T) {
+	rm := NewManager(nil)
+	room, err := rm.CreateRoom(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rm.mu.Lock()
+	finish := rm.retire(room, true)
+	rm.mu.Unlock()
+
+	waited := make(chan struct{})
+	go func() {
+		rm.mu.Lock()
+		rm.awaitRetired(room.Code)
+		rm.mu.Unlock()
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+		t.Fatal("awaitRetired returned before the room finished closing")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	finish()
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("awaitRetired still waiting after finish")
+	}
+}
+
+func TestFullServerEvictsOnlyShellRooms(t *testing.T) {
+	rm := NewManager(nil)
+	const maxRooms = 5
+	create := func(age time.Duration) *Room {
+		t.Helper()
+		r, err := rm.CreateRoom(0, maxRooms)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.mu.Lock()
+		r.CreatedAt = time.Now().Add(-age)
+		r.mu.Unlock()
+		return r
+	}
+
+	oldShell := create(time.Hour)
+	shell := create(10 * time.Minute)
+	newShell := create(time.Minute) // too young, might be about to be joined
+	drawn := create(2 * time.Hour)
+	if err := drawn.AddObject(drawing("s1", "alice")); err != nil {
+		t.Fatal(err)
+	}
+	occupied := create(2 * time.Hour)
+	occupied.mu.Lock()
+	occupied.Connections["alice"] = &user.User{ID: "alice"}
+	occupied.mu.Unlock()
+
+	for _, evicted := range []*Room{oldShell, shell} {
+		if _, err := rm.CreateRoom(0, maxRooms); err != nil {
+			t.Fatalf("CreateRoom at MaxRooms: %v", err)
+		}
+		if _, exists := rm.GetRoom(evicted.Code); exists {
+			t.Errorf("room %s not evicted", evicted.Code)
+		}
+	}
+	if _, err := rm.CreateRoom(0, maxRooms); !errors.Is(err, ErrServerFull) {
+		t.Fatalf("CreateRoom without shells left = %v, want ErrServerFull", err)
+	}
+	for _, kept := range []*Room{newShell, drawn, occupied} {
+		if _, exists := rm.GetRoom(kept.Code); !exists {
+			t.Errorf("room %s evicted", kept.Code)
+		}
+	}
+	if rm.EvictedCount() != 2 {
+		t.Errorf("evicted count = %d, want 2", rm.EvictedCount())
+	}
+}
+
+func TestJoinProtectedRoom(t *testing.T) {
+	store := newBlockingStore()
+	saved, err := hashPassword("saved")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.boards["RESTORED"] = &Board{Version: 1, CreatedAt: time.Now(), Pages: []Page{{ID: DefaultPageID, Name: "Page 1"}}, PasswordHash: saved}
+	rm := NewManager(store)
+	rl := middleware.NewRateLimit(10, 1000, 250000, 100, 5, 1000, 30, 60)
+	sessions := testSessions()
+
+	for i, tc := range []struct {
+		code, password string
+		want           error
+	}{
+		{"locked", "secret", nil}, // created with the password
+		{"locked", "wrong", ErrWrongPassword},
+		{"locked", "", ErrWrongPassword},
+		{"locked", "secret", nil},
+		{"open", "", nil},
+		{"restored", "secret", ErrWrongPassword}, // the saved password, not the new one
+		{"restored", "saved", nil},
+	} {
+		_, err := rm.JoinRoom(tc.code, tc.password, member(sessions, fmt.Sprintf("user%d", i), ""), rl)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("JoinRoom(%s, %q) = %v, want %v", tc.code, tc.password, err, tc.want)
+		}
+	}
+	if r, _ := rm.GetRoom("open"); r.Protected() {
+		t.Error("room created without a password is protected")
+	}
+}
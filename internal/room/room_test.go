@@ -0,0 +1,213 @@
+package room
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"main/internal/middleware"
+	"main/internal/object"
+	"main/internal/user"
+)
+
+// newTestRoom: an empty room in a manager without storage
+func newTestRoom(t testing.TB) *Room {
+	t.Helper()
+	rm, err := NewManager(nil).CreateRoom(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(rm.Close)
+	return rm
+}
+
+// drawing: a stroke owned by userID
+func drawing(id string, userID string) *object.Drawing {
+	return &object.Drawing{
+		ID:     id,
+		Type:   "stroke",
+		UserID: userID,
+		Data:   map[string]interface{}{"points": []interface{}{}},
+	}
+}
+
+func TestDeleteLeavesTombstone(t *testing.T) {
+	r := newTestRoom(t)
+	if err := r.AddObject(drawing("s1", "alice")); err != nil {
+		t.Fatal(err)
+	}
+	if r.IsDeleted("s1") {
+		t.Fatal("live drawing reported deleted")
+	}
+	if _, err := r.DeleteObject("s1", "alice", CapEraseOthers); err != nil {
+		t.Fatal(err)
+	}
+	if !r.IsDeleted("s1") {
+		t.Fatal("deleted drawing has no tombstone")
+	}
+
+	// Adding the ID again (revive) clears it
+	if err := r.AddObject(drawing("s1", "alice")); err != nil {
+		t.Fatal(err)
+	}
+	if r.IsDeleted("s1") {
+		t.Error("re-added drawing still tombstoned")
+	}
+}
+
+func TestTombstonesCappedOldestFirst(t *testing.T) {
+	r := newTestRoom(t)
+	r.mu.Lock()
+	for i := 0; i < maxTombstones; i++ {
+		r.addTombstone(fmt.Sprintf("old%d", i))
+		r.tombstones[fmt.Sprintf("old%d", i)] = time.Now().Add(-time.Duration(maxTombstones-i) * time.Millisecond)
+	}
+	r.addTombstone("new")
+	count := len(r.tombstones)
+	r.mu.Unlock()
+
+	if count != maxTombstones {
+		t.Errorf("%d tombstones, want the cap %d", count, maxTombstones)
+	}
+	if r.IsDeleted("old0") {
+		t.Error("oldest tombstone not evicted")
+	}
+	if !r.IsDeleted("old1") || !r.IsDeleted("new") {
+		t.Error("newer tombstones evicted")
+	}
+}
+
+func TestTombstonesExpire(t *testing.T) {
+	r := newTestRoom(t)
+	r.mu.Lock()
+	r.tombstones["stale"] = time.Now().Add(-tombstoneTTL - time.Second)
+	r.tombstones["fresh"] = time.Now()
+	r.mu.Unlock()
+
+	if r.IsDeleted("stale") {
+		t.Error("expired tombstone still counts")
+	}
+	r.PruneTombstones()
+
+	r.mu.RLock()
+	_, stale := r.tombstones["stale"]
+	_, fresh := r.tombstones["fresh"]
+	r.mu.RUnlock()
+	if stale || !fresh {
+		t.Errorf("after prune: stale kept %v, fresh kept %v, want only fresh", stale, fresh)
+	}
+}
+
+func TestTombstonesNotSaved(t *testing.T) {
+	r := newTestRoom(t)
+	for _, id := range []string{"kept", "gone"} {
+		if err := r.AddObject(drawing(id, "alice")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := r.DeleteObject("gone", "alice", CapEraseOthers); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := json.Marshal(r.snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(saved), "kept") {
+		t.Fatalf("snapshot is missing the live drawing: %s", saved)
+	}
+	if strings.Contains(string(saved), "gone") {
+		t.Errorf("snapshot mentions the deleted drawing: %s", saved)
+	}
+}
+
+// testSessions: a session manager with the default limits
+func testSessions() *user.SessionManager {
+	return user.NewSessionManager(middleware.NewRateLimit(10, 1000, 250000, 100, 5, 1000, 30, 60))
+}
+
+// member: a connection for userID whose session color is color
+func member(sessions *user.SessionManager, userID string, color string) *user.User {
+	return &user.User{ID: userID, Session: sessions.GetOrCreate(userID, color)}
+}
+
+func TestSessionColorSeedsRoomColor(t *testing.T) {
+	sessions := testSessions()
+	first, second := newTestRoom(t), newTestRoom(t)
+
+	alice := member(sessions, "alice", "#e6194b")
+	if err := first.Join(alice, 10, 10); err != nil {
+		t.Fatal(err)
+	}
+	if got := first.GetUserColor("alice"); got != "#e6194b" {
+		t.Errorf("color = %s, want the session color", got)
+	}
+
+	// Someone in the second room already has alice's session color
+	if err := second.Join(member(sessions, "bob", "#e6194b"), 10, 10); err != nil {
+		t.Fatal(err)
+	}
+	aliceThere := member(sessions, "alice", "")
+	if err := second.Join(aliceThere, 10, 10); err != nil {
+		t.Fatal(err)
+	}
+	if got := second.GetUserColor("alice"); got == "#e6194b" || got == "" {
+		t.Errorf("color in a room where it's taken = %q, want another one", got)
+	}
+}
+
+func TestRoomColorStableAcrossReconnects(t *testing.T) {
+	sessions := testSessions()
+	r := newTestRoom(t)
+
+	alice := member(sessions, "alice", "")
+	if err := r.Join(alice, 10, 10); err != nil {
+		t.Fatal(err)
+	}
+	r.ConfirmJoin("alice")
+	color := r.GetUserColor("alice")
+	r.Leave(alice)
+
+	// Meanwhile bob joins, the generator moves on
+	if err := r.Join(member(sessions, "bob", ""), 10, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Join(member(sessions, "alice", ""), 10, 10); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.GetUserColor("alice"); got != color {
+		t.Errorf("color after reconnect = %s, want %s", got, color)
+	}
+}
+
+func TestAbortJoinFreesProvisionalColor(t *testing.T) {
+	sessions := testSessions()
+	r := newTestRoom(t)
+
+	alice := member(sessions, "alice", "")
+	if err := r.Join(alice, 10, 10); err != nil {
+		t.Fatal(err)
+	}
+	r.AbortJoin(alice)
+	if r.ConnectionCount() != 0 || r.GetUserColor("alice") != "" {
+		t.Fatalf("after abort: %d connections, color %q, want none", r.ConnectionCount(), r.GetUserColor("alice"))
+	}
+
+	// A color from an earlier, completed join is kept
+	if err := r.Join(alice, 10, 10); err != nil {
+		t.Fatal(err)
+	}
+	r.ConfirmJoin("alice")
+	color := r.GetUserColor("alice")
+	r.Leave(alice)
+	again := member(sessions, "alice", "")
+	if err := r.Join(again, 10, 10); err != nil {
+		t.Fatal(err)
+	}
+	r.AbortJoin(again)
+	if got := r.GetUserColor("alice"); got != color {
+		t.Errorf("color after aborted rejoin = %q, want %s", got, color)
+	}
+}
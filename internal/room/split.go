@@ -0,0 +1,79 @@
+package room
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"main/internal/object"
+)
+
+var (
+	// ErrReplacedMissing: the drawing to replace was deleted meanwhile
+	ErrReplacedMissing = errors.New("object not found")
+	// ErrReplaceLimit: the replacements would take the room over its object limit
+	ErrReplaceLimit = errors.New("room at maximum object capacity")
+)
+
+// ReplaceObject: swaps drawing id for replacements as one change (an eraser
+// splitting a stroke), nobody sees the board without both. Replacements keep
+// the original's author, and its page and zIndex unless they set their own.
+// Fails without changing anything if the drawing is gone or locked by someone
+// other than userID, a replacement ID is taken by another drawing or names an
+// unknown page, or the room would end up with more than maxObjects drawings
+func (r *Room) ReplaceObject(id string, replacements []*object.Drawing, hasZIndex []bool, userID string, maxObjects int) (*object.Drawing, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	original, exists := r.Objects[id]
+	if !exists {
+		return nil, ErrReplacedMissing
+	}
+	now := time.Now()
+	if held, locked := r.locks[id]; locked && held.userID != userID && now.Before(held.expires) {
+		return nil, ErrObjectLocked
+	}
+	if len(r.Objects)-1+len(replacements) > maxObjects {
+		return nil, ErrReplaceLimit
+	}
+	for i, obj := range replacements {
+		if _, taken := r.Objects[obj.ID]; taken && obj.ID != id {
+			return nil, fmt.Errorf("object id already in use: %s", obj.ID)
+		}
+		if obj.PageID == "" {
+			obj.PageID = original.PageID
+		}
+		if err := r.resolvePage(obj); err != nil {
+			return nil, err
+		}
+		if !hasZIndex[i] {
+			obj.ZIndex = original.ZIndex
+		}
+	}
+
+	r.untrackObject(original)
+	delete(r.Objects, id)
+	delete(r.locks, id)
+
+	ids := []string{id}
+	reused := false
+	for _, obj := range replacements {
+		obj.UserID = original.UserID
+		obj.CreatedAt = now
+		obj.UpdatedAt = now
+		r.trackObject(obj)
+		r.keepObject(obj)
+		delete(r.tombstones, obj.ID)
+		if obj.ID == id {
+			reused = true
+		} else {
+			ids = append(ids, obj.ID)
+		}
+	}
+	if !reused {
+		r.addTombstone(id)
+	}
+	r.LastActive = now
+	r.changed(ids...)
+	return original, nil
+}
@@ -0,0 +1,269 @@
+package room
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"main/internal/logging"
+	"main/internal/object"
+)
+
+// Board: persisted room state (same shape as the importObjects board format)
+type Board struct {
+	Version   int               `json:"version"`
+	CreatedAt time.Time         `json:"createdAt"`
+	Pages     []Page            `json:"pages"`
+	Objects   []*object.Drawing `json:"objects"`
+
+	// Only set when saving to the store, never exported or synced
+	PasswordHash []byte    `json:"passwordHash,omitempty"`
+	ExpiresAt    time.Time `json:"expiresAt,omitempty"`  // issued rooms only (see CreateRoom)
+	TTLSeconds   int64     `json:"ttlSeconds,omitempty"` // issued rooms' idle lifetime
+	LastActive   time.Time `json:"lastActive,omitempty"`
+	PinnedUntil  time.Time `json:"pinnedUntil,omitempty"` // see ExtendRoom
+}
+
+// Store: persistence for room boards, Load returns (nil, nil) for unknown rooms
+type Store interface {
+	Save(roomCode string, board *Board) error
+	Load(roomCode string) (*Board, error)
+	Delete(roomCode string) error
+}
+
+// FileStore: one JSON file per room in dir
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore: creates dir if needed, and renames boards saved under a room
+// code that isn't canonical (see ValidateRoomCode)
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create data directory: %w", err)
+	}
+	fs := &FileStore{dir: dir}
+	if err := fs.canonicalize(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// canonicalize: renames boards saved before room codes were case-insensitive
+// to their canonical code. A board whose canonical name is already taken (the
+// same code in another case) is left as it was, and logged
+func (fs *FileStore) canonicalize() error {
+	entries, err := os.ReadDir(fs.dir)
+	if err != nil {
+		return fmt.Errorf("read data directory: %w", err)
+	}
+	for _, entry := range entries {
+		saved, isBoard := strings.CutSuffix(entry.Name(), ".json")
+		if !isBoard || entry.IsDir() {
+			continue
+		}
+		code, err := ValidateRoomCode(saved)
+		if err != nil || code == saved {
+			continue
+		}
+		if _, err := os.Stat(fs.path(code)); err == nil {
+			slog.Warn("Saved room not renamed, the canonical code is also saved", "saved", saved, logging.KeyRoom, code)
+			continue
+		}
+		if err := os.Rename(fs.path(saved), fs.path(code)); err != nil {
+			return fmt.Errorf("rename saved room %s: %w", saved, err)
+		}
+		slog.Info("Renamed saved room", "saved", saved, logging.KeyRoom, code)
+	}
+	return nil
+}
+
+// path: room codes are validated to [A-Za-z0-9_-] (see ValidateRoomCode) before any room exists
+func (fs *FileStore) path(roomCode string) string {
+	return filepath.Join(fs.dir, roomCode+".json")
+}
+
+// Save: writes to a temp file and renames, so a crash never leaves half a board
+func (fs *FileStore) Save(roomCode string, board *Board) error {
+	encoded, err := json.Marshal(board)
+	if err != nil {
+		return fmt.Errorf("marshal board: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(fs.dir, roomCode+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	if _, err := tmp.Write(encoded); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write board: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write board: %w", err)
+	}
+	return os.Rename(tmp.Name(), fs.path(roomCode))
+}
+
+// Load: reads a saved board, (nil, nil) if the room was never saved
+func (fs *FileStore) Load(roomCode string) (*Board, error) {
+	encoded, err := os.ReadFile(fs.path(roomCode))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read board: %w", err)
+	}
+
+	var board Board
+	if err := json.Unmarshal(encoded, &board); err != nil {
+		return nil, fmt.Errorf("parse board: %w", err)
+	}
+	if board.Version != object.BoardFormatVersion {
+		return nil, fmt.Errorf("unsupported board version %d", board.Version)
+	}
+	return &board, nil
+}
+
+// Delete: removes a saved board (missing is fine)
+func (fs *FileStore) Delete(roomCode string) error {
+	err := os.Remove(fs.path(roomCode))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// snapshot: board for saving if the room changed since the last save
+// In-progress (provisional) drawings are left out. Clears the dirty flag
+func (r *Room) snapshot() *Board {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.dirty {
+		return nil
+	}
+	r.dirty = false
+	board := r.board()
+	board.PasswordHash = r.passwordHash
+	board.LastActive = r.LastActive
+	board.PinnedUntil = r.pinnedUntil
+	if r.issued {
+		board.ExpiresAt = r.expiry()
+		board.TTLSeconds = int64(r.lifetime.Idle / time.Second)
+	}
+	return board
+}
+
+// Export: copy of the room's board for download, in-progress drawings left out
+// Objects are ordered by zIndex (ties by ID) so repeated exports are stable
+func (r *Room) Export() *Board {
+	r.mu.RLock()
+	board := r.board()
+	r.mu.RUnlock()
+
+	// Sorting happens outside the lock, drawings are copies
+	sort.Slice(board.Objects, func(i, j int) bool {
+		a, b := board.Objects[i], board.Objects[j]
+		if a.ZIndex != b.ZIndex {
+			return a.ZIndex < b.ZIndex
+		}
+		return a.ID < b.ID
+	})
+	return board
+}
+
+// board: copy of pages and finalized drawings (Data maps are shared, they're
+// replaced on update, never modified in place)
+// caller must hold lock
+func (r *Room) board() *Board {
+	board := &Board{
+		Version:   object.BoardFormatVersion,
+		CreatedAt: r.CreatedAt,
+		Pages:     make([]Page, len(r.Pages)),
+		Objects:   make([]*object.Drawing, 0, len(r.Objects)),
+	}
+	copy(board.Pages, r.Pages)
+	for _, obj := range r.Objects {
+		if obj.Provisional {
+			continue
+		}
+		saved := *obj
+		board.Objects = append(board.Objects, &saved)
+	}
+	return board
+}
+
+// restore: loads a saved board into a new room
+// caller must hold write lock (or own the room exclusively)
+func (r *Room) restore(board *Board) {
+	if len(board.Pages) > 0 {
+		r.Pages = board.Pages
+	}
+	if !board.CreatedAt.IsZero() {
+		r.CreatedAt = board.CreatedAt
+	}
+	if board.PasswordHash != nil {
+		r.passwordHash = board.PasswordHash
+	}
+	if !board.LastActive.IsZero() {
+		r.LastActive = board.LastActive
+	}
+	r.pinnedUntil = board.PinnedUntil
+	if !board.ExpiresAt.IsZero() {
+		r.issued = true
+	}
+	if board.TTLSeconds > 0 {
+		r.lifetime.Idle = time.Duration(board.TTLSeconds) * time.Second
+	}
+	for _, obj := range board.Objects {
+		if r.pageIndex(obj.PageID) == -1 {
+			obj.PageID = r.Pages[0].ID
+		}
+		r.Objects[obj.ID] = obj
+	}
+}
+
+// changed: records a content change touching objectIDs (none for page-only
+// changes), saved on the next flush
+// caller must hold write lock
+func (r *Room) changed(objectIDs ...string) {
+	r.dirty = true
+	r.revision++
+	r.recordChange(objectIDs, false)
+	r.objectsMetric.Set(float64(len(r.Objects)))
+}
+
+// changedAll: records a change to the whole board (cleared, restored), clients
+// reconnecting across it get a full sync
+// caller must hold write lock
+func (r *Room) changedAll() {
+	r.zOrder.known = false // the board was replaced
+	r.dirty = true
+	r.revision++
+	r.recordChange(nil, true)
+	r.objectsMetric.Set(float64(len(r.Objects)))
+}
+
+// Revision: content version, changes whenever objects or pages do
+func (r *Room) Revision() uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.revision
+}
+
+// markDirty: forces the next flush to save (e.g. after a failed save)
+func (r *Room) markDirty() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.dirty = true
+}
@@ -0,0 +1,85 @@
+package room
+
+import (
+	"fmt"
+
+	"main/internal/user"
+)
+
+// Category: kind of broadcast, tagged where the broadcast is emitted so
+// filtering per recipient is a bitmask check (see user.Subscription)
+type Category uint32
+
+const (
+	CategoryObject   Category = 1 << iota // drawings added, changed or deleted
+	CategoryCursor                        // cursor moves
+	CategoryPresence                      // users joining and leaving
+	CategoryRoom                          // pages, settings, timers, notices
+	CategorySystem                        // shutdown, board freeze: never filtered
+)
+
+// maxSubscriptionPageID: longest pageId accepted in a subscription
+const maxSubscriptionPageID = 64
+
+// Tag: what a broadcast is about
+type Tag struct {
+	Category Category
+	PageID   string // page the event belongs to, "" if not page specific
+}
+
+// Tags for broadcasts that aren't page specific
+var (
+	TagObject   = Tag{Category: CategoryObject}
+	TagPresence = Tag{Category: CategoryPresence}
+	TagRoom     = Tag{Category: CategoryRoom}
+	TagSystem   = Tag{Category: CategorySystem}
+)
+
+// ObjectTag: tag for a change to a drawing on pageID
+func ObjectTag(pageID string) Tag {
+	return Tag{Category: CategoryObject, PageID: pageID}
+}
+
+// wantedBy: true if a recipient with sub should get the broadcast
+func (t Tag) wantedBy(sub user.Subscription) bool {
+	if t.Category == CategorySystem {
+		return true
+	}
+	if uint32(t.Category)&sub.Muted != 0 {
+		return false
+	}
+	return sub.PageID == "" || t.PageID == "" || t.PageID == sub.PageID
+}
+
+// ParseSubscription: filters as sent by clients, every field optional
+// {"cursors": false} no cursor moves, {"objectsOnly": true} only drawing changes,
+// {"pageId": "..."} only page specific events for that page. Sync is never filtered
+func ParseSubscription(raw map[string]interface{}) (user.Subscription, error) {
+	var sub user.Subscription
+	if value, ok := raw["cursors"]; ok {
+		cursors, ok := value.(bool)
+		if !ok {
+			return sub, fmt.Errorf("cursors must be a boolean")
+		}
+		if !cursors {
+			sub.Muted |= uint32(CategoryCursor)
+		}
+	}
+	if value, ok := raw["objectsOnly"]; ok {
+		objectsOnly, ok := value.(bool)
+		if !ok {
+			return sub, fmt.Errorf("objectsOnly must be a boolean")
+		}
+		if objectsOnly {
+			sub.Muted |= uint32(CategoryCursor | CategoryPresence | CategoryRoom)
+		}
+	}
+	if value, ok := raw["pageId"]; ok {
+		pageID, ok := value.(string)
+		if !ok || len(pageID) > maxSubscriptionPageID {
+			return sub, fmt.Errorf("pageId must be a string of at most %d characters", maxSubscriptionPageID)
+		}
+		sub.PageID = pageID
+	}
+	return sub, nil
+}
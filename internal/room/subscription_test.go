@@ -0,0 +1,66 @@
+package room
+
+import (
+	"strings"
+	"testing"
+
+	"main/internal/user"
+)
+
+func TestParseSubscription(t *testing.T) {
+	for _, tc := range []struct {
+		raw  map[string]interface{}
+		want user.Subscription
+	}{
+		{nil, user.Subscription{}},
+		{map[string]interface{}{"cursors": true}, user.Subscription{}},
+		{map[string]interface{}{"cursors": false}, user.Subscription{Muted: uint32(CategoryCursor)}},
+		{map[string]interface{}{"objectsOnly": true}, user.Subscription{Muted: uint32(CategoryCursor | CategoryPresence | CategoryRoom)}},
+		{map[string]interface{}{"objectsOnly": false, "pageId": "p2"}, user.Subscription{PageID: "p2"}},
+	} {
+		got, err := ParseSubscription(tc.raw)
+		if err != nil || got != tc.want {
+			t.Errorf("%v = %+v, %v, want %+v", tc.raw, got, err, tc.want)
+		}
+	}
+
+	for _, raw := range []map[string]interface{}{
+		{"cursors": "no"},
+		{"objectsOnly": 1},
+		{"pageId": 7},
+		{"pageId": strings.Repeat("p", maxSubscriptionPageID+1)},
+	} {
+		if _, err := ParseSubscription(raw); err == nil {
+			t.Errorf("%v accepted", raw)
+		}
+	}
+}
+
+func TestTagWantedBy(t *testing.T) {
+	noCursors := user.Subscription{Muted: uint32(CategoryCursor)}
+	objectsOnly := user.Subscription{Muted: uint32(CategoryCursor | CategoryPresence | CategoryRoom)}
+	pageTwo := user.Subscription{PageID: "p2"}
+
+	for _, tc := range []struct {
+		name string
+		tag  Tag
+		sub  user.Subscription
+		want bool
+	}{
+		{"everything", Tag{Category: CategoryCursor, PageID: "p1"}, user.Subscription{}, true},
+		{"cursor muted", Tag{Category: CategoryCursor, PageID: "p1"}, noCursors, false},
+		{"object with cursors muted", ObjectTag("p1"), noCursors, true},
+		{"presence objects only", TagPresence, objectsOnly, false},
+		{"room objects only", TagRoom, objectsOnly, false},
+		{"object objects only", ObjectTag("p1"), objectsOnly, true},
+		{"system objects only", TagSystem, objectsOnly, true},
+		{"other page", ObjectTag("p1"), pageTwo, false},
+		{"same page", ObjectTag("p2"), pageTwo, true},
+		{"not page specific", TagRoom, pageTwo, true},
+		{"system other page", Tag{Category: CategorySystem, PageID: "p1"}, pageTwo, true},
+	} {
+		if got := tc.tag.wantedBy(tc.sub); got != tc.want {
+			t.Errorf("%s: wantedBy = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
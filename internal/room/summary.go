@@ -0,0 +1,100 @@
+package room
+
+import (
+	"sort"
+	"time"
+)
+
+// RoomSummary: copy of a room's listing fields, safe to read without any lock
+type RoomSummary struct {
+	Code        string    `json:"code"`
+	Connections int       `json:"connections"`
+	Objects     int       `json:"objects"`
+	Pages       int       `json:"pages"`
+	Protected   bool      `json:"protected"`
+	TimerActive bool      `json:"timerActive"`
+	Frozen      bool      `json:"frozen"`
+	Locale      string    `json:"locale,omitempty"`
+	LastActive  time.Time `json:"lastActive"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	Issued      bool      `json:"issued"` // code from POST /rooms
+}
+
+// Summary: the room's summary, false if it was closed (cleaned up or evicted)
+// since the caller got hold of it
+func (r *Room) Summary() (RoomSummary, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.ctx.Err() != nil {
+		return RoomSummary{}, false
+	}
+	return RoomSummary{
+		Code:        r.Code,
+		Connections: len(r.Connections),
+		Objects:     len(r.Objects),
+		Pages:       len(r.Pages),
+		Protected:   r.passwordHash != nil,
+		TimerActive: r.timer != nil,
+		Frozen:      r.frozen,
+		Locale:      r.locale,
+		LastActive:  r.LastActive,
+		CreatedAt:   r.CreatedAt,
+		ExpiresAt:   r.expiry(),
+		Issued:      r.issued,
+	}, true
+}
+
+// ConnectionDetail: a connection as operators see it (admin API), with its IP
+type ConnectionDetail struct {
+	UserID      string    `json:"userId"`
+	Name        string    `json:"name,omitempty"`
+	Color       string    `json:"color"`
+	Spectator   bool      `json:"spectator"`
+	ClientIP    string    `json:"clientIp"`
+	UserAgent   string    `json:"userAgent"`
+	ConnectedAt time.Time `json:"connectedAt"`
+}
+
+// ConnectionDetails: everyone connected to the room, longest connected first
+func (r *Room) ConnectionDetails() []ConnectionDetail {
+	r.mu.RLock()
+	details := make([]ConnectionDetail, 0, len(r.Connections))
+	for userID, conn := range r.Connections {
+		details = append(details, ConnectionDetail{
+			UserID:      userID,
+			Name:        r.names[userID],
+			Color:       r.UserColors[userID],
+			Spectator:   conn.Spectator,
+			ClientIP:    conn.Info.ClientIP,
+			UserAgent:   conn.Info.UserAgent,
+			ConnectedAt: conn.Info.ConnectedAt,
+		})
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(details, func(i, j int) bool {
+		if !details[i].ConnectedAt.Equal(details[j].ConnectedAt) {
+			return details[i].ConnectedAt.Before(details[j].ConnectedAt)
+		}
+		return details[i].UserID < details[j].UserID
+	})
+	return details
+}
+
+// Summaries: every live room's summary, for admin listings and stats
+// The manager lock is only held to collect the rooms and each room is then
+// locked briefly on its own, so joins and cleanup aren't stalled. Rooms removed
+// meanwhile are left out
+func (rm *Manager) Summaries() []RoomSummary {
+	rooms := rm.Rooms()
+
+	summaries := make([]RoomSummary, 0, len(rooms))
+	for _, room := range rooms {
+		if summary, live := room.Summary(); live {
+			summaries = append(summaries, summary)
+		}
+	}
+	return summaries
+}
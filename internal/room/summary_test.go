@@ -0,0 +1,96 @@
+package room
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSummarySkipsClosedRooms(t *testing.T) {
+	rm := NewManager(nil)
+	kept, err := rm.CreateRoom(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed, err := rm.CreateRoom(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kept.AddObject(drawing("s1", "alice")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rm.CloseRoom(closed.Code); err != nil {
+		t.Fatal(err)
+	}
+
+	// a listing holding the pointer from before the close
+	if _, live := closed.Summary(); live {
+		t.Error("closed room still summarised")
+	}
+	summaries := rm.Summaries()
+	if len(summaries) != 1 || summaries[0].Code != kept.Code || summaries[0].Objects != 1 {
+		t.Errorf("summaries = %+v, want only %s with its drawing", summaries, kept.Code)
+	}
+}
+
+// TestSummariesDuringChurn: run with -race, listings while rooms are created,
+// joined, drawn into, cleaned up and closed
+func TestSummariesDuringChurn(t *testing.T) {
+	rm := NewManager(nil)
+	rm.SetLifetime(Lifetime{Idle: time.Nanosecond}) // empty rooms go on the next Cleanup
+	sessions := testSessions()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				r, err := rm.CreateRoom(0, 1000)
+				if err != nil {
+					continue
+				}
+				u := member(sessions, fmt.Sprintf("u%d-%d", w, i), "")
+				if r.Join(u, 10, 10) == nil {
+					r.AddObject(drawing(fmt.Sprintf("s%d", i), u.ID))
+					r.Leave(u)
+				}
+				if i%3 == 0 {
+					rm.CloseRoom(r.Code)
+				}
+			}
+		}(w)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				rm.Cleanup()
+			}
+		}
+	}()
+
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for listings := 0; time.Now().Before(deadline) || listings < 100; listings++ {
+		for _, summary := range rm.Summaries() {
+			if summary.Code == "" || summary.Connections < 0 || summary.Objects > 1 {
+				t.Fatalf("torn summary %+v", summary)
+			}
+		}
+		rm.ConnectionCount()
+		rm.ObjectCount()
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -3,45 +3,164 @@ package room
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
 
+	"main/internal/logging"
+	"main/internal/object"
 	"main/internal/user"
 
 	"github.com/gorilla/websocket"
 )
 
+// DefaultMaxSyncSize: single sync message size above which sync is chunked
+// (some browsers/proxies drop WebSocket messages around 1MB)
+const DefaultMaxSyncSize = 512 * 1024
+
 // Synchronizer: handles synchronizing room state to new users
-type Synchronizer struct{}
+type Synchronizer struct {
+	maxSyncSize int
+	cache       *syncCache // serialized objects of unchanged rooms, reused across joins
+}
+
+// NewSynchronizer: creates new synchronizer, syncs larger than maxSyncSize bytes are chunked
+func NewSynchronizer(maxSyncSize int) *Synchronizer {
+	if maxSyncSize <= 0 {
+		maxSyncSize = DefaultMaxSyncSize
+	}
+	return &Synchronizer{
+		maxSyncSize: maxSyncSize,
+		cache:       newSyncCache(DefaultSyncCacheBytes),
+	}
+}
+
+// SetCacheBytes: memory for serialized objects reused by joins to rooms that
+// haven't changed since the last sync (shared by all rooms), 0 disables it
+func (s *Synchronizer) SetCacheBytes(maxBytes int) {
+	s.cache.setMaxBytes(maxBytes)
+}
 
-// NewSynchronizer: creates new synchronizer
-func NewSynchronizer() *Synchronizer {
-	return &Synchronizer{}
+// SyncUser: sends a joining user what changed since from (syncDelta) when the
+// room can tell exactly, otherwise the full state (sync). from is nil for
+// clients that have no state yet
+func (s *Synchronizer) SyncUser(rm *Room, u *user.User, from *ResumePoint) error {
+	if from != nil {
+		sent, err := s.syncDelta(rm, u, *from)
+		if sent || err != nil {
+			return err
+		}
+	}
+	return s.SyncNewUser(rm, u)
 }
 
-// SyncNewUser sends the current room state (all objects) to a newly joined user
+// syncDelta: sends the objects changed since from (current state, or their ID
+// under "deleted") with the pages and users. Returns false without sending if
+// the change log can't cover from or the delta is too big for one message
+func (s *Synchronizer) syncDelta(rm *Room, u *user.User, from ResumePoint) (bool, error) {
+	rm.mu.RLock()
+	ids, known := rm.changedSince(from)
+	if !known {
+		rm.mu.RUnlock()
+		return false, nil
+	}
+	objects := make([]map[string]interface{}, 0, len(ids))
+	deleted := make([]string, 0)
+	for _, id := range ids {
+		if obj, exists := rm.Objects[id]; exists {
+			objects = append(objects, syncEntry(obj))
+		} else {
+			deleted = append(deleted, id)
+		}
+	}
+	pages := make([]Page, len(rm.Pages))
+	copy(pages, rm.Pages)
+	users := rm.presence()
+	chat := rm.chatHistory()
+	revision := rm.revision
+	rm.mu.RUnlock()
+
+	msgBytes, err := json.Marshal(map[string]interface{}{
+		"type":         "syncDelta",
+		"epoch":        rm.epoch,
+		"revision":     revision,
+		"fromRevision": from.Revision,
+		"pages":        pages,
+		"users":        users,
+		"objects":      objects,
+		"deleted":      deleted,
+		"chat":         chat,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal sync delta: %w", err)
+	}
+	if len(msgBytes) > s.maxSyncSize {
+		return false, nil // a (chunked) full sync instead
+	}
+
+	if err := u.WriteMessage(websocket.TextMessage, msgBytes); err != nil {
+		return false, fmt.Errorf("failed to send sync delta: %w", err)
+	}
+	return true, nil
+}
+
+// SyncNewUser sends the current room state (all objects) to a newly joined user.
+// Objects are serialized once per room revision, later joins reuse the bytes
 func (s *Synchronizer) SyncNewUser(rm *Room, u *user.User) error {
 	rm.mu.RLock()
-	// Build list of objects to sync
-	objects := make([]map[string]interface{}, 0, len(rm.Objects))
-	for _, obj := range rm.Objects {
-		objects = append(objects, map[string]interface{}{
-			"id":     obj.ID,
-			"type":   obj.Type,
-			"data":   obj.Data,
-			"userId": obj.UserID,
-			"zIndex": obj.ZIndex,
-		})
+	revision := rm.revision
+	key := syncCacheKey{epoch: rm.epoch, variant: syncWhole}
+	cached, hit := s.cache.get(key, revision)
+	var objects []map[string]interface{}
+	if !hit {
+		// Build list of objects to sync, grouped by page (in page order)
+		objects = make([]map[string]interface{}, 0, len(rm.Objects))
+		for _, page := range rm.Pages {
+			for _, obj := range rm.Objects {
+				if obj.PageID != page.ID {
+					continue
+				}
+				objects = append(objects, syncEntry(obj))
+			}
+		}
 	}
+	pages := make([]Page, len(rm.Pages))
+	copy(pages, rm.Pages)
+	users := rm.presence()
+	chat := rm.chatHistory()
 	rm.mu.RUnlock()
 
+	var encoded json.RawMessage
+	if hit {
+		encoded = cached[0]
+	} else {
+		var err error
+		if encoded, err = json.Marshal(objects); err != nil {
+			return fmt.Errorf("failed to marshal sync objects: %w", err)
+		}
+		s.cache.put(key, revision, []json.RawMessage{encoded})
+	}
+
+	// epoch and revision let the client resume with a delta after reconnecting
+	// chat is the recent history, so late joiners see the conversation
 	syncMsg := map[string]interface{}{
-		"type":    "sync",
-		"objects": objects,
+		"type":     "sync",
+		"epoch":    rm.epoch,
+		"revision": revision,
+		"pages":    pages,
+		"users":    users,
+		"chat":     chat,
 	}
 
-	msgBytes, err := json.Marshal(syncMsg)
+	envelope, err := json.Marshal(syncMsg)
 	if err != nil {
 		return fmt.Errorf("failed to marshal sync message: %w", err)
 	}
+	msgBytes := withObjects(envelope, encoded)
+	rm.lastSyncSize.Store(int64(len(msgBytes)))
+
+	if len(msgBytes) > s.maxSyncSize {
+		slog.Debug("Sync sent in chunks", logging.KeyRoom, rm.Code, "bytes", len(msgBytes))
+		return s.syncChunked(u, syncMsg, revision, encoded)
+	}
 
 	if err := u.WriteMessage(websocket.TextMessage, msgBytes); err != nil {
 		return fmt.Errorf("failed to send sync message: %w", err)
@@ -49,3 +168,98 @@ func (s *Synchronizer) SyncNewUser(rm *Room, u *user.User) error {
 
 	return nil
 }
+
+// syncChunked: sends syncMsg with no objects (and the chunk count) then objects
+// in syncChunk messages each at most maxSyncSize bytes (unless a single object is larger)
+func (s *Synchronizer) syncChunked(u *user.User, syncMsg map[string]interface{}, revision uint64, objects json.RawMessage) error {
+	key := syncCacheKey{epoch: syncMsg["epoch"].(string), variant: syncChunks}
+	chunks, hit := s.cache.get(key, revision)
+	if !hit {
+		var err error
+		if chunks, err = s.chunkObjects(objects); err != nil {
+			return err
+		}
+		s.cache.put(key, revision, chunks)
+	}
+
+	header := make(map[string]interface{}, len(syncMsg)+2)
+	for k, v := range syncMsg {
+		header[k] = v
+	}
+	header["objects"] = []interface{}{}
+	header["chunks"] = len(chunks)
+	if err := writeJSON(u, header); err != nil {
+		return fmt.Errorf("failed to send sync message: %w", err)
+	}
+
+	for i, chunk := range chunks {
+		envelope, err := json.Marshal(map[string]interface{}{
+			"type":   "syncChunk",
+			"chunk":  i,
+			"chunks": len(chunks),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal sync chunk %d: %w", i, err)
+		}
+		if err := u.WriteMessage(websocket.TextMessage, withObjects(envelope, chunk)); err != nil {
+			return fmt.Errorf("failed to send sync chunk %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// chunkObjects: splits a serialized object array into arrays of at most
+// maxSyncSize bytes (less envelope overhead), a larger object gets its own
+func (s *Synchronizer) chunkObjects(objects json.RawMessage) ([]json.RawMessage, error) {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(objects, &entries); err != nil {
+		return nil, fmt.Errorf("failed to split sync objects: %w", err)
+	}
+
+	var chunks []json.RawMessage
+	budget := s.maxSyncSize - 256 // envelope overhead
+	current := []byte{'['}
+	for _, entry := range entries {
+		if len(current) > 1 && len(current)+len(entry)+1 > budget {
+			chunks = append(chunks, append(current, ']'))
+			current = []byte{'['}
+		}
+		if len(current) > 1 {
+			current = append(current, ',')
+		}
+		current = append(current, entry...)
+	}
+	if len(current) > 1 {
+		chunks = append(chunks, append(current, ']'))
+	}
+	return chunks, nil
+}
+
+// syncEntry: an object as sent in sync messages
+// caller must hold lock
+func syncEntry(obj *object.Drawing) map[string]interface{} {
+	entry := map[string]interface{}{
+		"id":     obj.ID,
+		"type":   obj.Type,
+		"data":   obj.Data,
+		"userId": obj.UserID,
+		"zIndex": obj.ZIndex,
+		"pageId": obj.PageID,
+	}
+	if obj.Provisional {
+		entry["provisional"] = true
+	}
+	if obj.Origin != nil {
+		entry["origin"] = obj.Origin
+	}
+	return entry
+}
+
+// writeJSON: marshals and writes a message to the user
+func writeJSON(u *user.User, payload map[string]interface{}) error {
+	msg, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return u.WriteMessage(websocket.TextMessage, msg)
+}
@@ -0,0 +1,156 @@
+package room
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+)
+
+// received: a message read by the client end of a connectedUser, with its size
+type received struct {
+	size int
+	data map[string]interface{}
+}
+
+// connectedUser: a user with a live websocket connection, and the messages
+// the client end receives
+func connectedUser(t *testing.T, id string) (*user.User, <-chan received) {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetReadLimit(-1)
+	u := user.NewUser(<-conns, user.ConnectionInfo{})
+	u.ID = id
+	t.Cleanup(func() {
+		u.StopWriter()
+		client.Close()
+		u.Connection.Close()
+	})
+
+	messages := make(chan received, 1024)
+	go func() {
+		defer close(messages)
+		for {
+			_, msg, err := client.ReadMessage()
+			if err != nil {
+				return
+			}
+			var data map[string]interface{}
+			if json.Unmarshal(msg, &data) == nil {
+				messages <- received{size: len(msg), data: data}
+			}
+		}
+	}()
+	return u, messages
+}
+
+// nextMessage: the next message from a connectedUser's client end
+func nextMessage(t *testing.T, messages <-chan received) received {
+	t.Helper()
+	select {
+	case msg, ok := <-messages:
+		if !ok {
+			t.Fatal("connection closed")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+	return received{}
+}
+
+// fillRoom: adds n strokes of about size bytes each
+func fillRoom(t testing.TB, r *Room, n int, size int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		obj := drawing(fmt.Sprintf("s%d", i), "alice")
+		obj.Data["label"] = strings.Repeat("x", size)
+		if err := r.AddObject(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLargeSyncIsChunked(t *testing.T) {
+	r := newTestRoom(t)
+	fillRoom(t, r, 200, 10*1024) // about 2MB
+	s := NewSynchronizer(DefaultMaxSyncSize)
+	u, messages := connectedUser(t, "bob")
+
+	if err := s.SyncNewUser(r, u); err != nil {
+		t.Fatal(err)
+	}
+
+	header := nextMessage(t, messages)
+	if header.data["type"] != "sync" {
+		t.Fatalf("first message = %v, want sync", header.data["type"])
+	}
+	chunks, _ := header.data["chunks"].(float64)
+	if chunks < 4 {
+		t.Fatalf("sync announced %v chunks, want a 2MB room split in at least 4", header.data["chunks"])
+	}
+	if objects := header.data["objects"].([]interface{}); len(objects) != 0 {
+		t.Errorf("chunked sync header carries %d objects", len(objects))
+	}
+
+	ids := make(map[string]bool)
+	for i := 0; i < int(chunks); i++ {
+		chunk := nextMessage(t, messages)
+		if chunk.data["type"] != "syncChunk" || chunk.data["chunk"] != float64(i) {
+			t.Fatalf("message %d = %v chunk %v, want syncChunk %d", i+1, chunk.data["type"], chunk.data["chunk"], i)
+		}
+		if chunk.size > DefaultMaxSyncSize {
+			t.Errorf("chunk %d is %d bytes, over %d", i, chunk.size, DefaultMaxSyncSize)
+		}
+		for _, obj := range chunk.data["objects"].([]interface{}) {
+			ids[obj.(map[string]interface{})["id"].(string)] = true
+		}
+	}
+	if len(ids) != 200 {
+		t.Errorf("chunks carried %d objects, want 200", len(ids))
+	}
+	if size := r.SyncSize(); size < 2_000_000 {
+		t.Errorf("SyncSize = %d, want the full payload size (over 2MB)", size)
+	}
+}
+
+func TestSmallSyncIsWhole(t *testing.T) {
+	r := newTestRoom(t)
+	fillRoom(t, r, 10, 100)
+	s := NewSynchronizer(DefaultMaxSyncSize)
+	u, messages := connectedUser(t, "bob")
+
+	if err := s.SyncNewUser(r, u); err != nil {
+		t.Fatal(err)
+	}
+	msg := nextMessage(t, messages)
+	if msg.data["type"] != "sync" || msg.data["chunks"] != nil {
+		t.Fatalf("sync = %v chunks %v, want one whole sync", msg.data["type"], msg.data["chunks"])
+	}
+	if objects := msg.data["objects"].([]interface{}); len(objects) != 10 {
+		t.Errorf("sync carries %d objects, want 10", len(objects))
+	}
+	if r.SyncSize() != int64(msg.size) {
+		t.Errorf("SyncSize = %d, want %d", r.SyncSize(), msg.size)
+	}
+}
@@ -0,0 +1,129 @@
+package room
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"sync"
+)
+
+// DefaultSyncCacheBytes: memory for serialized sync objects, shared by all rooms
+const DefaultSyncCacheBytes = 64 * 1024 * 1024
+
+// syncVariant: form serialized sync objects are cached in, each built the
+// first time a join needs it
+type syncVariant int
+
+const (
+	syncWhole  syncVariant = iota // one JSON array (sync message)
+	syncChunks                    // one JSON array per syncChunk message
+)
+
+// syncCacheKey: a room instance's objects in one variant
+type syncCacheKey struct {
+	epoch   string // unique per room instance, so rooms recreated under a code don't collide
+	variant syncVariant
+}
+
+// syncCacheEntry: serialized objects as of revision
+type syncCacheEntry struct {
+	key      syncCacheKey
+	revision uint64
+	parts    []json.RawMessage
+	size     int
+}
+
+// syncCache: serialized objects of recently synced rooms, least recently used
+// dropped first once over maxBytes. Entries are only valid for the revision
+// they were built at, any change to the room makes them stale (replaced on the
+// next join, or evicted)
+type syncCache struct {
+	mu       sync.Mutex
+	maxBytes int
+	bytes    int
+	entries  map[syncCacheKey]*list.Element
+	order    *list.List // front is most recently used
+}
+
+// newSyncCache: creates a cache holding at most maxBytes, 0 caches nothing
+func newSyncCache(maxBytes int) *syncCache {
+	return &syncCache{
+		maxBytes: maxBytes,
+		entries:  make(map[syncCacheKey]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get: cached parts for key, if built at revision
+func (c *syncCache) get(key syncCacheKey, revision uint64) ([]json.RawMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, exists := c.entries[key]
+	if !exists || element.Value.(*syncCacheEntry).revision != revision {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*syncCacheEntry).parts, true
+}
+
+// put: caches parts for key as of revision (replacing an older revision),
+// evicting the least recently used entries to stay within maxBytes
+func (c *syncCache) put(key syncCacheKey, revision uint64, parts []json.RawMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, exists := c.entries[key]; exists {
+		if element.Value.(*syncCacheEntry).revision > revision {
+			return // a join that read the room later already cached a newer state
+		}
+		c.remove(element)
+	}
+
+	size := 0
+	for _, part := range parts {
+		size += len(part)
+	}
+	if size > c.maxBytes {
+		return
+	}
+	for c.bytes+size > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+	c.entries[key] = c.order.PushFront(&syncCacheEntry{key: key, revision: revision, parts: parts, size: size})
+	c.bytes += size
+}
+
+// remove: drops a cached entry
+// caller must hold c.mu
+func (c *syncCache) remove(element *list.Element) {
+	entry := element.Value.(*syncCacheEntry)
+	c.order.Remove(element)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
+
+// setMaxBytes: changes the budget, evicting entries over it
+func (c *syncCache) setMaxBytes(maxBytes int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.maxBytes = maxBytes
+	for c.bytes > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+}
+
+// withObjects: envelope (a marshaled JSON object) with objects added as its
+// "objects" field, so cached objects are sent without encoding them again
+func withObjects(envelope []byte, objects json.RawMessage) []byte {
+	envelope = bytes.TrimSuffix(envelope, []byte("}"))
+	msg := make([]byte, 0, len(envelope)+len(objects)+12)
+	msg = append(msg, envelope...)
+	if len(envelope) > 1 {
+		msg = append(msg, ',')
+	}
+	msg = append(msg, `"objects":`...)
+	msg = append(msg, objects...)
+	return append(msg, '}')
+}
@@ -0,0 +1,247 @@
+package room
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+)
+
+// syncedIDs: the object IDs of one sync (whole or chunked) from messages
+func syncedIDs(t *testing.T, messages <-chan received) []string {
+	t.Helper()
+	header := nextMessage(t, messages)
+	if header.data["type"] != "sync" {
+		t.Fatalf("first message = %v, want sync", header.data["type"])
+	}
+	collect := func(objects interface{}, ids []string) []string {
+		for _, obj := range objects.([]interface{}) {
+			ids = append(ids, obj.(map[string]interface{})["id"].(string))
+		}
+		return ids
+	}
+	ids := collect(header.data["objects"], nil)
+	chunks, _ := header.data["chunks"].(float64)
+	for i := 0; i < int(chunks); i++ {
+		chunk := nextMessage(t, messages)
+		if chunk.data["type"] != "syncChunk" || chunk.data["chunk"] != float64(i) {
+			t.Fatalf("message %d = %v chunk %v, want syncChunk %d", i+1, chunk.data["type"], chunk.data["chunk"], i)
+		}
+		ids = collect(chunk.data["objects"], ids)
+	}
+	return ids
+}
+
+func TestSyncCacheInvalidatedByRevision(t *testing.T) {
+	r := newTestRoom(t)
+	fillRoom(t, r, 10, 10)
+	s := NewSynchronizer(DefaultMaxSyncSize)
+	u, messages := connectedUser(t, "bob")
+	key := syncCacheKey{epoch: r.epoch, variant: syncWhole}
+
+	if err := s.SyncNewUser(r, u); err != nil {
+		t.Fatal(err)
+	}
+	syncedIDs(t, messages)
+	before := r.Revision()
+	if _, hit := s.cache.get(key, before); !hit {
+		t.Fatal("sync not cached")
+	}
+
+	if err := r.AddObject(drawing("late", "alice")); err != nil {
+		t.Fatal(err)
+	}
+	if _, hit := s.cache.get(key, r.Revision()); hit {
+		t.Fatal("cache hit after the room changed")
+	}
+	if err := s.SyncNewUser(r, u); err != nil {
+		t.Fatal(err)
+	}
+	if ids := syncedIDs(t, messages); len(ids) != 11 {
+		t.Errorf("sync after a change carries %d objects, want 11", len(ids))
+	}
+	if _, hit := s.cache.get(key, r.Revision()); !hit {
+		t.Error("new revision not cached")
+	}
+	if _, hit := s.cache.get(key, before); hit {
+		t.Error("old revision still cached")
+	}
+}
+
+func TestSyncCacheKeyedByEpoch(t *testing.T) {
+	s := NewSynchronizer(DefaultMaxSyncSize)
+	// Same revision, different rooms (or the same code recreated)
+	first, second := newTestRoom(t), newTestRoom(t)
+	if err := first.AddObject(drawing("first", "alice")); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.AddObject(drawing("second", "alice")); err != nil {
+		t.Fatal(err)
+	}
+	if first.Revision() != second.Revision() {
+		t.Fatalf("revisions %d and %d, want the same", first.Revision(), second.Revision())
+	}
+
+	u, messages := connectedUser(t, "bob")
+	for _, tc := range []struct {
+		room *Room
+		want string
+	}{{first, "first"}, {second, "second"}} {
+		if err := s.SyncNewUser(tc.room, u); err != nil {
+			t.Fatal(err)
+		}
+		if ids := syncedIDs(t, messages); len(ids) != 1 || ids[0] != tc.want {
+			t.Errorf("sync of room %s = %v, want [%s]", tc.want, ids, tc.want)
+		}
+	}
+}
+
+func TestSyncCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newSyncCache(100)
+	part := func(n int) []json.RawMessage {
+		return []json.RawMessage{json.RawMessage(strings.Repeat("x", n))}
+	}
+	a, b, d := syncCacheKey{epoch: "a"}, syncCacheKey{epoch: "b"}, syncCacheKey{epoch: "d"}
+
+	c.put(a, 1, part(40))
+	c.put(b, 1, part(40))
+	c.get(a, 1) // a is now the most recently used
+	c.put(d, 1, part(40))
+	if _, hit := c.get(b, 1); hit {
+		t.Error("least recently used entry kept over the budget")
+	}
+	for _, key := range []syncCacheKey{a, d} {
+		if _, hit := c.get(key, 1); !hit {
+			t.Errorf("entry %s evicted", key.epoch)
+		}
+	}
+	if c.bytes != 80 {
+		t.Errorf("cache holds %d bytes, want 80", c.bytes)
+	}
+
+	// Larger than the whole budget: not cached, nothing evicted for it
+	c.put(b, 1, part(101))
+	if _, hit := c.get(b, 1); hit || c.bytes != 80 {
+		t.Errorf("oversized entry cached (%d bytes held)", c.bytes)
+	}
+
+	// A late put of an older revision doesn't replace a newer one
+	c.put(a, 2, part(10))
+	c.put(a, 1, part(40))
+	if _, hit := c.get(a, 2); !hit || c.bytes != 50 {
+		t.Errorf("older revision replaced the newer one (%d bytes held)", c.bytes)
+	}
+
+	// A smaller budget evicts down to it, 0 caches nothing
+	c.setMaxBytes(40)
+	if c.bytes > 40 {
+		t.Errorf("%d bytes held over a budget of 40", c.bytes)
+	}
+	c.setMaxBytes(0)
+	c.put(b, 1, part(1))
+	if c.bytes != 0 || len(c.entries) != 0 {
+		t.Errorf("disabled cache holds %d entries", len(c.entries))
+	}
+}
+
+func TestCachedChunkedSyncDecodes(t *testing.T) {
+	r := newTestRoom(t)
+	fillRoom(t, r, 50, 200)
+	s := NewSynchronizer(2048)
+	u, messages := connectedUser(t, "bob")
+
+	// Built on the first join, served from the cache on the second
+	for join := 0; join < 2; join++ {
+		if err := s.SyncNewUser(r, u); err != nil {
+			t.Fatal(err)
+		}
+		ids := syncedIDs(t, messages)
+		seen := make(map[string]bool)
+		for _, id := range ids {
+			if seen[id] {
+				t.Errorf("join %d: %s synced twice", join, id)
+			}
+			seen[id] = true
+		}
+		if len(seen) != 50 {
+			t.Errorf("join %d: chunks carried %d objects, want 50", join, len(seen))
+		}
+	}
+	chunks, hit := s.cache.get(syncCacheKey{epoch: r.epoch, variant: syncChunks}, r.Revision())
+	if !hit || len(chunks) < 2 {
+		t.Fatalf("chunks cached: %v (%d), want several", hit, len(chunks))
+	}
+	for i, chunk := range chunks {
+		var entries []map[string]interface{}
+		if err := json.Unmarshal(chunk, &entries); err != nil || len(entries) == 0 {
+			t.Errorf("cached chunk %d doesn't decode: %v", i, err)
+		}
+	}
+}
+
+// drainedUser: a user whose client end reads and discards every message,
+// signalling each one on the returned channel
+func drainedUser(b *testing.B) (*user.User, <-chan struct{}) {
+	b.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conns <- conn
+	}))
+	b.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	u := user.NewUser(<-conns, user.ConnectionInfo{})
+	b.Cleanup(func() {
+		u.StopWriter()
+		client.Close()
+		u.Connection.Close()
+	})
+
+	read := make(chan struct{}, 1)
+	go func() {
+		for {
+			if _, _, err := client.ReadMessage(); err != nil {
+				return
+			}
+			read <- struct{}{}
+		}
+	}()
+	return u, read
+}
+
+// BenchmarkSyncUnchangedRoom: sequential joins to an unchanged 1,000-object
+// room, each one synced whole
+func BenchmarkSyncUnchangedRoom(b *testing.B) {
+	for _, bench := range []struct {
+		name       string
+		cacheBytes int
+	}{{"cached", DefaultSyncCacheBytes}, {"uncached", 0}} {
+		b.Run(bench.name, func(b *testing.B) {
+			r := newTestRoom(b)
+			fillRoom(b, r, 1000, 100)
+			s := NewSynchronizer(4 * 1024 * 1024)
+			s.SetCacheBytes(bench.cacheBytes)
+			u, read := drainedUser(b)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := s.SyncNewUser(r, u); err != nil {
+					b.Fatal(err)
+				}
+				<-read
+			}
+		})
+	}
+}
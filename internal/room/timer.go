@@ -0,0 +1,164 @@
+package room
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrTimerActive: room already has a running timer
+	ErrTimerActive = errors.New("a timer is already running in this room")
+	// ErrNoTimer: room has no running timer and isn't frozen
+	ErrNoTimer = errors.New("no timer is running in this room")
+)
+
+// Clock: time source for room timers, the restoreLastClear window and the
+// provisional drawing grace, replaced in tests to fast-forward
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// wallClock: the real time
+type wallClock struct{}
+
+func (wallClock) Now() time.Time                         { return time.Now() }
+func (wallClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SetClock: time source for the timers (and clear restore windows) of rooms
+// created from now on
+func (rm *Manager) SetClock(clock Clock) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.clock = clock
+}
+
+// After: like time.After, on the room's clock
+func (r *Room) After(d time.Duration) <-chan time.Time {
+	return r.clock.After(d)
+}
+
+// roomTimer: running countdown, stop is closed to end it early
+type roomTimer struct {
+	duration time.Duration
+	endsAt   time.Time
+	stop     chan struct{}
+}
+
+// TimerState: countdown info for clients (room_joined, timer messages)
+type TimerState struct {
+	Active    bool
+	Duration  time.Duration
+	EndsAt    time.Time
+	Remaining time.Duration // as of when the state was read
+	Frozen    bool          // board is read-only because a timer expired
+}
+
+// StartTimer: starts a countdown, onTick is called every interval with the time left
+// and onExpire once the board has been frozen. Starting a timer lifts a previous freeze
+func (r *Room) StartTimer(duration, interval time.Duration, onTick func(remaining time.Duration), onExpire func()) (TimerState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.timer != nil {
+		return TimerState{}, ErrTimerActive
+	}
+
+	t := &roomTimer{
+		duration: duration,
+		endsAt:   r.clock.Now().Add(duration),
+		stop:     make(chan struct{}),
+	}
+	r.timer = t
+	r.frozen = false
+
+	r.Go(func(ctx context.Context) {
+		r.runTimer(ctx, t, interval, onTick, onExpire)
+	})
+	return r.timerState(), nil
+}
+
+// runTimer: ticks until the timer expires, is stopped, or the room closes
+func (r *Room) runTimer(ctx context.Context, t *roomTimer, interval time.Duration, onTick func(time.Duration), onExpire func()) {
+	for {
+		remaining := t.endsAt.Sub(r.clock.Now())
+		if remaining <= 0 {
+			break
+		}
+		wait := min(interval, remaining)
+
+		select {
+		case <-t.stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-r.clock.After(wait):
+		}
+		if remaining := t.endsAt.Sub(r.clock.Now()); remaining > 0 {
+			onTick(remaining)
+		}
+	}
+
+	r.mu.Lock()
+	if r.timer != t { // cancelled while expiring
+		r.mu.Unlock()
+		return
+	}
+	r.timer = nil
+	r.frozen = true
+	r.mu.Unlock()
+
+	onExpire()
+}
+
+// CancelTimer: stops the running timer, or lifts the freeze left by an expired one
+func (r *Room) CancelTimer() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.timer == nil && !r.frozen {
+		return ErrNoTimer
+	}
+	r.stopTimer()
+	r.frozen = false
+	return nil
+}
+
+// stopTimer: caller must hold write lock
+func (r *Room) stopTimer() {
+	if r.timer != nil {
+		close(r.timer.stop)
+		r.timer = nil
+	}
+}
+
+// Timer: current countdown state
+func (r *Room) Timer() TimerState {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.timerState()
+}
+
+// timerState: caller must hold lock
+func (r *Room) timerState() TimerState {
+	if r.timer == nil {
+		return TimerState{Frozen: r.frozen}
+	}
+	return TimerState{
+		Active:    true,
+		Duration:  r.timer.duration,
+		EndsAt:    r.timer.endsAt,
+		Remaining: r.timer.endsAt.Sub(r.clock.Now()),
+	}
+}
+
+// IsFrozen: board is read-only (timer expired)
+func (r *Room) IsFrozen() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.frozen
+}
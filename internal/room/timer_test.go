@@ -0,0 +1,211 @@
+package room
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock: a Clock that only moves when advanced
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1_700_000_000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// advance: moves the clock by d in steps of step, after each one waiting for
+// the timer to be waiting again, so every tick in between fires
+func (c *fakeClock) advance(t *testing.T, d time.Duration, step time.Duration) {
+	t.Helper()
+	for moved := time.Duration(0); moved < d; moved += step {
+		c.waiting(t)
+		c.mu.Lock()
+		c.now = c.now.Add(step)
+		var pending []fakeWaiter
+		for _, w := range c.waiters {
+			if w.at.After(c.now) {
+				pending = append(pending, w)
+			} else {
+				w.ch <- c.now
+			}
+		}
+		c.waiters = pending
+		c.mu.Unlock()
+	}
+}
+
+// waiting: blocks until something is waiting on the clock
+func (c *fakeClock) waiting(t *testing.T) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		c.mu.Lock()
+		n := len(c.waiters)
+		c.mu.Unlock()
+		if n > 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("nothing waiting on the clock")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// timerRoom: a room whose timers run on clock
+func timerRoom(t *testing.T, clock Clock) *Room {
+	t.Helper()
+	rm := NewManager(nil)
+	rm.SetClock(clock)
+	r, err := rm.CreateRoom(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.Close)
+	return r
+}
+
+func TestTimerTicksThenFreezes(t *testing.T) {
+	clock := newFakeClock()
+	r := timerRoom(t, clock)
+
+	ticks := make(chan time.Duration, 16)
+	expired := make(chan struct{})
+	state, err := r.StartTimer(2*time.Minute, 30*time.Second, func(remaining time.Duration) { ticks <- remaining }, func() { close(expired) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Active || state.Remaining != 2*time.Minute || !state.EndsAt.Equal(clock.Now().Add(2*time.Minute)) {
+		t.Fatalf("started state = %+v", state)
+	}
+
+	clock.advance(t, time.Minute, 30*time.Second)
+	for _, want := range []time.Duration{90 * time.Second, time.Minute} {
+		if got := <-ticks; got != want {
+			t.Errorf("tick = %v, want %v", got, want)
+		}
+	}
+	if state := r.Timer(); state.Remaining != time.Minute || r.IsFrozen() {
+		t.Errorf("halfway: remaining %v, frozen %v", state.Remaining, r.IsFrozen())
+	}
+
+	clock.advance(t, time.Minute, 30*time.Second)
+	select {
+	case <-expired:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timer didn't expire")
+	}
+	if got := <-ticks; got != 30*time.Second {
+		t.Errorf("last tick = %v, want 30s", got)
+	}
+	select {
+	case got := <-ticks:
+		t.Errorf("tick of %v at or after expiry", got)
+	default:
+	}
+	if state := r.Timer(); state.Active || !state.Frozen || !r.IsFrozen() {
+		t.Errorf("after expiry: %+v, want inactive and frozen", state)
+	}
+}
+
+func TestOneTimerPerRoom(t *testing.T) {
+	r := timerRoom(t, newFakeClock())
+	noop := func(time.Duration) {}
+
+	if _, err := r.StartTimer(time.Minute, time.Second, noop, func() {}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.StartTimer(time.Minute, time.Second, noop, func() {}); !errors.Is(err, ErrTimerActive) {
+		t.Errorf("second timer = %v, want ErrTimerActive", err)
+	}
+
+	if err := r.CancelTimer(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CancelTimer(); !errors.Is(err, ErrNoTimer) {
+		t.Errorf("cancelling with no timer = %v, want ErrNoTimer", err)
+	}
+	if _, err := r.StartTimer(time.Minute, time.Second, noop, func() {}); err != nil {
+		t.Errorf("timer after cancel: %v", err)
+	}
+}
+
+func TestCancelStopsTimerAndLiftsFreeze(t *testing.T) {
+	clock := newFakeClock()
+	r := timerRoom(t, clock)
+
+	expired := make(chan struct{})
+	if _, err := r.StartTimer(time.Minute, time.Minute, func(time.Duration) {}, func() { close(expired) }); err != nil {
+		t.Fatal(err)
+	}
+	clock.advance(t, time.Minute, time.Minute)
+	<-expired
+	if !r.IsFrozen() {
+		t.Fatal("board not frozen after expiry")
+	}
+	if err := r.CancelTimer(); err != nil {
+		t.Fatalf("cancel after expiry: %v", err)
+	}
+	if r.IsFrozen() {
+		t.Error("cancel left the board frozen")
+	}
+
+	// A cancelled timer never expires
+	if _, err := r.StartTimer(time.Minute, time.Minute, func(time.Duration) {}, func() { t.Error("cancelled timer expired") }); err != nil {
+		t.Fatal(err)
+	}
+	clock.waiting(t)
+	if err := r.CancelTimer(); err != nil {
+		t.Fatal(err)
+	}
+	clock.advance(t, time.Hour, time.Hour)
+	time.Sleep(10 * time.Millisecond)
+	if r.IsFrozen() {
+		t.Error("board frozen by a cancelled timer")
+	}
+}
+
+func TestTimerStopsWithRoom(t *testing.T) {
+	clock := newFakeClock()
+	r := timerRoom(t, clock)
+
+	if _, err := r.StartTimer(time.Minute, time.Second, func(time.Duration) {}, func() { t.Error("timer expired after the room closed") }); err != nil {
+		t.Fatal(err)
+	}
+	clock.waiting(t)
+
+	closed := make(chan struct{})
+	go func() {
+		r.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close waited on the timer")
+	}
+}
@@ -0,0 +1,174 @@
+package room
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"main/internal/object"
+)
+
+// Reorder commands (objectReordered). Forward and backward step past the next
+// drawing on the same page, front and back go above or below every drawing
+const (
+	ZFront    = "front"
+	ZBack     = "back"
+	ZForward  = "forward"
+	ZBackward = "backward"
+)
+
+// ErrZIndexRange: no zIndex left above (or below) the stack, the board needs
+// its drawings restacked first
+var ErrZIndexRange = errors.New("zIndex out of allowed range")
+
+// zBounds: lowest and highest zIndex handed out. Watermarks: deleting the top
+// drawing doesn't lower them (a gap in the stack is harmless), replacing the
+// whole board (changedAll) has them recomputed on next use
+type zBounds struct {
+	min, max int
+	known    bool
+}
+
+// noteZ: widens the bounds to a stored zIndex
+// caller must hold write lock
+func (r *Room) noteZ(z int) {
+	if !r.zOrder.known {
+		return // recomputed from every drawing on next use anyway
+	}
+	r.zOrder.min = min(r.zOrder.min, z)
+	r.zOrder.max = max(r.zOrder.max, z)
+}
+
+// zRange: current bounds, recomputed if unknown (zero for an empty board)
+// caller must hold write lock
+func (r *Room) zRange() (int, int) {
+	if !r.zOrder.known {
+		r.zOrder = zBounds{known: true}
+		first := true
+		for _, obj := range r.Objects {
+			if first {
+				r.zOrder.min, r.zOrder.max, first = obj.ZIndex, obj.ZIndex, false
+				continue
+			}
+			r.noteZ(obj.ZIndex)
+		}
+	}
+	return r.zOrder.min, r.zOrder.max
+}
+
+// raiseZ: a zIndex above every drawing (never below 0), reserved so the next
+// call returns a higher one
+// caller must hold write lock
+func (r *Room) raiseZ() (int, error) {
+	_, top := r.zRange()
+	next := 0
+	if len(r.Objects) > 0 && top >= 0 {
+		next = top + 1
+	}
+	if next > object.MaxZIndex {
+		return 0, ErrZIndexRange
+	}
+	r.zOrder.max = max(r.zOrder.max, next)
+	return next, nil
+}
+
+// lowerZ: a zIndex below every drawing, reserved like raiseZ
+// caller must hold write lock
+func (r *Room) lowerZ() (int, error) {
+	bottom, _ := r.zRange()
+	next := bottom - 1
+	if next < object.MinZIndex {
+		return 0, ErrZIndexRange
+	}
+	r.zOrder.min = next
+	return next, nil
+}
+
+// ReorderObject: moves a drawing in the stacking order, by command (ZFront, ...)
+// or to zIndex when command is "". Returns every drawing whose zIndex changed
+// (forward and backward swap with the neighbour), false if the drawing is gone
+func (r *Room) ReorderObject(id string, command string, zIndex int) (map[string]int, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	obj, exists := r.Objects[id]
+	if !exists {
+		return nil, false, nil
+	}
+
+	moved := make(map[string]int)
+	var err error
+	switch command {
+	case ZFront:
+		zIndex, err = r.raiseZ()
+	case ZBack:
+		zIndex, err = r.lowerZ()
+	case ZForward, ZBackward:
+		zIndex = obj.ZIndex
+		if neighbour := r.zNeighbour(obj, command == ZForward); neighbour != nil {
+			if neighbour.ZIndex == obj.ZIndex {
+				// Tied (ordered by ID), one step past it breaks the tie
+				if command == ZForward {
+					zIndex++
+				} else {
+					zIndex--
+				}
+			} else {
+				zIndex = neighbour.ZIndex
+				neighbour.ZIndex = obj.ZIndex
+				moved[neighbour.ID] = neighbour.ZIndex
+			}
+		}
+	}
+	if err != nil {
+		return nil, true, err
+	}
+	if zIndex < object.MinZIndex || zIndex > object.MaxZIndex {
+		return nil, true, ErrZIndexRange
+	}
+
+	if zIndex == obj.ZIndex && len(moved) == 0 {
+		return map[string]int{obj.ID: zIndex}, true, nil // already there
+	}
+	obj.ZIndex = zIndex
+	r.noteZ(zIndex)
+	moved[obj.ID] = zIndex
+	r.LastActive = time.Now()
+	ids := make([]string, 0, len(moved))
+	for movedID := range moved {
+		ids = append(ids, movedID)
+	}
+	r.changed(ids...)
+	return moved, true, nil
+}
+
+// zNeighbour: the drawing right above (or below) obj on its page, in stacking
+// order (zIndex, ties by ID like exports), nil if obj is already topmost
+// caller must hold lock
+func (r *Room) zNeighbour(obj *object.Drawing, above bool) *object.Drawing {
+	page := make([]*object.Drawing, 0)
+	for _, other := range r.Objects {
+		if other.PageID == obj.PageID {
+			page = append(page, other)
+		}
+	}
+	sort.Slice(page, func(i, j int) bool {
+		if page[i].ZIndex != page[j].ZIndex {
+			return page[i].ZIndex < page[j].ZIndex
+		}
+		return page[i].ID < page[j].ID
+	})
+	for i, other := range page {
+		if other != obj {
+			continue
+		}
+		if above && i+1 < len(page) {
+			return page[i+1]
+		}
+		if !above && i > 0 {
+			return page[i-1]
+		}
+		return nil
+	}
+	return nil
+}
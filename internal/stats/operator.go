@@ -0,0 +1,48 @@
+package stats
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Totals: exact counts for operators, never rounded (see OperatorHandler)
+type Totals struct {
+	Rooms       int                 `json:"rooms"`
+	Connections int                 `json:"connections"`
+	Objects     int                 `json:"objects"`
+	Sessions    int                 `json:"sessions"`
+	IPLimiters  int                 `json:"ipLimiters"`
+	OpenByIP    map[string]int      `json:"openByIp"` // open websockets per client IP (see WB_IP_MAX_CONNECTIONS)
+	Latency     []ConnectionLatency `json:"latency"`  // per connection
+}
+
+// ConnectionLatency: a connection's ping round trip (rolling average, 0 until
+// the first pong)
+type ConnectionLatency struct {
+	Room      string  `json:"room"`
+	UserID    string  `json:"userId"`
+	RTTMillis float64 `json:"rttMs"`
+}
+
+// HealthHandler: GET /healthz, 200 while the server accepts connections and
+// 503 once it's shutting down (so load balancers stop routing to it)
+func HealthHandler(accepting func() bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		if !accepting() {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+}
+
+// OperatorHandler: GET /stats with exact totals. Unlike PublicHandler nothing is
+// rounded, so it must only be served to operators
+func OperatorHandler(totals func() Totals) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(totals())
+	})
+}
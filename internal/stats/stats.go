@@ -0,0 +1,52 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Source: aggregate counts exposed by the stats endpoint
+type Source interface {
+	RoomCount() int
+	ConnectionCount() int
+}
+
+// Privacy: rounding rules for publicly visible counts, so small teams' usage
+// (e.g. 0 → 4 connections at the same hour every week) can't be singled out
+type Privacy struct {
+	Floor int // counts below this are reported as "<Floor"
+	Step  int // counts at or above Floor are rounded to the nearest Step
+}
+
+// DefaultPrivacy: rules applied to the public endpoint
+var DefaultPrivacy = Privacy{Floor: 5, Step: 5}
+
+// Count: privacy-safe representation of n (int, or a "<Floor" range string)
+func (p Privacy) Count(n int) interface{} {
+	if n < p.Floor {
+		return fmt.Sprintf("<%d", p.Floor)
+	}
+	if p.Step <= 1 {
+		return n
+	}
+	return ((n + p.Step/2) / p.Step) * p.Step
+}
+
+// PublicHandler: GET /api/stats with counts rounded by privacy
+func PublicHandler(source Source, privacy Privacy) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false) // keep "<5" readable
+		encoder.Encode(map[string]interface{}{
+			"rooms":       privacy.Count(source.RoomCount()),
+			"connections": privacy.Count(source.ConnectionCount()),
+		})
+	})
+}
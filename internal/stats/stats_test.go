@@ -0,0 +1,72 @@
+package stats
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeSource struct{ rooms, connections int }
+
+func (s fakeSource) RoomCount() int       { return s.rooms }
+func (s fakeSource) ConnectionCount() int { return s.connections }
+
+func TestPrivacyCount(t *testing.T) {
+	for _, tc := range []struct {
+		n    int
+		want interface{}
+	}{
+		{0, "<5"},
+		{4, "<5"},
+		{5, 5},
+		{7, 5},
+		{8, 10},
+		{12, 10},
+		{13, 15},
+		{1002, 1000},
+	} {
+		if got := DefaultPrivacy.Count(tc.n); got != tc.want {
+			t.Errorf("Count(%d) = %v, want %v", tc.n, got, tc.want)
+		}
+	}
+
+	exact := Privacy{Floor: 0, Step: 1}
+	for _, n := range []int{0, 3, 17} {
+		if got := exact.Count(n); got != n {
+			t.Errorf("Step 1: Count(%d) = %v, want it unchanged", n, got)
+		}
+	}
+}
+
+func TestPublicHandlerRounds(t *testing.T) {
+	rec := httptest.NewRecorder()
+	PublicHandler(fakeSource{rooms: 2, connections: 13}, DefaultPrivacy).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["rooms"] != "<5" || body["connections"] != float64(15) {
+		t.Errorf("public stats = %v, want rooms <5 and connections 15", body)
+	}
+
+	rec = httptest.NewRecorder()
+	PublicHandler(fakeSource{}, DefaultPrivacy).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/stats", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST = %d, want 405", rec.Code)
+	}
+}
+
+func TestOperatorHandlerIsExact(t *testing.T) {
+	rec := httptest.NewRecorder()
+	OperatorHandler(func() Totals { return Totals{Rooms: 2, Connections: 13} }).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+
+	var totals Totals
+	if err := json.Unmarshal(rec.Body.Bytes(), &totals); err != nil {
+		t.Fatal(err)
+	}
+	if totals.Rooms != 2 || totals.Connections != 13 {
+		t.Errorf("operator stats = %+v, want the exact 2 rooms and 13 connections", totals)
+	}
+}
@@ -0,0 +1,38 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer: tracer used for per-message spans
+// No-op until Setup installs a provider, so span creation is near free when disabled
+func Tracer() trace.Tracer {
+	return otel.Tracer("whiteboard")
+}
+
+// Setup: installs an OTLP exporting tracer provider when sampling is enabled
+// Returns a shutdown func that flushes pending spans
+func Setup(ctx context.Context, endpoint string, sampleRate float64) (func(context.Context) error, error) {
+	noop := func(context.Context) error { return nil }
+	if endpoint == "" || sampleRate <= 0 {
+		return noop, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return noop, fmt.Errorf("create OTLP exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRate))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,36 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetupDisabled(t *testing.T) {
+	before := otel.GetTracerProvider()
+	for _, tc := range []struct {
+		endpoint string
+		rate     float64
+	}{
+		{"", 1},
+		{"http://localhost:4318", 0},
+	} {
+		shutdown, err := Setup(context.Background(), tc.endpoint, tc.rate)
+		if err != nil {
+			t.Fatalf("Setup(%q, %v): %v", tc.endpoint, tc.rate, err)
+		}
+		if err := shutdown(context.Background()); err != nil {
+			t.Errorf("shutdown: %v", err)
+		}
+		if otel.GetTracerProvider() != before {
+			t.Errorf("Setup(%q, %v) installed a provider", tc.endpoint, tc.rate)
+		}
+	}
+
+	_, span := Tracer().Start(context.Background(), "message")
+	defer span.End()
+	if span.IsRecording() {
+		t.Error("span recording with tracing disabled")
+	}
+}
@@ -0,0 +1,52 @@
+package user
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// rttWeight: weight of a new sample in the rolling RTT average
+const rttWeight = 0.2
+
+// PingPayload: ping application data carrying the send time, the pong echoes
+// it back for ParsePong
+func PingPayload(now time.Time) []byte {
+	return strconv.AppendInt(nil, now.UnixNano(), 10)
+}
+
+// ParsePong: round trip time of the ping a pong answers, false if the pong
+// data isn't a ping sent within maxAge (unsolicited or tampered pongs)
+func ParsePong(appData string, now time.Time, maxAge time.Duration) (time.Duration, bool) {
+	sent, err := strconv.ParseInt(appData, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	rtt := now.Sub(time.Unix(0, sent))
+	if rtt < 0 || rtt > maxAge {
+		return 0, false
+	}
+	return rtt, true
+}
+
+// RecordRTT: adds a round trip sample to the connection's rolling average
+// Called from the connection's read loop only (pong handler), reads may come
+// from anywhere
+func (u *User) RecordRTT(rtt time.Duration) {
+	previous := u.rtt.Load()
+	if previous == 0 {
+		u.rtt.Store(int64(rtt))
+		return
+	}
+	u.rtt.Store(int64(float64(previous)*(1-rttWeight) + float64(rtt)*rttWeight))
+}
+
+// RTT: rolling average round trip time, 0 until the first pong
+func (u *User) RTT() time.Duration {
+	return time.Duration(u.rtt.Load())
+}
+
+// RTTMillis: RTT in milliseconds, to a tenth
+func (u *User) RTTMillis() float64 {
+	return math.Round(float64(u.RTT())/float64(time.Millisecond)*10) / 10
+}
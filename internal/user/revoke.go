@@ -0,0 +1,96 @@
+package user
+
+import (
+	"time"
+)
+
+// CloseSessionRevoked: close code for connections whose session token was revoked
+const CloseSessionRevoked = 4001
+
+// maxRecentRooms: rooms kept in a session's history (see SessionInfo)
+const maxRecentRooms = 10
+
+// RoomVisit: a room a session entered
+type RoomVisit struct {
+	Room      string    `json:"room"`
+	EnteredAt time.Time `json:"enteredAt"`
+}
+
+// visit: records roomCode as the most recently entered room
+// caller must hold the SessionManager write lock
+func (s *UserSession) visit(roomCode string) {
+	for i, visit := range s.recentRooms {
+		if visit.Room == roomCode {
+			s.recentRooms = append(s.recentRooms[:i], s.recentRooms[i+1:]...)
+			break
+		}
+	}
+	if len(s.recentRooms) >= maxRecentRooms {
+		s.recentRooms = s.recentRooms[1:]
+	}
+	s.recentRooms = append(s.recentRooms, RoomVisit{Room: roomCode, EnteredAt: time.Now()})
+}
+
+// SessionInfo: what a connection may see about its own session
+type SessionInfo struct {
+	CreatedAt        time.Time        `json:"createdAt"`
+	LastSeen         time.Time        `json:"lastSeen"`
+	RecentRooms      []RoomVisit      `json:"recentRooms"` // most recent first
+	OtherConnections int              `json:"otherConnections"`
+	Terms            *TermsAcceptance `json:"termsAccepted,omitempty"`
+}
+
+// Info: u's session as seen from u, false if the session is gone
+func (sm *SessionManager) Info(u *User) (SessionInfo, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, exists := sm.sessions[u.ID]
+	if !exists || session != u.Session {
+		return SessionInfo{}, false
+	}
+
+	info := SessionInfo{
+		CreatedAt:   session.CreatedAt,
+		LastSeen:    session.LastSeen,
+		RecentRooms: make([]RoomVisit, 0, len(session.recentRooms)),
+	}
+	if session.terms.Version != "" {
+		terms := session.terms
+		info.Terms = &terms
+	}
+	for i := len(session.recentRooms) - 1; i >= 0; i-- {
+		info.RecentRooms = append(info.RecentRooms, session.recentRooms[i])
+	}
+	for attached := range session.attached {
+		if attached != u {
+			info.OtherConnections++
+		}
+	}
+	return info, true
+}
+
+// Revoke: replaces the token of u's session with a fresh one in one step, so the
+// old token (and one rotated out, still in its grace period) stops validating
+// before anyone can use it again. Returns the new
+// token and the session's other connections, which the caller must close
+func (sm *SessionManager) Revoke(u *User) (string, []*User, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, exists := sm.sessions[u.ID]
+	if !exists || session != u.Session {
+		return "", nil, ErrSessionNotFound
+	}
+
+	token := GenerateSessionToken()
+	sm.replaceToken(session, token)
+
+	others := make([]*User, 0, len(session.attached))
+	for attached := range session.attached {
+		if attached != u {
+			others = append(others, attached)
+		}
+	}
+	return token, others, nil
+}
@@ -0,0 +1,107 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestInfoListsRoomsAndOtherConnections(t *testing.T) {
+	sm := testSessions()
+	token := sm.GetOrCreate("alice", "").SessionToken
+	laptop, tablet := &User{}, &User{}
+	for _, u := range []*User{laptop, tablet} {
+		if _, err := sm.Attach(token, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, code := range []string{"ROOM1", "ROOM2", "ROOM1"} {
+		if err := sm.EnterRoom("alice", code, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, ok := sm.Info(laptop)
+	if !ok {
+		t.Fatal("no info for an attached connection")
+	}
+	if info.OtherConnections != 1 {
+		t.Errorf("other connections = %d, want 1", info.OtherConnections)
+	}
+	if len(info.RecentRooms) != 2 || info.RecentRooms[0].Room != "ROOM1" || info.RecentRooms[1].Room != "ROOM2" {
+		t.Errorf("recent rooms = %+v, want ROOM1 (re-entered) then ROOM2", info.RecentRooms)
+	}
+
+	sm.Detach(tablet)
+	if info, _ := sm.Info(laptop); info.OtherConnections != 0 {
+		t.Errorf("other connections after detach = %d, want 0", info.OtherConnections)
+	}
+}
+
+func TestRecentRoomsCapped(t *testing.T) {
+	sm := testSessions()
+	token := sm.GetOrCreate("alice", "").SessionToken
+	u := &User{}
+	if _, err := sm.Attach(token, u); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxRecentRooms+3; i++ {
+		if err := sm.EnterRoom("alice", fmt.Sprintf("ROOM%d", i), 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info, _ := sm.Info(u)
+	if len(info.RecentRooms) != maxRecentRooms {
+		t.Fatalf("%d recent rooms, want %d", len(info.RecentRooms), maxRecentRooms)
+	}
+	if latest := fmt.Sprintf("ROOM%d", maxRecentRooms+2); info.RecentRooms[0].Room != latest {
+		t.Errorf("most recent = %s, want %s", info.RecentRooms[0].Room, latest)
+	}
+}
+
+func TestRevokeReplacesTokenAtOnce(t *testing.T) {
+	sm := testSessions()
+	token := sm.GetOrCreate("alice", "").SessionToken
+	laptop, tablet := &User{}, &User{}
+	for _, u := range []*User{laptop, tablet} {
+		if _, err := sm.Attach(token, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a token rotated out, still in its grace period
+	rotated, err := sm.Rotate(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fresh, others, err := sm.Revoke(laptop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(others) != 1 || others[0] != tablet {
+		t.Errorf("others = %v, want only the tablet", others)
+	}
+	if validTokens(sm, token, rotated) != 0 {
+		t.Error("revoked tokens still validate")
+	}
+	if userID, ok := sm.ValidateToken(fresh); !ok || userID != "alice" {
+		t.Errorf("fresh token validates as %q, %v", userID, ok)
+	}
+	if sm.TokenCount() != 1 {
+		t.Errorf("%d tokens after revoke, want 1", sm.TokenCount())
+	}
+}
+
+func TestRevokeUnknownSession(t *testing.T) {
+	sm := testSessions()
+	stale := &User{ID: "alice", Session: &UserSession{UserID: "alice"}}
+	sm.GetOrCreate("alice", "")
+
+	// a connection whose session was since replaced
+	if _, _, err := sm.Revoke(stale); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("err = %v, want ErrSessionNotFound", err)
+	}
+	if _, ok := sm.Info(stale); ok {
+		t.Error("info for a replaced session")
+	}
+}
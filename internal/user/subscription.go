@@ -0,0 +1,21 @@
+package user
+
+// Subscription: which broadcasts a connection wants, declared by the client
+// (authenticate or setSubscriptions). Checked by the broadcaster per recipient
+type Subscription struct {
+	Muted  uint32 // broadcast categories not delivered (bits are room.Category)
+	PageID string // only page specific events for this page, "" = every page
+}
+
+// SetSubscription: replaces the connection's filters, applies to later broadcasts
+func (u *User) SetSubscription(sub Subscription) {
+	u.subscription.Store(&sub)
+}
+
+// Subscription: the connection's filters, zero (everything) if none were set
+func (u *User) Subscription() Subscription {
+	if sub := u.subscription.Load(); sub != nil {
+		return *sub
+	}
+	return Subscription{}
+}
@@ -0,0 +1,31 @@
+package user
+
+import "time"
+
+// TermsAcceptance: terms version a session accepted, and when
+type TermsAcceptance struct {
+	Version    string    `json:"version"`
+	AcceptedAt time.Time `json:"acceptedAt"`
+}
+
+// AcceptTerms: records that userID's session accepted version of the terms
+func (sm *SessionManager) AcceptTerms(userID string, version string) (TermsAcceptance, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, exists := sm.sessions[userID]
+	if !exists {
+		return TermsAcceptance{}, ErrSessionNotFound
+	}
+	session.terms = TermsAcceptance{Version: version, AcceptedAt: time.Now()}
+	return session.terms, nil
+}
+
+// TermsAccepted: userID's session accepted version (a newer version prompts again)
+func (sm *SessionManager) TermsAccepted(userID string, version string) bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, exists := sm.sessions[userID]
+	return exists && session.terms.Version == version
+}
@@ -0,0 +1,39 @@
+package user
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTermsAcceptedPerVersion(t *testing.T) {
+	sm := testSessions()
+	token := sm.GetOrCreate("alice", "").SessionToken
+	if sm.TermsAccepted("alice", "v1") {
+		t.Fatal("new session has accepted the terms")
+	}
+
+	accepted, err := sm.AcceptTerms("alice", "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accepted.Version != "v1" || accepted.AcceptedAt.IsZero() {
+		t.Errorf("acceptance = %+v", accepted)
+	}
+	if !sm.TermsAccepted("alice", "v1") || sm.TermsAccepted("alice", "v2") {
+		t.Error("acceptance should hold for v1 only")
+	}
+
+	// shows in the session view
+	u := &User{}
+	if _, err := sm.Attach(token, u); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := sm.Info(u)
+	if info.Terms == nil || *info.Terms != accepted {
+		t.Errorf("session info terms = %v, want %+v", info.Terms, accepted)
+	}
+
+	if _, err := sm.AcceptTerms("bob", "v1"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("accept for unknown session: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package user
+
+import (
+	"time"
+)
+
+// TokenGrace: how long a rotated token keeps validating, so tabs that read the
+// stored token before the rotation can still resume the session
+const TokenGrace = 60 * time.Second
+
+// lookupToken: the session token belongs to, if the token is the session's
+// current token and unexpired, or its previous token within the grace period
+// caller must hold lock
+func (sm *SessionManager) lookupToken(token string, now time.Time) (*UserSession, bool) {
+	if token == "" {
+		return nil, false
+	}
+	session, exists := sm.sessions[sm.tokenToUserID[token]]
+	if !exists {
+		return nil, false
+	}
+	switch token {
+	case session.SessionToken:
+		return session, now.Before(session.TokenExpiresAt)
+	case session.previousToken:
+		return session, now.Before(session.previousExpiresAt)
+	}
+	return nil, false
+}
+
+// replaceToken: makes token the session's only valid one, with a fresh expiry
+// caller must hold write lock
+func (sm *SessionManager) replaceToken(session *UserSession, token string) {
+	delete(sm.tokenToUserID, session.SessionToken)
+	sm.dropPreviousToken(session)
+	session.SessionToken = token
+	session.TokenExpiresAt = time.Now().Add(sm.limits.SessionTokenTTL)
+	sm.tokenToUserID[token] = session.UserID
+}
+
+// dropPreviousToken: ends a rotated token's grace period early
+// caller must hold write lock
+func (sm *SessionManager) dropPreviousToken(session *UserSession) {
+	if session.previousToken != "" {
+		delete(sm.tokenToUserID, session.previousToken)
+	}
+	session.previousToken = ""
+	session.previousExpiresAt = time.Time{}
+}
+
+// Rotate: swaps a valid token for a new one (each resume gets a new token), the
+// old one keeps validating for TokenGrace. A token rotated within the grace
+// period gets the session's current token back, so racing tabs converge on it
+func (sm *SessionManager) Rotate(token string) (string, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	now := time.Now()
+	session, valid := sm.lookupToken(token, now)
+	if !valid {
+		return "", ErrSessionNotFound
+	}
+	if token == session.previousToken {
+		return session.SessionToken, nil
+	}
+
+	sm.dropPreviousToken(session)
+	session.previousToken = token
+	session.previousExpiresAt = now.Add(TokenGrace)
+
+	rotated := GenerateSessionToken()
+	session.SessionToken = rotated
+	session.TokenExpiresAt = now.Add(sm.limits.SessionTokenTTL)
+	sm.tokenToUserID[rotated] = session.UserID
+	return rotated, nil
+}
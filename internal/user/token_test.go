@@ -0,0 +1,152 @@
+package user
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRotateKeepsOneTokenAfterGrace(t *testing.T) {
+	sm := testSessions()
+	first := sm.GetOrCreate("alice", "").SessionToken
+
+	second, err := sm.Rotate(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Fatal("Rotate returned the same token")
+	}
+	// Both validate during the grace period
+	if validTokens(sm, first, second) != 2 || sm.TokenCount() != 2 {
+		t.Fatalf("in grace: %d valid, %d mapped", validTokens(sm, first, second), sm.TokenCount())
+	}
+	// Rotating the old token again converges on the current one
+	if again, err := sm.Rotate(first); err != nil || again != second {
+		t.Errorf("rotating the previous token = %q, %v, want the current token", again, err)
+	}
+
+	// A second rotation ends the first token's grace right away
+	third, err := sm.Rotate(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if validTokens(sm, first) != 0 || validTokens(sm, second, third) != 2 || sm.TokenCount() != 2 {
+		t.Errorf("after second rotation: first valid %d, %d mapped", validTokens(sm, first), sm.TokenCount())
+	}
+
+	// Once the grace period is over, Cleanup leaves just the current token
+	sm.mu.Lock()
+	sm.sessions["alice"].previousExpiresAt = time.Now().Add(-time.Second)
+	sm.mu.Unlock()
+	if validTokens(sm, second) != 0 {
+		t.Error("token past its grace period still validates")
+	}
+	sm.Cleanup()
+	if validTokens(sm, third) != 1 || sm.TokenCount() != 1 {
+		t.Errorf("after grace: %d mapped, want 1", sm.TokenCount())
+	}
+}
+
+func TestReconnectAttachesWithCurrentToken(t *testing.T) {
+	sm := testSessions()
+	token := sm.GetOrCreate("alice", "").SessionToken
+
+	first := &User{}
+	if _, err := sm.Attach(token, first); err != nil {
+		t.Fatal(err)
+	}
+	sm.Detach(first)
+
+	// Reconnecting resumes (and rotates) the session, one token stays current
+	rotated, err := sm.Rotate(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again := &User{}
+	if _, err := sm.Attach(rotated, again); err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != "alice" || again.Session != first.Session {
+		t.Errorf("reconnect attached %q to another session", again.ID)
+	}
+	if session, _ := sm.GetSessionByToken(rotated); session.SessionToken != rotated {
+		t.Errorf("current token = %s, want %s", session.SessionToken, rotated)
+	}
+	if _, err := sm.Attach("unknown", &User{}); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Attach with an unknown token = %v, want ErrSessionNotFound", err)
+	}
+}
+
+// expire: moves the session's token expiry into the past
+func expire(sm *SessionManager, userID string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.sessions[userID].TokenExpiresAt = time.Now().Add(-time.Second)
+}
+
+func TestExpiredTokenRejected(t *testing.T) {
+	sm := testSessions()
+	sm.limits.SessionTokenTTL = time.Hour
+	session := sm.GetOrCreate("alice", "")
+	token := session.SessionToken
+	if left := time.Until(session.TokenExpiresAt); left <= 59*time.Minute || left > time.Hour {
+		t.Fatalf("token expires in %v, want the TTL", left)
+	}
+	if validTokens(sm, token) != 1 {
+		t.Fatal("fresh token doesn't validate")
+	}
+
+	expire(sm, "alice")
+	if validTokens(sm, token) != 0 {
+		t.Error("expired token validates")
+	}
+	if _, ok := sm.GetSessionByToken(token); ok {
+		t.Error("GetSessionByToken found the session of an expired token")
+	}
+	if _, err := sm.Attach(token, &User{}); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Attach with an expired token = %v, want ErrSessionNotFound", err)
+	}
+	if _, err := sm.Rotate(token); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Rotate of an expired token = %v, want ErrSessionNotFound", err)
+	}
+
+	// Nothing can resume it, so Cleanup removes it without waiting for the idle hour
+	if removed := sm.Cleanup(); len(removed) != 1 || sm.SessionCount() != 0 || sm.TokenCount() != 0 {
+		t.Errorf("Cleanup removed %d, left %d sessions and %d tokens", len(removed), sm.SessionCount(), sm.TokenCount())
+	}
+}
+
+func TestExpiredSessionKeptWhileConnected(t *testing.T) {
+	sm := testSessions()
+	u := &User{}
+	if _, err := sm.Attach(sm.GetOrCreate("alice", "").SessionToken, u); err != nil {
+		t.Fatal(err)
+	}
+	expire(sm, "alice")
+	if removed := sm.Cleanup(); len(removed) != 0 || sm.SessionCount() != 1 {
+		t.Fatalf("Cleanup removed a connected session")
+	}
+	sm.Detach(u)
+	if removed := sm.Cleanup(); len(removed) != 1 {
+		t.Errorf("Cleanup after disconnect removed %d sessions, want 1", len(removed))
+	}
+}
+
+func TestRotateRenewsExpiry(t *testing.T) {
+	sm := testSessions()
+	sm.limits.SessionTokenTTL = time.Hour
+	token := sm.GetOrCreate("alice", "").SessionToken
+
+	sm.mu.Lock()
+	sm.sessions["alice"].TokenExpiresAt = time.Now().Add(time.Minute)
+	sm.mu.Unlock()
+	rotated, err := sm.Rotate(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, _ := sm.GetSessionByToken(rotated)
+	if left := time.Until(session.TokenExpiresAt); left <= 59*time.Minute {
+		t.Errorf("rotated token expires in %v, want a fresh TTL", left)
+	}
+}
@@ -1,33 +1,154 @@
-package user 
+package user
 
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
+	"log/slog"
+	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"main/internal/i18n"
+
 	"github.com/gorilla/websocket"
 	"golang.org/x/time/rate"
 )
 
-// UserSession: persists across disconnects
+// UserSession: identity shared by every connection using the token (e.g. a
+// laptop and a tablet), per device state lives on User
+// LastSeen, the token fields, ActiveRooms, recentRooms, attached and terms are guarded by the SessionManager lock
 type UserSession struct {
-	UserID             string
-	SessionToken       string
-	LastRoom           string
-	LastSeen           time.Time
-	LastCursorUpdate   time.Time
-	ObjectRateLimiter  *rate.Limiter
-	CursorRateLimiter  *rate.Limiter
-	Color              string
+	UserID            string
+	SessionToken      string
+	TokenExpiresAt    time.Time // SessionToken stops validating (see Rotate)
+	previousToken     string    // rotated out, still valid until previousExpiresAt
+	previousExpiresAt time.Time
+	CreatedAt         time.Time
+	LastSeen          time.Time
+	ActiveRooms       map[string]int  // roomCode → open connections in that room
+	recentRooms       []RoomVisit     // rooms entered, most recent last (see EnterRoom)
+	attached          map[*User]bool  // open connections (see Attach)
+	terms             TermsAcceptance // terms accepted, zero if none (see AcceptTerms)
+	ObjectRateLimiter *rate.Limiter   // shared, extra devices don't add budget
+	HostRateLimiter   *rate.Limiter   // destructive host actions
+	ChatRateLimiter   *rate.Limiter   // chat messages
+	Color             string
+	name              atomic.Pointer[string] // display name, nil until set (see SetName)
+}
+
+// Name: the session's display name, "" if none was set
+func (s *UserSession) Name() string {
+	if name := s.name.Load(); name != nil {
+		return *name
+	}
+	return ""
 }
 
-// User: connected user
+// SetName: sets the display name (validated by the caller), kept across reconnects
+func (s *UserSession) SetName(name string) {
+	s.name.Store(&name)
+}
+
+// User: one connection of a session
 type User struct {
-	ID         string
-	Session    *UserSession
-	Connection *websocket.Conn
-	WriteMutex sync.Mutex 
+	ID                string
+	Session           *UserSession
+	Connection        *websocket.Conn
+	Info              ConnectionInfo
+	CursorRateLimiter *rate.Limiter // per connection, each device moves its own cursor
+	Spectator         bool          // view only (mode=spectator), set before joining and fixed for the connection
+	Encoding          string        // EncodingMsgpack or "" (JSON), negotiated in authenticate before anything is sent
+	send              chan frame    // outbound queue, drained by the writer goroutine (see NewUser)
+	stop              chan struct{} // closed by StopWriter
+	stopOnce          sync.Once
+	writerDone        chan struct{} // closed once the writer goroutine has exited
+	dropOnce          sync.Once     // slow consumer handling runs once
+	holding           bool          // broadcasts are queued until the join sync is sent
+	held              [][]byte      // queued broadcasts, in arrival order
+	holdMutex         sync.Mutex
+	lastNotice        atomic.Int64                 // unix nanos of the last throttled notice (see NoticeAllowed)
+	rtt               atomic.Int64                 // rolling average ping round trip, nanoseconds (see RecordRTT)
+	subscription      atomic.Pointer[Subscription] // broadcast filters (see SetSubscription)
+	logger            atomic.Pointer[slog.Logger]  // connection logger (see Logger)
+	clockOffset       time.Duration                // server time - this device's clock (smoothed)
+	clockSamples      int                          // timeSync samples behind clockOffset
+	locale            string                       // declared in authenticate, "" if none (see Locale)
+	roomLocale        string                       // the room's default locale
+	stateMutex        sync.Mutex                   // guards the clock and locale fields
+}
+
+// Logger: the connection's logger, its lines carry conn_id, remote_ip, room and
+// user_id as they become known (slog.Default until SetLogger)
+func (u *User) Logger() *slog.Logger {
+	if logger := u.logger.Load(); logger != nil {
+		return logger
+	}
+	return slog.Default()
+}
+
+// SetLogger: replaces the connection's logger (e.g. with user_id once authenticated)
+func (u *User) SetLogger(logger *slog.Logger) {
+	u.logger.Store(logger)
+}
+
+// EncodingMsgpack: the connection exchanges MessagePack binary frames instead of
+// JSON text frames (see Deliver and the writer)
+const EncodingMsgpack = "msgpack"
+
+// Msgpack: true if messages to this connection are MessagePack encoded
+func (u *User) Msgpack() bool {
+	return u.Encoding == EncodingMsgpack
+}
+
+// maxHeldBroadcasts: broadcasts queued during a join sync before the user is dropped
+const maxHeldBroadcasts = 1000
+
+// ErrHoldOverflow: too many broadcasts arrived while the user was being synced
+var ErrHoldOverflow = errors.New("too many broadcasts during sync")
+
+// ConnectionInfo: metadata captured at upgrade (for auditing / abuse handling)
+// Redaction lives here: ClientIP is never encoded, so the struct is safe to put
+// in client-visible payloads as is. Operators get the IP only where it's copied
+// out on purpose, the admin room details (room.ConnectionDetail) and the
+// connection's log lines (remote_ip)
+type ConnectionInfo struct {
+	ClientIP    string    `json:"-"`
+	UserAgent   string    `json:"userAgent"`
+	Protocol    string    `json:"protocol"`
+	Compression bool      `json:"compression"` // permessage-deflate negotiated
+	ConnectedAt time.Time `json:"connectedAt"`
+}
+
+// LimiterStatus: remaining budget of one rate limiter (approximate, whole tokens)
+type LimiterStatus struct {
+	Tokens float64 `json:"tokens"`
+	Rate   float64 `json:"rate"`  // tokens refilled per second
+	Burst  int     `json:"burst"` // max tokens
+}
+
+// RateStatus: current budget per limiter class, read without consuming tokens
+func (u *User) RateStatus() map[string]LimiterStatus {
+	return u.rateStatusAt(time.Now())
+}
+
+// rateStatusAt: the budget as of now
+func (u *User) rateStatusAt(now time.Time) map[string]LimiterStatus {
+	return map[string]LimiterStatus{
+		"object": limiterStatus(u.Session.ObjectRateLimiter, now),
+		"cursor": limiterStatus(u.CursorRateLimiter, now),
+		"host":   limiterStatus(u.Session.HostRateLimiter, now),
+		"chat":   limiterStatus(u.Session.ChatRateLimiter, now),
+	}
+}
+
+func limiterStatus(l *rate.Limiter, now time.Time) LimiterStatus {
+	return LimiterStatus{
+		Tokens: math.Max(0, math.Floor(l.TokensAt(now))),
+		Rate:   float64(l.Limit()),
+		Burst:  l.Burst(),
+	}
 }
 
 // GenerateUUID: generate random UUID for user identification
@@ -44,11 +165,127 @@ func GenerateSessionToken() string {
 	return hex.EncodeToString(bytes)
 }
 
-// WriteMessage: writes message to WebSocket connection 
-// (gorilla/websocket does not allow concurrent writes)
-func (u *User) WriteMessage(messageType int, data []byte) error {
-	u.WriteMutex.Lock()
-	defer u.WriteMutex.Unlock()
+// HoldBroadcasts: queues broadcasts instead of sending them (call before joining
+// the room, so nothing that lands after the sync snapshot is missed)
+func (u *User) HoldBroadcasts() {
+	u.holdMutex.Lock()
+	defer u.holdMutex.Unlock()
+
+	u.holding = true
+}
+
+// ReleaseBroadcasts: sends queued broadcasts in order, then delivers directly again
+// Broadcasts already reflected in the sync may arrive twice, clients apply them idempotently
+func (u *User) ReleaseBroadcasts() error {
+	u.holdMutex.Lock()
+	defer u.holdMutex.Unlock()
+
+	held := u.held
+	u.held = nil
+	u.holding = false
+
+	// Up to maxHeldBroadcasts can be waiting, more than the send queue holds,
+	// so this waits for the writer instead of dropping the user
+	for _, msg := range held {
+		if err := u.enqueue(frame{u.broadcastType(), msg}, writeWait); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// broadcastType: frame type of broadcasts, already encoded for this connection
+// (see room.Broadcaster)
+func (u *User) broadcastType() int {
+	if u.Msgpack() {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
+
+// Deliver: sends a broadcast, or queues it while broadcasts are held
+// data is in the connection's encoding (MessagePack if Msgpack, else JSON)
+func (u *User) Deliver(data []byte) error {
+	u.holdMutex.Lock()
+	if u.holding {
+		defer u.holdMutex.Unlock()
+		if len(u.held) >= maxHeldBroadcasts {
+			return ErrHoldOverflow
+		}
+		u.held = append(u.held, data)
+		return nil
+	}
+	u.holdMutex.Unlock()
+
+	return u.WriteMessage(u.broadcastType(), data)
+}
+
+// NoticeAllowed: true at most once per interval, for notices that would
+// otherwise be sent once per dropped message
+func (u *User) NoticeAllowed(interval time.Duration) bool {
+	now := time.Now().UnixNano()
+	last := u.lastNotice.Load()
+	if now-last < int64(interval) {
+		return false
+	}
+	return u.lastNotice.CompareAndSwap(last, now)
+}
+
+// ClockOffset: estimated offset of this device's clock
+// ok is false if there are no timeSync samples yet
+func (u *User) ClockOffset() (time.Duration, bool) {
+	u.stateMutex.Lock()
+	defer u.stateMutex.Unlock()
+
+	return u.clockOffset, u.clockSamples > 0
+}
+
+// AddClockSample: folds a new offset sample into the connection's estimate
+func (u *User) AddClockSample(offset time.Duration) {
+	u.stateMutex.Lock()
+	defer u.stateMutex.Unlock()
+
+	// Moving average smooths network jitter between samples
+	if u.clockSamples == 0 {
+		u.clockOffset = offset
+	} else {
+		u.clockOffset = (u.clockOffset*4 + offset) / 5
+	}
+	u.clockSamples++
+}
+
+// SetLocale: locale the client declared (already resolved, see i18n.Resolve)
+func (u *User) SetLocale(locale string) {
+	u.stateMutex.Lock()
+	defer u.stateMutex.Unlock()
+
+	u.locale = locale
+}
+
+// SetRoomLocale: default locale of the room the connection is in
+func (u *User) SetRoomLocale(locale string) {
+	u.stateMutex.Lock()
+	defer u.stateMutex.Unlock()
+
+	u.roomLocale = locale
+}
+
+// Locale: locale for system texts, the client's own, else the room's, else English
+func (u *User) Locale() string {
+	u.stateMutex.Lock()
+	defer u.stateMutex.Unlock()
+
+	switch {
+	case u.locale != "":
+		return u.locale
+	case u.roomLocale != "":
+		return u.roomLocale
+	}
+	return i18n.Fallback
+}
 
-	return u.Connection.WriteMessage(messageType, data)
+// Text: system text for code in the connection's locale
+// Every text the server generates for a client goes through here
+func (u *User) Text(code string, params map[string]interface{}) string {
+	return i18n.Text(u.Locale(), code, params)
 }
@@ -1,26 +1,36 @@
 package user
 
 import (
+	"errors"
+	"log/slog"
 	"sync"
 	"time"
 
+	"main/internal/middleware"
+
 	"golang.org/x/time/rate"
 )
 
 type SessionManager struct {
-	sessions      map[string]*UserSession // userID -> session
-	tokenToUserID map[string]string       // token -> userID
-	mu            sync.RWMutex
+	sessions       map[string]*UserSession // userID -> session
+	tokenToUserID  map[string]string       // token -> userID
+	colorGenerator *ColorGenerator
+	limits         *middleware.RateLimit // per session message rates
+	mu             sync.RWMutex
 }
 
-func NewSessionManager() *SessionManager {
+func NewSessionManager(limits *middleware.RateLimit) *SessionManager {
 	return &SessionManager{
-		sessions:      make(map[string]*UserSession),
-		tokenToUserID: make(map[string]string),
+		sessions:       make(map[string]*UserSession),
+		tokenToUserID:  make(map[string]string),
+		colorGenerator: NewColorGenerator(),
+		limits:         limits,
 	}
 }
 
 // GetOrCreate: gets an existing session or creates a new one
+// color is the session color (generated if empty), it seeds the user's color in
+// each room they join, room colors (Room.UserColors) are what clients render
 func (sm *SessionManager) GetOrCreate(userID string, color string) *UserSession {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
@@ -34,13 +44,21 @@ func (sm *SessionManager) GetOrCreate(userID string, color string) *UserSession
 	// Create new session with generated token
 	now := time.Now()
 	token := GenerateSessionToken()
+	if color == "" {
+		color = sm.colorGenerator.NextColor()
+	}
 	session = &UserSession{
 		UserID:            userID,
 		SessionToken:      token,
+		TokenExpiresAt:    now.Add(sm.limits.SessionTokenTTL),
+		CreatedAt:         now,
 		LastSeen:          now,
-		LastCursorUpdate:  time.Time{},
-		ObjectRateLimiter: rate.NewLimiter(30, 10), // 30 msg/sec, burst of 10 for objects
-		CursorRateLimiter: rate.NewLimiter(60, 20), // 60 msg/sec, burst of 20 for cursor
+		ObjectRateLimiter: rate.NewLimiter(rate.Limit(sm.limits.MessagesPerSecond), sm.limits.BurstSize),
+		HostRateLimiter:   rate.NewLimiter(rate.Every(sm.limits.HostActionInterval), sm.limits.HostActionBurst),
+		ChatRateLimiter:   rate.NewLimiter(rate.Limit(sm.limits.ChatPerSecond), sm.limits.ChatBurstSize),
+		Color:             color,
+		ActiveRooms:       make(map[string]int),
+		attached:          make(map[*User]bool),
 	}
 	sm.sessions[userID] = session
 	sm.tokenToUserID[token] = userID
@@ -48,47 +66,63 @@ func (sm *SessionManager) GetOrCreate(userID string, color string) *UserSession
 }
 
 // ValidateToken: validate session token and returns the associated userID
+// Expired tokens (and rotated ones past their grace period) don't validate
 func (sm *SessionManager) ValidateToken(token string) (string, bool) {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
-
-	userID, exists := sm.tokenToUserID[token]
-	if !exists {
-		return "", false
-	}
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 
-	// Verify the session still exists
-	session, sessionExists := sm.sessions[userID]
-	if !sessionExists {
+	now := time.Now()
+	session, valid := sm.lookupToken(token, now)
+	if !valid {
 		return "", false
 	}
 
 	// Update last seen
-	session.LastSeen = time.Now()
-	return userID, true
+	session.LastSeen = now
+	return session.UserID, true
 }
 
-// GetSessionByToken: retrieve session by token
+// GetSessionByToken: retrieve session by token (unexpired, like ValidateToken)
 func (sm *SessionManager) GetSessionByToken(token string) (*UserSession, bool) {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
-	userID, exists := sm.tokenToUserID[token]
+	return sm.lookupToken(token, time.Now())
+}
+
+// SetToken: replaces the session's token, earlier tokens stop validating right
+// away (no grace period, unlike Rotate)
+func (sm *SessionManager) SetToken(userID string, token string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, exists := sm.sessions[userID]
 	if !exists {
-		return nil, false
+		return ErrSessionNotFound
+	}
+	if owner, taken := sm.tokenToUserID[token]; taken && owner != userID {
+		return errors.New("token already in use")
 	}
 
-	session, sessionExists := sm.sessions[userID]
-	return session, sessionExists
+	sm.replaceToken(session, token)
+	return nil
 }
 
-// UpdateTokenMapping: updates the token-to-userID mapping
-// Used when overriding a session's token
-func (sm *SessionManager) UpdateTokenMapping(token string, userID string) {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
+// TokenCount: number of token mappings (the session count, plus rotated tokens
+// still in their grace period)
+func (sm *SessionManager) TokenCount() int {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
 
-	sm.tokenToUserID[token] = userID
+	return len(sm.tokenToUserID)
+}
+
+// SessionCount: number of live sessions
+func (sm *SessionManager) SessionCount() int {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return len(sm.sessions)
 }
 
 // UpdateLastSeen: update last seen time for a user session
@@ -112,51 +146,130 @@ func (sm *SessionManager) LastSeen(userID string) (time.Time, bool) {
 	return time.Time{}, false
 }
 
-// LastCursor: gets the last cursor update time for a user session
-func (sm *SessionManager) LastCursor(userID string) (time.Time, bool) {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
+// ErrTooManyRooms: session already has the maximum number of rooms open
+var ErrTooManyRooms = errors.New("too many boards open")
 
-	if session, exists := sm.sessions[userID]; exists {
-		return session.LastCursorUpdate, true
+// EnterRoom: records a connection to roomCode, rejecting a new room beyond maxRooms
+// Extra connections to an already open room don't count against the limit
+func (sm *SessionManager) EnterRoom(userID string, roomCode string, maxRooms int) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, exists := sm.sessions[userID]
+	if !exists {
+		return ErrSessionNotFound
 	}
-	return time.Time{}, false
+
+	if session.ActiveRooms[roomCode] == 0 && len(session.ActiveRooms) >= maxRooms {
+		return ErrTooManyRooms
+	}
+	session.ActiveRooms[roomCode]++
+	session.visit(roomCode)
+	return nil
 }
 
-// UpdateLastCursor: updates the last cursor update time for a user session
-func (sm *SessionManager) UpdateLastCursor(userID string, lastCursorUpdate time.Time) {
+// ExitRoom: releases a connection recorded by EnterRoom
+func (sm *SessionManager) ExitRoom(userID string, roomCode string) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	if session, exists := sm.sessions[userID]; exists {
-		session.LastCursorUpdate = lastCursorUpdate
+	session, exists := sm.sessions[userID]
+	if !exists {
+		return
+	}
+
+	session.ActiveRooms[roomCode]--
+	if session.ActiveRooms[roomCode] <= 0 {
+		delete(session.ActiveRooms, roomCode)
 	}
 }
 
-// Remove:  removes a user session (called on disconnect)
-func (sm *SessionManager) Remove(userID string) {
+// ErrSessionNotFound: token doesn't belong to a live session
+var ErrSessionNotFound = errors.New("session not found")
+
+// Attach: binds connection u to the token's session, a session can have any
+// number of connections (one per device or room). Sets u.ID, u.Session and
+// the connection's own limiters. Balanced by Detach
+func (sm *SessionManager) Attach(token string, u *User) (*UserSession, error) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	// Remove token mapping if session exists
-	if session, exists := sm.sessions[userID]; exists {
-		delete(sm.tokenToUserID, session.SessionToken)
+	now := time.Now()
+	session, valid := sm.lookupToken(token, now)
+	if !valid {
+		return nil, ErrSessionNotFound
 	}
 
-	delete(sm.sessions, userID)
+	session.attached[u] = true
+	session.LastSeen = now
+	u.ID = session.UserID
+	u.Session = session
+	u.CursorRateLimiter = rate.NewLimiter(rate.Limit(sm.limits.CursorPerSecond), sm.limits.CursorBurstSize)
+	return session, nil
 }
 
-// Cleanup: removes expired user sessions
-func (sm *SessionManager) Cleanup() {
+// Detach: releases a connection bound by Attach (called on disconnect)
+// The session stays until Cleanup expires it, so reconnecting with its token
+// resumes the same user (and their room roles)
+func (sm *SessionManager) Detach(u *User) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
+	session, exists := sm.sessions[u.ID]
+	if !exists || session != u.Session {
+		return
+	}
+
+	delete(session.attached, u)
+	session.LastSeen = time.Now()
+}
+
+// Cleanup: removes expired user sessions, returns the removed sessions
+func (sm *SessionManager) Cleanup() []*UserSession {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	var expired []*UserSession
 	now := time.Now()
 	for userID, session := range sm.sessions {
-		// Remove sessions inactive for 1 hour
-		if now.Sub(session.LastSeen) > 1*time.Hour {
+		if session.previousToken != "" && !now.Before(session.previousExpiresAt) {
+			sm.dropPreviousToken(session)
+		}
+		// Remove sessions inactive for 1 hour or whose token expired (they can't
+		// be resumed), never one still connected
+		if len(session.attached) == 0 && (now.Sub(session.LastSeen) > 1*time.Hour || !now.Before(session.TokenExpiresAt)) {
 			delete(sm.tokenToUserID, session.SessionToken)
+			sm.dropPreviousToken(session)
 			delete(sm.sessions, userID)
+			expired = append(expired, session)
+		}
+	}
+
+	sm.repairTokens()
+	return expired
+}
+
+// repairTokens: drops mappings for tokens that aren't their session's current or
+// rotated out token (or whose session is gone) and restores missing mappings,
+// logging anything fixed
+// caller must hold write lock
+func (sm *SessionManager) repairTokens() {
+	dangling, missing := 0, 0
+	for token, userID := range sm.tokenToUserID {
+		session, exists := sm.sessions[userID]
+		if !exists || (session.SessionToken != token && session.previousToken != token) {
+			delete(sm.tokenToUserID, token)
+			dangling++
+		}
+	}
+	for userID, session := range sm.sessions {
+		if sm.tokenToUserID[session.SessionToken] != userID {
+			sm.tokenToUserID[session.SessionToken] = userID
+			missing++
 		}
 	}
+
+	if dangling > 0 || missing > 0 {
+		slog.Warn("Session tokens repaired", "dangling_removed", dangling, "missing_restored", missing)
+	}
 }
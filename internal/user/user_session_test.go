@@ -0,0 +1,132 @@
+package user
+
+import (
+	"errors"
+	"testing"
+
+	"main/internal/middleware"
+)
+
+func testSessions() *SessionManager {
+	return NewSessionManager(middleware.NewRateLimit(10, 1000, 250000, 100, 5, 1000, 30, 60))
+}
+
+func TestEnterRoomCap(t *testing.T) {
+	sm := testSessions()
+	sm.GetOrCreate("alice", "")
+
+	for _, code := range []string{"ONE", "TWO", "THREE"} {
+		if err := sm.EnterRoom("alice", code, 3); err != nil {
+			t.Fatalf("room %s: %v", code, err)
+		}
+	}
+	// Another tab on an open board doesn't use a slot
+	if err := sm.EnterRoom("alice", "TWO", 3); err != nil {
+		t.Fatalf("second connection to an open room: %v", err)
+	}
+	if err := sm.EnterRoom("alice", "FOUR", 3); !errors.Is(err, ErrTooManyRooms) {
+		t.Fatalf("room beyond the cap = %v, want ErrTooManyRooms", err)
+	}
+
+	// TWO is still open in one tab
+	sm.ExitRoom("alice", "TWO")
+	if err := sm.EnterRoom("alice", "FOUR", 3); !errors.Is(err, ErrTooManyRooms) {
+		t.Fatalf("after closing one of two tabs = %v, want ErrTooManyRooms", err)
+	}
+	sm.ExitRoom("alice", "TWO")
+	if err := sm.EnterRoom("alice", "FOUR", 3); err != nil {
+		t.Fatalf("after leaving a room: %v", err)
+	}
+}
+
+func TestEnterRoomUnknownSession(t *testing.T) {
+	sm := testSessions()
+	if err := sm.EnterRoom("nobody", "ONE", 3); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("EnterRoom = %v, want ErrSessionNotFound", err)
+	}
+	sm.ExitRoom("nobody", "ONE") // must not panic
+}
+
+// validTokens: how many of tokens validate
+func validTokens(sm *SessionManager, tokens ...string) int {
+	n := 0
+	for _, token := range tokens {
+		if _, ok := sm.ValidateToken(token); ok {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSetTokenReplacesIssuedToken(t *testing.T) {
+	sm := testSessions()
+	issued := sm.GetOrCreate("alice", "").SessionToken
+	if validTokens(sm, issued) != 1 || sm.TokenCount() != 1 {
+		t.Fatalf("new session: %d tokens mapped", sm.TokenCount())
+	}
+
+	// The auth flow swaps in the token it generated
+	authToken := GenerateSessionToken()
+	if err := sm.SetToken("alice", authToken); err != nil {
+		t.Fatal(err)
+	}
+	if validTokens(sm, issued, authToken) != 1 || sm.TokenCount() != 1 {
+		t.Errorf("after SetToken: %d valid, %d mapped, want only the auth token", validTokens(sm, issued, authToken), sm.TokenCount())
+	}
+	if userID, _ := sm.ValidateToken(authToken); userID != "alice" {
+		t.Errorf("auth token validates to %q", userID)
+	}
+
+	// Another session's token can't be taken over
+	bobToken := sm.GetOrCreate("bob", "").SessionToken
+	if err := sm.SetToken("alice", bobToken); err == nil {
+		t.Error("SetToken took another session's token")
+	}
+	if err := sm.SetToken("carol", GenerateSessionToken()); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("SetToken without a session = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestCleanupRepairsTokenMap(t *testing.T) {
+	sm := testSessions()
+	alice := sm.GetOrCreate("alice", "")
+	sm.GetOrCreate("bob", "")
+
+	sm.mu.Lock()
+	sm.tokenToUserID["stale"] = "alice"          // a token alice no longer has
+	sm.tokenToUserID["orphan"] = "gone"          // a session that's gone
+	delete(sm.tokenToUserID, alice.SessionToken) // alice's current token lost
+	sm.mu.Unlock()
+
+	sm.Cleanup()
+	if sm.TokenCount() != 2 {
+		t.Errorf("%d tokens mapped after repair, want one per session", sm.TokenCount())
+	}
+	if validTokens(sm, "stale", "orphan") != 0 {
+		t.Error("dangling tokens still validate")
+	}
+	if userID, ok := sm.ValidateToken(alice.SessionToken); !ok || userID != "alice" {
+		t.Error("missing mapping not restored")
+	}
+}
+
+func TestSessionLimitersFromConfig(t *testing.T) {
+	limits := middleware.NewRateLimit(10, 1000, 250000, 100, 5, 1000, 12, 34)
+	limits.CursorPerSecond, limits.CursorBurstSize = 56, 78
+	limits.ChatPerSecond, limits.ChatBurstSize = 2, 3
+	sm := NewSessionManager(limits)
+
+	u := &User{}
+	if _, err := sm.Attach(sm.GetOrCreate("alice", "").SessionToken, u); err != nil {
+		t.Fatal(err)
+	}
+	for class, want := range map[string]LimiterStatus{
+		"object": {Rate: 12, Burst: 34},
+		"cursor": {Rate: 56, Burst: 78},
+		"chat":   {Rate: 2, Burst: 3},
+	} {
+		if got := u.RateStatus()[class]; got.Rate != want.Rate || got.Burst != want.Burst {
+			t.Errorf("%s limiter = %v/s burst %d, want %v/s burst %d", class, got.Rate, got.Burst, want.Rate, want.Burst)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package user
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateStatusDrainsAndRecovers(t *testing.T) {
+	sessions := testSessions()
+	u := &User{}
+	if _, err := sessions.Attach(sessions.GetOrCreate("alice", "").SessionToken, u); err != nil {
+		t.Fatal(err)
+	}
+	objects := u.Session.ObjectRateLimiter
+
+	now := time.Now()
+	status := u.rateStatusAt(now)["object"]
+	if status.Tokens != 60 || status.Rate != 30 || status.Burst != 60 {
+		t.Fatalf("fresh object budget = %+v, want 60 tokens at 30/s, burst 60", status)
+	}
+
+	// Each message sent lowers it by one, reading it doesn't
+	for i := 1; i <= 10; i++ {
+		objects.AllowN(now, 1)
+		got := u.rateStatusAt(now)["object"].Tokens
+		if got != float64(60-i) {
+			t.Fatalf("after %d messages: %v tokens, want %d", i, got, 60-i)
+		}
+		if again := u.rateStatusAt(now)["object"].Tokens; again != got {
+			t.Fatalf("reading the budget used tokens: %v then %v", got, again)
+		}
+	}
+
+	// And it refills with time, up to the burst
+	for _, step := range []struct {
+		after time.Duration
+		want  float64
+	}{
+		{100 * time.Millisecond, 53},
+		{200 * time.Millisecond, 56},
+		{time.Second, 60},
+		{time.Minute, 60},
+	} {
+		if got := u.rateStatusAt(now.Add(step.after))["object"].Tokens; got != step.want {
+			t.Errorf("%v later: %v tokens, want %v", step.after, got, step.want)
+		}
+	}
+
+	// Overdrawn limiters report zero, not a negative budget
+	objects.ReserveN(now, 60)
+	if got := u.rateStatusAt(now)["object"].Tokens; got != 0 {
+		t.Errorf("overdrawn: %v tokens, want 0", got)
+	}
+}
+
+func TestRateStatusCoversEveryClass(t *testing.T) {
+	sessions := testSessions()
+	u := &User{}
+	if _, err := sessions.Attach(sessions.GetOrCreate("alice", "").SessionToken, u); err != nil {
+		t.Fatal(err)
+	}
+	status := u.RateStatus()
+	for _, class := range []string{"object", "cursor", "host", "chat"} {
+		if s, ok := status[class]; !ok || s.Burst == 0 {
+			t.Errorf("%s budget = %+v (reported %v)", class, s, ok)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package user
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"main/internal/metrics"
+	"main/internal/msgpack"
+
+	"github.com/gorilla/websocket"
+)
+
+// Send queue limits: a connection whose queue fills up is dropped (slow consumer)
+// rather than blocking broadcasts to everyone else
+const (
+	sendQueueSize = 256
+	writeWait     = 10 * time.Second // per write, also bounds the flush in StopWriter
+)
+
+// compressMinBytes: messages smaller than this (cursors, acks) are sent
+// uncompressed even if the connection negotiated compression, it wouldn't pay
+const compressMinBytes = 512
+
+var (
+	// ErrSlowConsumer: the send queue was full, the connection has been closed
+	ErrSlowConsumer = errors.New("send queue full, slow consumer dropped")
+	// ErrWriterStopped: the connection is closing, nothing more is sent
+	ErrWriterStopped = errors.New("connection writer stopped")
+)
+
+// frame: one queued WebSocket message (data, ping or close)
+type frame struct {
+	messageType int
+	data        []byte
+}
+
+// NewUser: user for a just established connection, with its writer goroutine
+// running. Every write to conn goes through the writer (see WriteMessage),
+// StopWriter must be called once the connection is done
+func NewUser(conn *websocket.Conn, info ConnectionInfo) *User {
+	u := &User{
+		Connection: conn,
+		Info:       info,
+		send:       make(chan frame, sendQueueSize),
+		stop:       make(chan struct{}),
+		writerDone: make(chan struct{}),
+	}
+	go u.writeLoop()
+	return u
+}
+
+// WriteMessage: queues a message for the writer goroutine, never blocks
+// A full queue drops the connection (ErrSlowConsumer)
+func (u *User) WriteMessage(messageType int, data []byte) error {
+	return u.enqueue(frame{messageType, data}, 0)
+}
+
+// enqueue: queues f, waiting up to wait for room in the queue
+func (u *User) enqueue(f frame, wait time.Duration) error {
+	select {
+	case <-u.stop:
+		return ErrWriterStopped
+	default:
+	}
+
+	select {
+	case u.send <- f:
+		return nil
+	default:
+	}
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case u.send <- f:
+			return nil
+		case <-u.stop:
+			return ErrWriterStopped
+		case <-timer.C:
+		}
+	}
+
+	u.dropSlow()
+	return ErrSlowConsumer
+}
+
+// dropSlow: closes a connection that can't keep up, its read loop then exits
+// and the usual cleanup removes it from the room
+func (u *User) dropSlow() {
+	u.dropOnce.Do(func() {
+		u.Logger().Warn("Slow consumer, dropping connection", "queued", len(u.send))
+		metrics.SlowConsumers.Inc()
+		u.Connection.Close()
+	})
+}
+
+// StopWriter: sends what's still queued (e.g. a final error and close frame)
+// and waits for the writer goroutine to exit. Safe to call more than once
+func (u *User) StopWriter() {
+	u.stopOnce.Do(func() {
+		close(u.stop)
+	})
+	<-u.writerDone
+}
+
+// writeLoop: the only goroutine writing to the connection
+func (u *User) writeLoop() {
+	defer close(u.writerDone)
+	defer u.stopOnce.Do(func() { close(u.stop) }) // later writes fail fast instead of filling the queue
+
+	for {
+		select {
+		case f := <-u.send:
+			if !u.write(f) {
+				return
+			}
+		case <-u.stop:
+			for {
+				select {
+				case f := <-u.send:
+					if !u.write(f) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write: writes one frame, closing the connection if it fails (the read loop
+// notices and cleans up). JSON text frames to MessagePack connections are
+// transcoded here, broadcasts arrive already encoded
+func (u *User) write(f frame) bool {
+	if f.messageType == websocket.TextMessage && u.Msgpack() {
+		packed, err := msgpack.FromJSON(f.data)
+		if err != nil {
+			u.Logger().Error("Encode message", "err", err)
+			return true // nothing sent, the connection is still fine
+		}
+		f = frame{websocket.BinaryMessage, packed}
+	}
+
+	u.Connection.SetWriteDeadline(time.Now().Add(writeWait))
+	if u.Info.Compression {
+		u.Connection.EnableWriteCompression(len(f.data) >= compressMinBytes)
+	}
+	if err := u.Connection.WriteMessage(f.messageType, f.data); err != nil {
+		if !errors.Is(err, websocket.ErrCloseSent) && !errors.Is(err, net.ErrClosed) {
+			u.Logger().Debug("Write failed", "err", err)
+		}
+		u.Connection.Close()
+		return false
+	}
+	return true
+}
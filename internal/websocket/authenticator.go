@@ -2,10 +2,17 @@ package transport
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"main/internal/i18n"
+	"main/internal/logging"
+	"main/internal/room"
 	"main/internal/user"
 
 	"github.com/gorilla/websocket"
@@ -28,25 +35,92 @@ type AuthResult struct {
 	UserID       string
 	SessionToken string
 	IsNewUser    bool
+	Locale       string            // declared locale resolved against the catalog, "" if none or unsupported
+	Subscription user.Subscription // broadcast filters, everything if none were declared
+	Resume       *room.ResumePoint // state the client already has (reconnect), nil if none
+	Spectator    bool              // mode: "spectator" (view only)
+	Encoding     string            // user.EncodingMsgpack or "" (JSON)
 }
 
+// parseMode: join mode from the query or authenticate message, "" or "editor"
+// to edit, "spectator" to watch (switching means reconnecting)
+func parseMode(mode string) (bool, error) {
+	switch mode {
+	case "", "editor":
+		return false, nil
+	case "spectator":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown mode: %q", mode)
+	}
+}
+
+// authRequest: what a client authenticates with, from the authenticate message
+// or (token in the HTTP request) the /ws request
+type authRequest struct {
+	Type   string `json:"type"`
+	Token  string `json:"token"`  // Session token for returning users
+	Locale string `json:"locale"` // optional, for system texts (e.g. "es", "es-MX")
+	// optional broadcast filters, e.g. {"cursors": false} (see room.ParseSubscription)
+	Subscriptions map[string]interface{} `json:"subscriptions"`
+	// optional, epoch and revision of the last sync / broadcast received (reconnect)
+	Epoch        string `json:"epoch"`
+	LastRevision uint64 `json:"lastRevision"`
+	Mode         string `json:"mode"` // optional, "spectator" to join view only
+	// optional, "msgpack" for MessagePack binary frames from here on (both ways)
+	Encoding string `json:"encoding"`
+}
+
+// options: the request's AuthResult without the identity (UserID, SessionToken
+// and IsNewUser are up to the caller)
+func (req *authRequest) options() (*AuthResult, error) {
+	subscription, err := room.ParseSubscription(req.Subscriptions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subscriptions: %w", err)
+	}
+	spectator, err := parseMode(req.Mode)
+	if err != nil {
+		return nil, err
+	}
+	encoding := req.Encoding
+	switch encoding {
+	case "json":
+		encoding = ""
+	case "", user.EncodingMsgpack:
+	default:
+		return nil, fmt.Errorf("unknown encoding: %q", req.Encoding)
+	}
+	var resume *room.ResumePoint
+	if req.Epoch != "" {
+		resume = &room.ResumePoint{Epoch: req.Epoch, Revision: req.LastRevision}
+	}
+	return &AuthResult{
+		Locale:       i18n.Resolve(req.Locale),
+		Subscription: subscription,
+		Resume:       resume,
+		Spectator:    spectator,
+		Encoding:     encoding,
+	}, nil
+}
+
+// maxAuthMessageSize: largest authenticate message read, in bytes
+const maxAuthMessageSize = 4096
+
 // Authenticate: reads and validates authentication message from new connection
 // Returns userID and session token. For new users, generates both.
 // For returning users, validates token and retrieves userID.
-func (a *Authenticator) Authenticate(conn *websocket.Conn, timeout time.Duration) (*AuthResult, error) {
-	// Read deadline
+// Logs to the connection's logger
+func (a *Authenticator) Authenticate(conn *websocket.Conn, timeout time.Duration, logger *slog.Logger) (*AuthResult, error) {
+	// Read deadline, and a limit: nothing larger is buffered (gorilla closes with 1009)
 	conn.SetReadDeadline(time.Now().Add(timeout))
+	conn.SetReadLimit(maxAuthMessageSize)
 	_, msg, err := conn.ReadMessage()
 	if err != nil {
 		return nil, fmt.Errorf("failed to receive auth message: %w", err)
 	}
 	conn.SetReadDeadline(time.Time{}) // Clear timeout
 
-	var authMsg struct {
-		Type  string `json:"type"`
-		Token string `json:"token"` // Session token for returning users
-	}
-
+	var authMsg authRequest
 	if err := json.Unmarshal(msg, &authMsg); err != nil {
 		return nil, fmt.Errorf("invalid auth message format: %w", err)
 	}
@@ -55,28 +129,97 @@ func (a *Authenticator) Authenticate(conn *websocket.Conn, timeout time.Duration
 		return nil, fmt.Errorf("expected authenticate message, got: %s", authMsg.Type)
 	}
 
+	result, err := authMsg.options()
+	if err != nil {
+		return nil, err
+	}
+
 	// Case 1: Returning user with valid token
 	if authMsg.Token != "" {
 		userID, valid := a.sessionMgr.ValidateToken(authMsg.Token)
 		if valid {
-			log.Printf("Returning user authenticated: %s", userID)
-			return &AuthResult{
-				UserID:       userID,
-				SessionToken: authMsg.Token,
-				IsNewUser:    false,
-			}, nil
+			logger.Info("Returning user authenticated", logging.KeyUserID, userID)
+			result.UserID = userID
+			result.SessionToken = authMsg.Token
+			return result, nil
 		}
-		log.Printf("Invalid or expired token provided, treating as new user")
+		logger.Warn("Invalid or expired token provided, treating as new user")
 	}
 
 	// Case 2: New user (empty token or invalid token)
-	userID := user.GenerateUUID()
-	sessionToken := user.GenerateSessionToken()
+	result.UserID = user.GenerateUUID()
+	result.SessionToken = user.GenerateSessionToken()
+	result.IsNewUser = true
 
-	log.Printf("New user created: %s", userID)
-	return &AuthResult{
-		UserID:       userID,
-		SessionToken: sessionToken,
-		IsNewUser:    true,
-	}, nil
+	logger.Info("New user created", logging.KeyUserID, result.UserID)
+	return result, nil
+}
+
+// ProtocolTokenPrefix: subprotocol carrying the session token, for browsers
+// (which can't set headers on the /ws request). Offered alongside ProtocolJSON
+// or ProtocolBinary, which the server then selects
+const ProtocolTokenPrefix = "whiteboard.token."
+
+// ErrInvalidToken: the /ws request carried a token that doesn't validate
+var ErrInvalidToken = errors.New("invalid or expired session token")
+
+// requestToken: the session token in the /ws request, "" if none. Looked for in
+// the Authorization header (Bearer), the subprotocols, then the token query param
+func requestToken(r *http.Request) string {
+	if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		return strings.TrimSpace(token)
+	}
+	for _, protocol := range websocket.Subprotocols(r) {
+		if token, found := strings.CutPrefix(protocol, ProtocolTokenPrefix); found {
+			return token
+		}
+	}
+	return r.URL.Query().Get("token")
+}
+
+// AuthenticateHTTP: authenticates from the /ws request, before upgrading, so a
+// bad token never gets a websocket. Returns nil (and no error) for requests
+// without a token, those authenticate in-band (see Authenticate). What the
+// authenticate message would carry comes from the query: locale, mode,
+// encoding, epoch, lastRevision and subscriptions (as JSON). Logs to the
+// connection's logger
+func (a *Authenticator) AuthenticateHTTP(r *http.Request, logger *slog.Logger) (*AuthResult, error) {
+	token := requestToken(r)
+	if token == "" {
+		return nil, nil
+	}
+
+	query := r.URL.Query()
+	req := authRequest{
+		Token:    token,
+		Locale:   query.Get("locale"),
+		Epoch:    query.Get("epoch"),
+		Mode:     query.Get("mode"),
+		Encoding: query.Get("encoding"),
+	}
+	if value := query.Get("lastRevision"); value != "" {
+		revision, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lastRevision: %q", value)
+		}
+		req.LastRevision = revision
+	}
+	if value := query.Get("subscriptions"); value != "" {
+		if err := json.Unmarshal([]byte(value), &req.Subscriptions); err != nil {
+			return nil, fmt.Errorf("invalid subscriptions: %w", err)
+		}
+	}
+	result, err := req.options()
+	if err != nil {
+		return nil, err
+	}
+
+	userID, valid := a.sessionMgr.ValidateToken(token)
+	if !valid {
+		return nil, ErrInvalidToken
+	}
+	logger.Info("Returning user authenticated before upgrade", logging.KeyUserID, userID)
+	result.UserID = userID
+	result.SessionToken = token
+	return result, nil
 }
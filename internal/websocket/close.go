@@ -0,0 +1,64 @@
+package transport
+
+import (
+	"encoding/json"
+
+	"main/internal/room"
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+)
+
+// Application close codes for connections that couldn't join, each sent after
+// a join_rejected message (4001 is user.CloseSessionRevoked, 4005
+// room.CloseSuperseded, 4007 room.CloseRoomClosed, 4008 room.CloseKicked)
+const (
+	CloseServerFull  = 4002 // the server has its maximum number of rooms
+	CloseAuthFailed  = 4003 // bad authenticate message or expired session
+	CloseRoomFull    = 4004 // no slot in the room (or its join queue)
+	CloseUnknownRoom = 4006 // room code not issued by the server (STRICT_ROOMS)
+)
+
+// CloseCode: a close code the server sends, and when
+type CloseCode struct {
+	Code    int    `json:"code"`
+	Meaning string `json:"meaning"`
+}
+
+// CloseCodes: every close code the pipeline sends (see fail, Drain, room signOut,
+// handlers revoked)
+var CloseCodes = []CloseCode{
+	{websocket.CloseGoingAway, "server shutting down, or the connection was lost while joining"},
+	{websocket.ClosePolicyViolation, "missing or invalid room code (join_rejected invalid_room_code is sent first), too many rooms open in the session (join_rejected too_many_rooms is sent first), or wrong room password"},
+	{websocket.CloseUnsupportedData, "binary frame from a connection that didn't negotiate the " + ProtocolBinary + " subprotocol or the msgpack encoding"},
+	{websocket.CloseInternalServerErr, "unexpected server error"},
+	{websocket.CloseTryAgainLater, "the room couldn't be joined (unexpected error)"},
+	{user.CloseSessionRevoked, "session token revoked from another connection of the session (revokeSession)"},
+	{CloseServerFull, "server at its maximum number of rooms, join_rejected (server_full) is sent first"},
+	{CloseAuthFailed, "bad authenticate message or expired session, join_rejected (auth_failed) is sent first"},
+	{CloseRoomFull, "room full (after waiting in the join queue, if enabled), join_rejected (room_full) is sent first"},
+	{CloseUnknownRoom, "room code not issued by the server (POST /rooms) or expired, only with STRICT_ROOMS set, join_rejected (unknown_room) is sent first"},
+	{room.CloseSuperseded, "the session joined the room from another connection, which replaced this one (error signed_in_elsewhere is sent first, don't reconnect)"},
+	{room.CloseRoomClosed, "an operator closed the room (room_closed is sent first, or join_rejected room_closed while joining), don't reconnect"},
+	{room.CloseKicked, "a moderator removed the user from the room (kicked is sent first, or join_rejected banned when rejoining after a ban), don't reconnect"},
+}
+
+// joinRejection: why a connection couldn't join, for the join_rejected message
+type joinRejection struct {
+	Reason string                 // room_full, server_full, auth_failed, too_many_rooms, unknown_room, invalid_room_code, room_closed or banned
+	Code   int                    // close code sent after it
+	Limit  map[string]interface{} // the limit that was hit, if any (e.g. maxSize)
+}
+
+// rejectAndClose: sends {"type":"join_rejected","reason",...limit} then a close
+// frame with the rejection's code. Both are queued behind earlier messages
+func rejectAndClose(u *user.User, rejection joinRejection, closeReason string) {
+	msg := map[string]interface{}{"type": "join_rejected", "reason": rejection.Reason}
+	for key, value := range rejection.Limit {
+		msg[key] = value
+	}
+	if encoded, err := json.Marshal(msg); err == nil {
+		u.WriteMessage(websocket.TextMessage, encoded)
+	}
+	u.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(rejection.Code, closeReason))
+}
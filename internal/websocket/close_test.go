@@ -0,0 +1,118 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"main/client"
+
+	"github.com/gorilla/websocket"
+)
+
+// rejected: the join_rejected message on conn and the close code after it
+func rejected(t *testing.T, conn *websocket.Conn) (map[string]interface{}, int) {
+	t.Helper()
+	rejection := readType(t, conn, "join_rejected")
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				t.Fatalf("connection ended with %v, want a close frame", err)
+			}
+			return rejection, closeErr.Code
+		}
+	}
+}
+
+func TestJoinRejections(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		setup  func(s *testServer) (roomCode string, token string)
+		reason string
+		code   int
+		limit  string
+	}{
+		{
+			name: "room full",
+			setup: func(s *testServer) (string, string) {
+				s.config.MaxRoomSize = 1
+				s.authenticate("full-room", "")
+				return "full-room", ""
+			},
+			reason: "room_full", code: CloseRoomFull, limit: "maxSize",
+		},
+		{
+			name: "server full",
+			setup: func(s *testServer) (string, string) {
+				s.config.MaxRooms = 1
+				s.authenticate("first-room", "")
+				return "second-room", ""
+			},
+			reason: "server_full", code: CloseServerFull, limit: "maxRooms",
+		},
+		{
+			name: "too many rooms",
+			setup: func(s *testServer) (string, string) {
+				s.config.MaxRoomsPerSession = 1
+				_, authenticated := s.authenticate("first-room", "")
+				return "second-room", authenticated["token"].(string)
+			},
+			reason: "too_many_rooms", code: websocket.ClosePolicyViolation, limit: "maxRooms",
+		},
+		{
+			name: "invalid room code",
+			setup: func(s *testServer) (string, string) {
+				return "not%20a%20code", ""
+			},
+			reason: "invalid_room_code", code: websocket.ClosePolicyViolation,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			roomCode, token := tc.setup(s)
+			rejection, code := rejected(t, s.dial(roomCode, token))
+			if rejection["reason"] != tc.reason {
+				t.Errorf("reason = %v, want %s", rejection["reason"], tc.reason)
+			}
+			if tc.limit != "" && rejection[tc.limit] == nil {
+				t.Errorf("join_rejected = %v, want %s", rejection, tc.limit)
+			}
+			if code != tc.code {
+				t.Errorf("close code = %d, want %d", code, tc.code)
+			}
+		})
+	}
+}
+
+func TestBadAuthenticateRejected(t *testing.T) {
+	s := newTestServer(t)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.http.URL, "http")+"?room=auth-room", map[string][]string{"Origin": {testOrigin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.WriteJSON(map[string]interface{}{"type": "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	rejection, code := rejected(t, conn)
+	if rejection["reason"] != "auth_failed" || code != CloseAuthFailed {
+		t.Errorf("rejection %v with close %d, want auth_failed and %d", rejection, code, CloseAuthFailed)
+	}
+}
+
+func TestClientReportsJoinRejected(t *testing.T) {
+	s := newTestServer(t)
+	s.config.MaxRoomSize = 1
+	s.connect("full-room")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := client.Connect(ctx, "ws"+strings.TrimPrefix(s.http.URL, "http"), "full-room", "", client.WithOrigin(testOrigin))
+	var rejectedErr *client.JoinRejectedError
+	if !errors.As(err, &rejectedErr) || rejectedErr.Reason != "room_full" {
+		t.Errorf("connect to a full room: %v, want JoinRejectedError room_full", err)
+	}
+}
@@ -0,0 +1,159 @@
+package transport
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"main/internal/object"
+
+	"github.com/gorilla/websocket"
+)
+
+// countingConn: a net.Conn counting the bytes read from it
+type countingConn struct {
+	net.Conn
+	read *atomic.Int64
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+// compressedServer: a test server offering permessage-deflate
+func compressedServer(t *testing.T) *testServer {
+	s := newTestServer(t)
+	s.config.Compression = true
+	s.pipeline.upgrader.EnableCompression = true
+	return s
+}
+
+// dialCounting: like dial, offering compression if compress, with the bytes
+// read off the wire counted in read
+func (s *testServer) dialCounting(roomCode string, compress bool, read *atomic.Int64) *websocket.Conn {
+	s.t.Helper()
+	dialer := websocket.Dialer{
+		EnableCompression: compress,
+		NetDial: func(network, addr string) (net.Conn, error) {
+			conn, err := net.Dial(network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return countingConn{Conn: conn, read: read}, nil
+		},
+	}
+	header := http.Header{"Origin": {testOrigin}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(s.http.URL, "http")+"?room="+roomCode, header)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.t.Cleanup(func() { conn.Close() })
+	if err := conn.WriteJSON(map[string]interface{}{"type": "authenticate"}); err != nil {
+		s.t.Fatal(err)
+	}
+	return conn
+}
+
+// readSync: reads conn's sync and any chunks following it, the objects received
+func readSync(t *testing.T, conn *websocket.Conn) int {
+	t.Helper()
+	sync := readType(t, conn, "sync")
+	objects := len(sync["objects"].([]interface{}))
+	chunks, _ := sync["chunks"].(float64)
+	for i := 0; i < int(chunks); i++ {
+		objects += len(readType(t, conn, "syncChunk")["objects"].([]interface{}))
+	}
+	return objects
+}
+
+func TestCompressedSyncSmallerOnTheWire(t *testing.T) {
+	s := compressedServer(t)
+	s.connect("deflate-room")
+	rm, _ := s.rooms.GetRoom("deflate-room")
+	const strokes = 1000
+	for i := 0; i < strokes; i++ {
+		points := make([]interface{}, 50)
+		for p := range points {
+			points[p] = map[string]interface{}{"x": float64(i + p), "y": float64(2*p + 1)}
+		}
+		err := rm.AddObject(&object.Drawing{
+			ID:   fmt.Sprintf("s%d", i),
+			Type: "stroke",
+			Data: map[string]interface{}{"points": points, "color": "#000000", "width": 2},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var plainBytes, compressedBytes atomic.Int64
+	plain := s.dialCounting("deflate-room", false, &plainBytes)
+	if n := readSync(t, plain); n != strokes {
+		t.Fatalf("uncompressed sync has %d objects, want %d", n, strokes)
+	}
+	compressed := s.dialCounting("deflate-room", true, &compressedBytes)
+	if n := readSync(t, compressed); n != strokes {
+		t.Fatalf("compressed sync has %d objects, want %d", n, strokes)
+	}
+
+	t.Logf("sync of %d strokes: %d bytes uncompressed, %d compressed", strokes, plainBytes.Load(), compressedBytes.Load())
+	if compressedBytes.Load()*4 > plainBytes.Load() {
+		t.Errorf("compressed sync is %d bytes, want under a quarter of %d", compressedBytes.Load(), plainBytes.Load())
+	}
+}
+
+func TestCompressionNegotiatedPerConnection(t *testing.T) {
+	s := compressedServer(t)
+	var read atomic.Int64
+	readSync(t, s.dialCounting("mixed-room", true, &read))
+	readSync(t, s.dialCounting("mixed-room", false, &read))
+
+	rm, _ := s.rooms.GetRoom("mixed-room")
+	negotiated := 0
+	for _, u := range rm.GetConnections() {
+		if u.Info.Compression {
+			negotiated++
+		}
+	}
+	if negotiated != 1 {
+		t.Errorf("%d connections compressed, want only the one that offered it", negotiated)
+	}
+}
+
+func TestPingPongWithCompression(t *testing.T) {
+	s := compressedServer(t)
+	var read atomic.Int64
+	conn := s.dialCounting("ping-room", true, &read)
+	readSync(t, conn)
+
+	pongs := make(chan string, 1)
+	conn.SetPongHandler(func(appData string) error {
+		pongs <- appData
+		return nil
+	})
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	if err := conn.WriteControl(websocket.PingMessage, []byte("probe"), time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case appData := <-pongs:
+		if appData != "probe" {
+			t.Errorf("pong carried %q, want the ping's payload", appData)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no pong with compression enabled")
+	}
+}
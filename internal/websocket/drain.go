@@ -0,0 +1,105 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrDraining: server is shutting down and no longer accepts connections
+var ErrDraining = errors.New("server shutting down")
+
+// connTracker: open WebSocket connections, so shutdown can close them and wait
+// for their read loops (http.Server.Shutdown doesn't track hijacked connections)
+type connTracker struct {
+	conns    map[*user.User]struct{}
+	draining bool
+	done     sync.WaitGroup // one per tracked connection, released after its cleanup
+	mu       sync.Mutex
+}
+
+// track: registers a connection, false once draining has started
+func (t *connTracker) track(u *user.User) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.draining {
+		return false
+	}
+	if t.conns == nil {
+		t.conns = make(map[*user.User]struct{})
+	}
+	t.conns[u] = struct{}{}
+	t.done.Add(1)
+	return true
+}
+
+// untrack: called once the connection is closed and cleaned up
+func (t *connTracker) untrack(u *user.User) {
+	t.mu.Lock()
+	delete(t.conns, u)
+	t.mu.Unlock()
+
+	t.done.Done()
+}
+
+// startDrain: stops new connections, returns the open ones
+func (t *connTracker) startDrain() []*user.User {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.draining = true
+	conns := make([]*user.User, 0, len(t.conns))
+	for u := range t.conns {
+		conns = append(conns, u)
+	}
+	return conns
+}
+
+// Accepting: false once Drain has started
+func (p *ConnectionPipeline) Accepting() bool {
+	p.tracker.mu.Lock()
+	defer p.tracker.mu.Unlock()
+
+	return !p.tracker.draining
+}
+
+// Drain: shuts the WebSocket side down. Stops accepting connections, sends
+// server_shutdown to every room, closes every connection with 1001 (going away)
+// and waits for their read loops to exit and clean up. Connections still open
+// when ctx is done are closed without waiting further
+func (p *ConnectionPipeline) Drain(ctx context.Context) error {
+	conns := p.tracker.startDrain()
+
+	for _, rm := range p.roomManager.Rooms() {
+		p.broadcaster.BroadcastSystem(ctx, rm, map[string]interface{}{"type": "server_shutdown"}, "server_shutdown", nil)
+	}
+
+	// Queued behind server_shutdown, so clients get the notice before the close
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for _, u := range conns {
+		u.WriteMessage(websocket.CloseMessage, closeMsg)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		p.tracker.done.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		slog.Info("Drained connections", "connections", len(conns))
+		return nil
+	case <-ctx.Done():
+		for _, u := range conns {
+			u.Connection.Close()
+		}
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,144 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"main/client"
+	"main/internal/analytics"
+	"main/internal/handlers"
+	"main/internal/middleware"
+	"main/internal/object"
+	"main/internal/room"
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+)
+
+// testOrigin: the origin test clients connect from (see upgrader's CheckOrigin)
+const testOrigin = "http://whiteboard.test"
+
+// testServer: the full connection pipeline behind an httptest server
+type testServer struct {
+	t        *testing.T
+	http     *httptest.Server
+	config   *middleware.RateLimit
+	sessions *user.SessionManager
+	rooms    *room.Manager
+	pipeline *ConnectionPipeline
+}
+
+// newTestServer: a server whose analytics events go to sinks
+func newTestServer(t *testing.T, sinks ...analytics.Sink) *testServer {
+	t.Helper()
+	t.Setenv("DOMAINS", testOrigin)
+
+	config := middleware.NewRateLimit(10, 1000, 250000, 100, 5, 1000, 1e6, 1e6)
+	config.CursorPerSecond, config.CursorBurstSize = 1e6, 1e6
+	sessions := user.NewSessionManager(config)
+	rooms := room.NewManager(nil)
+	broadcaster := room.NewBroadcaster()
+	synchronizer := room.NewSynchronizer(config.MaxSyncSize)
+	router := handlers.NewMessageRouter(object.NewValidator(), config, broadcaster, synchronizer, sessions)
+
+	events := analytics.NewBus(64)
+	for _, sink := range sinks {
+		events.AddSink(sink)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go events.Run(ctx)
+
+	s := &testServer{
+		t:        t,
+		config:   config,
+		sessions: sessions,
+		rooms:    rooms,
+		pipeline: NewConnectionPipeline(middleware.NewIPRateLimit(1e6, 1e6, 1000, nil), config, sessions, rooms, router, synchronizer, NewAuthenticator(sessions), broadcaster, events),
+	}
+	s.http = httptest.NewServer(s.pipeline)
+	t.Cleanup(func() {
+		s.http.Close()
+		cancel()
+	})
+	return s
+}
+
+// connect: a client joined to roomCode, closed when the test ends
+func (s *testServer) connect(roomCode string, opts ...client.Option) *client.Client {
+	s.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, err := client.Connect(ctx, "ws"+strings.TrimPrefix(s.http.URL, "http"), roomCode, "", append(opts, client.WithOrigin(testOrigin))...)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// dial: a raw connection to roomCode that has sent authenticate (with token,
+// if any), for checking the handshake messages themselves
+func (s *testServer) dial(roomCode string, token string) *websocket.Conn {
+	s.t.Helper()
+	header := http.Header{"Origin": {testOrigin}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.http.URL, "http")+"?room="+roomCode, header)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.t.Cleanup(func() { conn.Close() })
+	if err := conn.WriteJSON(map[string]interface{}{"type": "authenticate", "token": token}); err != nil {
+		s.t.Fatal(err)
+	}
+	return conn
+}
+
+// readType: the next message of type msgType on conn, skipping others
+func readType(t *testing.T, conn *websocket.Conn, msgType string) map[string]interface{} {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var msg map[string]interface{}
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("waiting for %s: %v", msgType, err)
+		}
+		if msg["type"] == msgType {
+			return msg
+		}
+	}
+}
+
+// recordingSink: keeps every event it's handed
+type recordingSink struct {
+	mu     sync.Mutex
+	events []analytics.Event
+}
+
+func (s *recordingSink) Handle(e analytics.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+}
+
+// wait: the events received once there are n (fails the test after a while)
+func (s *recordingSink) wait(t *testing.T, n int) []analytics.Event {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s.mu.Lock()
+		events := append([]analytics.Event(nil), s.events...)
+		s.mu.Unlock()
+		if len(events) >= n || time.Now().After(deadline) {
+			if len(events) < n {
+				t.Fatalf("got %d events, want %d: %+v", len(events), n, events)
+			}
+			return events
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,93 @@
+package transport
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// closeCode: the close code conn ends with, failing if it doesn't close in time
+func closeCode(t *testing.T, conn *websocket.Conn) int {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				t.Fatalf("connection ended with %v, want a close frame", err)
+			}
+			return closeErr.Code
+		}
+	}
+}
+
+func TestOversizedAuthMessageClosesPromptly(t *testing.T) {
+	s := newTestServer(t)
+	header := http.Header{"Origin": {testOrigin}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.http.URL, "http")+"?room=auth-room", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	// A masked text frame header announcing 1GB, and none of the payload: a
+	// server that buffered before checking would wait here until the deadline
+	frame := []byte{0x81, 0x80 | 127}
+	frame = binary.BigEndian.AppendUint64(frame, 1<<30)
+	frame = append(frame, 1, 2, 3, 4) // masking key
+	if _, err := conn.UnderlyingConn().Write(frame); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if code := closeCode(t, conn); code != websocket.CloseMessageTooBig {
+		t.Errorf("close code = %d, want %d", code, websocket.CloseMessageTooBig)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("closed after %v", elapsed)
+	}
+
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 16<<20 {
+		t.Errorf("allocated %d bytes for a rejected frame", allocated)
+	}
+}
+
+func TestOversizedMessageClosesConnection(t *testing.T) {
+	s := newTestServer(t)
+	conn, _ := s.authenticate("size-room", "")
+
+	msg := `{"type":"chat","text":"` + strings.Repeat("a", s.config.MaxMessageSize) + `"}`
+	conn.WriteMessage(websocket.TextMessage, []byte(msg)) // the server may close mid-write
+	if code := closeCode(t, conn); code != websocket.CloseMessageTooBig {
+		t.Errorf("close code = %d, want %d", code, websocket.CloseMessageTooBig)
+	}
+}
+
+func TestCompressedMessageLimitedAfterInflating(t *testing.T) {
+	s := compressedServer(t)
+	var read atomic.Int64
+	conn := s.dialCounting("bomb-room", true, &read)
+	readSync(t, conn)
+
+	// a few KB on the wire, over the limit once inflated
+	conn.EnableWriteCompression(true)
+	msg := `{"type":"chat","text":"` + strings.Repeat("a", 4*s.config.MaxMessageSize) + `"}`
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+	if code := closeCode(t, conn); code != websocket.CloseMessageTooBig {
+		t.Errorf("close code = %d, want %d", code, websocket.CloseMessageTooBig)
+	}
+}
@@ -0,0 +1,551 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"main/internal/analytics"
+	"main/internal/handlers"
+	"main/internal/logging"
+	"main/internal/middleware"
+	"main/internal/room"
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+)
+
+// authTimeout: how long a new connection has to send its authenticate message
+const authTimeout = 5 * time.Second
+
+// maxCloseReason: close frame payloads are limited to 125 bytes, 2 of them the code
+const maxCloseReason = 123
+
+// ConnState: state carried between pipeline stages, each stage fills in its part
+type ConnState struct {
+	ConnID      string
+	Log         *slog.Logger // conn_id and remote_ip, then room and user_id once known
+	ClientIP    string
+	RoomCode    string
+	Password    string // room password from the query, never logged
+	Mode        string // join mode from the query ("spectator" to watch), see parseMode
+	Conn        *websocket.Conn
+	ConnectedAt time.Time
+	Auth        *AuthResult
+	Session     *user.UserSession
+	User        *user.User
+	Room        *room.Room
+	JoinedAt    time.Time
+}
+
+// StageError: failure in a pipeline stage, Code is the WebSocket close code sent to the client
+type StageError struct {
+	Stage  string
+	Code   int
+	Reason string // optional close reason shown to the client
+	Err    error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	// ErrRateLimited: connection rejected by the per-IP rate limiter (before upgrade)
+	ErrRateLimited = errors.New("too many connections")
+	// ErrTooManyOpen: the IP already has its maximum of open connections (before upgrade)
+	ErrTooManyOpen = errors.New("too many open connections")
+	// ErrAuthFailed: bad authenticate message, or the session expired meanwhile
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrConnectionLost: a write to the client failed, no further writes are attempted
+	ErrConnectionLost = errors.New("connection lost")
+)
+
+// ConnectionPipeline: admits, upgrades, authenticates, and serves WebSocket connections
+// Each stage is a method so it can be exercised on its own
+type ConnectionPipeline struct {
+	ipRateLimiter *middleware.IPRateLimit
+	config        *middleware.RateLimit
+	sessionMgr    *user.SessionManager
+	roomManager   *room.Manager
+	msgRouter     *handlers.MessageRouter
+	synchronizer  *room.Synchronizer
+	authenticator *Authenticator
+	broadcaster   *room.Broadcaster
+	events        *analytics.Bus
+	tracker       connTracker // open connections, for Drain
+	upgrader      websocket.Upgrader
+}
+
+// NewConnectionPipeline: creates a pipeline with its dependencies
+func NewConnectionPipeline(
+	ipRateLimiter *middleware.IPRateLimit,
+	config *middleware.RateLimit,
+	sessionMgr *user.SessionManager,
+	roomManager *room.Manager,
+	msgRouter *handlers.MessageRouter,
+	synchronizer *room.Synchronizer,
+	authenticator *Authenticator,
+	broadcaster *room.Broadcaster,
+	events *analytics.Bus,
+) *ConnectionPipeline {
+	// Compression is offered only if configured, clients choose whether to use it
+	withCompression := upgrader
+	withCompression.EnableCompression = config.Compression
+
+	return &ConnectionPipeline{
+		upgrader:      withCompression,
+		ipRateLimiter: ipRateLimiter,
+		config:        config,
+		sessionMgr:    sessionMgr,
+		roomManager:   roomManager,
+		msgRouter:     msgRouter,
+		synchronizer:  synchronizer,
+		authenticator: authenticator,
+		broadcaster:   broadcaster,
+		events:        events,
+	}
+}
+
+// ServeHTTP: runs all stages for one connection
+func (p *ConnectionPipeline) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	st, err := p.Admit(r)
+	if errors.Is(err, ErrTooManyOpen) {
+		st.Log.Warn("Open connection limit reached")
+		http.Error(w, "Too many open connections", http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		st.Log.Warn("Connection rate limit exceeded")
+		http.Error(w, "Too many connections", http.StatusTooManyRequests)
+		return
+	}
+	// Deferred first so it runs last, on every exit path (panics included)
+	defer p.ipRateLimiter.Release(st.ClientIP)
+
+	// A token in the request is checked before upgrading (see AuthenticateHTTP)
+	st.Auth, err = p.authenticator.AuthenticateHTTP(r, st.Log)
+	if errors.Is(err, ErrInvalidToken) {
+		st.Log.Warn("Rejected /ws request", "err", err)
+		http.Error(w, "Invalid or expired session token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		st.Log.Warn("Rejected /ws request", "err", err)
+		http.Error(w, "Invalid authentication parameters", http.StatusBadRequest)
+		return
+	}
+
+	if err := p.Upgrade(w, r, st); err != nil {
+		st.Log.Warn("Upgrade failed", "err", err)
+		return
+	}
+	defer st.Conn.Close()
+	defer st.User.StopWriter() // flushes queued messages (e.g. a close frame) first
+
+	// Connections arriving mid-shutdown are turned away, the rest are waited for by Drain
+	if !p.tracker.track(st.User) {
+		p.fail(st, &StageError{Stage: "upgrade", Code: websocket.CloseGoingAway, Reason: "server shutting down", Err: ErrDraining})
+		return
+	}
+	defer p.tracker.untrack(st.User)
+
+	// Release room slot and session on every exit path after the session exists
+	defer cleanup(st, p.sessionMgr, p.msgRouter)
+
+	stages := []func(*ConnState) error{
+		p.Authenticate,
+		p.EstablishSession,
+		p.JoinRoom,
+	}
+	for _, stage := range stages {
+		if err := stage(st); err != nil {
+			p.fail(st, err)
+			return
+		}
+	}
+
+	defer p.emitLeft(st)
+	p.msgRouter.Joined(st.Room, st.User)
+	p.Serve(st)
+}
+
+// Admit: pre-upgrade checks (per-IP connection rate and open connections)
+// The client IP is RemoteAddr, or who a trusted proxy forwards for. Once
+// admitted, the caller must Release the IP's open connection
+func (p *ConnectionPipeline) Admit(r *http.Request) (*ConnState, error) {
+	st := &ConnState{ConnID: logging.NewConnID(), ClientIP: p.ipRateLimiter.ClientIP(r)}
+	st.Log = slog.Default().With(logging.KeyConnID, st.ConnID, logging.KeyRemoteIP, st.ClientIP)
+	if !p.ipRateLimiter.Allow(st.ClientIP) {
+		return st, ErrRateLimited
+	}
+	if !p.ipRateLimiter.Acquire(st.ClientIP) {
+		return st, ErrTooManyOpen
+	}
+	return st, nil
+}
+
+// Upgrade: upgrades HTTP to WebSocket and reads the room code (and password)
+func (p *ConnectionPipeline) Upgrade(w http.ResponseWriter, r *http.Request, st *ConnState) error {
+	// Set security headers before upgrade
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	conn, err := p.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return err
+	}
+	compressed := p.upgrader.EnableCompression && offersDeflate(r)
+	if compressed {
+		conn.SetCompressionLevel(p.config.CompressionLevel)
+	}
+	st.Conn = conn
+	st.ConnectedAt = time.Now()
+	st.RoomCode = r.URL.Query().Get("room")
+	st.Password = r.URL.Query().Get("password")
+	st.Mode = r.URL.Query().Get("mode")
+
+	// Connection info is captured now, ID and session are set once authenticated
+	st.User = user.NewUser(conn, user.ConnectionInfo{
+		ClientIP:    st.ClientIP,
+		UserAgent:   r.UserAgent(),
+		Protocol:    conn.Subprotocol(),
+		Compression: compressed,
+		ConnectedAt: st.ConnectedAt,
+	})
+	st.User.SetLogger(st.Log)
+	return nil
+}
+
+// Authenticate: validates token or creates new user, from the authenticate
+// message unless the /ws request already authenticated (st.Auth set)
+func (p *ConnectionPipeline) Authenticate(st *ConnState) error {
+	roomCode, err := room.ValidateRoomCode(st.RoomCode)
+	if err != nil {
+		return &StageError{Stage: "upgrade", Code: websocket.ClosePolicyViolation, Reason: "invalid room code", Err: err}
+	}
+	st.RoomCode = roomCode // canonical, the room's Code
+	st.Log = st.Log.With(logging.KeyRoom, roomCode)
+	st.User.SetLogger(st.Log)
+	spectator, err := parseMode(st.Mode)
+	if err != nil {
+		return &StageError{Stage: "upgrade", Code: websocket.ClosePolicyViolation, Reason: err.Error(), Err: err}
+	}
+
+	authResult := st.Auth
+	if authResult == nil {
+		authResult, err = p.authenticator.Authenticate(st.Conn, authTimeout, st.Log)
+		if errors.Is(err, websocket.ErrReadLimit) {
+			return &StageError{Stage: "authenticate", Code: websocket.CloseMessageTooBig, Err: err}
+		}
+		if err != nil {
+			return &StageError{Stage: "authenticate", Code: CloseAuthFailed, Err: fmt.Errorf("%w: %v", ErrAuthFailed, err)}
+		}
+	}
+	st.Auth = authResult
+	st.Log = st.Log.With(logging.KeyUserID, authResult.UserID)
+	st.User.SetLogger(st.Log)
+	// Either the query or the authenticate message can ask for view only
+	st.User.Spectator = spectator || authResult.Spectator
+	st.User.Encoding = authResult.Encoding // the authenticated reply is the first message in it
+	return nil
+}
+
+// EstablishSession: gets or creates the session and sends the token to the client
+// A returning token may already be in use by other connections (devices), they
+// share the session and keep working (see room.Join for the same room)
+// Returning tokens are rotated, the client must store the one sent back
+func (p *ConnectionPipeline) EstablishSession(st *ConnState) error {
+	authResult := st.Auth
+
+	if authResult.IsNewUser {
+		// Create new session, then swap in the token generated during auth
+		// (replaces the one GetOrCreate issued, so only one token validates)
+		p.sessionMgr.GetOrCreate(authResult.UserID, "")
+		if err := p.sessionMgr.SetToken(authResult.UserID, authResult.SessionToken); err != nil {
+			return &StageError{Stage: "session", Code: websocket.CloseInternalServerErr, Err: fmt.Errorf("set session token: %w", err)}
+		}
+	} else {
+		// The presented token stays valid for user.TokenGrace (other tabs)
+		token, err := p.sessionMgr.Rotate(authResult.SessionToken)
+		if err != nil {
+			return &StageError{Stage: "session", Code: CloseAuthFailed, Reason: "session expired, please reconnect", Err: fmt.Errorf("%w: %v", ErrAuthFailed, err)}
+		}
+		authResult.SessionToken = token
+	}
+
+	// Session may have expired since the token was validated
+	session, err := p.sessionMgr.Attach(authResult.SessionToken, st.User)
+	if err != nil {
+		return &StageError{Stage: "session", Code: CloseAuthFailed, Reason: "session expired, please reconnect", Err: fmt.Errorf("%w: %v", ErrAuthFailed, err)}
+	}
+	st.Session = session
+	st.User.SetLocale(authResult.Locale)
+	st.User.SetSubscription(authResult.Subscription)
+
+	userHash := analytics.AnonymizeID(authResult.UserID)
+	if authResult.IsNewUser {
+		p.events.Emit(analytics.Event{Type: analytics.SessionCreated, UserHash: userHash})
+	} else {
+		p.events.Emit(analytics.Event{Type: analytics.SessionResumed, UserHash: userHash})
+	}
+
+	// Send authentication response with token to client
+	response := map[string]interface{}{
+		"type":   "authenticated",
+		"userId": authResult.UserID,
+		"token":  authResult.SessionToken, // Client must store this token
+		// The token can be used from several devices at once: each connection has
+		// its own cursor and clock state, edits share one rate budget, and joining
+		// a room the session is already in signs the other connection out of it
+		// (error signed_in_elsewhere, the signed out client shouldn't reconnect)
+		"multiDevice": map[string]interface{}{
+			"maxRooms": p.config.MaxRoomsPerSession,
+			"sameRoom": "replace",
+		},
+	}
+	if authResult.Locale != "" {
+		response["locale"] = authResult.Locale // what system texts will be in
+	}
+	if p.config.Banner != "" {
+		response["banner"] = p.config.Banner
+	}
+	// Only control messages are handled until acceptTerms (see handlers.TermsPending)
+	if p.config.TermsVersion != "" && !p.sessionMgr.TermsAccepted(authResult.UserID, p.config.TermsVersion) {
+		response["termsRequired"] = map[string]interface{}{
+			"version": p.config.TermsVersion,
+			"url":     p.config.TermsURL,
+		}
+	}
+	// room_joined carries the color to render, legacy clients read it from here
+	if p.config.LegacyAuthColor {
+		response["color"] = session.Color
+	}
+	if err := writeJSON(st.User, response); err != nil {
+		return &StageError{Stage: "session", Code: websocket.CloseInternalServerErr, Err: fmt.Errorf("send auth response: %w", err)}
+	}
+	return nil
+}
+
+// JoinRoom: joins (or creates) the room and syncs its state to the user
+// Join is undone if the user can't be sent the join response or room state
+func (p *ConnectionPipeline) JoinRoom(st *ConnState) (err error) {
+	if err := p.sessionMgr.EnterRoom(st.User.ID, st.RoomCode, p.config.MaxRoomsPerSession); err != nil {
+		return &StageError{Stage: "join", Code: websocket.ClosePolicyViolation, Reason: err.Error(), Err: err}
+	}
+	// Membership is released by cleanup once joined, or here if the join fails
+	defer func() {
+		if err != nil {
+			p.sessionMgr.ExitRoom(st.User.ID, st.RoomCode)
+		}
+	}()
+
+	// Broadcasts are queued from the moment the user is in the room until the
+	// sync is sent, so changes after the snapshot arrive after it, in order
+	st.User.HoldBroadcasts()
+
+	rm, err := p.roomManager.JoinRoom(st.RoomCode, st.Password, st.User, p.config)
+	if errors.Is(err, room.ErrRoomFull) && p.config.JoinQueueSize > 0 && !st.User.Spectator {
+		rm, err = p.waitForSlot(st)
+	}
+	if errors.Is(err, room.ErrWrongPassword) || errors.Is(err, room.ErrPasswordTooLong) {
+		return &StageError{Stage: "join", Code: websocket.ClosePolicyViolation, Reason: err.Error(), Err: fmt.Errorf("join room (%s): %w", st.RoomCode, err)}
+	}
+	if err != nil {
+		var stageErr *StageError
+		if errors.As(err, &stageErr) {
+			return err
+		}
+		return &StageError{Stage: "join", Code: websocket.CloseTryAgainLater, Err: fmt.Errorf("join room (%s): %w", st.RoomCode, err)}
+	}
+
+	// Send room-specific color after joining
+	response := map[string]interface{}{
+		"type":  "room_joined",
+		"color": rm.GetUserColor(st.User.ID),
+		"room":  st.RoomCode,
+		"timer": handlers.TimerMessage(rm.Timer()),
+		"role":  rm.Role(st.User.ID),
+		// Clients hide controls the role can't use, the server enforces them regardless
+		"permissions": rm.Permissions(),
+		"locale":      st.User.Locale(),
+		"roomLocale":  rm.Locale(),
+	}
+	if name := rm.UserName(st.User.ID); name != "" {
+		response["name"] = name // may have a suffix, another user here has the session's name
+	}
+	if err := writeJSON(st.User, response); err != nil {
+		rm.AbortJoin(st.User)
+		return &StageError{Stage: "join", Code: websocket.CloseGoingAway, Err: fmt.Errorf("%w: send room joined response: %v", ErrConnectionLost, err)}
+	}
+
+	// Sync room state to new user (only what changed if it's resuming)
+	if err := p.synchronizer.SyncUser(rm, st.User, st.Auth.Resume); err != nil {
+		rm.AbortJoin(st.User)
+		return &StageError{Stage: "sync", Code: websocket.CloseGoingAway, Err: fmt.Errorf("%w: %v", ErrConnectionLost, err)}
+	}
+	if err := p.synchronizer.SendNotices(rm, st.User); err != nil {
+		rm.AbortJoin(st.User)
+		return &StageError{Stage: "sync", Code: websocket.CloseGoingAway, Err: fmt.Errorf("%w: %v", ErrConnectionLost, err)}
+	}
+
+	if err := st.User.ReleaseBroadcasts(); err != nil {
+		rm.AbortJoin(st.User)
+		return &StageError{Stage: "sync", Code: websocket.CloseGoingAway, Err: fmt.Errorf("%w: %v", ErrConnectionLost, err)}
+	}
+
+	rm.ConfirmJoin(st.User.ID)
+	st.Room = rm
+	st.JoinedAt = time.Now()
+	p.events.Emit(analytics.Event{Type: analytics.RoomJoined, UserHash: analytics.AnonymizeID(st.User.ID), RoomHash: analytics.AnonymizeID(st.RoomCode)})
+	return nil
+}
+
+// waitForSlot: parks the user in the room's join queue until admitted or timed out
+// Pings while waiting so a departed client is dropped from the queue
+func (p *ConnectionPipeline) waitForSlot(st *ConnState) (*room.Room, error) {
+	rm, exists := p.roomManager.GetRoom(st.RoomCode)
+	if !exists {
+		return nil, room.ErrRoomFull
+	}
+
+	admitted, position, err := rm.Enqueue(st.User, p.config.JoinQueueSize)
+	if err != nil {
+		return nil, err
+	}
+	if position > 0 {
+		response := map[string]interface{}{"type": "queued", "position": position}
+		if err := writeJSON(st.User, response); err != nil {
+			rm.Dequeue(st.User.ID)
+			return nil, &StageError{Stage: "queue", Code: websocket.CloseGoingAway, Err: fmt.Errorf("%w: %v", ErrConnectionLost, err)}
+		}
+	}
+
+	timeout := time.NewTimer(p.config.JoinQueueTimeout)
+	defer timeout.Stop()
+	ping := time.NewTicker(5 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-admitted:
+			return rm, nil
+		case <-timeout.C:
+			if rm.Dequeue(st.User.ID) {
+				return nil, &StageError{Stage: "queue", Code: CloseRoomFull, Reason: "room is full, please try again later", Err: room.ErrRoomFull}
+			}
+			return rm, nil // admitted just before timing out
+		case <-ping.C:
+			if err := st.User.WriteMessage(websocket.PingMessage, nil); err != nil {
+				if !rm.Dequeue(st.User.ID) {
+					rm.AbortJoin(st.User)
+				}
+				return nil, &StageError{Stage: "queue", Code: websocket.CloseGoingAway, Err: fmt.Errorf("%w: %v", ErrConnectionLost, err)}
+			}
+		}
+	}
+}
+
+// Serve: message loop until the connection closes
+func (p *ConnectionPipeline) Serve(st *ConnState) {
+	run(st.Conn, st.Room, st.User, p.config, p.msgRouter)
+}
+
+// fail: logs stage error and closes the connection with the mapped close code
+func (p *ConnectionPipeline) fail(st *ConnState, err error) {
+	st.Log.Warn("Connection failed", "err", err)
+	if errors.Is(err, ErrConnectionLost) {
+		return
+	}
+	if errors.Is(err, websocket.ErrReadLimit) {
+		return // gorilla already sent the 1009 close
+	}
+
+	code, reason := websocket.CloseInternalServerErr, ""
+	var stageErr *StageError
+	if errors.As(err, &stageErr) {
+		code, reason = stageErr.Code, stageErr.Reason
+	}
+
+	// Close reasons are easy to miss client side, a full room or wrong password
+	// also gets an error message (and both are in the client's locale)
+	if st.User != nil {
+		var msgErr *handlers.MessageError
+		switch {
+		case errors.Is(err, room.ErrRoomFull):
+			msgErr = handlers.NewError(handlers.CodeRoomFull, "room is full")
+		case errors.Is(err, room.ErrWrongPassword):
+			msgErr = handlers.NewError(handlers.CodeWrongPassword, "wrong room password")
+		case errors.Is(err, room.ErrPasswordTooLong):
+			msgErr = handlers.NewError(handlers.CodeInvalidMessage, "room password too long")
+		}
+		if msgErr != nil {
+			handlers.ReplyError(st.User, msgErr)
+			if text := st.User.Text(msgErr.Code, nil); len(text) <= maxCloseReason {
+				reason = text
+			}
+		}
+
+		// Limits the client can act on: join_rejected says which, then the close frame
+		if rejection, rejected := p.rejection(st, err); rejected {
+			rejectAndClose(st.User, rejection, reason)
+			return
+		}
+	}
+
+	// Queued behind the error message, sent before ServeHTTP closes the connection
+	st.User.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+}
+
+// rejection: the join_rejected message (and close code) for a failed join, false
+// for failures that aren't about a limit or credentials
+func (p *ConnectionPipeline) rejection(st *ConnState, err error) (joinRejection, bool) {
+	switch {
+	case errors.Is(err, room.ErrRoomFull) && st.User.Spectator:
+		return joinRejection{Reason: "room_full", Code: CloseRoomFull, Limit: map[string]interface{}{"maxSpectators": p.config.MaxSpectators}}, true
+	case errors.Is(err, room.ErrRoomFull), errors.Is(err, room.ErrQueueFull):
+		return joinRejection{Reason: "room_full", Code: CloseRoomFull, Limit: map[string]interface{}{"maxSize": p.config.MaxRoomSize}}, true
+	case errors.Is(err, room.ErrServerFull):
+		return joinRejection{Reason: "server_full", Code: CloseServerFull, Limit: map[string]interface{}{"maxRooms": p.config.MaxRooms}}, true
+	case errors.Is(err, ErrAuthFailed):
+		return joinRejection{Reason: "auth_failed", Code: CloseAuthFailed}, true
+	case errors.Is(err, room.ErrInvalidRoomCode):
+		return joinRejection{Reason: "invalid_room_code", Code: websocket.ClosePolicyViolation}, true
+	case errors.Is(err, room.ErrUnknownRoom):
+		return joinRejection{Reason: "unknown_room", Code: CloseUnknownRoom}, true
+	case errors.Is(err, room.ErrRoomClosed):
+		return joinRejection{Reason: "room_closed", Code: room.CloseRoomClosed}, true
+	case errors.Is(err, room.ErrBanned):
+		return joinRejection{Reason: "banned", Code: room.CloseKicked}, true
+	case errors.Is(err, user.ErrTooManyRooms):
+		return joinRejection{Reason: "too_many_rooms", Code: websocket.ClosePolicyViolation, Limit: map[string]interface{}{"maxRooms": p.config.MaxRoomsPerSession}}, true
+	default:
+		return joinRejection{}, false
+	}
+}
+
+// emitLeft: publishes room_left with time spent in the room
+func (p *ConnectionPipeline) emitLeft(st *ConnState) {
+	p.events.Emit(analytics.Event{
+		Type:     analytics.RoomLeft,
+		UserHash: analytics.AnonymizeID(st.User.ID),
+		RoomHash: analytics.AnonymizeID(st.RoomCode),
+		Duration: time.Since(st.JoinedAt),
+	})
+}
+
+// writeJSON: marshals and writes a message to the user
+func writeJSON(u *user.User, payload map[string]interface{}) error {
+	msg, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal response: %w", err)
+	}
+	return u.WriteMessage(websocket.TextMessage, msg)
+}
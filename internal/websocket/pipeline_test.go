@@ -0,0 +1,971 @@
+package transport
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"main/client"
+	"main/internal/analytics"
+	"main/internal/handlers"
+	"main/internal/msgpack"
+	"main/internal/object"
+	"main/internal/room"
+	"main/internal/user"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSessionEventsForConnectDrawDisconnect(t *testing.T) {
+	sink := &recordingSink{}
+	s := newTestServer(t, sink)
+
+	c := s.connect("events-room")
+	userID := c.UserID()
+	err := c.AddObject(client.Object{
+		ID:   "s1",
+		Type: "stroke",
+		Data: map[string]interface{}{
+			"points": []map[string]int{{"x": 1, "y": 1}, {"x": 5, "y": 5}},
+			"color":  "#000000",
+			"width":  2,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Wait for the drawing to land before leaving
+	rm, _ := s.rooms.GetRoom("events-room")
+	for deadline := time.Now().Add(2 * time.Second); rm.GetObject("s1") == nil; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("drawing never added")
+		}
+	}
+	c.Close()
+
+	events := sink.wait(t, 3)
+	want := []analytics.EventType{analytics.SessionCreated, analytics.RoomJoined, analytics.RoomLeft}
+	if len(events) != len(want) {
+		t.Fatalf("events = %+v, want %v", events, want)
+	}
+	userHash := analytics.AnonymizeID(userID)
+	roomHash := analytics.AnonymizeID("EVENTS-ROOM") // the canonical code
+	for i, e := range events {
+		if e.Type != want[i] {
+			t.Errorf("event %d = %s, want %s", i, e.Type, want[i])
+		}
+		if e.UserHash != userHash {
+			t.Errorf("event %d user = %q, want the anonymized ID %q", i, e.UserHash, userHash)
+		}
+		if e.Time.IsZero() {
+			t.Errorf("event %d has no time", i)
+		}
+	}
+	if events[1].RoomHash != roomHash || events[2].RoomHash != roomHash {
+		t.Errorf("room hashes = %q, %q, want %q", events[1].RoomHash, events[2].RoomHash, roomHash)
+	}
+	if events[2].Duration <= 0 {
+		t.Errorf("left event duration = %v, want time in room", events[2].Duration)
+	}
+}
+
+func TestAuthenticatedCarriesNoColor(t *testing.T) {
+	s := newTestServer(t)
+	conn := s.dial("colors", "")
+
+	authenticated := readType(t, conn, "authenticated")
+	if _, has := authenticated["color"]; has {
+		t.Errorf("authenticated has a color: %v", authenticated)
+	}
+	joined := readType(t, conn, "room_joined")
+	if color, _ := joined["color"].(string); color == "" {
+		t.Errorf("room_joined has no color: %v", joined)
+	}
+}
+
+func TestLegacyAuthColor(t *testing.T) {
+	s := newTestServer(t)
+	s.config.LegacyAuthColor = true
+	conn := s.dial("colors", "")
+
+	authenticated := readType(t, conn, "authenticated")
+	session, ok := s.sessions.GetSessionByToken(authenticated["token"].(string))
+	if !ok {
+		t.Fatal("no session for the authenticated user")
+	}
+	if authenticated["color"] != session.Color {
+		t.Errorf("authenticated color = %v, want the session color %q", authenticated["color"], session.Color)
+	}
+	// The first room the session joins gets the session color
+	if joined := readType(t, conn, "room_joined"); joined["color"] != session.Color {
+		t.Errorf("room_joined color = %v, want %q", joined["color"], session.Color)
+	}
+}
+
+func TestColorStableAcrossReconnects(t *testing.T) {
+	s := newTestServer(t)
+	first := s.connect("colors")
+	color, token := first.Color(), first.Token()
+	first.Close()
+
+	again, err := client.Connect(context.Background(), "ws"+strings.TrimPrefix(s.http.URL, "http"), "colors", token, client.WithOrigin(testOrigin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	if again.UserID() != first.UserID() {
+		t.Fatalf("reconnect is user %s, want %s", again.UserID(), first.UserID())
+	}
+	if again.Color() != color {
+		t.Errorf("color after reconnect = %s, want %s", again.Color(), color)
+	}
+}
+
+// serverConn: the server end of a fresh websocket connection
+func serverConn(t *testing.T) *websocket.Conn {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	conn := <-conns
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestFailedJoinWriteUndoesJoin(t *testing.T) {
+	s := newTestServer(t)
+	present := s.connect("undo-join")
+
+	// The client is gone by the time the join is answered, every write fails
+	u := user.NewUser(serverConn(t), user.ConnectionInfo{})
+	u.StopWriter()
+	session := s.sessions.GetOrCreate("leaver", "")
+	if _, err := s.sessions.Attach(session.SessionToken, u); err != nil {
+		t.Fatal(err)
+	}
+	st := &ConnState{RoomCode: "UNDO-JOIN", User: u, Auth: &AuthResult{UserID: "leaver"}, Log: slog.Default()}
+
+	err := s.pipeline.JoinRoom(st)
+	if !errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("JoinRoom = %v, want ErrConnectionLost", err)
+	}
+	var stageErr *StageError
+	if !errors.As(err, &stageErr) || stageErr.Code != websocket.CloseGoingAway {
+		t.Errorf("stage error = %+v, want close code going away", stageErr)
+	}
+
+	rm, _ := s.rooms.GetRoom("UNDO-JOIN")
+	if n := rm.ConnectionCount(); n != 1 {
+		t.Errorf("%d connections after the failed join, want 1", n)
+	}
+	if color := rm.GetUserColor("leaver"); color != "" {
+		t.Errorf("failed join kept color %s", color)
+	}
+	if color := rm.GetUserColor(present.UserID()); color == "" {
+		t.Error("the user already there lost their color")
+	}
+	// The session can join other rooms again, its slot was released
+	if err := s.sessions.EnterRoom("leaver", "UNDO-JOIN", 1); err != nil {
+		t.Errorf("room membership not released: %v", err)
+	}
+}
+
+func TestRoomsPerSessionReleasedOnUncleanDisconnect(t *testing.T) {
+	s := newTestServer(t)
+	s.config.MaxRoomsPerSession = 2
+
+	first := s.dial("board-a", "")
+	token := readType(t, first, "authenticated")["token"].(string)
+	readType(t, first, "room_joined")
+	second := s.dial("board-b", token)
+	token = readType(t, second, "authenticated")["token"].(string)
+	readType(t, second, "room_joined")
+
+	third := s.dial("board-c", token)
+	third.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var closeErr *websocket.CloseError
+	for {
+		if _, _, err := third.ReadMessage(); err != nil {
+			if !errors.As(err, &closeErr) {
+				t.Fatalf("third room: %v, want a close frame", err)
+			}
+			break
+		}
+	}
+	if closeErr.Code != websocket.ClosePolicyViolation || closeErr.Text != "too many boards open" {
+		t.Fatalf("third room closed with %d %q", closeErr.Code, closeErr.Text)
+	}
+
+	// The first tab's network goes away without a close frame
+	first.UnderlyingConn().Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		retry := s.dial("board-c", token)
+		retry.SetReadDeadline(time.Now().Add(time.Second))
+		joined := false
+		for {
+			var msg map[string]interface{}
+			if err := retry.ReadJSON(&msg); err != nil {
+				break
+			}
+			if msg["type"] == "authenticated" {
+				token = msg["token"].(string)
+			}
+			if msg["type"] == "room_joined" {
+				joined = true
+				break
+			}
+		}
+		if joined {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("slot of the dropped connection never released")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestClientReceivesChunkedSync(t *testing.T) {
+	s := newTestServer(t)
+	s.connect("big-board")
+	rm, _ := s.rooms.GetRoom("big-board")
+	for i := 0; i < 200; i++ {
+		err := rm.AddObject(&object.Drawing{
+			ID:   fmt.Sprintf("t%d", i),
+			Type: "text",
+			Data: map[string]interface{}{"x": 1, "y": 1, "text": strings.Repeat("x", 10*1024)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := s.connect("big-board")
+	if n := len(c.InitialState().Objects); n != 200 {
+		t.Errorf("joined with %d objects, want all 200", n)
+	}
+	if size := rm.SyncSize(); size <= room.DefaultMaxSyncSize {
+		t.Errorf("sync size = %d, want over the chunking threshold", size)
+	}
+}
+
+func TestJoinDuringConcurrentAddsSeesEveryObjectOnce(t *testing.T) {
+	s := newTestServer(t)
+	s.config.MaxObjects = 1e6
+	drawer := s.dial("busy-board", "")
+	readType(t, drawer, "sync")
+	drawer.SetReadDeadline(time.Time{})
+	rm, _ := s.rooms.GetRoom("busy-board")
+
+	// The drawer adds strokes as fast as the server acks them (a window of 64
+	// in flight, so it isn't dropped as a slow consumer) until every joiner
+	// has its sync
+	inflight := make(chan struct{}, 64)
+	go func() {
+		for {
+			var msg map[string]interface{}
+			if err := drawer.ReadJSON(&msg); err != nil {
+				return
+			}
+			if msg["type"] == "objectAck" {
+				<-inflight
+			}
+		}
+	}()
+	stop := make(chan struct{})
+	added := make(chan int, 1)
+	go func() {
+		n := 0
+		defer func() { added <- n }()
+		for {
+			select {
+			case <-stop:
+				return
+			case inflight <- struct{}{}:
+			}
+			err := drawer.WriteJSON(map[string]interface{}{
+				"type": "objectAdded",
+				"object": map[string]interface{}{
+					"id":   fmt.Sprintf("s%d", n),
+					"type": "stroke",
+					"data": map[string]interface{}{
+						"points": []map[string]int{{"x": n + 1, "y": 1}, {"x": n + 1, "y": 5}},
+						"color":  "#000000",
+						"width":  2,
+					},
+				},
+			})
+			if err != nil {
+				return // the test has ended, or the count shows the gap
+			}
+			n++
+		}
+	}()
+
+	// Joiners arrive one after another while the strokes keep coming, each
+	// must receive its sync before any broadcast, then every later stroke
+	type joiner struct {
+		synced map[string]bool
+		added  chan string
+		failed chan error
+	}
+	var joiners []joiner
+	for i := 0; i < 5; i++ {
+		for rm.ObjectCount() < 50*(i+1) {
+			time.Sleep(time.Millisecond)
+		}
+		conn := s.dial("busy-board", "")
+		var sync map[string]interface{}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for sync == nil {
+			var msg map[string]interface{}
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatalf("joiner %d waiting for sync: %v", i, err)
+			}
+			switch msg["type"] {
+			case "sync":
+				sync = msg
+			case "objectAdded":
+				t.Fatalf("joiner %d received objectAdded before its sync", i)
+			}
+		}
+		conn.SetReadDeadline(time.Time{})
+
+		j := joiner{synced: make(map[string]bool), added: make(chan string, 100000), failed: make(chan error, 1)}
+		for _, obj := range sync["objects"].([]interface{}) {
+			j.synced[obj.(map[string]interface{})["id"].(string)] = true
+		}
+		go func() {
+			for {
+				var msg map[string]interface{}
+				if err := conn.ReadJSON(&msg); err != nil {
+					j.failed <- err
+					return
+				}
+				if msg["type"] == "objectAdded" {
+					j.added <- msg["object"].(map[string]interface{})["id"].(string)
+				}
+			}
+		}()
+		joiners = append(joiners, j)
+	}
+	close(stop)
+	total := <-added
+
+	// Once every stroke is acked, every broadcast of one has been sent
+	for i := 0; i < cap(inflight); i++ {
+		select {
+		case inflight <- struct{}{}:
+		case <-time.After(5 * time.Second):
+			t.Fatal("strokes never acked")
+		}
+	}
+	if rm.ObjectCount() != total {
+		t.Fatalf("room has %d objects, want %d", rm.ObjectCount(), total)
+	}
+
+	overlapped := false
+	for i, j := range joiners {
+		board := make(map[string]bool)
+		for id := range j.synced {
+			board[id] = true
+		}
+		for len(board) < total {
+			select {
+			case id := <-j.added:
+				// Strokes already in the sync may be repeated, but only before
+				// anything newer
+				if board[id] && len(board) > len(j.synced) {
+					t.Fatalf("joiner %d: %s received again after later strokes", i, id)
+				}
+				board[id] = true
+			case err := <-j.failed:
+				t.Fatalf("joiner %d has %d of %d objects: %v", i, len(board), total, err)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("joiner %d has %d of %d objects", i, len(board), total)
+			}
+		}
+		for id := range board {
+			if rm.GetObject(id) == nil {
+				t.Errorf("joiner %d has %s, not in the room", i, id)
+			}
+		}
+		overlapped = overlapped || len(j.synced) < total
+	}
+	if !overlapped {
+		t.Logf("all %d objects were in every sync, no join overlapped the adds", total)
+	}
+}
+
+func TestOneTokenPerSessionAcrossReconnects(t *testing.T) {
+	s := newTestServer(t)
+	first := s.connect("tokens")
+	token := first.Token()
+	if s.sessions.SessionCount() != 1 || s.sessions.TokenCount() != 1 {
+		t.Fatalf("new user: %d sessions, %d tokens, want one each", s.sessions.SessionCount(), s.sessions.TokenCount())
+	}
+	if userID, ok := s.sessions.ValidateToken(token); !ok || userID != first.UserID() {
+		t.Fatalf("client's token validates to %q, %v", userID, ok)
+	}
+	first.Close()
+
+	again, err := client.Connect(context.Background(), "ws"+strings.TrimPrefix(s.http.URL, "http"), "tokens", token, client.WithOrigin(testOrigin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+
+	// Resuming rotates the token, the old one only lasts the grace period
+	session, ok := s.sessions.GetSessionByToken(again.Token())
+	if !ok || session.UserID != first.UserID() || session.SessionToken != again.Token() {
+		t.Fatalf("resumed client's token isn't its session's current one")
+	}
+	if s.sessions.SessionCount() != 1 || s.sessions.TokenCount() > 2 {
+		t.Errorf("after reconnect: %d sessions, %d tokens, want 1 and at most 2", s.sessions.SessionCount(), s.sessions.TokenCount())
+	}
+}
+
+// authenticate: a raw connection to roomCode with token, and the authenticated
+// reply once it has joined
+func (s *testServer) authenticate(roomCode string, token string) (*websocket.Conn, map[string]interface{}) {
+	s.t.Helper()
+	conn := s.dial(roomCode, token)
+	authenticated := readType(s.t, conn, "authenticated")
+	readType(s.t, conn, "sync")
+	conn.SetReadDeadline(time.Time{})
+	return conn, authenticated
+}
+
+func TestOneTokenOnTwoDevices(t *testing.T) {
+	s := newTestServer(t)
+	laptop, authenticated := s.authenticate("room-one", "")
+	token := authenticated["token"].(string)
+	multi, _ := authenticated["multiDevice"].(map[string]interface{})
+	if multi["sameRoom"] != "replace" || multi["maxRooms"] != float64(s.config.MaxRoomsPerSession) {
+		t.Errorf("authenticated multiDevice = %v", authenticated["multiDevice"])
+	}
+	tablet, again := s.authenticate("room-two", token)
+	if again["userId"] != authenticated["userId"] {
+		t.Fatalf("tablet is user %v, want %v", again["userId"], authenticated["userId"])
+	}
+
+	one, _ := s.rooms.GetRoom("room-one")
+	two, _ := s.rooms.GetRoom("room-two")
+	userID := authenticated["userId"].(string)
+	onLaptop, onTablet := one.GetConnections()[userID], two.GetConnections()[userID]
+	if onLaptop.Session != onTablet.Session {
+		t.Error("devices don't share the session")
+	}
+	if onLaptop.CursorRateLimiter == onTablet.CursorRateLimiter {
+		t.Error("devices share a cursor limiter")
+	}
+
+	// Both devices draw and move their cursor at once (run with -race)
+	const strokes = 20
+	var wg sync.WaitGroup
+	for device, conn := range map[string]*websocket.Conn{"laptop": laptop, "tablet": tablet} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < strokes; i++ {
+				conn.WriteJSON(map[string]interface{}{"type": "cursor", "x": float64(i), "y": 1.0})
+				conn.WriteJSON(map[string]interface{}{"type": "timeSync", "clientTime": time.Now().UnixMilli()})
+				conn.WriteJSON(map[string]interface{}{
+					"type": "objectAdded",
+					"object": map[string]interface{}{
+						"id":   fmt.Sprintf("%s-%d", device, i),
+						"type": "stroke",
+						"data": map[string]interface{}{
+							"points": []map[string]int{{"x": i + 1, "y": 1}, {"x": i + 1, "y": 5}},
+							"color":  "#000000",
+							"width":  2,
+						},
+					},
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, conn := range []*websocket.Conn{laptop, tablet} {
+		for i := 0; i < strokes; i++ {
+			readType(t, conn, "objectAck")
+		}
+	}
+	if one.ObjectCount() != strokes || two.ObjectCount() != strokes {
+		t.Errorf("rooms have %d and %d strokes, want %d each", one.ObjectCount(), two.ObjectCount(), strokes)
+	}
+}
+
+func TestSameRoomSignsOutOtherDevice(t *testing.T) {
+	s := newTestServer(t)
+	watcher := s.connect("shared")
+	left := make(chan string, 4)
+	watcher.OnBroadcast(func(e client.Event) {
+		if e.Type == "userLeft" {
+			left <- e.UserID
+		}
+	})
+
+	laptop, authenticated := s.authenticate("shared", "")
+	rm, _ := s.rooms.GetRoom("shared")
+	if rm.ConnectionCount() != 2 {
+		t.Fatalf("%d connections, want watcher and laptop", rm.ConnectionCount())
+	}
+
+	tablet, _ := s.authenticate("shared", authenticated["token"].(string))
+	signedOut := readType(t, laptop, "error")
+	if signedOut["code"] != "signed_in_elsewhere" {
+		t.Errorf("laptop got error %v, want signed_in_elsewhere", signedOut["code"])
+	}
+	var msg map[string]interface{}
+	err := laptop.ReadJSON(&msg)
+	if !websocket.IsCloseError(err, room.CloseSuperseded) {
+		t.Errorf("laptop connection ended with %v, want CloseSuperseded", err)
+	}
+
+	// The tablet took the laptop's place, nobody left
+	userID := authenticated["userId"].(string)
+	if rm.ConnectionCount() != 2 || !rm.Connected(rm.GetConnections()[userID]) {
+		t.Fatalf("%d connections after the tablet joined", rm.ConnectionCount())
+	}
+	if err := tablet.WriteJSON(map[string]interface{}{"type": "getUserId"}); err != nil {
+		t.Fatal(err)
+	}
+	readType(t, tablet, "userId")
+	select {
+	case id := <-left:
+		t.Errorf("userLeft for %s when a device was replaced", id)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDashboardWithoutCursorsInBusyRoom(t *testing.T) {
+	s := newTestServer(t)
+	drawer := s.connect("busy-room")
+	watcher := s.connect("busy-room")
+	stroke := func(id string) client.Object {
+		return client.Object{
+			ID:   id,
+			Type: "stroke",
+			Data: map[string]interface{}{
+				"points": []map[string]int{{"x": 1, "y": 1}, {"x": 5, "y": 5}},
+				"color":  "#000000",
+				"width":  2,
+			},
+		}
+	}
+	if err := drawer.AddObject(stroke("before")); err != nil {
+		t.Fatal(err)
+	}
+	rm, _ := s.rooms.GetRoom("busy-room")
+	deadline := time.Now().Add(2 * time.Second)
+	for rm.ObjectCount() < 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	dashboard := s.connect("busy-room", client.WithSubscriptions(client.Subscriptions{NoCursors: true}))
+	if n := len(dashboard.InitialState().Objects); n != 1 {
+		t.Fatalf("dashboard joined with %d objects, want the full board", n)
+	}
+
+	var mu sync.Mutex
+	counts := map[string]int{}
+	watcherCursors := make(chan struct{}, 1)
+	dashboard.OnBroadcast(func(e client.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		counts[e.Type]++
+	})
+	watcher.OnBroadcast(func(e client.Event) {
+		if e.Type == "cursor" {
+			select {
+			case watcherCursors <- struct{}{}:
+			default:
+			}
+		}
+	})
+
+	const strokes = 20
+	for i := 0; i < strokes; i++ {
+		if err := drawer.SendCursor(float64(i+1), float64(i+1)); err != nil {
+			t.Fatal(err)
+		}
+		if err := drawer.AddObject(stroke(fmt.Sprintf("s%d", i))); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	select {
+	case <-watcherCursors:
+	case <-time.After(2 * time.Second):
+		t.Fatal("unfiltered client received no cursors")
+	}
+	deadline = time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		added := counts["objectAdded"]
+		mu.Unlock()
+		if added == strokes {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("dashboard received %d of %d strokes", added, strokes)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if counts["cursor"] != 0 {
+		t.Errorf("dashboard received %d cursor events with cursors muted", counts["cursor"])
+	}
+}
+
+// dialProtocol: like dial, asking for subprotocol
+func (s *testServer) dialProtocol(roomCode string, subprotocol string) *websocket.Conn {
+	s.t.Helper()
+	dialer := websocket.Dialer{Subprotocols: []string{subprotocol}}
+	header := http.Header{"Origin": {testOrigin}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(s.http.URL, "http")+"?room="+roomCode, header)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.t.Cleanup(func() { conn.Close() })
+	if conn.Subprotocol() != subprotocol {
+		s.t.Fatalf("negotiated %q, want %q", conn.Subprotocol(), subprotocol)
+	}
+	if err := conn.WriteJSON(map[string]interface{}{"type": "authenticate"}); err != nil {
+		s.t.Fatal(err)
+	}
+	readType(s.t, conn, "sync")
+	return conn
+}
+
+// compactCursor: a binary cursor frame for x, y
+func compactCursor(x, y float32) []byte {
+	frame := make([]byte, 9)
+	frame[0] = handlers.BinaryCursor
+	binary.LittleEndian.PutUint32(frame[1:5], math.Float32bits(x))
+	binary.LittleEndian.PutUint32(frame[5:9], math.Float32bits(y))
+	return frame
+}
+
+func TestStrayBinaryFrameClosesJSONConnection(t *testing.T) {
+	s := newTestServer(t)
+	for _, subprotocol := range []string{"", ProtocolJSON} {
+		var conn *websocket.Conn
+		if subprotocol == "" {
+			conn, _ = s.authenticate("json-room", "")
+		} else {
+			conn = s.dialProtocol("json-room", subprotocol)
+		}
+		if err := conn.WriteMessage(websocket.BinaryMessage, compactCursor(1, 1)); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var err error
+		for err == nil {
+			_, _, err = conn.ReadMessage()
+		}
+		if !websocket.IsCloseError(err, websocket.CloseUnsupportedData) {
+			t.Errorf("subprotocol %q: connection ended with %v, want close %d", subprotocol, err, websocket.CloseUnsupportedData)
+		}
+	}
+}
+
+func TestBinaryConnectionSendsBothFrameKinds(t *testing.T) {
+	s := newTestServer(t)
+	watcher, _ := s.authenticate("binary-room", "")
+	conn := s.dialProtocol("binary-room", ProtocolBinary)
+
+	if err := conn.WriteMessage(websocket.BinaryMessage, compactCursor(3, 7)); err != nil {
+		t.Fatal(err)
+	}
+	cursors := readType(t, watcher, "cursors")["cursors"].([]interface{})
+	if cursor := cursors[0].(map[string]interface{}); cursor["x"] != 3.0 || cursor["y"] != 7.0 {
+		t.Errorf("cursor = %v, want 3, 7", cursor)
+	}
+
+	// unknown binary types are refused, the connection stays up
+	if err := conn.WriteMessage(websocket.BinaryMessage, []byte{0x7f}); err != nil {
+		t.Fatal(err)
+	}
+	if reply := readType(t, conn, "error"); reply["code"] != handlers.CodeUnknownType {
+		t.Errorf("error code = %v, want %s", reply["code"], handlers.CodeUnknownType)
+	}
+
+	err := conn.WriteJSON(map[string]interface{}{
+		"type": "objectAdded",
+		"object": map[string]interface{}{
+			"id":   "s1",
+			"type": "stroke",
+			"data": map[string]interface{}{
+				"points": []map[string]int{{"x": 1, "y": 1}, {"x": 5, "y": 5}},
+				"color":  "#000000",
+				"width":  2,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readType(t, conn, "objectAck")
+	readType(t, watcher, "objectAdded")
+}
+
+func TestRevokeSessionClosesOtherDevice(t *testing.T) {
+	s := newTestServer(t)
+	laptop, authenticated := s.authenticate("room-one", "")
+	token := authenticated["token"].(string)
+	userID := authenticated["userId"]
+	tablet, _ := s.authenticate("room-two", token)
+
+	if err := laptop.WriteJSON(map[string]interface{}{"type": "getSessionInfo"}); err != nil {
+		t.Fatal(err)
+	}
+	info := readType(t, laptop, "sessionInfo")["session"].(map[string]interface{})
+	if info["otherConnections"] != 1.0 || len(info["recentRooms"].([]interface{})) != 2 {
+		t.Errorf("session info = %v, want the tablet and both rooms", info)
+	}
+
+	if err := laptop.WriteJSON(map[string]interface{}{"type": "revokeSession"}); err != nil {
+		t.Fatal(err)
+	}
+	reply := readType(t, laptop, "sessionRevoked")
+	fresh, _ := reply["token"].(string)
+	if fresh == "" || fresh == token || reply["closed"] != 1.0 {
+		t.Fatalf("revoke reply = %v, want a fresh token and 1 closed", reply)
+	}
+
+	if reply := readType(t, tablet, "error"); reply["code"] != handlers.CodeSessionRevoked {
+		t.Errorf("tablet error code = %v, want %s", reply["code"], handlers.CodeSessionRevoked)
+	}
+	var err error
+	for err == nil {
+		_, _, err = tablet.ReadMessage()
+	}
+	if !websocket.IsCloseError(err, user.CloseSessionRevoked) {
+		t.Errorf("tablet closed with %v, want %d", err, user.CloseSessionRevoked)
+	}
+
+	// the old token no longer resumes the session, the fresh one does
+	_, stranger := s.authenticate("room-two", token)
+	if stranger["userId"] == userID {
+		t.Error("revoked token resumed the session")
+	}
+	_, resumed := s.authenticate("room-two", fresh)
+	if resumed["userId"] != userID {
+		t.Errorf("fresh token is user %v, want %v", resumed["userId"], userID)
+	}
+}
+
+func TestReturningSessionNotPromptedForAcceptedTerms(t *testing.T) {
+	s := newTestServer(t)
+	s.config.Banner = "maintenance at noon"
+	s.config.TermsVersion, s.config.TermsURL = "v1", "https://example.com/terms"
+
+	conn, authenticated := s.authenticate("terms-room", "")
+	required, _ := authenticated["termsRequired"].(map[string]interface{})
+	if required["version"] != "v1" || required["url"] != "https://example.com/terms" {
+		t.Errorf("termsRequired = %v", authenticated["termsRequired"])
+	}
+	if authenticated["banner"] != "maintenance at noon" {
+		t.Errorf("banner = %v", authenticated["banner"])
+	}
+	if err := conn.WriteJSON(map[string]interface{}{"type": "acceptTerms", "version": "v1"}); err != nil {
+		t.Fatal(err)
+	}
+	readType(t, conn, "termsAccepted")
+	conn.Close()
+
+	_, again := s.authenticate("terms-room", authenticated["token"].(string))
+	if again["userId"] != authenticated["userId"] {
+		t.Fatalf("reconnected as %v, want %v", again["userId"], authenticated["userId"])
+	}
+	if again["termsRequired"] != nil {
+		t.Errorf("accepted session prompted again: %v", again["termsRequired"])
+	}
+
+	// a new terms version prompts the same session again
+	s.config.TermsVersion = "v2"
+	_, bumped := s.authenticate("terms-room", again["token"].(string))
+	if required, _ := bumped["termsRequired"].(map[string]interface{}); required["version"] != "v2" {
+		t.Errorf("termsRequired after a version bump = %v", bumped["termsRequired"])
+	}
+}
+
+// readPacked: the next MessagePack message of type msgType on conn, skipping
+// others. Every frame must be binary
+func readPacked(t *testing.T, conn *websocket.Conn, msgType string) map[string]interface{} {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		frameType, frame, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for %s: %v", msgType, err)
+		}
+		if frameType != websocket.BinaryMessage {
+			t.Fatalf("text frame %s on a msgpack connection", frame)
+		}
+		decoded, err := msgpack.Unmarshal(frame, 100, 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg := decoded.(map[string]interface{}); msg["type"] == msgType {
+			return msg
+		}
+	}
+}
+
+func TestMsgpackAndJSONClientsInOneRoom(t *testing.T) {
+	s := newTestServer(t)
+	jsonConn, _ := s.authenticate("mixed-room", "")
+
+	header := http.Header{"Origin": {testOrigin}}
+	packedConn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.http.URL, "http")+"?room=mixed-room", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packedConn.Close()
+	if err := packedConn.WriteJSON(map[string]interface{}{"type": "authenticate", "encoding": "msgpack"}); err != nil {
+		t.Fatal(err)
+	}
+	readPacked(t, packedConn, "authenticated")
+	readPacked(t, packedConn, "sync")
+
+	// the msgpack client draws, in binary frames
+	strokeMsg := map[string]interface{}{
+		"type": "objectAdded",
+		"object": map[string]interface{}{
+			"id":   "s1",
+			"type": "stroke",
+			"data": map[string]interface{}{
+				"points": []interface{}{map[string]interface{}{"x": 1.5, "y": 1}, map[string]interface{}{"x": 5, "y": 5}},
+				"color":  "#000000",
+				"width":  2,
+			},
+		},
+	}
+	packed, err := msgpack.Marshal(strokeMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := packedConn.WriteMessage(websocket.BinaryMessage, packed); err != nil {
+		t.Fatal(err)
+	}
+	if ack := readPacked(t, packedConn, "objectAck"); ack["objectId"] != "s1" {
+		t.Errorf("ack = %v", ack)
+	}
+	added := readType(t, jsonConn, "objectAdded")
+
+	// the JSON client's messages reach the msgpack client as the same values
+	received := make(map[string]map[string]interface{})
+	for _, msg := range []map[string]interface{}{
+		{"type": "chat", "text": "héllo"},
+		{"type": "objectUpdated", "object": map[string]interface{}{"id": "s1", "partial": true, "data": map[string]interface{}{"color": "#ff0000"}}},
+		{"type": "objectDeleted", "objectId": "s1"},
+	} {
+		if err := jsonConn.WriteJSON(msg); err != nil {
+			t.Fatal(err)
+		}
+		msgType := msg["type"].(string)
+		received[msgType] = readPacked(t, packedConn, msgType)
+	}
+	if text := received["chat"]["text"]; text != "héllo" {
+		t.Errorf("chat text = %v", text)
+	}
+	updated := received["objectUpdated"]["object"].(map[string]interface{})
+	if data := updated["data"].(map[string]interface{}); data["color"] != "#ff0000" || data["width"] != 2.0 {
+		t.Errorf("objectUpdated data = %v", data)
+	}
+	if received["objectDeleted"]["objectId"] != "s1" {
+		t.Errorf("objectDeleted = %v", received["objectDeleted"])
+	}
+
+	// and a broadcast decodes to what JSON clients get
+	data := added["object"].(map[string]interface{})["data"].(map[string]interface{})
+	if points := data["points"].([]interface{}); points[0].(map[string]interface{})["x"] != 1.5 {
+		t.Errorf("JSON client got points %v", points)
+	}
+}
+
+func TestReplacedConnectionClosingKeepsNewer(t *testing.T) {
+	sink := &recordingSink{}
+	s := newTestServer(t, sink)
+	watcher := s.connect("tabs")
+
+	first, authenticated := s.authenticate("tabs", "")
+	second, _ := s.authenticate("tabs", authenticated["token"].(string))
+	readType(t, first, "error")
+
+	// The first tab goes away, its cleanup runs once room_left is out
+	first.Close()
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		events := sink.wait(t, 1)
+		if events[len(events)-1].Type == analytics.RoomLeft {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("first tab never left")
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	rm, _ := s.rooms.GetRoom("tabs")
+	userID := authenticated["userId"].(string)
+	if rm.ConnectionCount() != 2 || !rm.Connected(rm.GetConnections()[userID]) {
+		t.Fatalf("%d connections after the first tab closed, want watcher and second tab", rm.ConnectionCount())
+	}
+	err := watcher.AddObject(client.Object{
+		ID:   "after",
+		Type: "stroke",
+		Data: map[string]interface{}{
+			"points": []map[string]int{{"x": 1, "y": 1}, {"x": 5, "y": 5}},
+			"color":  "#000000",
+			"width":  2,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added := readType(t, second, "objectAdded"); added["object"].(map[string]interface{})["id"] != "after" {
+		t.Errorf("second tab got %v", added)
+	}
+}
+
+func TestExpiredTokenStartsNewSession(t *testing.T) {
+	s := newTestServer(t)
+	s.config.SessionTokenTTL = 100 * time.Millisecond
+
+	first, authenticated := s.authenticate("ttl-room", "")
+	first.Close()
+	time.Sleep(150 * time.Millisecond)
+
+	_, again := s.authenticate("ttl-room", authenticated["token"].(string))
+	if again["userId"] == authenticated["userId"] || again["token"] == authenticated["token"] {
+		t.Errorf("expired token resumed user %v", again["userId"])
+	}
+}
@@ -1,23 +1,32 @@
 package transport
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"errors"
+	"io"
 	"net/http"
 	"os"
 	"strings"
 	"time"
 
 	"main/internal/handlers"
+	"main/internal/metrics"
 	"main/internal/middleware"
-	"main/internal/object"
 	"main/internal/room"
 	"main/internal/user"
 
 	"github.com/gorilla/websocket"
 )
 
+// Subprotocols (Sec-WebSocket-Protocol), the encoding a connection may send in
+// Clients that ask for neither are JSON only, like ProtocolJSON
+const (
+	ProtocolJSON   = "whiteboard.json"   // text frames only
+	ProtocolBinary = "whiteboard.binary" // text frames, plus binary ones (see handlers.RouteBinary)
+)
+
 var upgrader = websocket.Upgrader{
+	Subprotocols: []string{ProtocolBinary, ProtocolJSON},
 	// CORS
 	CheckOrigin: func(r *http.Request) bool {
 		origin := r.Header.Get("origin")
@@ -34,163 +43,72 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-// GetClientIP: extracts the real client IP from the request
-func GetClientIP(r *http.Request) string {
-	// Use RemoteAddr only - cannot be spoofed by client
-	ip := r.RemoteAddr
-	if idx := strings.LastIndex(ip, ":"); idx != -1 {
-		ip = ip[:idx] // Remove port
+// offersDeflate: the client offered permessage-deflate, which the upgrader then
+// accepts if compression is enabled
+func offersDeflate(r *http.Request) bool {
+	for _, header := range r.Header.Values("Sec-WebSocket-Extensions") {
+		for _, extension := range strings.Split(header, ",") {
+			name, _, _ := strings.Cut(extension, ";")
+			if strings.TrimSpace(name) == "permessage-deflate" {
+				return true
+			}
+		}
 	}
-	return ip
+	return false
 }
 
 // cleanup ensures all resources are properly released
-func cleanup(rm *room.Room, u *user.User, sessionMgr *user.SessionManager) {
-	if rm != nil {
-		rm.Leave(u)
+func cleanup(st *ConnState, sessionMgr *user.SessionManager, msgRouter *handlers.MessageRouter) {
+	if st.Room != nil {
+		present := st.Room.Leave(st.User)
+		sessionMgr.ExitRoom(st.User.ID, st.RoomCode)
+		msgRouter.Left(st.Room, st.User, present)
 	}
-	if sessionMgr != nil && u != nil {
-		sessionMgr.Remove(u.ID)
+	if st.Session != nil {
+		sessionMgr.Detach(st.User)
 	}
 }
 
-// HandleWebSocket: upgrades HTTP to WebSocket and joins the room
-func HandleWebSocket(
-	w http.ResponseWriter,
-	r *http.Request,
-	ipRateLimiter *middleware.IPRateLimit,
-	config *middleware.RateLimit,
-	sessionMgr *user.SessionManager,
-	validator *object.Validator,
-	roomManager *room.Manager,
-	msgRouter *handlers.MessageRouter,
-	synchronizer *room.Synchronizer,
-	authenticator *Authenticator,
-) {
-	// Check if rate limited
-	clientIP := GetClientIP(r)
-	if !ipRateLimiter.Allow(clientIP) {
-		log.Printf("Rate limit exceeded for IP: %s", clientIP)
-		http.Error(w, "Too many connections", http.StatusTooManyRequests)
-		return
-	}
-
-	// Set security headers before upgrade
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("X-Content-Type-Options", "nosniff")
+// errMessageTooBig: a message over the size limit once decompressed
+var errMessageTooBig = errors.New("message too large")
 
-	// Upgrade connection
-	conn, err := upgrader.Upgrade(w, r, nil)
+// readMessage: the next message, like conn.ReadMessage but reading at most limit
+// bytes of it. The connection's read limit only bounds the frames on the wire,
+// a compressed message can inflate far beyond them
+func readMessage(conn *websocket.Conn, limit int) (int, []byte, error) {
+	messageType, r, err := conn.NextReader()
 	if err != nil {
-		log.Printf("Error: Failed to upgrade connection - %v", err)
-		return
-	}
-	defer conn.Close()
-
-	// Retrieve roomCode from URL
-	roomCode := r.URL.Query().Get("room")
-	if roomCode == "" {
-		log.Println("Error: No room code provided")
-		return
-	}
-
-	// Authenticate user (validates token or creates new user)
-	authResult, err := authenticator.Authenticate(conn, 5*time.Second)
-	if err != nil {
-		log.Printf("Error: Authentication failed - %v", err)
-		return
-	}
-
-	// Get or create session
-	var session *user.UserSession
-	if authResult.IsNewUser {
-		// Create new session with the generated token
-		session = sessionMgr.GetOrCreate(authResult.UserID, "")
-		// Override the token with the one we generated during auth
-		// (GetOrCreate generates its own, but we want to use the auth one)
-		session.SessionToken = authResult.SessionToken
-		sessionMgr.UpdateTokenMapping(authResult.SessionToken, authResult.UserID)
-	} else {
-		// Get existing session for returning user
-		session, _ = sessionMgr.GetSessionByToken(authResult.SessionToken)
-	}
-
-	session.LastRoom = roomCode // Track last room for resumption
-
-	// Create user with session
-	u := &user.User{
-		ID:         authResult.UserID,
-		Session:    session,
-		Connection: conn,
-	}
-	// Ensure cleanup on all exit paths (before room join)
-	var rm *room.Room
-	defer cleanup(rm, u, sessionMgr)
-
-	// Send authentication response with token to client
-	response := map[string]interface{}{
-		"type":   "authenticated",
-		"userId": authResult.UserID,
-		"token":  authResult.SessionToken, // Client must store this token
-	}
-	responseMsg, err := json.Marshal(response)
-	if err != nil {
-		log.Printf("Error: Failed to marshal auth response - %v", err)
-		return
-	}
-	if err := u.WriteMessage(websocket.TextMessage, responseMsg); err != nil {
-		log.Printf("Error: Failed to send auth response - %v", err)
-		return
-	}
-
-	// Join room using room joiner
-	var joinErr error
-	rm, joinErr = roomManager.JoinRoom(roomCode, session, u, config)
-	if joinErr != nil {
-		log.Printf("Error: Failed to join room (%s) - %v", roomCode, joinErr)
-		return
-	}
-
-	// Send room-specific color after joining
-	userColor := rm.GetUserColor(u.ID)
-
-	colorResponse := map[string]interface{}{
-		"type":  "room_joined",
-		"color": userColor,
-		"room":  roomCode,
+		return messageType, nil, err
 	}
-	colorMsg, err := json.Marshal(colorResponse)
+	msg, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
 	if err != nil {
-		log.Printf("Error: Failed to marshal room joined response - %v", err)
-		return
-	}
-	if err := u.WriteMessage(websocket.TextMessage, colorMsg); err != nil {
-		log.Printf("Error: Failed to send room joined response - %v", err)
-		return
+		return messageType, nil, err
 	}
-
-	// Sync room state to new user
-	if err := synchronizer.SyncNewUser(rm, u); err != nil {
-		log.Printf("Error: Failed to sync room state to user %s - %v", u.ID, err)
-		// Don't return - allow user to continue even if sync fails
+	if len(msg) > limit {
+		return messageType, nil, errMessageTooBig
 	}
-
-	// Start message processing loop
-	run(conn, rm, u, config, msgRouter)
+	return messageType, msg, nil
 }
 
 // run: message loop for WebSocket connections
 func run(conn *websocket.Conn, rm *room.Room, u *user.User, config *middleware.RateLimit, msgRouter *handlers.MessageRouter) {
 	const (
 		pongWait   = 60 * time.Second
-		pingPeriod = (pongWait * 9) / 10 // Send pings at 90% of pong deadline
+		pingPeriod = 10 * time.Second // well within the pong deadline, and often enough for RTT readings
 		readWait   = 60 * time.Second
 	)
 
+	metrics.ActiveConnections.Inc()
+	defer metrics.ActiveConnections.Dec()
+
 	// Set up pong handler to extend deadline when pong received
 	conn.SetReadDeadline(time.Now().Add(pongWait))
-	conn.SetPongHandler(func(string) error {
-		conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(appData string) error {
+		now := time.Now()
+		conn.SetReadDeadline(now.Add(pongWait))
+		if rtt, ok := user.ParsePong(appData, now, pongWait); ok {
+			u.RecordRTT(rtt)
+		}
 		return nil
 	})
 
@@ -202,13 +120,13 @@ func run(conn *websocket.Conn, rm *room.Room, u *user.User, config *middleware.R
 	done := make(chan struct{})
 	defer close(done)
 
-	// Ping goroutine
+	// Ping goroutine, pings go through the user's writer like every other write
+	// They carry their send time, so the round trip includes the writer queue
 	go func() {
 		for {
 			select {
 			case <-pingTicker.C:
-				conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				if err := u.WriteMessage(websocket.PingMessage, user.PingPayload(time.Now())); err != nil {
 					return // Connection dead, ping goroutine exits
 				}
 			case <-done:
@@ -217,49 +135,78 @@ func run(conn *websocket.Conn, rm *room.Room, u *user.User, config *middleware.R
 		}
 	}()
 
+	binaryAllowed := u.Info.Protocol == ProtocolBinary || u.Msgpack()
+
+	// Oversized frames end the connection before their payload is read
+	conn.SetReadLimit(int64(config.MaxMessageSize))
+
 	// Main read loop
 	for {
-		_, msg, err := conn.ReadMessage()
+		messageType, msg, err := readMessage(conn, config.MaxMessageSize)
+		if errors.Is(err, websocket.ErrReadLimit) || errors.Is(err, errMessageTooBig) {
+			u.Logger().Warn("Message too large, closing", "max_bytes", config.MaxMessageSize)
+			metrics.MessagesRejected.WithLabelValues(metrics.RejectSize).Inc()
+			if errors.Is(err, errMessageTooBig) { // gorilla sends the close for ErrReadLimit
+				u.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseMessageTooBig, "message too large"))
+			}
+			break
+		}
 		if err != nil {
-			log.Println("Error: Reading message", err)
+			u.Logger().Debug("Reading message failed", "err", err)
 			break // Connection dead
 		}
 
-		// Validate message size
-		if !config.ValidateMessageSize(len(msg)) {
-			log.Printf("Message too large from user %s: %d bytes", u.ID, len(msg))
-			continue // Drop oversized message
+		// Binary frames from a connection that didn't negotiate them: its
+		// encoding is wrong, the next frames can't be trusted either
+		if messageType == websocket.BinaryMessage && !binaryAllowed {
+			u.Logger().Warn("Binary frame from JSON connection, closing")
+			metrics.MessagesRejected.WithLabelValues(metrics.RejectProtocol).Inc()
+			u.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseUnsupportedData, "binary frames not negotiated"))
+			break
 		}
 
-		// Check rate limit based on message type
-		var data map[string]interface{}
-		if err := json.Unmarshal(msg, &data); err != nil {
-			log.Printf("Failed to parse message for rate limiting: %v", err)
+		// MessagePack connections send every message as a binary frame
+		if messageType == websocket.BinaryMessage && u.Msgpack() {
+			if err := msgRouter.RoutePacked(context.Background(), rm, u, msg); err != nil {
+				logMessageError(u, "Message rejected", err)
+				handlers.ReplyError(u, err)
+			}
 			continue
 		}
 
-		messageType, ok := data["type"].(string)
-		if !ok {
-			log.Printf("Message missing type field from user %s", u.ID)
+		if messageType == websocket.BinaryMessage {
+			if err := msgRouter.RouteBinary(context.Background(), rm, u, msg); err != nil {
+				logMessageError(u, "Binary frame rejected", err)
+				handlers.ReplyError(u, err)
+			}
 			continue
 		}
 
-		// Route to appropriate rate limiter
-		var rateLimitExceeded bool
-		if messageType == "cursor" {
-			rateLimitExceeded = !u.Session.CursorRateLimiter.Allow()
-		} else {
-			rateLimitExceeded = !u.Session.ObjectRateLimiter.Allow()
-		}
-
-		if rateLimitExceeded {
-			log.Printf("Rate limit exceeded for user %s (type: %s)", u.ID, messageType)
-			continue // Drop message
+		// Reject pathological nesting / token counts before decoding
+		if err := config.ScanJSON(msg); err != nil {
+			u.Logger().Warn("Message rejected", "err", err)
+			metrics.MessagesRejected.WithLabelValues(metrics.RejectSize).Inc()
+			handlers.ReplyError(u, err)
+			continue
 		}
 
-		if err := msgRouter.Route(rm, u, msg); err != nil {
-			log.Printf("Error handling message from user %s: %v", u.ID, err)
+		// Rate limits are applied per message type by the router
+		if err := msgRouter.Route(context.Background(), rm, u, msg); err != nil {
+			logMessageError(u, "Message rejected", err)
+			// Sender learns the message was rejected, its local state can't be trusted
+			handlers.ReplyError(u, err)
 			continue // Skip message
 		}
 	}
 }
+
+// logMessageError: rate limit and validation rejections at warn, other
+// per-message errors (usually a client bug) at debug
+func logMessageError(u *user.User, msg string, err error) {
+	var msgErr *handlers.MessageError
+	if errors.As(err, &msgErr) && (msgErr.Code == handlers.CodeRateLimited || msgErr.Code == handlers.CodeValidationFailed) {
+		u.Logger().Warn(msg, "code", msgErr.Code, "err", err)
+		return
+	}
+	u.Logger().Debug(msg, "err", err)
+}
@@ -2,65 +2,424 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"flag"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"main/internal/admin"
+	"main/internal/analytics"
+	"main/internal/config"
+	"main/internal/export"
+	"main/internal/frontend"
 	"main/internal/handlers"
+	"main/internal/logging"
+	"main/internal/metrics"
 	"main/internal/middleware"
+	"main/internal/object"
+	"main/internal/protocol"
 	"main/internal/room"
-	"main/internal/websocket"
+	"main/internal/stats"
+	"main/internal/tracing"
 	"main/internal/user"
-	"main/internal/object"
+	"main/internal/websocket"
 
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// defaultShutdownGrace: how long shutdown waits for connections to close
+const defaultShutdownGrace = 10 * time.Second
+
 func main() {
-	ctx, cancel := context.WithCancel(context.Background())
+	dumpProtocol := flag.String("dump-protocol", "", "write the protocol manifest (as served at /api/protocol) to this file and exit")
+	metricsDisabled := flag.Bool("metrics-disabled", false, "don't register or serve Prometheus metrics (also METRICS_DISABLED)")
+	flag.Parse()
+
+	// Cancelled on SIGINT/SIGTERM, stops the background workers and starts shutdown
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
 	godotenv.Load()
 
+	// JSON logs on stderr, LOG_LEVEL (debug, info, warn or error) sets how much
+	level, err := logging.ParseLevel(os.Getenv("LOG_LEVEL"))
+	logging.Setup(os.Stderr, level)
+	if err != nil {
+		fatal("Invalid LOG_LEVEL", "err", err)
+	}
+
+	// Tracing: disabled unless an OTLP endpoint and sample rate (0-1) are configured
+	sampleRate, _ := strconv.ParseFloat(os.Getenv("TRACE_SAMPLE_RATE"), 64)
+	shutdownTracing, err := tracing.Setup(ctx, os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), sampleRate)
+	if err != nil {
+		slog.Warn("Tracing disabled", "err", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// Limits and port, defaults overridden by WB_* variables (see config.Config)
+	settings, err := config.Load(os.LookupEnv)
+	if err != nil {
+		fatal("Invalid configuration", "err", err)
+	}
+
 	// Initialize rate limiting configuration
-	config := middleware.NewRateLimit(
-		10,     // maxRoomSize
-		1000,   // maxObjects (reduced from 3000)
-		250000, // maxMessageSize (250KB, increased from 100KB)
-		100,    // maxRooms (reduced from 1000)
-		5,      // maxObjectDepth
-		1000,   // maxObjectElements (unique keys)
-		30,     // messagesPerSecond
-		10,     // burstSize
+	limits := middleware.NewRateLimit(
+		settings.MaxRoomSize,
+		settings.MaxObjects,
+		settings.MaxMessageSize,
+		settings.MaxRooms,
+		settings.MaxObjectDepth,
+		settings.MaxObjectElements,
+		settings.MessagesPerSecond,
+		settings.BurstSize,
 	)
+	limits.MaxSpectators = settings.MaxSpectators
+	limits.Compression = settings.Compression
+	limits.CompressionLevel = settings.CompressionLevel
+	limits.RequireZIndex = settings.RequireZIndex
+	limits.SessionTokenTTL = settings.SessionTokenTTL
+	limits.StrictRooms = settings.StrictRooms
+	// Deployment notice and terms gate (TERMS_VERSION set: accept before drawing)
+	limits.Banner = os.Getenv("BANNER")
+	limits.TermsVersion = os.Getenv("TERMS_VERSION")
+	limits.TermsURL = os.Getenv("TERMS_URL")
+	// Soft object locks expire after LOCK_TIMEOUT (e.g. "45s"), default 30s
+	if timeout, err := time.ParseDuration(os.Getenv("LOCK_TIMEOUT")); err == nil && timeout > 0 {
+		limits.LockTimeout = timeout
+	}
+	// A clear or purge can be restored for CLEAR_RESTORE_WINDOW (e.g. "5m"), default 2m
+	if window, err := time.ParseDuration(os.Getenv("CLEAR_RESTORE_WINDOW")); err == nil && window > 0 {
+		limits.ClearRestoreWindow = window
+	}
+
+	// Protocol manifest for client codegen
+	fonts := fontPolicy()
+	manifest := protocol.Build(limits, fonts)
+	if *dumpProtocol != "" {
+		body, err := manifest.JSON()
+		if err == nil {
+			err = os.WriteFile(*dumpProtocol, append(body, '\n'), 0o644)
+		}
+		if err != nil {
+			fatal("Error writing protocol manifest", "err", err)
+		}
+		return
+	}
+
+	// Reverse proxies in TRUSTED_PROXIES (CIDRs, e.g. "10.0.0.0/8") are believed
+	// about the client IP (X-Forwarded-For), without it RemoteAddr is the client
+	proxies, err := middleware.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		fatal("Invalid TRUSTED_PROXIES", "err", err)
+	}
 
 	// Initialize managers
-	ipRateLimiter := middleware.NewIPRateLimit()
-	sessionMgr := user.NewSessionManager()
+	ipRateLimiter := middleware.NewIPRateLimit(settings.IPRate, settings.IPBurst, settings.IPMaxConnections, proxies)
+	sessionMgr := user.NewSessionManager(limits)
 	validator := object.NewValidator()
-	roomMgr := room.NewManager()
+	validator.SetLinkPolicy(object.LinkPolicy{
+		Allow: splitList(os.Getenv("LINK_ALLOWED_HOSTS")),
+		Deny:  splitList(os.Getenv("LINK_DENIED_HOSTS")),
+	})
+	validator.SetFontPolicy(fonts)
+	// Images are https URLs, IMAGE_DATA_URI_BYTES allows data: images up to that size
+	if value := os.Getenv("IMAGE_DATA_URI_BYTES"); value != "" {
+		budget, err := strconv.Atoi(value)
+		if err != nil || budget < 0 {
+			fatal("Invalid IMAGE_DATA_URI_BYTES", "value", value)
+		}
+		validator.SetImagePolicy(object.ImagePolicy{DataURIBytes: budget})
+	}
+	roomMgr := room.NewManager(roomStore())
+	// Empty rooms expire after ROOM_IDLE_TTL without joins or edits, and
+	// ROOM_MAX_AGE after they were created if set (see config.Config)
+	roomMgr.SetLifetime(room.Lifetime{Idle: settings.RoomIdleTTL, MaxAge: settings.RoomMaxAge})
 	broadcaster := room.NewBroadcaster()
-	synchronizer := room.NewSynchronizer()
-	msgRouter := handlers.NewMessageRouter(validator, config, sessionMgr, broadcaster)
+	synchronizer := room.NewSynchronizer(limits.MaxSyncSize)
+	// Serialized sync objects of unchanged rooms are reused by later joins,
+	// SYNC_CACHE_BYTES bounds their memory across all rooms (0 disables)
+	if value := os.Getenv("SYNC_CACHE_BYTES"); value != "" {
+		budget, err := strconv.Atoi(value)
+		if err != nil || budget < 0 {
+			fatal("Invalid SYNC_CACHE_BYTES", "value", value)
+		}
+		synchronizer.SetCacheBytes(budget)
+	}
+	msgRouter := handlers.NewMessageRouter(validator, limits, broadcaster, synchronizer, sessionMgr)
 	authenticator := transport.NewAuthenticator(sessionMgr)
 
+	// All routes are registered relative to BASE_PATH (e.g. "/whiteboard")
+	basePath := strings.TrimSuffix(os.Getenv("BASE_PATH"), "/")
+	mux := http.NewServeMux()
+
+	// Prometheus metrics at /metrics, unless METRICS_DISABLED (or -metrics-disabled) is set
+	metricsEnabled := !*metricsDisabled && !envBool("METRICS_DISABLED")
+	if metricsEnabled {
+		metrics.Register(prometheus.DefaultRegisterer)
+		mux.Handle("/metrics", promhttp.Handler())
+
+		prometheus.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "whiteboard_rooms_evicted_total",
+			Help: "Empty rooms without objects evicted to make space under MaxRooms.",
+		}, func() float64 {
+			return float64(roomMgr.EvictedCount())
+		}))
+		prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "whiteboard_session_tokens",
+			Help: "Session token mappings (one per live session when consistent).",
+		}, func() float64 {
+			return float64(sessionMgr.TokenCount())
+		}))
+		prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "whiteboard_sessions",
+			Help: "Live user sessions.",
+		}, func() float64 {
+			return float64(sessionMgr.SessionCount())
+		}))
+	}
+
+	// Session analytics, sinks selected by ANALYTICS_SINKS (e.g. "log,prometheus")
+	events := analytics.NewBus(1024)
+	sinks := analytics.ParseSinks(os.Getenv("ANALYTICS_SINKS"))
+	if sinks["log"] {
+		events.AddSink(analytics.LogSink{})
+	}
+	if sinks["prometheus"] && metricsEnabled {
+		events.AddSink(analytics.NewPrometheusSink(prometheus.DefaultRegisterer, events))
+	}
+	var workers sync.WaitGroup
+	runWorker(&workers, func() { events.Run(ctx) })
+
 	// Setup HTTP handlers
-	http.Handle("/", http.FileServer(http.Dir("./frontend")))
-	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		transport.HandleWebSocket(w, r, ipRateLimiter, config, sessionMgr, validator, roomMgr, msgRouter, synchronizer, authenticator)
-	})
+	mux.Handle("/", frontend.Handler(frontendConfig(basePath)))
+	mux.Handle("/api/stats", stats.PublicHandler(roomMgr, statsPrivacy()))
+	mux.Handle("GET /api/protocol", protocol.Handler(manifest))
+	exporter := export.NewExporter(roomMgr, sessionMgr, exportScrubber())
+	exporter.SetFontPolicy(fonts)
+	mux.Handle("GET /rooms/{code}/export", exporter.JSONHandler())
+	mux.Handle("GET /rooms/{code}/export.svg", exporter.SVGHandler())
+	mux.Handle("GET /api/rooms/{code}/thumbnail.png", exporter.ThumbnailHandler())
+	mux.Handle("POST /api/rooms/{target}/merge", msgRouter.EnableMerge(roomMgr).HTTPHandler(sessionMgr, os.Getenv("ADMIN_TOKEN")))
+	pipeline := transport.NewConnectionPipeline(ipRateLimiter, limits, sessionMgr, roomMgr, msgRouter, synchronizer, authenticator, broadcaster, events)
+	mux.Handle("/ws", pipeline)
+	mux.Handle("POST /rooms", roomMgr.CreateHandler(limits, ipRateLimiter))
+	mux.Handle("GET /healthz", stats.HealthHandler(pipeline.Accepting))
+	// Admin API (and exact stats) are only served when ADMIN_TOKEN is set
+	if adminToken := os.Getenv("ADMIN_TOKEN"); adminToken != "" {
+		mux.Handle("/admin/broadcast", admin.RequireToken(adminToken, admin.BroadcastHandler(roomMgr, broadcaster, validator)))
+		mux.Handle("GET /admin/rooms", admin.RequireToken(adminToken, admin.RoomsHandler(roomMgr)))
+		mux.Handle("GET /admin/rooms/{code}", admin.RequireToken(adminToken, admin.RoomHandler(roomMgr)))
+		mux.Handle("DELETE /admin/rooms/{code}", admin.RequireToken(adminToken, admin.CloseRoomHandler(roomMgr, broadcaster)))
+		mux.Handle("GET /rooms/{code}/audit", admin.RequireToken(adminToken, admin.AuditHandler(roomMgr)))
+		mux.Handle("POST /rooms/{code}/extend", admin.RequireToken(adminToken, admin.ExtendHandler(roomMgr)))
+		mux.Handle("GET /stats", admin.RequireToken(adminToken, stats.OperatorHandler(func() stats.Totals {
+			// One snapshot, so the room, connection and object counts agree
+			summaries := roomMgr.Summaries()
+			totals := stats.Totals{
+				Rooms:      len(summaries),
+				Sessions:   sessionMgr.SessionCount(),
+				IPLimiters: ipRateLimiter.Count(),
+				OpenByIP:   ipRateLimiter.OpenConnections(),
+			}
+			for _, summary := range summaries {
+				totals.Connections += summary.Connections
+				totals.Objects += summary.Objects
+			}
+			// Latency is read separately, it changes with every pong anyway
+			totals.Latency = []stats.ConnectionLatency{}
+			for _, rm := range roomMgr.Rooms() {
+				for _, p := range rm.Presence() {
+					totals.Latency = append(totals.Latency, stats.ConnectionLatency{Room: rm.Code, UserID: p.UserID, RTTMillis: p.RTTMillis})
+				}
+			}
+			return totals
+		})))
+	}
 
 	// Start periodic cleanups
-	go cleanupRooms(ctx, roomMgr)
-	go cleanupSessions(ctx, sessionMgr)
-	go cleanupIPLimiters(ctx, ipRateLimiter)
+	runWorker(&workers, func() { cleanupRooms(ctx, roomMgr) })
+	runWorker(&workers, func() { flushRooms(ctx, roomMgr) })
+	runWorker(&workers, func() { cleanupSessions(ctx, sessionMgr, events) })
+	runWorker(&workers, func() { cleanupIPLimiters(ctx, ipRateLimiter) })
+	runWorker(&workers, func() { broadcastPresence(ctx, roomMgr, broadcaster) })
 
 	// Run server
-	log.Println("Server Started on :8080")
-	err := http.ListenAndServe(":8080", nil)
+	grace := shutdownGrace()
+	server := &http.Server{Addr: settings.Addr(), Handler: withBasePath(basePath, mux)}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	slog.Info("Server started", "addr", settings.Addr(), "base_path", basePath+"/")
+
+	select {
+	case err := <-serveErr:
+		fatal("Error starting server", "err", err)
+	case <-ctx.Done():
+	}
+
+	// Shutdown: stop accepting, let plain HTTP requests finish, then drain the
+	// WebSocket connections (Shutdown doesn't wait for hijacked connections)
+	slog.Info("Shutting down", "grace_period", grace.String())
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), grace)
+	defer cancelShutdown()
+
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("HTTP shutdown failed", "err", err)
+	}
+	if err := pipeline.Drain(shutdownCtx); err != nil {
+		slog.Error("Connections still open after grace period, closed", "err", err)
+	}
+
+	// Boards changed since the last flush would be lost otherwise
+	roomMgr.Flush()
+	workers.Wait()
+	slog.Info("Server stopped")
+}
+
+// runWorker: runs task in the background, tracked by workers
+func runWorker(workers *sync.WaitGroup, task func()) {
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		task()
+	}()
+}
+
+// shutdownGrace: SHUTDOWN_GRACE_PERIOD (e.g. "30s"), how long shutdown waits for
+// clients to disconnect
+func shutdownGrace() time.Duration {
+	value := os.Getenv("SHUTDOWN_GRACE_PERIOD")
+	if value == "" {
+		return defaultShutdownGrace
+	}
+	grace, err := time.ParseDuration(value)
+	if err != nil || grace < 0 {
+		fatal("Invalid SHUTDOWN_GRACE_PERIOD", "value", value)
+	}
+	return grace
+}
+
+// withBasePath: serves mux under basePath only, unprefixed paths 404
+func withBasePath(basePath string, mux http.Handler) http.Handler {
+	if basePath == "" {
+		return mux
+	}
+
+	root := http.NewServeMux()
+	root.Handle(basePath+"/", http.StripPrefix(basePath, mux))
+	root.Handle(basePath, http.RedirectHandler(basePath+"/", http.StatusMovedPermanently))
+	return root
+}
+
+// frontendConfig: reads FRONTEND_MODE (off, dir, redirect), FRONTEND_DIR, FRONTEND_URL
+func frontendConfig(basePath string) frontend.Config {
+	cfg := frontend.Config{
+		BasePath:    basePath,
+		Mode:        frontend.Mode(os.Getenv("FRONTEND_MODE")),
+		Dir:         os.Getenv("FRONTEND_DIR"),
+		RedirectURL: os.Getenv("FRONTEND_URL"),
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = frontend.ModeDir
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = "./frontend"
+	}
+	if !cfg.Mode.Valid() {
+		fatal("Invalid FRONTEND_MODE (expected off, dir or redirect)", "value", cfg.Mode)
+	}
+	if cfg.Mode == frontend.ModeRedirect && cfg.RedirectURL == "" {
+		fatal("FRONTEND_URL is required when FRONTEND_MODE=redirect")
+	}
+	return cfg
+}
+
+// roomStore: file storage under DATA_DIR, rooms are memory only when unset
+func roomStore() room.Store {
+	dir := os.Getenv("DATA_DIR")
+	if dir == "" {
+		return nil
+	}
+
+	store, err := room.NewFileStore(dir)
+	if err != nil {
+		fatal("Invalid DATA_DIR", "err", err)
+	}
+	return store
+}
+
+// exportScrubber: export filters, EXPORT_BLOCKED_WORDS (comma separated) and
+// EXPORT_PII_PATTERNS (whitespace separated regexes, added to email and phone)
+func exportScrubber() *export.Scrubber {
+	scrubber, err := export.NewScrubber(splitList(os.Getenv("EXPORT_BLOCKED_WORDS")), strings.Fields(os.Getenv("EXPORT_PII_PATTERNS")))
 	if err != nil {
-		log.Fatalf("Error starting server: %v", err)
+		fatal("Invalid EXPORT_PII_PATTERNS", "err", err)
+	}
+	return scrubber
+}
+
+// envBool: true if the variable is set to a true value ("1", "true", ...)
+func envBool(name string) bool {
+	value, _ := strconv.ParseBool(os.Getenv(name))
+	return value
+}
+
+// splitList: comma separated env value, empty entries dropped
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
+}
+
+// fontPolicy: text fonts from FONT_FAMILIES (comma separated, the first is the
+// default, "*" allows any), FONT_STRICT (reject unknown families instead of
+// using the default) and FONT_SIZE_STEPS (e.g. "12,16,24,32")
+func fontPolicy() object.FontPolicy {
+	policy := object.DefaultFontPolicy()
+	if families := splitList(os.Getenv("FONT_FAMILIES")); len(families) == 1 && families[0] == "*" {
+		policy.Families = nil
+	} else if len(families) > 0 {
+		policy.Families = families
+	}
+	policy.Strict = envBool("FONT_STRICT")
+	for _, value := range splitList(os.Getenv("FONT_SIZE_STEPS")) {
+		step, err := strconv.ParseFloat(value, 64)
+		if err != nil || step < 1 || step > object.MaxFontSize {
+			fatal("Invalid FONT_SIZE_STEPS entry", "value", value, "max", object.MaxFontSize)
+		}
+		policy.SizeSteps = append(policy.SizeSteps, step)
+	}
+	return policy
+}
+
+// statsPrivacy: rounding for public stats, STATS_PRIVACY_FLOOR=0 reports exact counts
+func statsPrivacy() stats.Privacy {
+	privacy := stats.DefaultPrivacy
+	if value := os.Getenv("STATS_PRIVACY_FLOOR"); value != "" {
+		floor, err := strconv.Atoi(value)
+		if err != nil {
+			fatal("Invalid STATS_PRIVACY_FLOOR", "err", err)
+		}
+		privacy.Floor = floor
+		if floor == 0 {
+			privacy.Step = 1
+		}
+	}
+	return privacy
 }
 
 // cleanupRooms: periodically removes expired rooms
@@ -74,13 +433,28 @@ func cleanupRooms(ctx context.Context, roomMgr *room.Manager) {
 			return
 		case <-ticker.C:
 			roomMgr.Cleanup()
-			log.Println("Cleaned up expired rooms")
+			slog.Debug("Cleaned up expired rooms")
+		}
+	}
+}
+
+// flushRooms: periodically saves changed rooms (writes are batched, not per message)
+func flushRooms(ctx context.Context, roomMgr *room.Manager) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			roomMgr.Flush()
 		}
 	}
 }
 
 // cleanupSessions: periodically removes expired user sessions
-func cleanupSessions(ctx context.Context, sessionMgr *user.SessionManager) {
+func cleanupSessions(ctx context.Context, sessionMgr *user.SessionManager, events *analytics.Bus) {
 	ticker := time.NewTicker(10 * time.Minute)
 	defer ticker.Stop()
 
@@ -89,8 +463,34 @@ func cleanupSessions(ctx context.Context, sessionMgr *user.SessionManager) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			sessionMgr.Cleanup()
-			log.Println("Cleaned up expired sessions")
+			for _, session := range sessionMgr.Cleanup() {
+				events.Emit(analytics.Event{
+					Type:     analytics.SessionExpired,
+					UserHash: analytics.AnonymizeID(session.UserID),
+					Duration: session.LastSeen.Sub(session.CreatedAt),
+				})
+			}
+			slog.Debug("Cleaned up expired sessions")
+		}
+	}
+}
+
+// broadcastPresence: periodically sends rooms their users' latency (rooms with
+// a single user have no one to show it to)
+func broadcastPresence(ctx context.Context, roomMgr *room.Manager, broadcaster *room.Broadcaster) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, rm := range roomMgr.Rooms() {
+				if rm.ConnectionCount() > 1 {
+					broadcaster.PresenceUpdate(ctx, rm)
+				}
+			}
 		}
 	}
 }
@@ -106,7 +506,13 @@ func cleanupIPLimiters(ctx context.Context, ipRateLimiter *middleware.IPRateLimi
 			return
 		case <-ticker.C:
 			ipRateLimiter.Cleanup()
-			log.Println("IP rate limiters cleared")
+			slog.Debug("IP rate limiters cleared")
 		}
 	}
 }
+
+// fatal: logs msg at error level and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}